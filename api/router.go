@@ -9,6 +9,7 @@ import (
 	"github.com/qinguoyi/osproxy/docs"
 	gs "github.com/swaggo/gin-swagger"
 	"github.com/swaggo/gin-swagger/swaggerFiles"
+	"go.uber.org/zap"
 )
 
 func NewRouter(
@@ -19,6 +20,10 @@ func NewRouter(
 		gin.SetMode(gin.ReleaseMode)
 	}
 	router := gin.New()
+	// 只信任配置的代理转发的客户端IP
+	if err := router.SetTrustedProxies(conf.App.TrustedProxies); err != nil {
+		lgLogger.Logger.Error("设置可信代理失败", zap.Any("err", err.Error()))
+	}
 
 	// middleware
 	corsM := middleware.NewCors()
@@ -46,29 +51,71 @@ func setApiGroupRoutes(
 	router *gin.Engine,
 ) *gin.RouterGroup {
 	group := router.Group("/api/storage/v0")
+	// 配额、回调及统计按应用区分的接口需要租户鉴权
+	tenantAuth := middleware.NewTenantAuth().Handler()
+	adminAuth := middleware.NewAdminAuth().Handler()
 	{
 		//health
 		group.GET("/ping", v0.PingHandler)
 		group.GET("/health", v0.HealthCheckHandler)
 
 		// resume
-		group.POST("/resume", v0.ResumeHandler)
+		group.POST("/resume", tenantAuth, v0.ResumeHandler)
 		group.GET("/checkpoint", v0.CheckPointHandler)
+		group.GET("/status", v0.UploadStatusHandler)
 
 		// link
-		group.POST("/link/upload", v0.UploadLinkHandler)
-		group.POST("/link/download", v0.DownloadLinkHandler)
+		group.POST("/link/upload", tenantAuth, v0.UploadLinkHandler)
+		group.POST("/link/download", tenantAuth, v0.DownloadLinkHandler)
+		group.POST("/link/policy", tenantAuth, v0.PolicyLinkHandler)
+		group.POST("/link/revoke", adminAuth, v0.RevokeLinkHandler)
+		group.GET("/link/active", adminAuth, v0.ActiveLinkHandler)
+		group.POST("/link/bundle", tenantAuth, v0.BundleLinkHandler)
 
 		// proxy
 		group.GET("/proxy", v0.IsOnCurrentServerHandler)
 
 		// upload
 		group.PUT("/upload", v0.UploadSingleHandler)
+		group.HEAD("/upload", v0.UploadOffsetHandler)
 		group.PUT("/upload/multi", v0.UploadMultiPartHandler)
 		group.PUT("/upload/merge", v0.UploadMergeHandler)
+		group.POST("/upload/form", v0.UploadFormHandler)
 
 		//download
 		group.GET("/download", v0.DownloadHandler)
+		group.HEAD("/download", v0.DownloadHandler)
+		group.GET("/download/bundle", v0.BundleDownloadHandler)
+		group.HEAD("/download/bundle", v0.BundleDownloadHandler)
+
+		// batch
+		group.POST("/batch", tenantAuth, v0.BatchCreateHandler)
+		group.POST("/batch/link", tenantAuth, v0.BatchLinkHandler)
+		group.GET("/batch/files", tenantAuth, v0.BatchFilesHandler)
+		group.GET("/batch/status", tenantAuth, v0.BatchStatusHandler)
+		group.POST("/batch/commit", tenantAuth, v0.BatchCommitHandler)
+
+		// fetch
+		group.POST("/fetch", tenantAuth, v0.FetchHandler)
+		group.GET("/fetch/status", tenantAuth, v0.FetchStatusHandler)
+
+		// archive
+		group.GET("/archive/children", v0.ArchiveChildrenHandler)
+
+		// gc
+		group.GET("/gc/report", v0.GcReportHandler)
+
+		// quota
+		group.GET("/quota", tenantAuth, v0.QuotaHandler)
+
+		// meta
+		group.PUT("/meta", tenantAuth, v0.UserMetaHandler)
+		group.GET("/files", tenantAuth, v0.FileListHandler)
+		group.DELETE("/file", tenantAuth, v0.DeleteFileHandler)
+
+		// stats
+		group.GET("/stats/file", tenantAuth, v0.FileStatsHandler)
+		group.GET("/stats/tenant", tenantAuth, v0.TenantStatsHandler)
 
 	}
 	return group
@@ -0,0 +1,60 @@
+package v0
+
+import (
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/qinguoyi/osproxy/app/models"
+	"github.com/qinguoyi/osproxy/app/pkg/repo"
+	"github.com/qinguoyi/osproxy/app/pkg/web"
+	"github.com/qinguoyi/osproxy/bootstrap/plugins"
+	"net/url"
+	"strconv"
+)
+
+// ArchiveChildrenHandler    压缩包子文件列表
+//
+//	@Summary      压缩包子文件列表
+//	@Description  查询压缩包展开后的子文件
+//	@Tags         压缩包
+//	@Accept       application/json
+//	@Param        uid  query  string  true  "压缩包uid"
+//	@Produce      application/json
+//	@Success      200  {object}  web.Response{data=[]models.ArchiveChildResp}
+//	@Router       /api/storage/v0/archive/children [get]
+func ArchiveChildrenHandler(c *gin.Context) {
+	uidStr := c.Query("uid")
+	uid, err := strconv.ParseInt(uidStr, 10, 64)
+	if err != nil {
+		web.ParamsError(c, "uid参数有误")
+		return
+	}
+
+	lgDB := new(plugins.LangGoDB).Use("default").NewDB()
+	if _, err := repo.NewMetaDataInfoRepo().GetByUid(lgDB, uid); err != nil {
+		web.NotFoundResource(c, "uid不存在")
+		return
+	}
+	children, err := repo.NewMetaDataInfoRepo().GetByCompressUid(lgDB, uid)
+	if err != nil {
+		lgLogger.WithContext(c).Error("查询压缩包子文件失败")
+		web.InternalError(c, "内部异常")
+		return
+	}
+	resp := make([]models.ArchiveChildResp, 0, len(children))
+	for _, child := range children {
+		name, err := url.PathUnescape(child.Name)
+		if err != nil {
+			name = child.Name
+		}
+		resp = append(resp, models.ArchiveChildResp{
+			Uid:         fmt.Sprintf("%d", child.UID),
+			Name:        name,
+			Path:        child.RelPath,
+			Md5:         child.Md5,
+			Size:        child.StorageSize,
+			ContentType: child.ContentType,
+			Status:      repo.MetaStatusName(child.Status),
+		})
+	}
+	web.Success(c, resp)
+}
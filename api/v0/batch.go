@@ -0,0 +1,405 @@
+package v0
+
+import (
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/qinguoyi/osproxy/app/models"
+	"github.com/qinguoyi/osproxy/app/pkg/base"
+	"github.com/qinguoyi/osproxy/app/pkg/repo"
+	"github.com/qinguoyi/osproxy/app/pkg/utils"
+	"github.com/qinguoyi/osproxy/app/pkg/web"
+	"github.com/qinguoyi/osproxy/bootstrap/plugins"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"os"
+	"path"
+	"strconv"
+	"time"
+)
+
+/*
+批量(目录)上传，批次提交后批次内的文件才可见
+*/
+
+var errBatchCommitted = errors.New("批次已提交")
+
+// BatchCreateHandler    创建批量上传
+//
+//	@Summary      创建批量上传
+//	@Description  创建批量上传会话，之后分页生成批次内文件的上传链接
+//	@Tags         批量上传
+//	@Accept       application/json
+//	@Param        RequestBody  body  models.GenBatch  true  "创建批量上传请求体"
+//	@Produce      application/json
+//	@Success      200  {object}  web.Response{data=models.GenBatchResp}
+//	@Router       /api/storage/v0/batch [post]
+func BatchCreateHandler(c *gin.Context) {
+	var genBatchReq models.GenBatch
+	if err := c.ShouldBindJSON(&genBatchReq); err != nil {
+		web.ParamsError(c, fmt.Sprintf("参数解析有误，详情：%s", err))
+		return
+	}
+	if genBatchReq.Total < 0 {
+		web.ParamsError(c, "total参数有误")
+		return
+	}
+	if err := base.CheckCallback(genBatchReq.Callback); err != nil {
+		web.ParamsError(c, err.Error())
+		return
+	}
+	batchUid, err := base.NewSnowFlake().NextId()
+	if err != nil {
+		lgLogger.WithContext(c).Error("雪花算法生成ID失败，详情：", zap.Any("err", err.Error()))
+		web.InternalError(c, "内部异常")
+		return
+	}
+	now := time.Now()
+	lgDB := new(plugins.LangGoDB).Use("default").NewDB()
+	if err := repo.NewUploadBatchRepo().Create(lgDB, &models.UploadBatch{
+		BatchUid:  batchUid,
+		Name:      genBatchReq.Name,
+		Tenant:    c.GetString(utils.ContextTenant),
+		Callback:  genBatchReq.Callback,
+		Expire:    genBatchReq.Expire,
+		Total:     genBatchReq.Total,
+		Status:    utils.BatchStatusOpen,
+		CreatedAt: &now,
+		UpdatedAt: &now,
+	}); err != nil {
+		lgLogger.WithContext(c).Error("创建批量上传落数据库失败", zap.Any("err", err.Error()))
+		web.InternalError(c, "内部异常")
+		return
+	}
+	web.Success(c, models.GenBatchResp{BatchUid: fmt.Sprintf("%d", batchUid)})
+}
+
+// BatchLinkHandler    批量上传生成链接
+//
+//	@Summary      批量上传生成链接
+//	@Description  分页生成批次内文件的上传链接，path为目录内的相对路径，批次内不能重复
+//	@Tags         批量上传
+//	@Accept       application/json
+//	@Param        RequestBody  body  models.GenBatchLink  true  "批量上传生成链接请求体"
+//	@Produce      application/json
+//	@Success      200  {object}  web.Response{data=[]models.GenUploadResp}
+//	@Router       /api/storage/v0/batch/link [post]
+func BatchLinkHandler(c *gin.Context) {
+	var genBatchLinkReq models.GenBatchLink
+	if err := c.ShouldBindJSON(&genBatchLinkReq); err != nil {
+		web.ParamsError(c, fmt.Sprintf("参数解析有误，详情：%s", err))
+		return
+	}
+	batchUid, err := strconv.ParseInt(genBatchLinkReq.BatchUid, 10, 64)
+	if err != nil {
+		web.ParamsError(c, "batchUid参数有误")
+		return
+	}
+	if len(genBatchLinkReq.Files) == 0 || len(genBatchLinkReq.Files) > utils.BatchLinkLimit {
+		web.ParamsError(c, fmt.Sprintf("单次生成链接数量需在1-%d之间", utils.BatchLinkLimit))
+		return
+	}
+
+	lgDB := new(plugins.LangGoDB).Use("default").NewDB()
+	batch, err := repo.NewUploadBatchRepo().GetByBatchUid(lgDB, batchUid)
+	if err != nil {
+		web.NotFoundResource(c, "批次不存在")
+		return
+	}
+	if batch.Status != utils.BatchStatusOpen {
+		web.ParamsError(c, errBatchCommitted.Error())
+		return
+	}
+
+	// 规范化相对路径并去重
+	var fileList []models.UploadFile
+	var pathList []string
+	pathSet := map[string]bool{}
+	for _, file := range genBatchLinkReq.Files {
+		relPath := base.CleanArchivePath(file.Path)
+		if relPath == "" {
+			web.ParamsError(c, fmt.Sprintf("文件路径[%s]有误", file.Path))
+			return
+		}
+		if pathSet[relPath] {
+			continue
+		}
+		pathSet[relPath] = true
+		file.Path = relPath
+		fileList = append(fileList, file)
+		pathList = append(pathList, relPath)
+	}
+	if errorInfo := checkUploadFiles(fileList, genBatchLinkReq.PartSize); errorInfo != "" {
+		web.ParamsError(c, errorInfo)
+		return
+	}
+	if genBatchLinkReq.Rate < 0 {
+		web.ParamsError(c, "rate参数有误")
+		return
+	}
+	if !checkQuota(c, lgDB, batch.Tenant, sumUploadSize(fileList), int64(len(fileList))) {
+		return
+	}
+
+	resp, resourceInfo, err := genUploadLinks(fileList, genBatchLinkReq.PartSize, batch.Expire, genBatchLinkReq.Rate,
+		batch.Tenant, batch.Callback)
+	if err != nil {
+		lgLogger.WithContext(c).Error("批量上传生成链接，生成的url和输入数量不一致")
+		web.InternalError(c, "内部异常")
+		return
+	}
+	uidMapPath := map[string]string{}
+	for _, i := range resp {
+		uidMapPath[i.Uid] = i.Path
+	}
+	for i := range resourceInfo {
+		resourceInfo[i].BatchUid = batchUid
+		resourceInfo[i].RelPath = uidMapPath[strconv.FormatInt(resourceInfo[i].UID, 10)]
+	}
+
+	// 加锁后校验批次状态及路径，避免和提交并发
+	var errorInfo, quotaInfo string
+	if err := lgDB.Transaction(func(tx *gorm.DB) error {
+		batch, err := repo.NewUploadBatchRepo().LockByBatchUid(tx, batchUid)
+		if err != nil {
+			return err
+		}
+		if batch.Status != utils.BatchStatusOpen {
+			errorInfo = errBatchCommitted.Error()
+			return errBatchCommitted
+		}
+		existList, err := repo.NewMetaDataInfoRepo().GetByBatchPath(tx, batchUid, pathList)
+		if err != nil {
+			return err
+		}
+		if len(existList) != 0 {
+			errorInfo = fmt.Sprintf("文件路径[%s]在批次内已存在", existList[0].RelPath)
+			return errors.New(errorInfo)
+		}
+		if batch.Total > 0 {
+			count, err := repo.NewMetaDataInfoRepo().CountByBatchUid(tx, batchUid)
+			if err != nil {
+				return err
+			}
+			if count+int64(len(resourceInfo)) > int64(batch.Total) {
+				errorInfo = fmt.Sprintf("批次文件数量超过声明的%d个", batch.Total)
+				return errors.New(errorInfo)
+			}
+		}
+		if quotaInfo, err = base.ReserveQuota(tx, batch.Tenant, resourceInfo); err != nil {
+			return err
+		}
+		if quotaInfo != "" {
+			return errors.New(quotaInfo)
+		}
+		if err := repo.NewMetaDataInfoRepo().BatchCreate(tx, &resourceInfo); err != nil {
+			return err
+		}
+		metadata, tags := userMetaOfLinks(resp, fileList)
+		return repo.NewUserMetaRepo().BatchCreate(tx, metadata, tags)
+	}); err != nil {
+		for _, i := range resp {
+			_ = os.RemoveAll(path.Join(utils.LocalStore, i.Uid))
+		}
+		if errorInfo != "" {
+			web.ParamsError(c, errorInfo)
+			return
+		}
+		if quotaInfo != "" {
+			web.Forbidden(c, quotaInfo)
+			return
+		}
+		lgLogger.WithContext(c).Error("批量上传生成链接，落数据库失败", zap.Any("err", err.Error()))
+		web.InternalError(c, "内部异常")
+		return
+	}
+	web.Success(c, resp)
+}
+
+// BatchFilesHandler    批量上传文件列表
+//
+//	@Summary      批量上传文件列表
+//	@Description  分页查询批次内的文件及状态
+//	@Tags         批量上传
+//	@Accept       application/json
+//	@Param        batchUid  query  string  true   "批次ID"
+//	@Param        page      query  int     false  "页码，从1开始"
+//	@Param        pageSize  query  int     false  "每页数量，最大1000"
+//	@Produce      application/json
+//	@Success      200  {object}  web.Response{data=models.BatchFilesResp}
+//	@Router       /api/storage/v0/batch/files [get]
+func BatchFilesHandler(c *gin.Context) {
+	batchUid, err := strconv.ParseInt(c.Query("batchUid"), 10, 64)
+	if err != nil {
+		web.ParamsError(c, "batchUid参数有误")
+		return
+	}
+	page, err := strconv.Atoi(c.DefaultQuery("page", "1"))
+	if err != nil || page < 1 {
+		web.ParamsError(c, "page参数有误")
+		return
+	}
+	pageSize, err := strconv.Atoi(c.DefaultQuery("pageSize", "100"))
+	if err != nil || pageSize < 1 || pageSize > utils.BatchLinkLimit {
+		web.ParamsError(c, "pageSize参数有误")
+		return
+	}
+
+	lgDB := new(plugins.LangGoDB).Use("default").NewDB()
+	if _, err := repo.NewUploadBatchRepo().GetByBatchUid(lgDB, batchUid); err != nil {
+		web.NotFoundResource(c, "批次不存在")
+		return
+	}
+	metaList, total, err := repo.NewMetaDataInfoRepo().GetByBatchUid(lgDB, batchUid, (page-1)*pageSize, pageSize)
+	if err != nil {
+		lgLogger.WithContext(c).Error("查询批次文件失败")
+		web.InternalError(c, "内部异常")
+		return
+	}
+	resp := models.BatchFilesResp{Total: total, Data: []models.BatchFileResp{}}
+	for _, meta := range metaList {
+		resp.Data = append(resp.Data, models.BatchFileResp{
+			Uid:   fmt.Sprintf("%d", meta.UID),
+			Path:  meta.RelPath,
+			State: repo.MetaStatusName(meta.Status),
+			Md5:   meta.Md5,
+			Size:  meta.StorageSize,
+		})
+	}
+	web.Success(c, resp)
+}
+
+// BatchStatusHandler    批量上传进度
+//
+//	@Summary      批量上传进度
+//	@Description  查询批次内文件的整体进度
+//	@Tags         批量上传
+//	@Accept       application/json
+//	@Param        batchUid  query  string  true  "批次ID"
+//	@Produce      application/json
+//	@Success      200  {object}  web.Response{data=models.BatchStatusResp}
+//	@Router       /api/storage/v0/batch/status [get]
+func BatchStatusHandler(c *gin.Context) {
+	batchUid, err := strconv.ParseInt(c.Query("batchUid"), 10, 64)
+	if err != nil {
+		web.ParamsError(c, "batchUid参数有误")
+		return
+	}
+	lgDB := new(plugins.LangGoDB).Use("default").NewDB()
+	batch, err := repo.NewUploadBatchRepo().GetByBatchUid(lgDB, batchUid)
+	if err != nil {
+		web.NotFoundResource(c, "批次不存在")
+		return
+	}
+	resp, err := getBatchStatus(lgDB, batch)
+	if err != nil {
+		lgLogger.WithContext(c).Error("查询批次进度失败")
+		web.InternalError(c, "内部异常")
+		return
+	}
+	web.Success(c, resp)
+}
+
+// BatchCommitHandler    提交批量上传
+//
+//	@Summary      提交批量上传
+//	@Description  批次内文件全部上传完成且压缩包展开完成后提交，提交后批次内的文件才可下载
+//	@Tags         批量上传
+//	@Accept       application/json
+//	@Param        batchUid  query  string  true  "批次ID"
+//	@Produce      application/json
+//	@Success      200  {object}  web.Response{data=models.BatchStatusResp}
+//	@Router       /api/storage/v0/batch/commit [post]
+func BatchCommitHandler(c *gin.Context) {
+	batchUid, err := strconv.ParseInt(c.Query("batchUid"), 10, 64)
+	if err != nil {
+		web.ParamsError(c, "batchUid参数有误")
+		return
+	}
+	lgDB := new(plugins.LangGoDB).Use("default").NewDB()
+	if _, err := repo.NewUploadBatchRepo().GetByBatchUid(lgDB, batchUid); err != nil {
+		web.NotFoundResource(c, "批次不存在")
+		return
+	}
+
+	var errorInfo string
+	var resp *models.BatchStatusResp
+	if err := lgDB.Transaction(func(tx *gorm.DB) error {
+		batch, err := repo.NewUploadBatchRepo().LockByBatchUid(tx, batchUid)
+		if err != nil {
+			return err
+		}
+		resp, err = getBatchStatus(tx, batch)
+		if err != nil {
+			return err
+		}
+		// 重复提交直接返回
+		if batch.Status == utils.BatchStatusCommitted {
+			return nil
+		}
+		switch {
+		case resp.Files == 0:
+			errorInfo = "批次内没有文件"
+		case batch.Total > 0 && resp.Files != int64(batch.Total):
+			errorInfo = fmt.Sprintf("批次文件数量%d与声明的%d个不一致", resp.Files, batch.Total)
+		case resp.Available != resp.Files:
+			errorInfo = fmt.Sprintf("批次内还有%d个文件未上传完成", resp.Files-resp.Available)
+		}
+		if errorInfo != "" {
+			return errors.New(errorInfo)
+		}
+		// 压缩包展开的子文件继承批次，展开完成后才能提交，避免提交后批次内文件继续增加
+		expanding, err := repo.NewTaskRepo().CountUnfinishedByBatch(tx, batchUid, utils.TaskArchive)
+		if err != nil {
+			return err
+		}
+		if expanding > 0 {
+			errorInfo = fmt.Sprintf("批次内还有%d个压缩包正在展开，请稍后提交", expanding)
+			return errors.New(errorInfo)
+		}
+		if repo.NewUploadBatchRepo().Commit(tx, batchUid) != 1 {
+			return errors.New("提交批次失败")
+		}
+		resp.Committed = true
+		return base.NotifyBatchEvent(tx, batch, resp.Files, resp.Size)
+	}); err != nil {
+		if errorInfo != "" {
+			web.ParamsError(c, errorInfo)
+			return
+		}
+		lgLogger.WithContext(c).Error("提交批次失败", zap.Any("err", err.Error()))
+		web.InternalError(c, "内部异常")
+		return
+	}
+	web.Success(c, resp)
+}
+
+// getBatchStatus 汇总批次进度
+func getBatchStatus(lgDB *gorm.DB, batch *models.UploadBatch) (*models.BatchStatusResp, error) {
+	statList, err := repo.NewMetaDataInfoRepo().GetBatchStat(lgDB, batch.BatchUid)
+	if err != nil {
+		return nil, err
+	}
+	resp := &models.BatchStatusResp{
+		BatchUid:  fmt.Sprintf("%d", batch.BatchUid),
+		Name:      batch.Name,
+		Committed: batch.Status == utils.BatchStatusCommitted,
+		Total:     batch.Total,
+		States:    map[string]int64{},
+	}
+	for _, stat := range statList {
+		resp.Files += stat.Count
+		resp.Size += stat.Size
+		resp.States[repo.MetaStatusName(stat.Status)] += stat.Count
+		if stat.Status == utils.MetaStatusAvailable {
+			resp.Available += stat.Count
+			resp.Received += stat.Size
+		}
+	}
+	partSize, err := repo.NewMultiPartInfoRepo().SumSizeByBatch(lgDB, batch.BatchUid)
+	if err != nil {
+		return nil, err
+	}
+	resp.Received += partSize
+	return resp, nil
+}
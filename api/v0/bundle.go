@@ -0,0 +1,334 @@
+package v0
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/qinguoyi/osproxy/app/models"
+	"github.com/qinguoyi/osproxy/app/pkg/analytics"
+	"github.com/qinguoyi/osproxy/app/pkg/base"
+	"github.com/qinguoyi/osproxy/app/pkg/repo"
+	"github.com/qinguoyi/osproxy/app/pkg/thirdparty"
+	"github.com/qinguoyi/osproxy/app/pkg/throttle"
+	"github.com/qinguoyi/osproxy/app/pkg/utils"
+	"github.com/qinguoyi/osproxy/app/pkg/web"
+	"github.com/qinguoyi/osproxy/bootstrap"
+	"github.com/qinguoyi/osproxy/bootstrap/plugins"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+/*
+多文件打包下载，下载时从存储流式读取并写入zip，不落盘
+*/
+
+// BundleLinkHandler    获取打包下载链接
+//
+//	@Summary      获取打包下载链接
+//	@Description  多个文件打包为zip下载，已压缩的文件类型使用存储模式，全部为存储模式时可预先得知压缩包大小
+//	@Tags         链接
+//	@Accept       application/json
+//	@Param        X-App-Key    header  string            false  "应用标识"
+//	@Param        X-App-Token  header  string            false  "应用令牌"
+//	@Param        RequestBody  body    models.GenBundle  true   "打包下载链接请求体"
+//	@Produce      application/json
+//	@Success      200  {object}  web.Response{data=models.GenBundleResp}
+//	@Router       /api/storage/v0/link/bundle [post]
+func BundleLinkHandler(c *gin.Context) {
+	var genBundleReq models.GenBundle
+	if err := c.ShouldBindJSON(&genBundleReq); err != nil {
+		web.ParamsError(c, fmt.Sprintf("参数解析有误，详情：%s", err))
+		return
+	}
+	if len(genBundleReq.Files) == 0 || len(genBundleReq.Files) > utils.BundleFileLimit {
+		web.ParamsError(c, fmt.Sprintf("打包文件数量应为1-%d个", utils.BundleFileLimit))
+		return
+	}
+	if genBundleReq.Expire <= 0 {
+		web.ParamsError(c, "expire参数有误")
+		return
+	}
+	name := path.Base(base.CleanZipName(genBundleReq.Name, "bundle.zip"))
+	if !strings.HasSuffix(strings.ToLower(name), ".zip") {
+		name += ".zip"
+	}
+	var uidList []int64
+	for _, file := range genBundleReq.Files {
+		uid, err := strconv.ParseInt(file.Uid, 10, 64)
+		if err != nil {
+			web.ParamsError(c, "uid参数有误")
+			return
+		}
+		uidList = append(uidList, uid)
+	}
+
+	lgDB := new(plugins.LangGoDB).Use("default").NewDB()
+	uidMapMeta, err := getBundleMetas(lgDB, uidList)
+	if err != nil {
+		lgLogger.WithContext(c).Error("获取打包下载链接，查询元数据信息失败", zap.Any("err", err.Error()))
+		web.InternalError(c, "内部异常")
+		return
+	}
+	tenant := c.GetString(utils.ContextTenant)
+	var names []string
+	for i, uid := range uidList {
+		meta, ok := uidMapMeta[uid]
+		if !ok {
+			web.NotFoundResource(c, fmt.Sprintf("文件[%d]不存在或不可下载", uid))
+			return
+		}
+		if meta.Tenant != tenant {
+			web.Forbidden(c, fmt.Sprintf("无权下载文件[%d]", uid))
+			return
+		}
+		srcName, err := url.PathUnescape(meta.Name)
+		if err != nil {
+			srcName = meta.Name
+		}
+		names = append(names, base.CleanZipName(genBundleReq.Files[i].Path, path.Base(srcName)))
+	}
+	names = base.DedupZipNames(names)
+
+	var entries []models.BundleEntry
+	var zipEntries []base.ZipEntry
+	for i, uid := range uidList {
+		store := genBundleReq.Store || base.IsCompressedFile(names[i])
+		entries = append(entries, models.BundleEntry{Uid: uid, Name: names[i], Store: store})
+		zipEntries = append(zipEntries, base.ZipEntry{Name: names[i], Size: uidMapMeta[uid].StorageSize, Store: store})
+	}
+	files, err := json.Marshal(entries)
+	if err != nil {
+		lgLogger.WithContext(c).Error("获取打包下载链接，序列化文件列表失败")
+		web.InternalError(c, "内部异常")
+		return
+	}
+	bundleId, err := base.NewSnowFlake().NextId()
+	if err != nil {
+		lgLogger.WithContext(c).Error("获取打包下载链接，生成打包ID失败")
+		web.InternalError(c, "内部异常")
+		return
+	}
+	now := time.Now()
+	expireAt := now.Add(time.Duration(genBundleReq.Expire) * time.Second)
+	bundle := models.DownloadBundle{
+		BundleId:  bundleId,
+		Tenant:    tenant,
+		Name:      name,
+		Files:     string(files),
+		Size:      base.ZipStreamSize(zipEntries),
+		ExpireAt:  &expireAt,
+		CreatedAt: &now,
+	}
+	if err := repo.NewDownloadBundleRepo().Create(lgDB, &bundle); err != nil {
+		lgLogger.WithContext(c).Error("获取打包下载链接，保存打包信息失败", zap.Any("err", err.Error()))
+		web.InternalError(c, "内部异常")
+		return
+	}
+
+	bundleIdStr := strconv.FormatInt(bundleId, 10)
+	expireStr := fmt.Sprintf("%d", genBundleReq.Expire)
+	date := now.Format("2006-01-02T15:04:05Z")
+	signature := base.SignBundle(date, expireStr, bundleIdStr)
+	web.Success(c, models.GenBundleResp{
+		BundleId: bundleIdStr,
+		Name:     name,
+		Url: fmt.Sprintf("/api/storage/v0/download/bundle?bid=%s&date=%s&expire=%s&signature=%s",
+			bundleIdStr, date, expireStr, signature),
+		Count: len(entries),
+		Size:  bundle.Size,
+	})
+}
+
+// BundleDownloadHandler    打包下载
+//
+//	@Summary      打包下载
+//	@Description  流式返回zip压缩包，全部为存储模式时返回Content-Length，不支持Range
+//	@Tags         下载
+//	@Accept       application/json
+//	@Param        bid        query  string  true  "打包ID"
+//	@Param        date       query  string  true  "链接生成时间"
+//	@Param        expire     query  string  true  "过期时间"
+//	@Param        signature  query  string  true  "签名"
+//	@Produce      application/zip
+//	@Success      200  {object}  web.Response
+//	@Failure      404  {object}  web.Response
+//	@Router       /api/storage/v0/download/bundle [get]
+//	@Router       /api/storage/v0/download/bundle [head]
+func BundleDownloadHandler(c *gin.Context) {
+	bundleIdStr := c.Query("bid")
+	date := c.Query("date")
+	expireStr := c.Query("expire")
+	signature := c.Query("signature")
+	bundleId, err, errorInfo := base.CheckValid(bundleIdStr, date, expireStr)
+	if err != nil {
+		web.ParamsError(c, errorInfo)
+		return
+	}
+	if !base.CheckBundleSignature(date, expireStr, bundleIdStr, signature) {
+		web.ParamsError(c, "签名校验失败")
+		return
+	}
+
+	lgDB := new(plugins.LangGoDB).Use("default").NewDB()
+	bundle, err := repo.NewDownloadBundleRepo().GetByBundleId(lgDB, bundleId)
+	if err != nil {
+		web.NotFoundResource(c, "打包链接不存在")
+		return
+	}
+	var entries []models.BundleEntry
+	if err := json.Unmarshal([]byte(bundle.Files), &entries); err != nil {
+		lgLogger.WithContext(c).Error("打包下载，解析文件列表失败")
+		web.InternalError(c, "内部异常")
+		return
+	}
+	var uidList []int64
+	for _, entry := range entries {
+		uidList = append(uidList, entry.Uid)
+	}
+	uidMapMeta, err := getBundleMetas(lgDB, uidList)
+	if err != nil {
+		lgLogger.WithContext(c).Error("打包下载，查询元数据信息失败", zap.Any("err", err.Error()))
+		web.InternalError(c, "内部异常")
+		return
+	}
+	var metaList []*models.MetaDataInfo
+	var zipEntries []base.ZipEntry
+	for _, entry := range entries {
+		meta, ok := uidMapMeta[entry.Uid]
+		if !ok {
+			web.NotFoundResource(c, fmt.Sprintf("文件[%d]已不可下载", entry.Uid))
+			return
+		}
+		zipEntry := base.ZipEntry{Name: entry.Name, Size: meta.StorageSize, Store: entry.Store}
+		if meta.UpdatedAt != nil {
+			zipEntry.Modified = *meta.UpdatedAt
+		}
+		metaList = append(metaList, meta)
+		zipEntries = append(zipEntries, zipEntry)
+	}
+
+	c.Writer.Header().Set("Content-Type", "application/zip")
+	c.Writer.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%s", bundle.Name))
+	if size := base.ZipStreamSize(zipEntries); size >= 0 {
+		c.Writer.Header().Set("Content-Length", fmt.Sprintf("%d", size))
+	}
+	c.Status(http.StatusOK)
+	if c.Request.Method == http.MethodHead {
+		c.Writer.WriteHeaderNow()
+		return
+	}
+	limiters := base.TransferLimiters(bundle.Tenant, 0, c.ClientIP())
+	w := throttle.NewWriter(c.Request.Context(), c.Writer, limiters...)
+	err = base.WriteZipStream(w, zipEntries, func(w io.Writer, i int) error {
+		err := copyBundleObject(c.Request.Context(), w, metaList[i])
+		recordBundleEvent(c, bundleId, metaList[i], err)
+		return err
+	})
+	if err != nil {
+		// 响应头已发送，只能中断连接，客户端得到不完整的压缩包
+		lgLogger.WithContext(c).Error(fmt.Sprintf("打包下载，写入http响应出错，%s", err.Error()))
+	}
+}
+
+// recordBundleEvent 按文件上报打包下载事件，读取失败的文件计为错误
+func recordBundleEvent(c *gin.Context, bundleId int64, meta *models.MetaDataInfo, err error) {
+	event := models.DownloadEvent{
+		Uid:    meta.UID,
+		LinkId: bundleId,
+		Tenant: meta.Tenant,
+		Status: http.StatusOK,
+		Method: c.Request.Method,
+		Client: c.ClientIP(),
+		Time:   time.Now(),
+	}
+	if err != nil {
+		event.Status = http.StatusInternalServerError
+	} else {
+		event.Bytes = meta.StorageSize
+	}
+	analytics.Record(event)
+}
+
+// getBundleMetas 获取可下载的文件元数据，不存在、不可下载或所属批次未提交的文件不返回
+func getBundleMetas(db *gorm.DB, uidList []int64) (map[int64]*models.MetaDataInfo, error) {
+	metaList, err := repo.NewMetaDataInfoRepo().GetByUidList(db, uidList)
+	if err != nil {
+		return nil, err
+	}
+	var batchUidList []int64
+	for _, meta := range metaList {
+		if meta.BatchUid != 0 {
+			batchUidList = append(batchUidList, meta.BatchUid)
+		}
+	}
+	committed, err := repo.NewUploadBatchRepo().GetCommitted(db, batchUidList)
+	if err != nil {
+		return nil, err
+	}
+	ret := map[int64]*models.MetaDataInfo{}
+	for i, meta := range metaList {
+		if !repo.IsDownloadable(meta.Status, bootstrap.NewConfig("").Scan.Enabled) || (meta.BatchUid != 0 && !committed[meta.BatchUid]) {
+			continue
+		}
+		ret[meta.UID] = &metaList[i]
+	}
+	return ret, nil
+}
+
+// copyBundleObject 将文件完整内容写入w，local存储时不在本地的文件从所在节点读取
+func copyBundleObject(ctx context.Context, w io.Writer, meta *models.MetaDataInfo) error {
+	uidStr := strconv.FormatInt(meta.UID, 10)
+	if bootstrap.NewConfig("").Local.Enabled && !localObjectExists(meta) {
+		return copyRemoteObject(ctx, w, meta)
+	}
+	var parts []models.MultiPartInfo
+	if meta.MultiPart {
+		var err error
+		parts, err = getDownloadParts(uidStr, meta.UID)
+		if err != nil {
+			return fmt.Errorf("查询分片数据失败，%s", err.Error())
+		}
+		if meta.PartNum != len(parts) {
+			return errors.New("分片数量和整体数量不一致")
+		}
+	}
+	return copyObjectRange(w, meta, parts, 0, meta.StorageSize)
+}
+
+// copyRemoteObject 生成短期签名，从文件所在节点下载完整内容
+func copyRemoteObject(ctx context.Context, w io.Writer, meta *models.MetaDataInfo) error {
+	uidStr := strconv.FormatInt(meta.UID, 10)
+	proxyIP, err := locateServer(uidStr)
+	if err != nil {
+		return err
+	}
+	linkId, err := base.NewSnowFlake().NextId()
+	if err != nil {
+		return err
+	}
+	extra := url.Values{utils.LinkParamId: {strconv.FormatInt(linkId, 10)}}
+	expire := "300"
+	date := time.Now().Format("2006-01-02T15:04:05Z")
+	signature := base.SignDownload(meta.UID, date, expire, meta.Bucket, meta.StorageName, extra)
+	query := base.GenDownloadSignature(meta.UID, meta.Name, meta.Bucket, meta.StorageName, expire, date, signature, extra)
+	resp, err := thirdparty.NewStorageService().DownloadObject(ctx, utils.Scheme, proxyIP,
+		bootstrap.NewConfig("").App.Port, query)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("从节点[%s]下载文件[%s]失败，状态码%d", proxyIP, uidStr, resp.StatusCode)
+	}
+	_, err = io.Copy(w, resp.Body)
+	return err
+}
@@ -1,25 +1,31 @@
 package v0
 
 import (
-	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/gin-gonic/gin"
 	"github.com/go-redis/redis/v8"
 	"github.com/qinguoyi/osproxy/app/models"
+	"github.com/qinguoyi/osproxy/app/pkg/analytics"
 	"github.com/qinguoyi/osproxy/app/pkg/base"
 	"github.com/qinguoyi/osproxy/app/pkg/repo"
 	"github.com/qinguoyi/osproxy/app/pkg/storage"
 	"github.com/qinguoyi/osproxy/app/pkg/thirdparty"
+	"github.com/qinguoyi/osproxy/app/pkg/throttle"
 	"github.com/qinguoyi/osproxy/app/pkg/utils"
 	"github.com/qinguoyi/osproxy/app/pkg/web"
 	"github.com/qinguoyi/osproxy/bootstrap"
 	"github.com/qinguoyi/osproxy/bootstrap/plugins"
+	"go.uber.org/zap"
 	"io"
+	"mime/multipart"
 	"net/http"
 	"os"
 	"path"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 )
@@ -31,20 +37,41 @@ import (
 // DownloadHandler    下载数据
 //
 //	@Summary      下载数据
-//	@Description  下载数据
+//	@Description  下载数据，HEAD请求校验签名后只返回大小、类型及Range支持等响应头
 //	@Tags         下载
 //	@Accept       application/json
-//	@Param        uid        query  string  true  "文件uid"
-//	@Param        name       query  string  true  "文件名称"
-//	@Param        online     query  string  true  "是否在线"
-//	@Param        date       query  string  true  "链接生成时间"
-//	@Param        expire     query  string  true  "过期时间"
-//	@Param        bucket     query  string  true  "存储桶"
-//	@Param        object     query  string  true  "存储名称"
-//	@Param        signature  query  string  true  "签名"
+//	@Param        uid                query   string  true   "文件uid"
+//	@Param        name               query   string  true   "文件名称"
+//	@Param        online             query   string  true   "是否在线"
+//	@Param        date               query   string  true   "链接生成时间"
+//	@Param        expire             query   string  true   "过期时间"
+//	@Param        bucket             query   string  true   "存储桶"
+//	@Param        object             query   string  true   "存储名称"
+//	@Param        signature          query   string  true   "签名"
+//	@Param        rate               query   int     false  "链接限速(KB/s)，参与签名"
+//	@Param        lid                query   string  true   "链接ID，参与签名"
+//	@Param        lt                 query   string  false  "链接信息已落库，校验下载次数及撤销，参与签名"
+//	@Param        ip                 query   string  false  "允许的客户端IP或CIDR，逗号分隔，参与签名"
+//	@Param        referer            query   string  false  "允许的来源域名，逗号分隔，参与签名"
+//	@Param        header             query   string  false  "要求的请求头，格式Name:Value，参与签名"
+//	@Param        w                  query   int     false  "图片处理：宽度，参与签名"
+//	@Param        h                  query   int     false  "图片处理：高度，参与签名"
+//	@Param        fit                query   string  false  "图片处理：缩放方式contain、cover、fill，参与签名"
+//	@Param        crop               query   string  false  "图片处理：裁剪区域x,y,w,h，参与签名"
+//	@Param        q                  query   int     false  "图片处理：jpeg质量，参与签名"
+//	@Param        fmt                query   string  false  "图片处理：输出格式jpeg、png、gif，参与签名"
+//	@Param        Range              header  string  false  "字节区间，支持bytes=a-b、a-、-n及多个区间"
+//	@Param        If-None-Match      header  string  false  "ETag匹配时返回304"
+//	@Param        If-Modified-Since  header  string  false  "文件未修改时返回304"
+//	@Param        If-Range           header  string  false  "与当前ETag或修改时间一致时Range才生效"
 //	@Produce      application/json
 //	@Success      200  {object}  web.Response
+//	@Success      206  {object}  web.Response
+//	@Success      304  {object}  web.Response
+//	@Failure      403  {object}  web.Response
+//	@Failure      416  {object}  web.Response
 //	@Router       /api/storage/v0/download [get]
+//	@Router       /api/storage/v0/download [head]
 func DownloadHandler(c *gin.Context) {
 	// 校验参数
 	uidStr := c.Query("uid")
@@ -69,10 +96,56 @@ func DownloadHandler(c *gin.Context) {
 		web.ParamsError(c, errorInfo)
 		return
 	}
-	if !base.CheckDownloadSignature(date, expireStr, bucketName, objectName, signature) {
+	if !base.CheckDownloadSignature(uid, date, expireStr, bucketName, objectName, signature, c.Request.URL.Query()) {
 		web.ParamsError(c, "签名校验失败")
 		return
 	}
+	// 其他节点转发的请求已在入口节点校验链接绑定，使用签名头中的原始客户端IP
+	clientIP, forwardedIn := base.CheckForwardHeader(c.Request.Header, c.Request.URL.RequestURI())
+	if !forwardedIn {
+		clientIP = c.ClientIP()
+	}
+	// 下载统计，响应结束后异步上报，转发到其他节点的请求由所在节点统计，打包下载读取其他节点的文件由入口节点统计
+	event := models.DownloadEvent{Uid: uid, Method: c.Request.Method, Client: clientIP, Time: time.Now()}
+	internal := forwardedIn && clientIP == ""
+	forwarded := false
+	defer func() {
+		if forwarded || internal {
+			return
+		}
+		event.Status = c.Writer.Status()
+		if size := c.Writer.Size(); size > 0 {
+			event.Bytes = int64(size)
+		}
+		analytics.Record(event)
+	}()
+	// 绑定客户端的链接校验IP、来源及请求头，转发的请求不重复校验
+	if !forwardedIn {
+		if errorInfo := base.CheckLinkBinding(c.Request.URL.Query(), clientIP, c.Request.Header); errorInfo != "" {
+			web.Forbidden(c, errorInfo)
+			return
+		}
+	}
+	linkRate, _ := strconv.ParseInt(c.Query(utils.LinkParamRate), 10, 64)
+	// 链接ID均参与签名，落库的链接校验是否已撤销或次数已用完
+	linkId, err := strconv.ParseInt(c.Query(utils.LinkParamId), 10, 64)
+	if err != nil {
+		web.ParamsError(c, "lid参数有误")
+		return
+	}
+	event.LinkId = linkId
+	var link *models.DownloadLink
+	if c.Query(utils.LinkParamTrack) != "" {
+		link, err = base.GetDownloadLink(linkId)
+		if err != nil || link.UID != uid {
+			web.NotFoundResource(c, "链接不存在")
+			return
+		}
+		if errorInfo := base.CheckDownloadLink(link); errorInfo != "" {
+			web.Forbidden(c, errorInfo)
+			return
+		}
+	}
 
 	var meta *models.MetaDataInfo
 	lgRedis := new(plugins.LangGoRedis).NewRedis()
@@ -108,260 +181,339 @@ func DownloadHandler(c *gin.Context) {
 		lgRedis.Expire(context.Background(), fmt.Sprintf("%s-meta", uidStr), 5*60*time.Second)
 		meta = &msg
 	}
+	event.Tenant = meta.Tenant
+	// 签名的桶及存储名称需与文件一致，避免用其他文件的签名下载
+	if meta.Bucket != bucketName || meta.StorageName != objectName {
+		web.Forbidden(c, "链接与文件不匹配")
+		return
+	}
+	if base.IsLinkRevoked(meta, date) {
+		web.Forbidden(c, "链接已撤销")
+		return
+	}
+	if !repo.IsDownloadable(meta.Status, bootstrap.NewConfig("").Scan.Enabled) {
+		web.NotFoundResource(c, fmt.Sprintf("当前文件状态[%s]不可下载", repo.MetaStatusName(meta.Status)))
+		return
+	}
+	if !repo.NewUploadBatchRepo().IsVisible(new(plugins.LangGoDB).Use("default").NewDB(), meta.BatchUid) {
+		web.NotFoundResource(c, "文件所属批次未提交")
+		return
+	}
+	// 不在本地，转发到所在节点，由所在节点处理Range及图片处理
+	if bootstrap.NewConfig("").Local.Enabled && !localObjectExists(meta) {
+		forwarded = true
+		downloadForward(c, uidStr, base.TransferLimiters(meta.Tenant, linkRate, clientIP))
+		return
+	}
+
+	// 图片处理，使用处理结果代替原图，缓存策略沿用原图所在的桶
+	cacheBucket := meta.Bucket
+	transform, err := base.ParseImageTransform(c.Request.URL.Query(), bootstrap.NewConfig("").Image.MaxSize)
+	if err != nil {
+		web.ParamsError(c, err.Error())
+		return
+	}
+	if transform != nil {
+		derived, errorInfo, err := getImageDerivative(meta, transform)
+		if err != nil {
+			lgLogger.WithContext(c).Error("下载数据，图片处理失败", zap.Any("err", err.Error()))
+			web.InternalError(c, "图片处理失败")
+			return
+		}
+		if errorInfo != "" {
+			web.ParamsError(c, errorInfo)
+			return
+		}
+		meta = derived
+		name = strings.TrimSuffix(name, path.Ext(name)) + path.Ext(meta.StorageName)
+	}
 	bucketName = meta.Bucket
 	objectName = meta.StorageName
 	fileSize := meta.StorageSize
-	start, end := base.GetRange(c.GetHeader("Range"), fileSize)
-	c.Writer.Header().Add("Content-Length", fmt.Sprintf("%d", end-start+1))
+
+	// 缓存校验，文件未变化时返回304
+	etag := base.FormatETag(meta.Md5)
+	var lastModified time.Time
+	if meta.UpdatedAt != nil {
+		lastModified = meta.UpdatedAt.UTC().Truncate(time.Second)
+		c.Writer.Header().Set("Last-Modified", lastModified.Format(http.TimeFormat))
+	}
+	if etag != "" {
+		c.Writer.Header().Set("ETag", etag)
+	}
+	downloadConf := bootstrap.NewConfig("").Download
+	if cacheControl := base.GetCacheControl(cacheBucket, downloadConf.CacheControl, downloadConf.BucketCache); cacheControl != "" {
+		c.Writer.Header().Set("Cache-Control", cacheControl)
+	}
+	if base.CheckNotModified(c.Request.Header, etag, lastModified) {
+		c.Status(http.StatusNotModified)
+		return
+	}
+
+	// If-Range与当前版本不一致时忽略Range，返回完整内容
+	rangeHeader := c.GetHeader("Range")
+	if !base.CheckIfRange(c.Request.Header, etag, lastModified) {
+		rangeHeader = ""
+	}
+	ranges, err := base.ParseRange(rangeHeader, fileSize)
+	event.Range = len(ranges) != 0
+	if err == base.ErrRangeNotSatisfiable {
+		c.Header("Content-Range", fmt.Sprintf("bytes */%d", fileSize))
+		c.Status(http.StatusRequestedRangeNotSatisfiable)
+		return
+	}
+	// 限次链接每次返回原图数据的GET请求均计数，Range请求同样计数，HEAD、304及缩略图不计数
+	if link != nil && transform == nil && c.Request.Method == http.MethodGet {
+		errorInfo, err := base.ConsumeDownloadLink(link)
+		if err != nil {
+			lgLogger.WithContext(c).Error("下载数据，更新链接下载次数失败")
+			web.InternalError(c, "内部异常")
+			return
+		}
+		if errorInfo != "" {
+			web.Forbidden(c, errorInfo)
+			return
+		}
+	}
+	var parts []models.MultiPartInfo
+	if meta.MultiPart {
+		parts, err = getDownloadParts(uidStr, uid)
+		if err != nil {
+			lgLogger.WithContext(c).Error("下载数据，查询分片数据失败")
+			web.InternalError(c, "查询分片数据失败")
+			return
+		}
+		if meta.PartNum != len(parts) {
+			lgLogger.WithContext(c).Error("分片数量和整体数量不一致")
+			web.InternalError(c, "分片数量和整体数量不一致")
+			return
+		}
+	}
+
 	if online == "0" {
 		c.Writer.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%s", name))
 	} else {
 		c.Writer.Header().Set("Content-Disposition", fmt.Sprintf("inline; filename=%s", name))
 	}
-	c.Writer.Header().Add("Content-Type", meta.ContentType)
-	c.Writer.Header().Add("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, end, fileSize))
 	c.Writer.Header().Set("Accept-Ranges", "bytes")
-	if start == fileSize {
-		c.Status(http.StatusOK)
-		return
+	copyRange := func(w io.Writer, r base.HttpRange) error {
+		return copyObjectRange(w, meta, parts, r.Start, r.Length)
 	}
-	if end == fileSize-1 {
+	var writeBody func(w io.Writer) error
+	switch len(ranges) {
+	case 0:
+		c.Writer.Header().Set("Content-Type", meta.ContentType)
+		c.Writer.Header().Set("Content-Length", fmt.Sprintf("%d", fileSize))
 		c.Status(http.StatusOK)
-	} else {
+		writeBody = func(w io.Writer) error {
+			return copyRange(w, base.HttpRange{Start: 0, Length: fileSize})
+		}
+	case 1:
+		c.Writer.Header().Set("Content-Type", meta.ContentType)
+		c.Writer.Header().Set("Content-Length", fmt.Sprintf("%d", ranges[0].Length))
+		c.Writer.Header().Set("Content-Range", ranges[0].ContentRange(fileSize))
+		c.Status(http.StatusPartialContent)
+		writeBody = func(w io.Writer) error {
+			return copyRange(w, ranges[0])
+		}
+	default:
+		// 多个区间，响应multipart/byteranges，长度需按相同的boundary预先计算
+		boundary := multipart.NewWriter(io.Discard).Boundary()
+		c.Writer.Header().Set("Content-Type", "multipart/byteranges; boundary="+boundary)
+		c.Writer.Header().Set("Content-Length",
+			fmt.Sprintf("%d", base.MultipartRangeSize(ranges, boundary, meta.ContentType, fileSize)))
 		c.Status(http.StatusPartialContent)
+		writeBody = func(w io.Writer) error {
+			return base.WriteMultipartRange(w, ranges, boundary, meta.ContentType, fileSize, copyRange)
+		}
+	}
+	// HEAD请求只返回响应头，不读取对象数据
+	if c.Request.Method == http.MethodHead {
+		c.Writer.WriteHeaderNow()
+		return
+	}
+	// 其他节点转发的请求已在入口节点限速
+	var limiters []throttle.Limiter
+	if !forwardedIn {
+		limiters = base.TransferLimiters(meta.Tenant, linkRate, clientIP)
+	}
+	if err := writeBody(throttle.NewWriter(c.Request.Context(), c.Writer, limiters...)); err != nil {
+		lgLogger.WithContext(c).Error(fmt.Sprintf("下载数据，写入http响应出错，%s", err.Error()))
+	}
+}
+
+// localObjectExists local存储时文件是否在当前节点，单文件上传完uid会删除, 大文件合并后会删除
+func localObjectExists(meta *models.MetaDataInfo) bool {
+	dirName := path.Join(utils.LocalStore, strconv.FormatInt(meta.UID, 10))
+	// 不分片：单文件或大文件已合并
+	if !meta.MultiPart {
+		dirName = path.Join(utils.LocalStore, meta.Bucket, meta.StorageName)
 	}
+	_, err := os.Stat(dirName)
+	return !os.IsNotExist(err)
+}
 
-	ch := make(chan []byte, 1024*1024*20)
-	proxyFlag := false
-	// local存储: 单文件上传完uid会删除, 大文件合并后会删除
-	if bootstrap.NewConfig("").Local.Enabled {
-		dirName := path.Join(utils.LocalStore, uidStr)
-		// 不分片：单文件或大文件已合并
-		if !meta.MultiPart {
-			dirName = path.Join(utils.LocalStore, bucketName, objectName)
+// getDownloadParts 获取分片对象的分片列表，按分片序号排序
+func getDownloadParts(uidStr string, uid int64) ([]models.MultiPartInfo, error) {
+	var multiPartInfoList []models.MultiPartInfo
+	lgRedis := new(plugins.LangGoRedis).NewRedis()
+	key := fmt.Sprintf("%s-multiPart", uidStr)
+	val, err := lgRedis.Get(context.Background(), key).Result()
+	// key在redis中不存在
+	if err == redis.Nil {
+		lgDB := new(plugins.LangGoDB).Use("default").NewDB()
+		if err := lgDB.Model(&models.MultiPartInfo{}).Where(
+			"storage_uid = ? and status = ?", uid, 1).Order("chunk_num ASC").Find(&multiPartInfoList).Error; err != nil {
+			return nil, err
 		}
-		if _, err := os.Stat(dirName); os.IsNotExist(err) {
-			proxyFlag = true
+		// 写入redis
+		if b, err := json.Marshal(multiPartInfoList); err == nil {
+			lgRedis.SetNX(context.Background(), key, b, 5*60*time.Second)
 		}
+		return multiPartInfoList, nil
 	}
-	if proxyFlag {
-		// 不在本地，询问集群内其他服务并转发
-		serviceList, err := base.NewServiceRegister().Discovery()
-		if err != nil || serviceList == nil {
-			lgLogger.WithContext(c).Error("发现其他服务失败")
-			web.InternalError(c, "发现其他服务失败")
-			return
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal([]byte(val), &multiPartInfoList); err != nil {
+		return nil, err
+	}
+	// 续期
+	lgRedis.Expire(context.Background(), key, 5*60*time.Second)
+	return multiPartInfoList, nil
+}
+
+// copyObjectRange 将[start, start+length)的数据写入w，分片对象按分片顺序读取
+func copyObjectRange(w io.Writer, meta *models.MetaDataInfo, parts []models.MultiPartInfo, start, length int64) error {
+	if !meta.MultiPart {
+		return copyStorageRange(w, meta.Bucket, meta.StorageName, start, length)
+	}
+	offset := int64(0)
+	for _, part := range parts {
+		if length <= 0 {
+			break
 		}
-		var wg sync.WaitGroup
-		var ipList []string
-		ipChan := make(chan string, len(serviceList))
-		for _, service := range serviceList {
-			wg.Add(1)
-			go func(ip string, port string, ipChan chan string, wg *sync.WaitGroup) {
-				defer wg.Done()
-				res, err := thirdparty.NewStorageService().Locate(utils.Scheme, ip, port, uidStr)
-				if err != nil {
-					fmt.Print(err.Error())
-					return
-				}
-				ipChan <- res
-			}(service.IP, service.Port, ipChan, &wg)
+		if start >= offset+part.StorageSize {
+			offset += part.StorageSize
+			continue
 		}
-		wg.Wait()
-		close(ipChan)
-		for re := range ipChan {
-			ipList = append(ipList, re)
+		partStart := start - offset
+		partLength := part.StorageSize - partStart
+		if partLength > length {
+			partLength = length
 		}
-		if len(ipList) == 0 {
-			lgLogger.WithContext(c).Error("发现其他服务失败")
-			web.InternalError(c, "发现其他服务失败")
-			return
+		if err := copyStorageRange(w, part.Bucket, part.StorageName, partStart, partLength); err != nil {
+			return err
 		}
-		proxyIP := ipList[0]
-		_, bodyData, _, err := thirdparty.NewStorageService().DownloadForward(c, utils.Scheme, proxyIP,
-			bootstrap.NewConfig("").App.Port)
-		if err != nil {
-			lgLogger.WithContext(c).Error("下载转发失败")
-			web.InternalError(c, err.Error())
-			return
+		start += partLength
+		length -= partLength
+		offset += part.StorageSize
+	}
+	if length > 0 {
+		return errors.New("分片数据不完整")
+	}
+	return nil
+}
+
+// copyStorageRange 按1MB分块从对象存储读取数据写入w，避免整体读入内存
+func copyStorageRange(w io.Writer, bucketName, objectName string, start, length int64) error {
+	step := int64(1 * 1024 * 1024)
+	for length > 0 {
+		size := step
+		if length < size {
+			size = length
 		}
-		defer bodyData.Close()
-		// 避免响应体全部读入内存，导致内存溢出问题
-		buffer := new(bytes.Buffer)
-		_, err = io.Copy(buffer, bodyData)
-		if err != nil {
-			lgLogger.WithContext(c).Error("转发下载数据发送失败")
-			web.InternalError(c, "转发下载数据发送失败")
-			return
+		data, err := storage.NewStorage().Storage.GetObject(bucketName, objectName, start, size)
+		if err != nil && err != io.EOF {
+			return fmt.Errorf("从对象存储获取数据失败%s", err.Error())
 		}
-		data := buffer.Bytes()
-		for len(data) > 0 {
-			chunkSize := 1024 * 1024 // 每次读取 1MB 数据
-			if len(data) < chunkSize {
-				chunkSize = len(data)
-			}
-			ch <- data[:chunkSize]
-			data = data[chunkSize:]
+		if int64(len(data)) != size {
+			return io.ErrUnexpectedEOF
 		}
+		if _, err := w.Write(data); err != nil {
+			return err
+		}
+		start += size
+		length -= size
+	}
+	return nil
+}
 
-		// 关闭 channel
-		close(ch)
-	} else {
-		// local在本地 || 其他os
-		if !meta.MultiPart {
-			go func() {
-				step := int64(1 * 1024 * 1024)
-				for {
-					if start >= end {
-						close(ch)
-						break
-					}
-					length := step
-					if start+length > end {
-						length = end - start + 1
-					}
-					data, err := storage.NewStorage().Storage.GetObject(bucketName, objectName, start, length)
-					if err != nil && err != io.EOF {
-						lgLogger.WithContext(c).Error(fmt.Sprintf("从对象存储获取数据失败%s", err.Error()))
-					}
-					ch <- data
-					start += step
-				}
-			}()
-
-			// 这种场景，会先从minio中获取全部数据，再流式传输，所以下载前会等待一下，但会把内存打爆
-			//go func() {
-			//	data, err := inner.NewStorage().Storage.GetObject(bucketName, objectName, start, end-start+1)
-			//	if err != nil && err != io.EOF {
-			//		lgLogger.WithContext(c).Error(fmt.Sprintf("从minio获取数据失败%s", err.Error()))
-			//	}
-			//	ch <- data
-			//	close(ch)
-			//}()
-
-		} else {
-			// 分片数据传输
-			var multiPartInfoList []models.MultiPartInfo
-			val, err := lgRedis.Get(context.Background(), fmt.Sprintf("%s-multiPart", uidStr)).Result()
-			// key在redis中不存在
-			if err == redis.Nil {
-				lgDB := new(plugins.LangGoDB).Use("default").NewDB()
-				if err := lgDB.Model(&models.MultiPartInfo{}).Where(
-					"storage_uid = ? and status = ?", uid, 1).Order("chunk_num ASC").Find(&multiPartInfoList).Error; err != nil {
-					lgLogger.WithContext(c).Error("下载数据，查询分片数据失败")
-					web.InternalError(c, "查询分片数据失败")
-					return
-				}
-				// 写入redis
-				b, err := json.Marshal(multiPartInfoList)
-				if err != nil {
-					lgLogger.WithContext(c).Warn("下载数据，写入redis失败")
-				}
-				lgRedis.SetNX(context.Background(), fmt.Sprintf("%s-multiPart", uidStr), b, 5*60*time.Second)
-			} else {
-				if err != nil {
-					lgLogger.WithContext(c).Error("下载数据，查询redis失败")
-					web.InternalError(c, "")
-					return
-				}
-				var msg []models.MultiPartInfo
-				if err := json.Unmarshal([]byte(val), &msg); err != nil {
-					lgLogger.WithContext(c).Error("下载数据，查询reids，结果序列化失败")
-					web.InternalError(c, "")
-					return
-				}
-				// 续期
-				lgRedis.Expire(context.Background(), fmt.Sprintf("%s-multiPart", uidStr), 5*60*time.Second)
-				multiPartInfoList = msg
-			}
+// hopHeaders 逐跳响应头，转发时不透传
+var hopHeaders = map[string]bool{
+	"Connection":          true,
+	"Keep-Alive":          true,
+	"Proxy-Authenticate":  true,
+	"Proxy-Authorization": true,
+	"Te":                  true,
+	"Trailer":             true,
+	"Transfer-Encoding":   true,
+	"Upgrade":             true,
+}
 
-			if meta.PartNum != len(multiPartInfoList) {
-				lgLogger.WithContext(c).Error("分片数量和整体数量不一致")
-				web.InternalError(c, "分片数量和整体数量不一致")
+// locateServer 询问集群内其他服务，返回文件所在节点的IP
+func locateServer(uidStr string) (string, error) {
+	serviceList, err := base.NewServiceRegister().Discovery()
+	if err != nil || serviceList == nil {
+		return "", errors.New("发现其他服务失败")
+	}
+	var wg sync.WaitGroup
+	var ipList []string
+	ipChan := make(chan string, len(serviceList))
+	for _, service := range serviceList {
+		wg.Add(1)
+		go func(ip string, port string, ipChan chan string, wg *sync.WaitGroup) {
+			defer wg.Done()
+			res, err := thirdparty.NewStorageService().Locate(utils.Scheme, ip, port, uidStr)
+			if err != nil {
+				fmt.Print(err.Error())
 				return
 			}
+			ipChan <- res
+		}(service.IP, service.Port, ipChan, &wg)
+	}
+	wg.Wait()
+	close(ipChan)
+	for re := range ipChan {
+		ipList = append(ipList, re)
+	}
+	if len(ipList) == 0 {
+		return "", errors.New("发现其他服务失败")
+	}
+	return ipList[0], nil
+}
 
-			// 查找起始分片
-			index, totalSize := int64(0), int64(0)
-			var startP, lengthP int64
-			for {
-				if totalSize >= start {
-					startP, lengthP = 0, multiPartInfoList[index].StorageSize
-				} else {
-					if totalSize+multiPartInfoList[index].StorageSize > start {
-						startP, lengthP = start-totalSize, multiPartInfoList[index].StorageSize-(start-totalSize)
-					} else {
-						totalSize += multiPartInfoList[index].StorageSize
-						index++
-						continue
-					}
-				}
-				break
-			}
-			var chanSlice []chan int
-			for i := 0; i < utils.MultiPartDownload; i++ {
-				chanSlice = append(chanSlice, make(chan int, 1))
-			}
-
-			chanSlice[0] <- 1
-			j := 0
-			for i := 0; i < utils.MultiPartDownload; i++ {
-				go func(i int, startP_, lengthP_ int64) {
-					for {
-						// 当前块计算完后，需要等待前一个块合并到主哈希
-						<-chanSlice[i]
-
-						if index >= int64(meta.PartNum) {
-							close(ch)
-							break
-						}
-						if totalSize >= start {
-							startP_, lengthP_ = 0, multiPartInfoList[index].StorageSize
-						}
-						totalSize += multiPartInfoList[index].StorageSize
-
-						data, err := storage.NewStorage().Storage.GetObject(
-							multiPartInfoList[index].Bucket,
-							multiPartInfoList[index].StorageName,
-							startP_,
-							lengthP_,
-						)
-						if err != nil && err != io.EOF {
-							lgLogger.WithContext(c).Error(fmt.Sprintf("从对象存储获取数据失败%s", err.Error()))
-						}
-						// 合并到主哈希
-						ch <- data
-						index++
-						// 这里要注意适配chanSlice的长度
-						if j == utils.MultiPartDownload-1 {
-							j = 0
-						} else {
-							j++
-						}
-						chanSlice[j] <- 1
-					}
-				}(i, startP, lengthP)
-			}
-		}
+// downloadForward 文件不在本地时，询问集群内其他服务并转发
+func downloadForward(c *gin.Context, uidStr string, limiters []throttle.Limiter) {
+	proxyIP, err := locateServer(uidStr)
+	if err != nil {
+		lgLogger.WithContext(c).Error(err.Error())
+		web.InternalError(c, err.Error())
+		return
+	}
+	resp, err := thirdparty.NewStorageService().DownloadForward(c, utils.Scheme, proxyIP,
+		bootstrap.NewConfig("").App.Port)
+	if err != nil {
+		lgLogger.WithContext(c).Error("下载转发失败")
+		web.InternalError(c, err.Error())
+		return
 	}
+	defer resp.Body.Close()
 
-	// 在使用 Stream 响应时，需要在调用stream之前设置status
-	c.Stream(func(w io.Writer) bool {
-		defer func() {
-			if err := recover(); err != nil {
-				lgLogger.WithContext(c).Error(fmt.Sprintf("stream流式响应出错，%s", err))
-			}
-		}()
-		data, ok := <-ch
-		if !ok {
-			return false
-		}
-		_, err := w.Write(data)
-		if err != nil {
-			lgLogger.WithContext(c).Error(fmt.Sprintf("写入http响应出错，%s", err.Error()))
-			return false
+	// 透传所在节点的状态码及响应头，响应体直接写回客户端，由写入速度控制读取
+	for key, values := range resp.Header {
+		if hopHeaders[http.CanonicalHeaderKey(key)] {
+			continue
 		}
-		return true
-	})
-	return
+		c.Writer.Header()[key] = values
+	}
+	c.Status(resp.StatusCode)
+	c.Writer.WriteHeaderNow()
+	if c.Request.Method == http.MethodHead {
+		return
+	}
+	if _, err := io.Copy(throttle.NewWriter(c.Request.Context(), c.Writer, limiters...), resp.Body); err != nil {
+		// 客户端断开时context取消，远端请求随之中止
+		lgLogger.WithContext(c).Warn(fmt.Sprintf("转发下载数据发送中断，%s", err.Error()))
+	}
 }
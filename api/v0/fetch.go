@@ -0,0 +1,216 @@
+package v0
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/qinguoyi/osproxy/app/models"
+	"github.com/qinguoyi/osproxy/app/pkg/base"
+	"github.com/qinguoyi/osproxy/app/pkg/repo"
+	"github.com/qinguoyi/osproxy/app/pkg/utils"
+	"github.com/qinguoyi/osproxy/app/pkg/web"
+	"github.com/qinguoyi/osproxy/bootstrap"
+	"github.com/qinguoyi/osproxy/bootstrap/plugins"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"time"
+)
+
+/*
+服务端拉取远程文件
+*/
+
+// fetchExpire 拉取任务的有效时间，超时未完成时由回收任务标记过期并释放预留的配额
+const fetchExpire = 24 * time.Hour
+
+// fetchContentLength 请求源地址获取文件大小，获取失败时返回0
+func fetchContentLength(rawUrl string, headers map[string]string) int64 {
+	req, err := http.NewRequest(http.MethodHead, rawUrl, nil)
+	if err != nil {
+		return 0
+	}
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := base.NewPublicClient(10 * time.Second).Do(req)
+	if err != nil {
+		return 0
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || resp.ContentLength < 0 {
+		return 0
+	}
+	return resp.ContentLength
+}
+
+// FetchHandler    拉取远程文件
+//
+//	@Summary      拉取远程文件
+//	@Description  根据源地址异步拉取文件，立即返回uid
+//	@Tags         拉取
+//	@Accept       application/json
+//	@Param        RequestBody  body  models.FetchReq  true  "拉取请求体"
+//	@Produce      application/json
+//	@Success      200  {object}  web.Response{data=[]models.FetchResp}
+//	@Router       /api/storage/v0/fetch [post]
+func FetchHandler(c *gin.Context) {
+	var fetchReq models.FetchReq
+	if err := c.ShouldBindJSON(&fetchReq); err != nil {
+		web.ParamsError(c, fmt.Sprintf("参数解析有误，详情：%s", err))
+		return
+	}
+	if len(fetchReq.Data) == 0 || len(fetchReq.Data) > utils.FetchLimit {
+		web.ParamsError(c, fmt.Sprintf("拉取文件数量有误，最多%d条", utils.FetchLimit))
+		return
+	}
+	if err := base.CheckCallback(fetchReq.Callback); err != nil {
+		web.ParamsError(c, err.Error())
+		return
+	}
+
+	tenant := c.GetString(utils.ContextTenant)
+	// 启用容量配额时，按声明或源地址返回的大小预留配额
+	tenantConf := base.GetTenant(tenant)
+	reserve := tenantConf != nil && tenantConf.MaxBytes > 0
+	maxSize := bootstrap.NewConfig("").Fetch.MaxSize * 1024 * 1024
+	expireAt := time.Now().Add(fetchExpire)
+	var totalSize int64
+	var resp []models.FetchResp
+	var metaDataList []models.MetaDataInfo
+	var taskList []*models.TaskInfo
+	for _, item := range fetchReq.Data {
+		srcUrl, err := url.Parse(item.Url)
+		if err != nil || (srcUrl.Scheme != "http" && srcUrl.Scheme != "https") || srcUrl.Host == "" {
+			web.ParamsError(c, fmt.Sprintf("源地址[%s]有误，仅支持http/https", item.Url))
+			return
+		}
+		if err := base.CheckPublicUrl(item.Url); err != nil {
+			web.ParamsError(c, fmt.Sprintf("源地址[%s]有误，%s", item.Url, err.Error()))
+			return
+		}
+		fileName := item.Name
+		if fileName == "" {
+			fileName = path.Base(srcUrl.Path)
+		}
+		if base.GetExtension(fileName) == "" {
+			web.ParamsError(c, fmt.Sprintf("文件[%s]后缀有误，不能为空", fileName))
+			return
+		}
+		size := item.Size
+		if size < 0 || (maxSize > 0 && size > maxSize) {
+			web.ParamsError(c, fmt.Sprintf("文件[%s]大小有误，上限%d", fileName, maxSize))
+			return
+		}
+		if size == 0 && reserve {
+			size = fetchContentLength(item.Url, item.Headers)
+		}
+		metaData, err := base.NewMetaDataInfo(fileName, tenant, fetchReq.Callback)
+		if err != nil {
+			lgLogger.WithContext(c).Error("拉取文件，生成uid失败", zap.Any("err", err.Error()))
+			web.InternalError(c, "内部异常")
+			return
+		}
+		metaData.StorageSize = size
+		metaData.ExpireAt = &expireAt
+		totalSize += size
+		b, err := json.Marshal(models.FetchInfo{
+			StorageUid: metaData.UID,
+			Url:        item.Url,
+			Headers:    item.Headers,
+			Md5:        item.Md5,
+		})
+		if err != nil {
+			lgLogger.WithContext(c).Error("消息struct转成json字符串失败", zap.Any("err", err.Error()))
+			web.InternalError(c, "内部异常")
+			return
+		}
+		metaDataList = append(metaDataList, *metaData)
+		taskList = append(taskList, &models.TaskInfo{
+			Status:     utils.TaskStatusUndo,
+			TaskType:   utils.TaskFetch,
+			ExtraData:  string(b),
+			StorageUid: metaData.UID,
+		})
+		resp = append(resp, models.FetchResp{
+			Uid: strconv.FormatInt(metaData.UID, 10),
+			Url: item.Url,
+		})
+	}
+
+	lgDB := new(plugins.LangGoDB).Use("default").NewDB()
+	if !checkQuota(c, lgDB, tenant, totalSize, int64(len(metaDataList))) {
+		return
+	}
+	var errorInfo string
+	if err := lgDB.Transaction(func(tx *gorm.DB) error {
+		info, err := base.ReserveQuota(tx, tenant, metaDataList)
+		if err != nil {
+			return err
+		}
+		if info != "" {
+			errorInfo = info
+			return errors.New(info)
+		}
+		if err := repo.NewMetaDataInfoRepo().BatchCreate(tx, &metaDataList); err != nil {
+			return err
+		}
+		return repo.NewTaskRepo().BatchCreate(tx, taskList)
+	}); err != nil {
+		if errorInfo != "" {
+			web.Forbidden(c, errorInfo)
+			return
+		}
+		lgLogger.WithContext(c).Error("拉取文件，创建任务失败", zap.Any("err", err.Error()))
+		web.InternalError(c, "内部异常")
+		return
+	}
+	web.Success(c, resp)
+}
+
+// FetchStatusHandler    查询拉取状态
+//
+//	@Summary      查询拉取状态
+//	@Description  查询拉取状态
+//	@Tags         拉取
+//	@Accept       application/json
+//	@Param        uid  query  string  true  "文件uid"
+//	@Produce      application/json
+//	@Success      200  {object}  web.Response{data=models.FetchStatusResp}
+//	@Router       /api/storage/v0/fetch/status [get]
+func FetchStatusHandler(c *gin.Context) {
+	uidStr := c.Query("uid")
+	uid, err := strconv.ParseInt(uidStr, 10, 64)
+	if err != nil {
+		web.ParamsError(c, "uid参数有误")
+		return
+	}
+
+	lgDB := new(plugins.LangGoDB).Use("default").NewDB()
+	metaData, err := repo.NewMetaDataInfoRepo().GetByUid(lgDB, uid)
+	if err != nil {
+		web.NotFoundResource(c, "uid不存在")
+		return
+	}
+	taskInfo, err := repo.NewTaskRepo().GetLatestByStorageUid(lgDB, uid, utils.TaskFetch)
+	if err != nil {
+		web.NotFoundResource(c, "当前uid不存在拉取任务")
+		return
+	}
+	resp := models.FetchStatusResp{
+		Uid:         uidStr,
+		Status:      metaData.Status,
+		TaskStatus:  taskInfo.Status,
+		ExecuteTime: taskInfo.ExecuteTime,
+	}
+	if taskInfo.TaskLogID != 0 {
+		if taskLog, err := repo.TaskLogRepo.GetByID(lgDB, int64(taskInfo.TaskLogID)); err == nil {
+			resp.ErrorInfo = taskLog.ErrorInfo
+		}
+	}
+	web.Success(c, resp)
+}
@@ -0,0 +1,57 @@
+package v0
+
+import (
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/qinguoyi/osproxy/app/pkg/base"
+	"github.com/qinguoyi/osproxy/app/pkg/repo"
+	"github.com/qinguoyi/osproxy/app/pkg/utils"
+	"github.com/qinguoyi/osproxy/app/pkg/web"
+	"github.com/qinguoyi/osproxy/bootstrap/plugins"
+	"go.uber.org/zap"
+	"strconv"
+)
+
+// DeleteFileHandler    删除文件
+//
+//	@Summary      删除文件
+//	@Description  删除上传完成的文件，已生成的下载链接立即失效，存储对象不再被其他文件引用时一并删除，并回调deleted事件
+//	@Tags         文件
+//	@Param        X-App-Key    header  string  false  "应用标识"
+//	@Param        X-App-Token  header  string  false  "应用令牌"
+//	@Param        uid          query   string  true   "文件uid"
+//	@Produce      application/json
+//	@Success      200  {object}  web.Response
+//	@Router       /api/storage/v0/file [delete]
+func DeleteFileHandler(c *gin.Context) {
+	uid, err := strconv.ParseInt(c.Query("uid"), 10, 64)
+	if err != nil {
+		web.ParamsError(c, "uid参数有误")
+		return
+	}
+	if !checkFileTenant(c, uid) {
+		return
+	}
+
+	lgDB := new(plugins.LangGoDB).Use("default").NewDB()
+	meta, err := repo.NewMetaDataInfoRepo().GetByUid(lgDB, uid)
+	if err != nil {
+		web.NotFoundResource(c, "文件不存在")
+		return
+	}
+	if !repo.CanTransition(meta.Status, utils.MetaStatusDeleted) {
+		web.ParamsError(c, fmt.Sprintf("当前文件状态[%s]不允许删除", repo.MetaStatusName(meta.Status)))
+		return
+	}
+	if err := base.DeleteFile(lgDB, meta); err != nil {
+		if errors.Is(err, repo.ErrStatusTransition) {
+			web.Conflict(c, "文件状态已变化，请稍后重试")
+			return
+		}
+		lgLogger.WithContext(c).Error("删除文件失败", zap.Any("err", err.Error()))
+		web.InternalError(c, "内部异常")
+		return
+	}
+	web.Success(c, "")
+}
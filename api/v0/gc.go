@@ -0,0 +1,39 @@
+package v0
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/gin-gonic/gin"
+	"github.com/qinguoyi/osproxy/app/models"
+	"github.com/qinguoyi/osproxy/app/pkg/utils"
+	"github.com/qinguoyi/osproxy/app/pkg/web"
+	"github.com/qinguoyi/osproxy/bootstrap/plugins"
+)
+
+// GcReportHandler    回收报告
+//
+//	@Summary      回收报告
+//	@Description  查询各节点最近一次过期上传会话回收结果
+//	@Tags         回收
+//	@Accept       application/json
+//	@Produce      application/json
+//	@Success      200  {object}  web.Response{data=[]models.GcReport}
+//	@Router       /api/storage/v0/gc/report [get]
+func GcReportHandler(c *gin.Context) {
+	lgRedis := new(plugins.LangGoRedis).NewRedis()
+	reports, err := lgRedis.HGetAll(context.Background(), utils.GcRedisReport).Result()
+	if err != nil {
+		lgLogger.WithContext(c).Error("查询回收报告失败")
+		web.InternalError(c, "内部异常")
+		return
+	}
+	resp := make([]models.GcReport, 0, len(reports))
+	for _, v := range reports {
+		var report models.GcReport
+		if err := json.Unmarshal([]byte(v), &report); err != nil {
+			continue
+		}
+		resp = append(resp, report)
+	}
+	web.Success(c, resp)
+}
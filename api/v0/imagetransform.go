@@ -0,0 +1,113 @@
+package v0
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/qinguoyi/osproxy/app/models"
+	"github.com/qinguoyi/osproxy/app/pkg/base"
+	"github.com/qinguoyi/osproxy/app/pkg/repo"
+	"github.com/qinguoyi/osproxy/bootstrap"
+	"github.com/qinguoyi/osproxy/bootstrap/plugins"
+	"gorm.io/gorm"
+	"strconv"
+	"time"
+)
+
+/*
+下载时的图片处理，处理结果按uid及参数缓存到存储，原图md5变化时重新生成
+*/
+
+// getImageDerivative 获取图片处理结果的元数据，不存在或已失效时生成，参数与原图不匹配时返回errorInfo
+func getImageDerivative(meta *models.MetaDataInfo, t *base.ImageTransform) (*models.MetaDataInfo, string, error) {
+	conf := bootstrap.NewConfig("").Image
+	if !conf.Enabled {
+		return nil, "未启用图片处理", nil
+	}
+	if !base.IsTransformable(meta.ContentType) {
+		return nil, "当前文件不支持图片处理", nil
+	}
+	if conf.MaxSource > 0 && meta.StorageSize > conf.MaxSource*1024*1024 {
+		return nil, "原图大小超过处理上限", nil
+	}
+
+	lgDB := new(plugins.LangGoDB).Use("default").NewDB()
+	params := t.Key()
+	derivative, err := findImageDerivative(lgDB, meta, params)
+	if err != nil || derivative != nil {
+		return derivative, "", err
+	}
+
+	// 同一处理结果只生成一次，其他请求等待生成完成
+	ctx := context.Background()
+	lgRedis := new(plugins.LangGoRedis).NewRedis()
+	lock := base.NewRedisLock(&ctx, lgRedis, fmt.Sprintf("image-derivative-%s", t.StorageName(meta.UID, "")))
+	lock.SetExpire(60)
+	locked, _ := lock.Acquire()
+	if locked {
+		defer func() {
+			_, _ = lock.Release()
+		}()
+	} else {
+		for i := 0; i < 20; i++ {
+			time.Sleep(500 * time.Millisecond)
+			derivative, err := findImageDerivative(lgDB, meta, params)
+			if err != nil || derivative != nil {
+				return derivative, "", err
+			}
+		}
+	}
+
+	var parts []models.MultiPartInfo
+	if meta.MultiPart {
+		if parts, err = getDownloadParts(strconv.FormatInt(meta.UID, 10), meta.UID); err != nil {
+			return nil, "", err
+		}
+	}
+	var buf bytes.Buffer
+	if err := copyObjectRange(&buf, meta, parts, 0, meta.StorageSize); err != nil {
+		return nil, "", err
+	}
+	result, err := base.TransformImage(buf.Bytes(), t, conf.MaxPixels*10000)
+	if err != nil {
+		return nil, err.Error(), nil
+	}
+
+	item, err := base.SaveImageDerivative(lgDB, meta, params, result, conf.Bucket, t.StorageName(meta.UID, result.Format))
+	if err != nil {
+		return nil, "", err
+	}
+	return derivativeMeta(meta, item), "", nil
+}
+
+// findImageDerivative 查询有效的处理结果，不存在或原图已变化时返回nil
+func findImageDerivative(db *gorm.DB, meta *models.MetaDataInfo, params string) (*models.MetaDataInfo, error) {
+	derivative, err := repo.NewImageDerivativeRepo().GetByUidParams(db, meta.UID, params)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if derivative.SourceMd5 != meta.Md5 {
+		return nil, nil
+	}
+	return derivativeMeta(meta, derivative), nil
+}
+
+// derivativeMeta 以处理结果替换原图的存储信息，其余字段沿用原图
+func derivativeMeta(meta *models.MetaDataInfo, item *models.ImageDerivative) *models.MetaDataInfo {
+	ret := *meta
+	ret.Bucket = item.Bucket
+	ret.StorageName = item.StorageName
+	ret.StorageSize = item.StorageSize
+	ret.ContentType = item.ContentType
+	ret.Md5 = item.Md5
+	ret.Width = item.Width
+	ret.Height = item.Height
+	ret.MultiPart = false
+	ret.PartNum = 0
+	ret.UpdatedAt = item.UpdatedAt
+	return &ret
+}
@@ -3,6 +3,7 @@ package v0
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/gin-gonic/gin"
 	"github.com/go-redis/redis/v8"
@@ -11,12 +12,17 @@ import (
 	"github.com/qinguoyi/osproxy/app/pkg/repo"
 	"github.com/qinguoyi/osproxy/app/pkg/utils"
 	"github.com/qinguoyi/osproxy/app/pkg/web"
+	"github.com/qinguoyi/osproxy/bootstrap"
 	"github.com/qinguoyi/osproxy/bootstrap/plugins"
 	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"net/url"
 	"os"
 	"path"
 	"strconv"
+	"strings"
 	"sync"
+	"time"
 )
 
 /*
@@ -39,29 +45,160 @@ func UploadLinkHandler(c *gin.Context) {
 		web.ParamsError(c, fmt.Sprintf("参数解析有误，详情：%s", err))
 		return
 	}
-	if len(genUploadReq.FilePath) > utils.LinkLimit {
+	if len(genUploadReq.FilePath)+len(genUploadReq.Files) == 0 {
+		web.ParamsError(c, "filePath和files不能同时为空")
+		return
+	}
+	if len(genUploadReq.FilePath)+len(genUploadReq.Files) > utils.LinkLimit {
 		web.ParamsError(c, fmt.Sprintf("批量上传路径数量有限，最多%d条", utils.LinkLimit))
 		return
 	}
 
 	// deduplication filepath
-	fileNameList := utils.RemoveDuplicates(genUploadReq.FilePath)
-	for _, fileName := range fileNameList {
-		if base.GetExtension(fileName) == "" {
-			web.ParamsError(c, fmt.Sprintf("文件[%s]后缀有误，不能为空", fileName))
+	var fileNameList []models.UploadFile
+	pathSet := map[string]bool{}
+	for _, fileName := range genUploadReq.FilePath {
+		if !pathSet[fileName] {
+			pathSet[fileName] = true
+			fileNameList = append(fileNameList, models.UploadFile{Path: fileName})
+		}
+	}
+	for _, file := range genUploadReq.Files {
+		if !pathSet[file.Path] {
+			pathSet[file.Path] = true
+			fileNameList = append(fileNameList, file)
+		}
+	}
+	if errorInfo := checkUploadFiles(fileNameList, genUploadReq.PartSize); errorInfo != "" {
+		web.ParamsError(c, errorInfo)
+		return
+	}
+	if genUploadReq.Rate < 0 {
+		web.ParamsError(c, "rate参数有误")
+		return
+	}
+	if err := base.CheckCallback(genUploadReq.Callback); err != nil {
+		web.ParamsError(c, err.Error())
+		return
+	}
+
+	tenant := c.GetString(utils.ContextTenant)
+	lgDB := new(plugins.LangGoDB).Use("default").NewDB()
+	if !checkQuota(c, lgDB, tenant, sumUploadSize(fileNameList), int64(len(fileNameList))) {
+		return
+	}
+	resp, resourceInfo, err := genUploadLinks(fileNameList, genUploadReq.PartSize, genUploadReq.Expire,
+		genUploadReq.Rate, tenant, genUploadReq.Callback)
+	if err != nil {
+		lgLogger.WithContext(c).Error("生成链接，生成的url和输入数量不一致")
+		web.InternalError(c, "内部异常")
+		return
+	}
+
+	// db batch create
+	metadata, tags := userMetaOfLinks(resp, fileNameList)
+	var errorInfo string
+	if err := lgDB.Transaction(func(tx *gorm.DB) error {
+		info, err := base.ReserveQuota(tx, tenant, resourceInfo)
+		if err != nil {
+			return err
+		}
+		if info != "" {
+			errorInfo = info
+			return errors.New(info)
+		}
+		if err := repo.NewMetaDataInfoRepo().BatchCreate(tx, &resourceInfo); err != nil {
+			return err
+		}
+		return repo.NewUserMetaRepo().BatchCreate(tx, metadata, tags)
+	}); err != nil {
+		if errorInfo != "" {
+			web.Forbidden(c, errorInfo)
 			return
 		}
+		lgLogger.WithContext(c).Error("生成链接，批量落数据库失败，详情：", zap.Any("err", err.Error()))
+		web.InternalError(c, "内部异常")
+		return
 	}
+	web.Success(c, resp)
+}
 
+// sumUploadSize 声明的文件总大小，未声明大小的文件不计入
+func sumUploadSize(files []models.UploadFile) int64 {
+	var size int64
+	for _, file := range files {
+		size += file.Size
+	}
+	return size
+}
+
+// checkQuota 校验租户配额，未通过时写入响应并返回false
+func checkQuota(c *gin.Context, lgDB *gorm.DB, tenant string, size, files int64) bool {
+	errorInfo, err := base.CheckQuota(lgDB, tenant, size, files)
+	if err != nil {
+		lgLogger.WithContext(c).Error("查询租户用量失败", zap.Any("err", err.Error()))
+		web.InternalError(c, "内部异常")
+		return false
+	}
+	if errorInfo != "" {
+		web.Forbidden(c, errorInfo)
+		return false
+	}
+	return true
+}
+
+// checkUploadFiles 校验待上传文件，返回错误信息
+func checkUploadFiles(files []models.UploadFile, partSize int64) string {
+	for _, file := range files {
+		if base.GetExtension(file.Path) == "" {
+			return fmt.Sprintf("文件[%s]后缀有误，不能为空", file.Path)
+		}
+		if file.Size < 0 {
+			return fmt.Sprintf("文件[%s]大小有误", file.Path)
+		}
+		if err := base.CheckUserMeta(file.Metadata, file.Tags); err != nil {
+			return fmt.Sprintf("文件[%s]%s", file.Path, err.Error())
+		}
+		if file.Size > 0 {
+			if _, _, err := base.CalcUploadPlan(file.Size, partSize, bootstrap.NewConfig("").Upload); err != nil {
+				return fmt.Sprintf("文件[%s]%s", file.Path, err.Error())
+			}
+		}
+	}
+	return ""
+}
+
+// userMetaOfLinks 按路径对应生成链接的文件和请求中的自定义元数据及标签
+func userMetaOfLinks(resp []models.GenUploadResp, files []models.UploadFile) (
+	[]models.FileMetadata, []models.FileTag) {
+	pathMapFile := map[string]models.UploadFile{}
+	for _, file := range files {
+		pathMapFile[file.Path] = file
+	}
+	var metadata []models.FileMetadata
+	var tags []models.FileTag
+	for _, i := range resp {
+		file := pathMapFile[i.Path]
+		uid, _ := strconv.ParseInt(i.Uid, 10, 64)
+		metaRows, tagRows := base.UserMetaRows(uid, file.Metadata, file.Tags)
+		metadata = append(metadata, metaRows...)
+		tags = append(tags, tagRows...)
+	}
+	return metadata, tags
+}
+
+// genUploadLinks 并发生成上传链接及元数据，部分失败时清理本地目录
+func genUploadLinks(files []models.UploadFile, partSize int64, expire int, rate int64, tenant, callback string) (
+	[]models.GenUploadResp, []models.MetaDataInfo, error) {
 	var resp []models.GenUploadResp
 	var resourceInfo []models.MetaDataInfo
-	respChan := make(chan models.GenUploadResp, len(fileNameList))
-	metaDataInfoChan := make(chan models.MetaDataInfo, len(fileNameList))
+	respChan := make(chan models.GenUploadResp, len(files))
+	metaDataInfoChan := make(chan models.MetaDataInfo, len(files))
 
 	var wg sync.WaitGroup
-	for _, fileName := range fileNameList {
+	for _, file := range files {
 		wg.Add(1)
-		go base.GenUploadSingle(fileName, genUploadReq.Expire, respChan, metaDataInfoChan, &wg)
+		go base.GenUploadSingle(file, partSize, expire, rate, tenant, callback, respChan, metaDataInfoChan, &wg)
 	}
 	wg.Wait()
 	close(respChan)
@@ -73,7 +210,7 @@ func UploadLinkHandler(c *gin.Context) {
 	for re := range metaDataInfoChan {
 		resourceInfo = append(resourceInfo, re)
 	}
-	if !(len(resp) == len(resourceInfo) && len(resp) == len(fileNameList)) {
+	if !(len(resp) == len(resourceInfo) && len(resp) == len(files)) {
 		// clean local dir
 		for _, i := range resp {
 			dirName := path.Join(utils.LocalStore, i.Uid)
@@ -81,19 +218,9 @@ func UploadLinkHandler(c *gin.Context) {
 				_ = os.RemoveAll(dirName)
 			}()
 		}
-		lgLogger.WithContext(c).Error("生成链接，生成的url和输入数量不一致")
-		web.InternalError(c, "内部异常")
-		return
-	}
-
-	// db batch create
-	lgDB := new(plugins.LangGoDB).Use("default").NewDB()
-	if err := repo.NewMetaDataInfoRepo().BatchCreate(lgDB, &resourceInfo); err != nil {
-		lgLogger.WithContext(c).Error("生成链接，批量落数据库失败，详情：", zap.Any("err", err.Error()))
-		web.InternalError(c, "内部异常")
-		return
+		return nil, nil, errors.New("生成的url和输入数量不一致")
 	}
-	web.Success(c, resp)
+	return resp, resourceInfo, nil
 }
 
 // DownloadLinkHandler    获取下载连接
@@ -118,6 +245,11 @@ func DownloadLinkHandler(c *gin.Context) {
 		return
 	}
 	expireStr := fmt.Sprintf("%d", genDownloadReq.Expire)
+	extra, errorInfo := downloadLinkExtra(genDownloadReq)
+	if errorInfo != "" {
+		web.ParamsError(c, errorInfo)
+		return
+	}
 	var uidList []int64
 	var resp []models.GenDownloadResp
 	for _, uidStr := range utils.RemoveDuplicates(genDownloadReq.Uid) {
@@ -127,8 +259,13 @@ func DownloadLinkHandler(c *gin.Context) {
 			return
 		}
 
+		// 限次链接每次单独生成，不走缓存
+		if genDownloadReq.MaxDownloads > 0 {
+			uidList = append(uidList, uid)
+			continue
+		}
 		// 查询redis
-		key := fmt.Sprintf("%d-%s", uid, expireStr)
+		key := base.DownloadCacheKey(uid, expireStr, extra)
 		lgRedis := new(plugins.LangGoRedis).NewRedis()
 		val, err := lgRedis.Get(context.Background(), key).Result()
 		// key在redis中不存在
@@ -162,15 +299,74 @@ func DownloadLinkHandler(c *gin.Context) {
 		return
 	}
 	uidMapMeta := map[int64]models.MetaDataInfo{}
+	var batchUidList []int64
 	for _, meta := range metaList {
 		uidMapMeta[meta.UID] = meta
+		if meta.BatchUid != 0 {
+			batchUidList = append(batchUidList, meta.BatchUid)
+		}
+	}
+	committed, err := repo.NewUploadBatchRepo().GetCommitted(lgDB, batchUidList)
+	if err != nil {
+		lgLogger.WithContext(c).Error("获取下载链接，查询批次信息失败")
+		web.InternalError(c, "内部异常")
+		return
+	}
+
+	// 每个链接生成链接ID，限次及可撤销的链接落库，用于限制下载次数及撤销
+	track := extra.Get(utils.LinkParamTrack) != ""
+	var metaToLink []models.MetaDataInfo
+	var linkIds []int64
+	var links []models.DownloadLink
+	now := time.Now()
+	expireAt := now.Add(time.Duration(genDownloadReq.Expire) * time.Second)
+	for _, uid := range uidList {
+		// 不存在、不可下载或所属批次未提交的文件不生成链接
+		meta, ok := uidMapMeta[uid]
+		if !ok || !repo.IsDownloadable(meta.Status, bootstrap.NewConfig("").Scan.Enabled) || (meta.BatchUid != 0 && !committed[meta.BatchUid]) {
+			continue
+		}
+		linkId, err := base.NewSnowFlake().NextId()
+		if err != nil {
+			lgLogger.WithContext(c).Error("获取下载链接，生成链接ID失败")
+			web.InternalError(c, "内部异常")
+			return
+		}
+		metaToLink = append(metaToLink, meta)
+		linkIds = append(linkIds, linkId)
+		if !track {
+			continue
+		}
+		links = append(links, models.DownloadLink{
+			LinkId:       linkId,
+			UID:          uid,
+			Tenant:       meta.Tenant,
+			MaxDownloads: genDownloadReq.MaxDownloads,
+			ExpireAt:     &expireAt,
+			CreatedAt:    &now,
+			UpdatedAt:    &now,
+		})
+	}
+	if err := repo.NewDownloadLinkRepo().BatchCreate(lgDB, &links); err != nil {
+		lgLogger.WithContext(c).Error("获取下载链接，保存链接信息失败", zap.Any("err", err.Error()))
+		web.InternalError(c, "内部异常")
+		return
 	}
 
 	respChan := make(chan models.GenDownloadResp, len(metaList))
 	var wg sync.WaitGroup
-	for _, uid := range uidList {
+	for i, meta := range metaToLink {
+		cacheKey := base.DownloadCacheKey(meta.UID, expireStr, extra)
+		if genDownloadReq.MaxDownloads > 0 {
+			cacheKey = ""
+		}
+		linkExtra := url.Values{}
+		for k, v := range extra {
+			linkExtra[k] = v
+		}
+		linkExtra.Set(utils.LinkParamId, strconv.FormatInt(linkIds[i], 10))
 		wg.Add(1)
-		go base.GenDownloadSingle(uidMapMeta[uid], expireStr, respChan, &wg)
+		go base.GenDownloadSingle(meta, expireStr, linkExtra, cacheKey, respChan, &wg)
 	}
 	wg.Wait()
 	close(respChan)
@@ -178,6 +374,118 @@ func DownloadLinkHandler(c *gin.Context) {
 	for re := range respChan {
 		resp = append(resp, re)
 	}
+
+	// 自定义元数据可随时更新，不走缓存
+	var respUidList []int64
+	for _, i := range resp {
+		uid, _ := strconv.ParseInt(i.Uid, 10, 64)
+		respUidList = append(respUidList, uid)
+	}
+	userMeta, err := base.GetUserMeta(lgDB, respUidList)
+	if err != nil {
+		lgLogger.WithContext(c).Error("获取下载链接，查询自定义元数据失败")
+		web.InternalError(c, "内部异常")
+		return
+	}
+	for i := range resp {
+		uid, _ := strconv.ParseInt(resp[i].Uid, 10, 64)
+		if item, ok := userMeta[uid]; ok {
+			resp[i].Meta.Metadata = item.Metadata
+			resp[i].Meta.Tags = item.Tags
+		}
+	}
 	web.Success(c, resp)
 	return
 }
+
+// PolicyLinkHandler    获取表单上传策略
+//
+//	@Summary      获取表单上传策略
+//	@Description  生成浏览器表单直传使用的签名策略
+//	@Tags         链接
+//	@Accept       application/json
+//	@Param        RequestBody  body  models.GenPolicy  true  "表单上传策略请求体"
+//	@Produce      application/json
+//	@Success      200  {object}  web.Response{data=models.GenPolicyResp}
+//	@Router       /api/storage/v0/link/policy [post]
+func PolicyLinkHandler(c *gin.Context) {
+	var genPolicyReq models.GenPolicy
+	if err := c.ShouldBindJSON(&genPolicyReq); err != nil {
+		web.ParamsError(c, fmt.Sprintf("参数解析有误，详情：%s", err))
+		return
+	}
+	if genPolicyReq.MaxSize > formMaxSize() {
+		web.ParamsError(c, fmt.Sprintf("maxSize超过表单上传的大小上限%d", formMaxSize()))
+		return
+	}
+	resp, err := base.GenPostPolicy(&genPolicyReq, c.GetString(utils.ContextTenant), time.Now())
+	if err != nil {
+		web.ParamsError(c, err.Error())
+		return
+	}
+	web.Success(c, resp)
+}
+
+// downloadLinkExtra 下载链接中参与签名的附加参数
+func downloadLinkExtra(req models.GenDownload) (url.Values, string) {
+	extra := url.Values{}
+	if req.Rate < 0 {
+		return nil, "rate参数有误"
+	}
+	if req.MaxDownloads < 0 {
+		return nil, "maxDownloads参数有误"
+	}
+	if err := base.CheckLinkBindingParams(req.Ip, req.Referer, req.Header); err != nil {
+		return nil, err.Error()
+	}
+	if req.Rate > 0 {
+		extra.Set(utils.LinkParamRate, strconv.FormatInt(req.Rate, 10))
+	}
+	if len(req.Ip) > 0 {
+		extra.Set(utils.LinkParamIp, strings.Join(req.Ip, ","))
+	}
+	if len(req.Referer) > 0 {
+		extra.Set(utils.LinkParamReferer, strings.Join(req.Referer, ","))
+	}
+	if req.Header != "" {
+		extra.Set(utils.LinkParamHeader, req.Header)
+	}
+	// 限次及可撤销的链接信息落库，其余链接只校验签名
+	if req.MaxDownloads > 0 || req.Revocable {
+		extra.Set(utils.LinkParamTrack, "1")
+	}
+	if req.Image != nil {
+		imageConf := bootstrap.NewConfig("").Image
+		if !imageConf.Enabled {
+			return nil, "未启用图片处理"
+		}
+		// 图片处理结果不计入下载次数
+		if req.MaxDownloads > 0 {
+			return nil, "限次链接不支持图片处理"
+		}
+		query := url.Values{}
+		for key, value := range map[string]int{
+			utils.LinkParamWidth:   req.Image.Width,
+			utils.LinkParamHeight:  req.Image.Height,
+			utils.LinkParamQuality: req.Image.Quality,
+		} {
+			if value != 0 {
+				query.Set(key, strconv.Itoa(value))
+			}
+		}
+		query.Set(utils.LinkParamFit, req.Image.Fit)
+		query.Set(utils.LinkParamCrop, req.Image.Crop)
+		query.Set(utils.LinkParamFormat, req.Image.Format)
+		transform, err := base.ParseImageTransform(query, imageConf.MaxSize)
+		if err != nil {
+			return nil, err.Error()
+		}
+		// 使用规范化后的参数，等效的处理参数生成相同的链接及缓存
+		if transform != nil {
+			for key, value := range transform.Values() {
+				extra[key] = value
+			}
+		}
+	}
+	return extra, ""
+}
@@ -0,0 +1,134 @@
+package v0
+
+import (
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/qinguoyi/osproxy/app/models"
+	"github.com/qinguoyi/osproxy/app/pkg/base"
+	"github.com/qinguoyi/osproxy/app/pkg/repo"
+	"github.com/qinguoyi/osproxy/app/pkg/utils"
+	"github.com/qinguoyi/osproxy/app/pkg/web"
+	"github.com/qinguoyi/osproxy/bootstrap/plugins"
+	"go.uber.org/zap"
+	"strconv"
+	"time"
+)
+
+/*
+下载链接管理
+*/
+
+// checkFileTenant 校验文件属于鉴权通过的应用，不满足时直接写入响应
+func checkFileTenant(c *gin.Context, uid int64) bool {
+	lgDB := new(plugins.LangGoDB).Use("default").NewDB()
+	meta, err := repo.NewMetaDataInfoRepo().GetByUid(lgDB, uid)
+	if err != nil {
+		web.NotFoundResource(c, "文件不存在")
+		return false
+	}
+	if meta.Tenant != c.GetString(utils.ContextTenant) {
+		web.Forbidden(c, "无权操作该文件")
+		return false
+	}
+	return true
+}
+
+// checkFileExists 校验文件存在，不满足时直接写入响应
+func checkFileExists(c *gin.Context, uid int64) bool {
+	lgDB := new(plugins.LangGoDB).Use("default").NewDB()
+	if _, err := repo.NewMetaDataInfoRepo().GetByUid(lgDB, uid); err != nil {
+		web.NotFoundResource(c, "文件不存在")
+		return false
+	}
+	return true
+}
+
+// RevokeLinkHandler    撤销下载链接
+//
+//	@Summary      撤销下载链接
+//	@Description  撤销单个下载链接，或传uid撤销该文件的所有下载链接(含未落库的链接)，撤销后立即失效，需管理令牌
+//	@Tags         链接
+//	@Accept       application/json
+//	@Param        X-Admin-Token  header  string             true  "管理令牌"
+//	@Param        RequestBody    body    models.RevokeLink  true  "撤销下载链接请求体"
+//	@Produce      application/json
+//	@Success      200  {object}  web.Response{data=models.RevokeLinkResp}
+//	@Router       /api/storage/v0/link/revoke [post]
+func RevokeLinkHandler(c *gin.Context) {
+	var req models.RevokeLink
+	if err := c.ShouldBindJSON(&req); err != nil {
+		web.ParamsError(c, fmt.Sprintf("参数解析有误，详情：%s", err))
+		return
+	}
+	if req.LinkId == "" && req.Uid == "" {
+		web.ParamsError(c, "linkId和uid不能同时为空")
+		return
+	}
+
+	var uid, linkId int64
+	var err error
+	if req.LinkId != "" {
+		if linkId, err = strconv.ParseInt(req.LinkId, 10, 64); err != nil {
+			web.ParamsError(c, "linkId参数有误")
+			return
+		}
+		lgDB := new(plugins.LangGoDB).Use("default").NewDB()
+		link, err := repo.NewDownloadLinkRepo().GetByLinkId(lgDB, linkId)
+		if err != nil {
+			web.NotFoundResource(c, "链接不存在")
+			return
+		}
+		uid = link.UID
+	} else if uid, err = strconv.ParseInt(req.Uid, 10, 64); err != nil {
+		web.ParamsError(c, "uid参数有误")
+		return
+	}
+	if !checkFileExists(c, uid) {
+		return
+	}
+
+	count, err := base.RevokeDownloadLinks(uid, linkId)
+	if err != nil {
+		lgLogger.WithContext(c).Error("撤销下载链接失败", zap.Any("err", err.Error()))
+		web.InternalError(c, "内部异常")
+		return
+	}
+	web.Success(c, models.RevokeLinkResp{Revoked: count})
+}
+
+// ActiveLinkHandler    有效的下载链接
+//
+//	@Summary      有效的下载链接
+//	@Description  查询文件未撤销且未过期的下载链接及下载次数，需管理令牌
+//	@Tags         链接
+//	@Accept       application/json
+//	@Param        X-Admin-Token  header  string  true  "管理令牌"
+//	@Param        uid            query   string  true  "文件uid"
+//	@Produce      application/json
+//	@Success      200  {object}  web.Response{data=[]models.DownloadLink}
+//	@Router       /api/storage/v0/link/active [get]
+func ActiveLinkHandler(c *gin.Context) {
+	uid, err := strconv.ParseInt(c.Query("uid"), 10, 64)
+	if err != nil {
+		web.ParamsError(c, "uid参数有误")
+		return
+	}
+	if !checkFileExists(c, uid) {
+		return
+	}
+
+	lgDB := new(plugins.LangGoDB).Use("default").NewDB()
+	links, err := repo.NewDownloadLinkRepo().GetActiveByUid(lgDB, uid, time.Now())
+	if err != nil {
+		lgLogger.WithContext(c).Error("查询下载链接失败", zap.Any("err", err.Error()))
+		web.InternalError(c, "内部异常")
+		return
+	}
+	// 下载次数以redis计数为准
+	for i := range links {
+		if links[i].MaxDownloads > 0 {
+			links[i].Downloads = base.GetDownloadCount(&links[i])
+		}
+	}
+	web.Success(c, links)
+}
@@ -0,0 +1,32 @@
+package v0
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/qinguoyi/osproxy/app/pkg/base"
+	"github.com/qinguoyi/osproxy/app/pkg/utils"
+	"github.com/qinguoyi/osproxy/app/pkg/web"
+	"github.com/qinguoyi/osproxy/bootstrap/plugins"
+	"go.uber.org/zap"
+)
+
+// QuotaHandler    租户配额
+//
+//	@Summary      租户配额
+//	@Description  查询当前应用的存储配额及用量，秒传共用存储对象的文件不计容量
+//	@Tags         配额
+//	@Accept       application/json
+//	@Param        X-App-Key    header  string  false  "应用标识"
+//	@Param        X-App-Token  header  string  false  "应用令牌"
+//	@Produce      application/json
+//	@Success      200  {object}  web.Response{data=models.QuotaResp}
+//	@Router       /api/storage/v0/quota [get]
+func QuotaHandler(c *gin.Context) {
+	lgDB := new(plugins.LangGoDB).Use("default").NewDB()
+	quota, err := base.GetQuota(lgDB, c.GetString(utils.ContextTenant))
+	if err != nil {
+		lgLogger.WithContext(c).Error("查询租户用量失败", zap.Any("err", err.Error()))
+		web.InternalError(c, "内部异常")
+		return
+	}
+	web.Success(c, quota)
+}
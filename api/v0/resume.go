@@ -74,6 +74,7 @@ func ResumeHandler(c *gin.Context) {
 		}
 	}
 
+	tenant := c.GetString(utils.ContextTenant)
 	var newMetaDataList []models.MetaDataInfo
 	for _, resume := range resumeReq.Data {
 		if _, ok := md5MapMetaInfo[resume.Md5]; !ok {
@@ -92,13 +93,18 @@ func ResumeHandler(c *gin.Context) {
 				Md5:         resume.Md5,
 				MultiPart:   false,
 				StorageSize: md5MapMetaInfo[resume.Md5].StorageSize,
-				Status:      1,
+				Status:      utils.MetaStatusAvailable,
 				ContentType: md5MapMetaInfo[resume.Md5].ContentType,
+				Tenant:      tenant,
 				CreatedAt:   &now,
 				UpdatedAt:   &now,
 			})
 		md5MapResp[resume.Md5].Uid = fmt.Sprintf("%d", uid)
 	}
+	// 秒传不占用存储容量，只校验文件数量
+	if len(newMetaDataList) != 0 && !checkQuota(c, lgDB, tenant, 0, int64(len(newMetaDataList))) {
+		return
+	}
 	if len(newMetaDataList) != 0 {
 		if err := repo.NewMetaDataInfoRepo().BatchCreate(lgDB, &newMetaDataList); err != nil {
 			lgLogger.WithContext(c).Error("秒传批量落数据库失败，详情：", zap.Any("err", err.Error()))
@@ -113,6 +119,9 @@ func ResumeHandler(c *gin.Context) {
 			lgLogger.WithContext(c).Warn("秒传数据，写入redis失败")
 		}
 		lgRedis.SetNX(context.Background(), fmt.Sprintf("%d-meta", metaDataCache.UID), b, 5*60*time.Second)
+		if err := base.AfterUpload(lgDB, &metaDataCache, utils.EventUploaded); err != nil {
+			lgLogger.WithContext(c).Warn("秒传数据，创建后置任务失败", zap.Any("err", err.Error()))
+		}
 	}
 
 	var respList []models.ResumeResp
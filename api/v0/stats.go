@@ -0,0 +1,149 @@
+package v0
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/qinguoyi/osproxy/app/models"
+	"github.com/qinguoyi/osproxy/app/pkg/analytics"
+	"github.com/qinguoyi/osproxy/app/pkg/repo"
+	"github.com/qinguoyi/osproxy/app/pkg/utils"
+	"github.com/qinguoyi/osproxy/app/pkg/web"
+	"github.com/qinguoyi/osproxy/bootstrap"
+	"github.com/qinguoyi/osproxy/bootstrap/plugins"
+	"go.uber.org/zap"
+	"strconv"
+	"time"
+)
+
+/*
+下载统计查询，统计数据定时写入数据库，最近一个写入周期内的下载暂未计入
+*/
+
+const statTopLimit = 10
+
+// parseStatRange 解析统计的时间范围及粒度，参数有误时返回false
+func parseStatRange(c *gin.Context) (time.Time, time.Time, string, bool) {
+	start, end, interval, err := analytics.ParseStatRange(c.Query("start"), c.Query("end"), c.Query("interval"),
+		bootstrap.NewConfig("").Analytics.MaxRange, time.Now())
+	if err != nil {
+		web.ParamsError(c, err.Error())
+		return start, end, interval, false
+	}
+	return start, end, interval, true
+}
+
+// FileStatsHandler    文件下载统计
+//
+//	@Summary      文件下载统计
+//	@Description  查询文件在时间范围内的下载次数、Range请求次数、发送字节数、失败次数及客户端数量
+//	@Tags         统计
+//	@Accept       application/json
+//	@Param        X-App-Key    header  string  false  "应用标识"
+//	@Param        X-App-Token  header  string  false  "应用令牌"
+//	@Param        uid          query   string  true   "文件uid"
+//	@Param        lid          query   string  false  "链接ID，为空时统计所有链接"
+//	@Param        start        query   string  false  "开始时间，格式2006-01-02 15:04:05，默认结束时间前24小时"
+//	@Param        end          query   string  false  "结束时间，格式2006-01-02 15:04:05，默认当前时间"
+//	@Param        interval     query   string  false  "统计粒度hour(默认)、day"
+//	@Produce      application/json
+//	@Success      200  {object}  web.Response{data=models.DownloadStatResp}
+//	@Router       /api/storage/v0/stats/file [get]
+func FileStatsHandler(c *gin.Context) {
+	uid, err := strconv.ParseInt(c.Query("uid"), 10, 64)
+	if err != nil {
+		web.ParamsError(c, "uid参数有误")
+		return
+	}
+	var linkId int64
+	if lid := c.Query(utils.LinkParamId); lid != "" {
+		if linkId, err = strconv.ParseInt(lid, 10, 64); err != nil {
+			web.ParamsError(c, "lid参数有误")
+			return
+		}
+	}
+	start, end, interval, ok := parseStatRange(c)
+	if !ok {
+		return
+	}
+	if !checkFileTenant(c, uid) {
+		return
+	}
+
+	lgDB := new(plugins.LangGoDB).Use("default").NewDB()
+	stats, err := repo.NewDownloadStatRepo().GetByUid(lgDB, uid, start, end)
+	if err != nil {
+		lgLogger.WithContext(c).Error("查询文件下载统计失败", zap.Any("err", err.Error()))
+		web.InternalError(c, "内部异常")
+		return
+	}
+	var rows []analytics.StatRow
+	for _, stat := range stats {
+		if linkId == 0 || stat.LinkId == linkId {
+			rows = append(rows, analytics.StatRow{Hour: stat.Hour, Metrics: stat.DownloadMetrics})
+		}
+	}
+	series, total := analytics.Series(rows, start, end, interval)
+	web.Success(c, models.DownloadStatResp{
+		Start:    start.Format("2006-01-02 15:04:05"),
+		End:      end.Format("2006-01-02 15:04:05"),
+		Interval: interval,
+		Total:    total,
+		Series:   series,
+	})
+}
+
+// TenantStatsHandler    租户下载统计
+//
+//	@Summary      租户下载统计
+//	@Description  查询当前应用在时间范围内的下载统计，及按发送字节数排序的前10个文件
+//	@Tags         统计
+//	@Accept       application/json
+//	@Param        X-App-Key    header  string  false  "应用标识"
+//	@Param        X-App-Token  header  string  false  "应用令牌"
+//	@Param        start        query   string  false  "开始时间，格式2006-01-02 15:04:05，默认结束时间前24小时"
+//	@Param        end          query   string  false  "结束时间，格式2006-01-02 15:04:05，默认当前时间"
+//	@Param        interval     query   string  false  "统计粒度hour(默认)、day"
+//	@Produce      application/json
+//	@Success      200  {object}  web.Response{data=models.DownloadStatResp}
+//	@Router       /api/storage/v0/stats/tenant [get]
+func TenantStatsHandler(c *gin.Context) {
+	start, end, interval, ok := parseStatRange(c)
+	if !ok {
+		return
+	}
+	tenant := c.GetString(utils.ContextTenant)
+
+	lgDB := new(plugins.LangGoDB).Use("default").NewDB()
+	stats, err := repo.NewDownloadStatRepo().GetByTenant(lgDB, tenant, start, end)
+	if err != nil {
+		lgLogger.WithContext(c).Error("查询租户下载统计失败", zap.Any("err", err.Error()))
+		web.InternalError(c, "内部异常")
+		return
+	}
+	top, err := repo.NewDownloadStatRepo().TopFiles(lgDB, tenant, start, end, statTopLimit)
+	if err != nil {
+		lgLogger.WithContext(c).Error("查询文件下载排行失败", zap.Any("err", err.Error()))
+		web.InternalError(c, "内部异常")
+		return
+	}
+	var rows []analytics.StatRow
+	for _, stat := range stats {
+		rows = append(rows, analytics.StatRow{Hour: stat.Hour, Metrics: stat.DownloadMetrics})
+	}
+	series, total := analytics.Series(rows, start, end, interval)
+	resp := models.DownloadStatResp{
+		Start:    start.Format("2006-01-02 15:04:05"),
+		End:      end.Format("2006-01-02 15:04:05"),
+		Interval: interval,
+		Total:    total,
+		Series:   series,
+		Top:      []models.FileDownloadStat{},
+	}
+	for _, item := range top {
+		resp.Top = append(resp.Top, models.FileDownloadStat{
+			Uid:      strconv.FormatInt(item.UID, 10),
+			Requests: item.Requests,
+			Bytes:    item.Bytes,
+		})
+	}
+	web.Success(c, resp)
+}
@@ -0,0 +1,202 @@
+package v0
+
+import (
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/qinguoyi/osproxy/app/models"
+	"github.com/qinguoyi/osproxy/app/pkg/base"
+	"github.com/qinguoyi/osproxy/app/pkg/repo"
+	"github.com/qinguoyi/osproxy/app/pkg/thirdparty"
+	"github.com/qinguoyi/osproxy/app/pkg/utils"
+	"github.com/qinguoyi/osproxy/app/pkg/web"
+	"github.com/qinguoyi/osproxy/bootstrap/plugins"
+	"gorm.io/gorm"
+	"net/url"
+	"os"
+	"path"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// UploadStatusHandler    上传会话状态
+//
+//	@Summary      上传会话状态
+//	@Description  查询上传会话状态，传入wait时阻塞直到状态不等于state或超时
+//	@Tags         断点续传
+//	@Accept       application/json
+//	@Param        uid    query  string  true   "文件uid"
+//	@Param        state  query  string  false  "客户端已知的状态"
+//	@Param        wait   query  int     false  "最长等待秒数，最大30"
+//	@Produce      application/json
+//	@Success      200  {object}  web.Response{data=models.UploadStatusResp}
+//	@Router       /api/storage/v0/status [get]
+func UploadStatusHandler(c *gin.Context) {
+	uidStr := c.Query("uid")
+	uid, err := strconv.ParseInt(uidStr, 10, 64)
+	if err != nil {
+		web.ParamsError(c, "uid参数有误")
+		return
+	}
+	wait := 0
+	if waitStr := c.Query("wait"); waitStr != "" {
+		wait, err = strconv.Atoi(waitStr)
+		if err != nil || wait < 0 {
+			web.ParamsError(c, "wait参数有误")
+			return
+		}
+		if wait > utils.StatusWaitLimit {
+			wait = utils.StatusWaitLimit
+		}
+	}
+	state := c.Query("state")
+
+	lgDB := new(plugins.LangGoDB).Use("default").NewDB()
+	resp, err := getUploadStatus(lgDB, uid)
+	if err != nil {
+		web.NotFoundResource(c, "uid不存在")
+		return
+	}
+
+	// 长轮询，状态变化、超时或客户端断开时返回
+	if wait > 0 && state != "" && resp.State == state {
+		ticker := time.NewTicker(500 * time.Millisecond)
+		defer ticker.Stop()
+		deadline := time.After(time.Duration(wait) * time.Second)
+	loop:
+		for {
+			select {
+			case <-ticker.C:
+				resp, err = getUploadStatus(lgDB, uid)
+				if err != nil {
+					web.NotFoundResource(c, "uid不存在")
+					return
+				}
+				if resp.State != state {
+					break loop
+				}
+			case <-deadline:
+				break loop
+			case <-c.Request.Context().Done():
+				return
+			}
+		}
+	}
+
+	// 数据仍暂存在节点上时，查询所在节点
+	if resp.State == utils.UploadStatePending || resp.State == utils.UploadStateReceiving ||
+		resp.State == utils.UploadStateMerging {
+		resp.Node = locateNode(uidStr)
+	}
+	web.Success(c, resp)
+}
+
+// getUploadStatus 汇总元数据、分片及合并任务得到会话状态
+func getUploadStatus(lgDB *gorm.DB, uid int64) (*models.UploadStatusResp, error) {
+	metaData, err := repo.NewMetaDataInfoRepo().GetByUid(lgDB, uid)
+	if err != nil {
+		return nil, err
+	}
+	name, err := url.PathUnescape(metaData.Name)
+	if err != nil {
+		name = metaData.Name
+	}
+	resp := &models.UploadStatusResp{
+		Uid:    fmt.Sprintf("%d", uid),
+		Status: metaData.Status,
+		Name:   name,
+		Parts:  []models.PartStatus{},
+	}
+
+	parts, err := repo.NewMultiPartInfoRepo().GetValidByUid(lgDB, uid)
+	if err != nil {
+		return nil, err
+	}
+	for _, part := range parts {
+		resp.Parts = append(resp.Parts, models.PartStatus{
+			Num:  part.ChunkNum,
+			Size: part.StorageSize,
+			Md5:  part.PartMd5,
+		})
+		resp.Received += part.StorageSize
+	}
+
+	taskInfo, err := repo.NewTaskRepo().GetLatestByStorageUid(lgDB, uid, utils.TaskPartMerge)
+	if err == nil {
+		resp.Merge = &models.MergeStatus{
+			TaskStatus:  taskInfo.Status,
+			ExecuteTime: taskInfo.ExecuteTime,
+			NodeId:      taskInfo.NodeId,
+		}
+		if taskInfo.TaskLogID != 0 {
+			if taskLog, err := repo.TaskLogRepo.GetByID(lgDB, int64(taskInfo.TaskLogID)); err == nil {
+				resp.Merge.ErrorInfo = taskLog.ErrorInfo
+			}
+		}
+	} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+
+	history, err := repo.NewMetaDataInfoRepo().GetStatusHistory(lgDB, uid)
+	if err != nil {
+		return nil, err
+	}
+	for _, h := range history {
+		resp.History = append(resp.History, models.StatusHistory{
+			From: repo.MetaStatusName(h.FromStatus),
+			To:   repo.MetaStatusName(h.ToStatus),
+			Time: h.CreatedAt.Format("2006-01-02 15:04:05"),
+		})
+	}
+
+	resp.State = repo.MetaStatusName(metaData.Status)
+	switch metaData.Status {
+	case utils.MetaStatusAvailable, utils.MetaStatusQuarantined, utils.MetaStatusInfected:
+		resp.Received = metaData.StorageSize
+		resp.Object = &models.ObjectInfo{
+			Bucket:      metaData.Bucket,
+			StorageName: metaData.StorageName,
+			Md5:         metaData.Md5,
+			Size:        metaData.StorageSize,
+			ContentType: metaData.ContentType,
+			ScanResult:  metaData.ScanResult,
+		}
+	}
+	return resp, nil
+}
+
+// locateNode 查询暂存目录所在节点，未找到时返回空
+func locateNode(uidStr string) string {
+	dirName := path.Join(utils.LocalStore, uidStr)
+	if _, err := os.Stat(dirName); err == nil {
+		ip, err := base.GetOutBoundIP()
+		if err != nil {
+			return ""
+		}
+		return ip
+	}
+	serviceList, err := base.NewServiceRegister().Discovery()
+	if err != nil || serviceList == nil {
+		return ""
+	}
+	var wg sync.WaitGroup
+	ipChan := make(chan string, len(serviceList))
+	for _, service := range serviceList {
+		wg.Add(1)
+		go func(ip string, port string, ipChan chan string, wg *sync.WaitGroup) {
+			defer wg.Done()
+			res, err := thirdparty.NewStorageService().Locate(utils.Scheme, ip, port, uidStr)
+			if err != nil {
+				return
+			}
+			ipChan <- res
+		}(service.IP, service.Port, ipChan, &wg)
+	}
+	wg.Wait()
+	close(ipChan)
+	if re, ok := <-ipChan; ok {
+		return re
+	}
+	return ""
+}
@@ -10,15 +10,22 @@ import (
 	"github.com/qinguoyi/osproxy/app/pkg/repo"
 	"github.com/qinguoyi/osproxy/app/pkg/storage"
 	"github.com/qinguoyi/osproxy/app/pkg/thirdparty"
+	"github.com/qinguoyi/osproxy/app/pkg/throttle"
 	"github.com/qinguoyi/osproxy/app/pkg/utils"
 	"github.com/qinguoyi/osproxy/app/pkg/web"
 	"github.com/qinguoyi/osproxy/bootstrap"
 	"github.com/qinguoyi/osproxy/bootstrap/plugins"
 	"go.uber.org/zap"
+	"gorm.io/gorm"
 	"io"
+	"mime/multipart"
+	"net/http"
+	"net/url"
 	"os"
 	"path"
+	"path/filepath"
 	"strconv"
+	"strings"
 	"sync"
 	"time"
 )
@@ -30,15 +37,17 @@ import (
 // UploadSingleHandler    上传单个文件
 //
 //	@Summary      上传单个文件
-//	@Description  上传单个文件
+//	@Description  上传单个文件，携带Content-Range时请求体为文件片段，追加写入直至接收完整
 //	@Tags         上传
 //	@Accept       multipart/form-data
-//	@Param        file       formData  file    true  "上传的文件"
-//	@Param        uid        query     string  true  "文件uid"
-//	@Param        md5        query     string  true  "md5"
-//	@Param        date       query     string  true  "链接生成时间"
-//	@Param        expire     query     string  true  "过期时间"
-//	@Param        signature  query     string  true  "签名"
+//	@Param        file           formData  file    false  "上传的文件"
+//	@Param        Content-Range  header    string  false  "断点续传范围，bytes a-b/total"
+//	@Param        uid            query     string  true   "文件uid"
+//	@Param        md5            query     string  true   "md5"
+//	@Param        date           query     string  true   "链接生成时间"
+//	@Param        expire         query     string  true   "过期时间"
+//	@Param        rate           query     int     false  "链接限速(KB/s)，参与签名"
+//	@Param        signature      query     string  true   "签名"
 //	@Produce      application/json
 //	@Success      200  {object}  web.Response
 //	@Router       /api/storage/v0/upload [put]
@@ -55,14 +64,13 @@ func UploadSingleHandler(c *gin.Context) {
 		return
 	}
 
-	if !base.CheckUploadSignature(date, expireStr, signature) {
+	if !base.CheckUploadSignature(uidStr, date, expireStr, signature, c.Request.URL.Query()) {
 		web.ParamsError(c, "签名校验失败")
 		return
 	}
-
-	file, err := c.FormFile("file")
-	if err != nil {
-		web.ParamsError(c, fmt.Sprintf("解析文件参数失败，详情：%s", err))
+	// 携带Content-Range时按断点续传追加写入
+	if c.GetHeader("Content-Range") != "" {
+		uploadRange(c, uid, uidStr, md5)
 		return
 	}
 
@@ -73,6 +81,29 @@ func UploadSingleHandler(c *gin.Context) {
 		web.NotFoundResource(c, "当前上传链接无效，uid不存在")
 		return
 	}
+	// 解析表单前按链接及租户限速读取请求体
+	throttleUpload(c, metaData.Tenant)
+	file, err := c.FormFile("file")
+	if err != nil {
+		web.ParamsError(c, fmt.Sprintf("解析文件参数失败，详情：%s", err))
+		return
+	}
+	if metaData.Status != utils.MetaStatusPending {
+		web.ParamsError(c, fmt.Sprintf("当前文件状态[%s]不允许上传", repo.MetaStatusName(metaData.Status)))
+		return
+	}
+	// 生成链接时声明了md5及大小，需保持一致
+	if md5 == "" {
+		md5 = metaData.Md5
+	}
+	if metaData.Md5 != "" && md5 != metaData.Md5 {
+		web.ParamsError(c, fmt.Sprintf("md5与声明的不一致，声明:%s, 参数:%s", metaData.Md5, md5))
+		return
+	}
+	if metaData.StorageSize > 0 && file.Size != metaData.StorageSize {
+		web.ParamsError(c, fmt.Sprintf("文件大小与声明的不一致，声明:%d, 实际:%d", metaData.StorageSize, file.Size))
+		return
+	}
 
 	dirName := path.Join(utils.LocalStore, uidStr)
 	// 判断是否上传过，md5
@@ -82,43 +113,24 @@ func UploadSingleHandler(c *gin.Context) {
 		web.InternalError(c, "")
 		return
 	}
+	// 秒传不占用存储容量
+	quotaSize := file.Size
 	if len(resumeInfo) != 0 {
-		now := time.Now()
-		if err := repo.NewMetaDataInfoRepo().Updates(lgDB, uid, map[string]interface{}{
-			"bucket":       resumeInfo[0].Bucket,
-			"storage_name": resumeInfo[0].StorageName,
-			"address":      resumeInfo[0].Address,
-			"md5":          md5,
-			"storage_size": resumeInfo[0].StorageSize,
-			"multi_part":   false,
-			"status":       1,
-			"updated_at":   &now,
-			"content_type": resumeInfo[0].ContentType,
-		}); err != nil {
+		quotaSize = 0
+	}
+	if !checkQuota(c, lgDB, metaData.Tenant, base.UploadQuotaSize(metaData, quotaSize), 1) {
+		return
+	}
+	if len(resumeInfo) != 0 {
+		if err := repo.NewMetaDataInfoRepo().Transition(lgDB, uid, utils.MetaStatusAvailable,
+			resumeColumns(resumeInfo[0], md5)); err != nil {
 			lgLogger.WithContext(c).Error("上传完更新数据失败")
 			web.InternalError(c, "上传完更新数据失败")
 			return
 		}
-		if err := os.RemoveAll(dirName); err != nil {
-			lgLogger.WithContext(c).Error(fmt.Sprintf("删除目录失败，详情%s", err.Error()))
-			web.InternalError(c, fmt.Sprintf("删除目录失败，详情%s", err.Error()))
-			return
-		}
-		// 首次写入redis 元数据
-		lgRedis := new(plugins.LangGoRedis).NewRedis()
-		metaCache, err := repo.NewMetaDataInfoRepo().GetByUid(lgDB, uid)
-		if err != nil {
-			lgLogger.WithContext(c).Error("上传数据，查询数据元信息失败")
-			web.InternalError(c, "内部异常")
-			return
-		}
-		b, err := json.Marshal(metaCache)
-		if err != nil {
-			lgLogger.WithContext(c).Warn("上传数据，写入redis失败")
+		if completeUpload(c, lgDB, uid) {
+			web.Success(c, "")
 		}
-		lgRedis.SetNX(context.Background(), fmt.Sprintf("%s-meta", uidStr), b, 5*60*time.Second)
-
-		web.Success(c, "")
 		return
 	}
 	// 判断是否在本地
@@ -209,14 +221,11 @@ func UploadSingleHandler(c *gin.Context) {
 		return
 	}
 	// 更新元数据
-	now := time.Now()
 	fileInfo, _ := os.Stat(fileName)
-	if err := repo.NewMetaDataInfoRepo().Updates(lgDB, metaData.UID, map[string]interface{}{
+	if err := repo.NewMetaDataInfoRepo().Transition(lgDB, metaData.UID, base.UploadedStatus(), map[string]interface{}{
 		"md5":          md5Str,
 		"storage_size": fileInfo.Size(),
 		"multi_part":   false,
-		"status":       1,
-		"updated_at":   &now,
 		"content_type": contentType,
 	}); err != nil {
 		lgLogger.WithContext(c).Error("上传完更新数据失败")
@@ -225,10 +234,32 @@ func UploadSingleHandler(c *gin.Context) {
 	}
 	_, _ = out.Close(), src.Close()
 
+	if completeUpload(c, lgDB, uid) {
+		web.Success(c, "")
+	}
+}
+
+// resumeColumns 秒传时复用已上传文件的存储对象
+func resumeColumns(resume models.MetaDataInfo, md5 string) map[string]interface{} {
+	return map[string]interface{}{
+		"bucket":       resume.Bucket,
+		"storage_name": resume.StorageName,
+		"address":      resume.Address,
+		"md5":          md5,
+		"storage_size": resume.StorageSize,
+		"multi_part":   false,
+		"content_type": resume.ContentType,
+	}
+}
+
+// completeUpload 上传完成后删除暂存目录、写入元数据缓存并执行后置处理，失败时写入响应并返回false
+func completeUpload(c *gin.Context, lgDB *gorm.DB, uid int64) bool {
+	uidStr := strconv.FormatInt(uid, 10)
+	dirName := path.Join(utils.LocalStore, uidStr)
 	if err := os.RemoveAll(dirName); err != nil {
 		lgLogger.WithContext(c).Error(fmt.Sprintf("删除目录失败，详情%s", err.Error()))
 		web.InternalError(c, fmt.Sprintf("删除目录失败，详情%s", err.Error()))
-		return
+		return false
 	}
 
 	// 首次写入redis 元数据
@@ -237,7 +268,7 @@ func UploadSingleHandler(c *gin.Context) {
 	if err != nil {
 		lgLogger.WithContext(c).Error("上传数据，查询数据元信息失败")
 		web.InternalError(c, "内部异常")
-		return
+		return false
 	}
 	b, err := json.Marshal(metaCache)
 	if err != nil {
@@ -245,8 +276,225 @@ func UploadSingleHandler(c *gin.Context) {
 	}
 	lgRedis.SetNX(context.Background(), fmt.Sprintf("%s-meta", uidStr), b, 5*60*time.Second)
 
-	web.Success(c, "")
-	return
+	if err := base.AfterUpload(lgDB, metaCache, utils.EventUploaded); err != nil {
+		lgLogger.WithContext(c).Warn("上传数据，创建后置任务失败", zap.Any("err", err.Error()))
+	}
+	return true
+}
+
+// formMaxSize 表单上传的文件大小上限
+func formMaxSize() int64 {
+	if size := bootstrap.NewConfig("").Upload.FormMaxSize; size > 0 {
+		return size * 1024 * 1024
+	}
+	return 100 * 1024 * 1024
+}
+
+// UploadFormHandler    表单上传文件
+//
+//	@Summary      表单上传文件
+//	@Description  浏览器使用签名策略直传，文件须为表单的最后一个字段，先校验策略再读取文件，服务端计算md5，Content-Type条件按服务端识别的类型校验
+//	@Tags         上传
+//	@Accept       multipart/form-data
+//	@Param        key                      formData  string  true   "文件路径，支持${filename}"
+//	@Param        policy                   formData  string  true   "策略"
+//	@Param        signature                formData  string  true   "签名"
+//	@Param        tenant                   formData  string  false  "租户应用标识"
+//	@Param        callback                 formData  string  false  "回调地址"
+//	@Param        success_action_redirect  formData  string  false  "上传成功后的跳转地址"
+//	@Param        file                     formData  file    true   "上传的文件"
+//	@Produce      application/json
+//	@Success      200  {object}  web.Response{data=models.PolicyUploadResp}
+//	@Router       /api/storage/v0/upload/form [post]
+func UploadFormHandler(c *gin.Context) {
+	// 租户在表单策略中，解析前只能按连接限速
+	throttleUpload(c, "")
+	// 整体大小不超过上限，文件须在其他字段之后，读取文件前先校验策略签名、有效期及字段
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, formMaxSize()+utils.FormFieldsLimit)
+	reader, err := c.Request.MultipartReader()
+	if err != nil {
+		web.ParamsError(c, fmt.Sprintf("解析表单失败，详情：%s", err))
+		return
+	}
+	fields := map[string]string{}
+	var file *multipart.Part
+	var fieldsSize int64
+	for file == nil {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			web.ParamsError(c, fmt.Sprintf("解析表单失败，详情：%s", err))
+			return
+		}
+		if part.FormName() == "file" {
+			file = part
+			break
+		}
+		b, err := io.ReadAll(io.LimitReader(part, utils.FormFieldsLimit-fieldsSize+1))
+		if err != nil {
+			web.ParamsError(c, fmt.Sprintf("解析表单失败，详情：%s", err))
+			return
+		}
+		if fieldsSize += int64(len(b)); fieldsSize > utils.FormFieldsLimit {
+			web.ParamsError(c, "表单字段超过大小限制")
+			return
+		}
+		if _, ok := fields[part.FormName()]; !ok {
+			fields[part.FormName()] = string(b)
+		}
+	}
+	if file == nil || file.FileName() == "" {
+		web.ParamsError(c, "表单需包含一个文件，且位于其他字段之后")
+		return
+	}
+	policy, err := base.ParsePostPolicy(fields[base.PolicyFieldPolicy], fields[base.PolicyFieldSignature], time.Now())
+	if err != nil {
+		web.ParamsError(c, err.Error())
+		return
+	}
+	if err := policy.CheckFields(fields); err != nil {
+		web.ParamsError(c, err.Error())
+		return
+	}
+	key := strings.ReplaceAll(fields[base.PolicyFieldKey], base.PolicyFilenameVar, filepath.Base(file.FileName()))
+	if base.GetExtension(key) == "" {
+		web.ParamsError(c, fmt.Sprintf("文件[%s]后缀有误，不能为空", key))
+		return
+	}
+
+	metaData, err := base.NewMetaDataInfo(key, fields[base.PolicyFieldTenant], fields[base.PolicyFieldCallback])
+	if err != nil {
+		lgLogger.WithContext(c).Error("表单上传，生成元数据失败", zap.Any("err", err.Error()))
+		web.InternalError(c, "内部异常")
+		return
+	}
+	uidStr := strconv.FormatInt(metaData.UID, 10)
+	dirName := path.Join(utils.LocalStore, uidStr)
+	if err := os.MkdirAll(dirName, 0755); err != nil {
+		lgLogger.WithContext(c).Error("表单上传，创建本地目录失败", zap.Any("err", err.Error()))
+		web.InternalError(c, "内部异常")
+		return
+	}
+	defer func() {
+		_ = os.RemoveAll(dirName)
+	}()
+
+	// 按策略的大小上限读取，超过时不再继续接收
+	maxSize := policy.MaxSize()
+	if maxSize < 0 || maxSize > formMaxSize() {
+		maxSize = formMaxSize()
+	}
+	fileName := path.Join(dirName, metaData.StorageName)
+	out, err := os.Create(fileName)
+	if err != nil {
+		lgLogger.WithContext(c).Error("表单上传，创建本地文件失败", zap.Any("err", err.Error()))
+		web.InternalError(c, "内部异常")
+		return
+	}
+	written, err := io.Copy(out, io.LimitReader(file, maxSize+1))
+	_ = out.Close()
+	if err != nil {
+		web.ParamsError(c, fmt.Sprintf("读取文件失败，详情：%s", err))
+		return
+	}
+	if written > maxSize {
+		web.ParamsError(c, fmt.Sprintf("文件大小超过上限%d", maxSize))
+		return
+	}
+	if _, err := reader.NextPart(); err != io.EOF {
+		web.ParamsError(c, "文件须为表单的最后一个字段")
+		return
+	}
+	md5Str, err := base.CalculateFileMd5(fileName)
+	if err != nil {
+		lgLogger.WithContext(c).Error(fmt.Sprintf("生成md5失败，详情%s", err.Error()))
+		web.InternalError(c, err.Error())
+		return
+	}
+	contentType, err := base.DetectContentType(fileName)
+	if err != nil {
+		lgLogger.WithContext(c).Error("判断文件content-type失败")
+		web.InternalError(c, "判断文件content-type失败")
+		return
+	}
+	// 按实际大小及识别出的content-type校验
+	fileInfo, _ := os.Stat(fileName)
+	fields[base.PolicyFieldContentType] = contentType
+	if err := policy.Check(fields, fileInfo.Size()); err != nil {
+		web.ParamsError(c, err.Error())
+		return
+	}
+
+	// 判断是否上传过，md5
+	lgDB := new(plugins.LangGoDB).Use("default").NewDB()
+	resumeInfo, err := repo.NewMetaDataInfoRepo().GetResumeByMd5(lgDB, []string{md5Str})
+	if err != nil {
+		lgLogger.WithContext(c).Error("查询文件是否已上传失败")
+		web.InternalError(c, "")
+		return
+	}
+	quotaSize := fileInfo.Size()
+	if len(resumeInfo) != 0 {
+		quotaSize = 0
+	}
+	if !checkQuota(c, lgDB, metaData.Tenant, base.UploadQuotaSize(metaData, quotaSize), 1) {
+		return
+	}
+	status := utils.MetaStatusAvailable
+	columns := map[string]interface{}{
+		"md5":          md5Str,
+		"storage_size": fileInfo.Size(),
+		"multi_part":   false,
+		"content_type": contentType,
+	}
+	if len(resumeInfo) != 0 {
+		columns = resumeColumns(resumeInfo[0], md5Str)
+	} else if err := storage.NewStorage().Storage.PutObject(metaData.Bucket, metaData.StorageName, fileName,
+		contentType); err != nil {
+		lgLogger.WithContext(c).Error("上传到minio失败")
+		web.InternalError(c, "上传到minio失败")
+		return
+	} else {
+		status = base.UploadedStatus()
+	}
+
+	// 先按未上传落库，再经状态流转记录历史
+	if err := repo.NewMetaDataInfoRepo().Create(lgDB, metaData); err != nil {
+		lgLogger.WithContext(c).Error("表单上传，落数据库失败", zap.Any("err", err.Error()))
+		web.InternalError(c, "内部异常")
+		return
+	}
+	if err := repo.NewMetaDataInfoRepo().Transition(lgDB, metaData.UID, status, columns); err != nil {
+		lgLogger.WithContext(c).Error("表单上传，更新数据失败", zap.Any("err", err.Error()))
+		web.InternalError(c, "内部异常")
+		return
+	}
+	if !completeUpload(c, lgDB, metaData.UID) {
+		return
+	}
+
+	if redirect := fields[base.PolicyFieldRedirect]; redirect != "" {
+		u, err := url.Parse(redirect)
+		if err != nil {
+			web.ParamsError(c, "跳转地址有误")
+			return
+		}
+		query := u.Query()
+		query.Set("uid", uidStr)
+		query.Set("key", key)
+		query.Set("md5", md5Str)
+		u.RawQuery = query.Encode()
+		c.Redirect(http.StatusSeeOther, u.String())
+		return
+	}
+	web.Success(c, models.PolicyUploadResp{
+		Uid:  uidStr,
+		Key:  key,
+		Md5:  md5Str,
+		Size: fileInfo.Size(),
+	})
 }
 
 // UploadMultiPartHandler    上传分片文件
@@ -255,13 +503,14 @@ func UploadSingleHandler(c *gin.Context) {
 //	@Description  上传分片文件
 //	@Tags         上传
 //	@Accept       multipart/form-data
-//	@Param        file       formData  file    true  "上传的文件"
-//	@Param        uid        query     string  true  "文件uid"
-//	@Param        md5        query     string  true  "md5"
-//	@Param        chunkNum   query     string  true  "当前分片id"
-//	@Param        date       query     string  true  "链接生成时间"
-//	@Param        expire     query     string  true  "过期时间"
-//	@Param        signature  query     string  true  "签名"
+//	@Param        file       formData  file    true   "上传的文件"
+//	@Param        uid        query     string  true   "文件uid"
+//	@Param        md5        query     string  true   "md5"
+//	@Param        chunkNum   query     string  true   "当前分片id"
+//	@Param        date       query     string  true   "链接生成时间"
+//	@Param        expire     query     string  true   "过期时间"
+//	@Param        rate       query     int     false  "链接限速(KB/s)，参与签名"
+//	@Param        signature  query     string  true   "签名"
 //	@Produce      application/json
 //	@Success      200  {object}  web.Response
 //	@Router       /api/storage/v0/upload/multi [put]
@@ -285,22 +534,49 @@ func UploadMultiPartHandler(c *gin.Context) {
 		return
 	}
 
-	if !base.CheckUploadSignature(date, expireStr, signature) {
+	if !base.CheckUploadSignature(uidStr, date, expireStr, signature, c.Request.URL.Query()) {
 		web.ParamsError(c, "签名校验失败")
 		return
 	}
 
+	// 判断记录是否存在
+	lgDB := new(plugins.LangGoDB).Use("default").NewDB()
+	metaData, err := repo.NewMetaDataInfoRepo().GetByUid(lgDB, uid)
+	if err != nil {
+		web.NotFoundResource(c, "当前上传链接无效，uid不存在")
+		return
+	}
+	// 解析表单前按链接及租户限速读取请求体
+	throttleUpload(c, metaData.Tenant)
 	file, err := c.FormFile("file")
 	if err != nil {
 		web.ParamsError(c, fmt.Sprintf("解析文件参数失败，详情：%s", err))
 		return
 	}
-
-	// 判断记录是否存在
-	lgDB := new(plugins.LangGoDB).Use("default").NewDB()
-	metaData, err := repo.NewMetaDataInfoRepo().GetByUid(lgDB, uid)
+	if metaData.Status != utils.MetaStatusPending && metaData.Status != utils.MetaStatusReceiving {
+		web.ParamsError(c, fmt.Sprintf("当前文件状态[%s]不允许上传分片", repo.MetaStatusName(metaData.Status)))
+		return
+	}
+	// 按上传计划校验分片序号及大小
+	if metaData.PartSize > 0 {
+		expectSize := base.PlanPartSize(metaData.StorageSize, metaData.PartSize, int64(metaData.PartNum), chunkNum)
+		if expectSize == 0 {
+			web.ParamsError(c, fmt.Sprintf("分片序号有误，应在1-%d之间", metaData.PartNum))
+			return
+		}
+		if file.Size != expectSize {
+			web.ParamsError(c, fmt.Sprintf("分片[%d]大小有误，计划:%d, 实际:%d", chunkNum, expectSize, file.Size))
+			return
+		}
+	}
+	// 按已上传分片加当前分片的大小校验配额
+	received, err := repo.NewMultiPartInfoRepo().SumSizeByUid(lgDB, uid)
 	if err != nil {
-		web.NotFoundResource(c, "当前上传链接无效，uid不存在")
+		lgLogger.WithContext(c).Error("多文件上传，查询分片信息失败")
+		web.InternalError(c, "内部异常")
+		return
+	}
+	if !checkQuota(c, lgDB, metaData.Tenant, base.UploadQuotaSize(metaData, received+file.Size), 1) {
 		return
 	}
 	// 判断当前分片是否已上传
@@ -323,6 +599,17 @@ func UploadMultiPartHandler(c *gin.Context) {
 		return
 	}
 	_, _ = createLock.Release()
+	// 同一序号已上传过不同内容的分片
+	chunkInfo, err := repo.NewMultiPartInfoRepo().GetByChunkNum(lgDB, uid, chunkNum)
+	if err != nil {
+		lgLogger.WithContext(c).Error("多文件上传，查询分片信息失败")
+		web.InternalError(c, "内部异常")
+		return
+	}
+	if len(chunkInfo) != 0 {
+		web.ParamsError(c, fmt.Sprintf("分片[%d]已上传，md5不一致", chunkNum))
+		return
+	}
 
 	// 判断是否在本地
 	dirName := path.Join(utils.LocalStore, uidStr)
@@ -433,6 +720,16 @@ func UploadMultiPartHandler(c *gin.Context) {
 		web.InternalError(c, "上传完更新数据失败")
 		return
 	}
+	// 首个分片上传后进入分片上传中，并发上传时只会有一个流转成功
+	if metaData.Status == utils.MetaStatusPending {
+		if err := repo.NewMetaDataInfoRepo().Transition(lgDB, uid, utils.MetaStatusReceiving, map[string]interface{}{
+			"multi_part": true,
+		}); err != nil && err != repo.ErrStatusTransition {
+			lgLogger.WithContext(c).Error("上传完更新数据失败")
+			web.InternalError(c, "上传完更新数据失败")
+			return
+		}
+	}
 	web.Success(c, "")
 	return
 }
@@ -444,9 +741,9 @@ func UploadMultiPartHandler(c *gin.Context) {
 //	@Tags         上传
 //	@Accept       multipart/form-data
 //	@Param        uid        query  string  true  "文件uid"
-//	@Param        md5        query  string  true  "md5"
-//	@Param        num        query  string  true  "总分片数量"
-//	@Param        size       query  string  true  "文件总大小"
+//	@Param        md5        query  string  false  "md5，声明过可省略"
+//	@Param        num        query  string  false  "总分片数量，有上传计划时可省略"
+//	@Param        size       query  string  false  "文件总大小，有上传计划时可省略"
 //	@Param        date       query  string  true  "链接生成时间"
 //	@Param        expire     query  string  true  "过期时间"
 //	@Param        signature  query  string  true  "签名"
@@ -457,7 +754,7 @@ func UploadMergeHandler(c *gin.Context) {
 	uidStr := c.Query("uid")
 	md5 := c.Query("md5")
 	numStr := c.Query("num")
-	size := c.Query("size")
+	sizeStr := c.Query("size")
 	date := c.Query("date")
 	expireStr := c.Query("expire")
 	signature := c.Query("signature")
@@ -468,13 +765,7 @@ func UploadMergeHandler(c *gin.Context) {
 		return
 	}
 
-	num, err := strconv.ParseInt(numStr, 10, 64)
-	if err != nil {
-		web.ParamsError(c, errorInfo)
-		return
-	}
-
-	if !base.CheckUploadSignature(date, expireStr, signature) {
+	if !base.CheckUploadSignature(uidStr, date, expireStr, signature, c.Request.URL.Query()) {
 		web.ParamsError(c, "签名校验失败")
 		return
 	}
@@ -487,6 +778,49 @@ func UploadMergeHandler(c *gin.Context) {
 		return
 	}
 
+	// 有上传计划时，参数可省略，传入时需与计划一致
+	planned := metaData.PartSize > 0
+	if planned {
+		if numStr == "" {
+			numStr = strconv.Itoa(metaData.PartNum)
+		}
+		if sizeStr == "" {
+			sizeStr = strconv.FormatInt(metaData.StorageSize, 10)
+		}
+	}
+	if md5 == "" {
+		md5 = metaData.Md5
+	}
+	num, err := strconv.ParseInt(numStr, 10, 64)
+	if err != nil {
+		web.ParamsError(c, "num参数有误")
+		return
+	}
+	size, err := strconv.ParseInt(sizeStr, 10, 64)
+	if err != nil {
+		web.ParamsError(c, "size参数有误")
+		return
+	}
+	if planned && (num != int64(metaData.PartNum) || size != metaData.StorageSize) {
+		web.ParamsError(c, fmt.Sprintf("分片数量或文件大小与上传计划不一致，计划分片数量:%d, 文件大小:%d",
+			metaData.PartNum, metaData.StorageSize))
+		return
+	}
+	if metaData.Md5 != "" && md5 != metaData.Md5 {
+		web.ParamsError(c, fmt.Sprintf("md5与声明的不一致，声明:%s, 参数:%s", metaData.Md5, md5))
+		return
+	}
+	// 已合并或合并中的重复请求直接返回
+	if metaData.Status == utils.MetaStatusMerging || metaData.Status == utils.MetaStatusAvailable ||
+		metaData.Status == utils.MetaStatusQuarantined {
+		web.Success(c, "")
+		return
+	}
+	if metaData.Status != utils.MetaStatusReceiving && metaData.Status != utils.MetaStatusFailed {
+		web.ParamsError(c, fmt.Sprintf("当前文件状态[%s]不允许合并", repo.MetaStatusName(metaData.Status)))
+		return
+	}
+
 	// 判断分片数量是否一致
 	var multiPartInfoList []models.MultiPartInfo
 	if err := lgDB.Model(&models.MultiPartInfo{}).Where(
@@ -496,7 +830,21 @@ func UploadMergeHandler(c *gin.Context) {
 		return
 	}
 
+	var mismatch string
+	var partSum int64
+	for i, part := range multiPartInfoList {
+		partSum += part.StorageSize
+		if planned && (part.ChunkNum != i+1 || part.StorageSize != base.PlanPartSize(metaData.StorageSize,
+			metaData.PartSize, int64(metaData.PartNum), int64(part.ChunkNum))) {
+			mismatch = fmt.Sprintf("分片[%d]与上传计划不一致", part.ChunkNum)
+		}
+	}
 	if num != int64(len(multiPartInfoList)) {
+		mismatch = "分片数量和整体数量不一致"
+	} else if mismatch == "" && partSum != size {
+		mismatch = fmt.Sprintf("分片大小之和%d与文件大小%d不一致", partSum, size)
+	}
+	if mismatch != "" {
 		// 创建脏数据删除任务
 		msg := models.MergeInfo{
 			StorageUid: uid,
@@ -505,20 +853,35 @@ func UploadMergeHandler(c *gin.Context) {
 		b, err := json.Marshal(msg)
 		if err != nil {
 			lgLogger.WithContext(c).Error("消息struct转成json字符串失败", zap.Any("err", err.Error()))
-			web.InternalError(c, "分片数量和整体数量不一致，创建删除任务失败")
+			web.InternalError(c, fmt.Sprintf("%s，创建删除任务失败", mismatch))
 			return
 		}
 		newModelTask := models.TaskInfo{
-			Status:    utils.TaskStatusUndo,
-			TaskType:  utils.TaskPartDelete,
-			ExtraData: string(b),
+			Status:     utils.TaskStatusUndo,
+			TaskType:   utils.TaskPartDelete,
+			ExtraData:  string(b),
+			StorageUid: uid,
 		}
 		if err := repo.NewTaskRepo().Create(lgDB, &newModelTask); err != nil {
-			lgLogger.WithContext(c).Error("分片数量和整体数量不一致，创建删除任务失败", zap.Any("err", err.Error()))
-			web.InternalError(c, "分片数量和整体数量不一致，创建删除任务失败")
+			lgLogger.WithContext(c).Error(fmt.Sprintf("%s，创建删除任务失败", mismatch), zap.Any("err", err.Error()))
+			web.InternalError(c, fmt.Sprintf("%s，创建删除任务失败", mismatch))
 			return
 		}
-		web.ParamsError(c, "分片数量和整体数量不一致")
+		web.ParamsError(c, mismatch)
+		return
+	}
+	// 合并后可秒传的文件不占用存储容量
+	resumeInfo, err := repo.NewMetaDataInfoRepo().GetResumeByMd5(lgDB, []string{md5})
+	if err != nil {
+		lgLogger.WithContext(c).Error("查询文件是否已上传失败")
+		web.InternalError(c, "")
+		return
+	}
+	quotaSize := size
+	if len(resumeInfo) != 0 {
+		quotaSize = 0
+	}
+	if !checkQuota(c, lgDB, metaData.Tenant, base.UploadQuotaSize(metaData, quotaSize), 1) {
 		return
 	}
 
@@ -578,14 +941,11 @@ func UploadMergeHandler(c *gin.Context) {
 	}
 
 	// 更新metadata的数据
-	now := time.Now()
-	if err := repo.NewMetaDataInfoRepo().Updates(lgDB, metaData.UID, map[string]interface{}{
+	if err := repo.NewMetaDataInfoRepo().Transition(lgDB, metaData.UID, utils.MetaStatusMerging, map[string]interface{}{
 		"part_num":     int(num),
 		"md5":          md5,
 		"storage_size": size,
 		"multi_part":   true,
-		"status":       1,
-		"updated_at":   &now,
 		"content_type": contentType,
 	}); err != nil {
 		lgLogger.WithContext(c).Error("上传完更新数据失败")
@@ -604,9 +964,10 @@ func UploadMergeHandler(c *gin.Context) {
 		return
 	}
 	newModelTask := models.TaskInfo{
-		Status:    utils.TaskStatusUndo,
-		TaskType:  utils.TaskPartMerge,
-		ExtraData: string(b),
+		Status:     utils.TaskStatusUndo,
+		TaskType:   utils.TaskPartMerge,
+		ExtraData:  string(b),
+		StorageUid: uid,
 	}
 	if err := repo.NewTaskRepo().Create(lgDB, &newModelTask); err != nil {
 		lgLogger.WithContext(c).Error("创建合并任务失败", zap.Any("err", err.Error()))
@@ -645,3 +1006,14 @@ func UploadMergeHandler(c *gin.Context) {
 	web.Success(c, "")
 	return
 }
+
+// throttleUpload 按链接签名中的限速及租户限速读取请求体，需在读取请求体前调用，
+// 其他节点转发的请求已在入口节点限速，不重复限速
+func throttleUpload(c *gin.Context, tenant string) {
+	if _, forwardedIn := base.CheckForwardHeader(c.Request.Header, c.Request.URL.RequestURI()); forwardedIn {
+		return
+	}
+	linkRate, _ := strconv.ParseInt(c.Query(utils.LinkParamRate), 10, 64)
+	c.Request.Body = throttle.NewReadCloser(c.Request.Context(), c.Request.Body,
+		base.TransferLimiters(tenant, linkRate, c.ClientIP())...)
+}
@@ -0,0 +1,316 @@
+package v0
+
+/*
+断点续传单文件上传，PUT携带Content-Range追加写入暂存文件，HEAD查询已接收的偏移
+*/
+
+import (
+	"context"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/qinguoyi/osproxy/app/models"
+	"github.com/qinguoyi/osproxy/app/pkg/base"
+	"github.com/qinguoyi/osproxy/app/pkg/repo"
+	"github.com/qinguoyi/osproxy/app/pkg/storage"
+	"github.com/qinguoyi/osproxy/app/pkg/thirdparty"
+	"github.com/qinguoyi/osproxy/app/pkg/utils"
+	"github.com/qinguoyi/osproxy/app/pkg/web"
+	"github.com/qinguoyi/osproxy/bootstrap"
+	"github.com/qinguoyi/osproxy/bootstrap/plugins"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"io"
+	"net/http"
+	"os"
+	"path"
+)
+
+// UploadOffsetHandler    查询断点续传偏移
+//
+//	@Summary      查询断点续传偏移
+//	@Description  查询单文件已接收的字节数，通过响应头Upload-Offset返回
+//	@Tags         上传
+//	@Param        uid        query     string  true  "文件uid"
+//	@Param        date       query     string  true  "链接生成时间"
+//	@Param        expire     query     string  true  "过期时间"
+//	@Param        signature  query     string  true  "签名"
+//	@Success      200
+//	@Header       200  {string}  Upload-Offset  "已接收的字节数"
+//	@Header       200  {string}  Upload-Length  "文件总大小"
+//	@Router       /api/storage/v0/upload [head]
+func UploadOffsetHandler(c *gin.Context) {
+	uidStr := c.Query("uid")
+	date := c.Query("date")
+	expireStr := c.Query("expire")
+	signature := c.Query("signature")
+
+	uid, err, _ := base.CheckValid(uidStr, date, expireStr)
+	if err != nil {
+		c.Status(http.StatusUnprocessableEntity)
+		return
+	}
+	if !base.CheckUploadSignature(uidStr, date, expireStr, signature, c.Request.URL.Query()) {
+		c.Status(http.StatusUnprocessableEntity)
+		return
+	}
+
+	lgDB := new(plugins.LangGoDB).Use("default").NewDB()
+	metaData, err := repo.NewMetaDataInfoRepo().GetByUid(lgDB, uid)
+	if err != nil {
+		c.Status(http.StatusNotFound)
+		return
+	}
+	switch metaData.Status {
+	case utils.MetaStatusAvailable, utils.MetaStatusQuarantined:
+		setUploadOffset(c, metaData.StorageSize, metaData.StorageSize)
+		c.Status(http.StatusOK)
+	case utils.MetaStatusPending:
+		dirName := path.Join(utils.LocalStore, uidStr)
+		if _, err := os.Stat(dirName); os.IsNotExist(err) {
+			forwardRangeUpload(c, uidStr)
+			return
+		}
+		setUploadOffset(c, stagedSize(path.Join(dirName, metaData.StorageName)), metaData.StorageSize)
+		c.Status(http.StatusOK)
+	default:
+		c.Status(http.StatusConflict)
+	}
+}
+
+// uploadRange 按Content-Range追加写入暂存文件，接收完整且md5一致时完成上传
+func uploadRange(c *gin.Context, uid int64, uidStr, md5 string) {
+	start, end, total, err := base.ParseContentRange(c.GetHeader("Content-Range"))
+	if err != nil {
+		web.ParamsError(c, err.Error())
+		return
+	}
+	if c.Request.ContentLength >= 0 && c.Request.ContentLength != end-start+1 {
+		web.ParamsError(c, fmt.Sprintf("请求体长度%d与Content-Range不一致", c.Request.ContentLength))
+		return
+	}
+
+	lgDB := new(plugins.LangGoDB).Use("default").NewDB()
+	metaData, err := repo.NewMetaDataInfoRepo().GetByUid(lgDB, uid)
+	if err != nil {
+		web.NotFoundResource(c, "当前上传链接无效，uid不存在")
+		return
+	}
+	// 已完成上传的重复请求直接返回
+	if (metaData.Status == utils.MetaStatusAvailable || metaData.Status == utils.MetaStatusQuarantined) &&
+		metaData.StorageSize == total {
+		setUploadOffset(c, total, total)
+		web.Success(c, models.RangeUploadResp{Uid: uidStr, Offset: total, Total: total})
+		return
+	}
+	if metaData.Status != utils.MetaStatusPending {
+		web.ParamsError(c, fmt.Sprintf("当前文件状态[%s]不允许上传", repo.MetaStatusName(metaData.Status)))
+		return
+	}
+	if md5 == "" {
+		md5 = metaData.Md5
+	}
+	if md5 == "" {
+		web.ParamsError(c, "断点续传需提供md5")
+		return
+	}
+	if metaData.Md5 != "" && md5 != metaData.Md5 {
+		web.ParamsError(c, fmt.Sprintf("md5与声明的不一致，声明:%s, 参数:%s", metaData.Md5, md5))
+		return
+	}
+	if metaData.StorageSize > 0 && total != metaData.StorageSize {
+		web.ParamsError(c, fmt.Sprintf("文件大小与声明的不一致，声明:%d, 实际:%d", metaData.StorageSize, total))
+		return
+	}
+
+	dirName := path.Join(utils.LocalStore, uidStr)
+	if _, err := os.Stat(dirName); os.IsNotExist(err) {
+		// 入口节点限速后转发，所在节点不再限速
+		throttleUpload(c, metaData.Tenant)
+		forwardRangeUpload(c, uidStr)
+		return
+	}
+
+	// 同一文件的写入互斥
+	lgRedis := new(plugins.LangGoRedis).NewRedis()
+	ctx := context.Background()
+	lock := base.NewRedisLock(&ctx, lgRedis, fmt.Sprintf("range-upload-%s", uidStr))
+	lock.SetExpire(10 * 60)
+	if flag, err := lock.Acquire(); err != nil || !flag {
+		web.Conflict(c, "文件正在上传，请稍后重试")
+		return
+	}
+	defer func() {
+		_, _ = lock.Release()
+	}()
+
+	if start == 0 && !checkQuota(c, lgDB, metaData.Tenant, base.UploadQuotaSize(metaData, total), 1) {
+		return
+	}
+	// 首次续传记录文件总大小，后续请求需保持一致
+	if metaData.StorageSize == 0 {
+		if err := repo.NewMetaDataInfoRepo().Updates(lgDB, uid, map[string]interface{}{
+			"storage_size": total,
+		}); err != nil {
+			lgLogger.WithContext(c).Error("断点续传，更新文件大小失败")
+			web.InternalError(c, "内部异常")
+			return
+		}
+	}
+
+	fileName := path.Join(dirName, metaData.StorageName)
+	offset := stagedSize(fileName)
+	if start > offset {
+		setUploadOffset(c, offset, total)
+		web.Conflict(c, fmt.Sprintf("起始位置%d与已接收的偏移%d不一致", start, offset))
+		return
+	}
+	out, err := os.OpenFile(fileName, os.O_WRONLY|os.O_CREATE, 0644)
+	if err != nil {
+		lgLogger.WithContext(c).Error("本地创建文件失败")
+		web.InternalError(c, "本地创建文件失败")
+		return
+	}
+	// 重传已接收的数据时从start处覆盖
+	if err := out.Truncate(start); err == nil {
+		_, err = out.Seek(start, io.SeekStart)
+	}
+	if err != nil {
+		_ = out.Close()
+		lgLogger.WithContext(c).Error("断点续传，定位写入位置失败")
+		web.InternalError(c, "内部异常")
+		return
+	}
+	throttleUpload(c, metaData.Tenant)
+	written, err := io.CopyN(out, c.Request.Body, end-start+1)
+	_ = out.Close()
+	offset = start + written
+	setUploadOffset(c, offset, total)
+	if err != nil {
+		web.ParamsError(c, fmt.Sprintf("请求数据不完整，已接收到%d", offset))
+		return
+	}
+	if offset < total {
+		web.Success(c, models.RangeUploadResp{Uid: uidStr, Offset: offset, Total: total})
+		return
+	}
+	finishRangeUpload(c, lgDB, metaData, fileName, md5)
+}
+
+// finishRangeUpload 接收完整后校验md5并上传到对象存储
+func finishRangeUpload(c *gin.Context, lgDB *gorm.DB, metaData *models.MetaDataInfo, fileName, md5 string) {
+	uidStr := fmt.Sprintf("%d", metaData.UID)
+	fileInfo, err := os.Stat(fileName)
+	if err != nil {
+		lgLogger.WithContext(c).Error("断点续传，读取暂存文件失败")
+		web.InternalError(c, "内部异常")
+		return
+	}
+	md5Str, err := base.CalculateFileMd5(fileName)
+	if err != nil {
+		lgLogger.WithContext(c).Error(fmt.Sprintf("生成md5失败，详情%s", err.Error()))
+		web.InternalError(c, err.Error())
+		return
+	}
+	if md5Str != md5 {
+		// 校验失败的数据无法续传，需从头上传
+		_ = os.Remove(fileName)
+		setUploadOffset(c, 0, fileInfo.Size())
+		web.ParamsError(c, fmt.Sprintf("校验md5失败，计算结果:%s, 参数:%s", md5Str, md5))
+		return
+	}
+
+	resumeInfo, err := repo.NewMetaDataInfoRepo().GetResumeByMd5(lgDB, []string{md5})
+	if err != nil {
+		lgLogger.WithContext(c).Error("查询文件是否已上传失败")
+		web.InternalError(c, "")
+		return
+	}
+	quotaSize := fileInfo.Size()
+	if len(resumeInfo) != 0 {
+		quotaSize = 0
+	}
+	if !checkQuota(c, lgDB, metaData.Tenant, base.UploadQuotaSize(metaData, quotaSize), 1) {
+		return
+	}
+	if len(resumeInfo) != 0 {
+		if err := repo.NewMetaDataInfoRepo().Transition(lgDB, metaData.UID, utils.MetaStatusAvailable,
+			resumeColumns(resumeInfo[0], md5)); err != nil {
+			lgLogger.WithContext(c).Error("上传完更新数据失败")
+			web.InternalError(c, "上传完更新数据失败")
+			return
+		}
+	} else {
+		contentType, err := base.DetectContentType(fileName)
+		if err != nil {
+			lgLogger.WithContext(c).Error("判断文件content-type失败")
+			web.InternalError(c, "判断文件content-type失败")
+			return
+		}
+		if err := storage.NewStorage().Storage.PutObject(metaData.Bucket, metaData.StorageName, fileName,
+			contentType); err != nil {
+			lgLogger.WithContext(c).Error("上传到minio失败", zap.Any("err", err.Error()))
+			web.InternalError(c, "上传到minio失败")
+			return
+		}
+		if err := repo.NewMetaDataInfoRepo().Transition(lgDB, metaData.UID, base.UploadedStatus(), map[string]interface{}{
+			"md5":          md5Str,
+			"storage_size": fileInfo.Size(),
+			"multi_part":   false,
+			"content_type": contentType,
+		}); err != nil {
+			lgLogger.WithContext(c).Error("上传完更新数据失败")
+			web.InternalError(c, "上传完更新数据失败")
+			return
+		}
+	}
+	if completeUpload(c, lgDB, metaData.UID) {
+		web.Success(c, models.RangeUploadResp{Uid: uidStr, Offset: fileInfo.Size(), Total: fileInfo.Size()})
+	}
+}
+
+// forwardRangeUpload 暂存文件不在本地时转发到所在节点，原样返回响应
+func forwardRangeUpload(c *gin.Context, uidStr string) {
+	proxyIP := locateNode(uidStr)
+	if proxyIP == "" {
+		lgLogger.WithContext(c).Error("发现其他服务失败")
+		web.InternalError(c, "发现其他服务失败")
+		return
+	}
+	resp, err := thirdparty.NewStorageService().RangeUploadForward(c, utils.Scheme, proxyIP,
+		bootstrap.NewConfig("").App.Port)
+	if err != nil {
+		lgLogger.WithContext(c).Error("断点续传，转发失败", zap.Any("err", err.Error()))
+		web.InternalError(c, err.Error())
+		return
+	}
+	defer resp.Body.Close()
+	for _, key := range []string{utils.HeaderUploadOffset, utils.HeaderUploadLength, "Range", "Content-Type",
+		"Cache-Control"} {
+		if v := resp.Header.Get(key); v != "" {
+			c.Header(key, v)
+		}
+	}
+	c.Status(resp.StatusCode)
+	_, _ = io.Copy(c.Writer, resp.Body)
+}
+
+// setUploadOffset 返回已接收的偏移，Range与Google断点续传协议保持一致
+func setUploadOffset(c *gin.Context, offset, total int64) {
+	c.Header("Cache-Control", "no-store")
+	c.Header(utils.HeaderUploadOffset, fmt.Sprintf("%d", offset))
+	if total > 0 {
+		c.Header(utils.HeaderUploadLength, fmt.Sprintf("%d", total))
+	}
+	if offset > 0 {
+		c.Header("Range", fmt.Sprintf("bytes=0-%d", offset-1))
+	}
+}
+
+// stagedSize 暂存文件已写入的大小
+func stagedSize(fileName string) int64 {
+	info, err := os.Stat(fileName)
+	if err != nil {
+		return 0
+	}
+	return info.Size()
+}
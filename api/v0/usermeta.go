@@ -0,0 +1,178 @@
+package v0
+
+import (
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/qinguoyi/osproxy/app/models"
+	"github.com/qinguoyi/osproxy/app/pkg/base"
+	"github.com/qinguoyi/osproxy/app/pkg/repo"
+	"github.com/qinguoyi/osproxy/app/pkg/utils"
+	"github.com/qinguoyi/osproxy/app/pkg/web"
+	"github.com/qinguoyi/osproxy/bootstrap/plugins"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"strconv"
+)
+
+// UserMetaHandler    更新自定义元数据
+//
+//	@Summary      更新自定义元数据
+//	@Description  更新文件的自定义元数据及标签，字段不传时保持不变，传入时整体替换
+//	@Tags         元数据
+//	@Accept       application/json
+//	@Param        X-App-Key    header  string                 false  "应用标识"
+//	@Param        X-App-Token  header  string                 false  "应用令牌"
+//	@Param        RequestBody  body    models.UpdateUserMeta  true   "更新自定义元数据请求体"
+//	@Produce      application/json
+//	@Success      200  {object}  web.Response{data=models.UserMetaResp}
+//	@Router       /api/storage/v0/meta [put]
+func UserMetaHandler(c *gin.Context) {
+	var req models.UpdateUserMeta
+	if err := c.ShouldBindJSON(&req); err != nil {
+		web.ParamsError(c, fmt.Sprintf("参数解析有误，详情：%s", err))
+		return
+	}
+	uid, err := strconv.ParseInt(req.Uid, 10, 64)
+	if err != nil {
+		web.ParamsError(c, "uid参数有误")
+		return
+	}
+	var metadata map[string]string
+	var tags []string
+	if req.Metadata != nil {
+		metadata = *req.Metadata
+	}
+	if req.Tags != nil {
+		tags = *req.Tags
+	}
+	if err := base.CheckUserMeta(metadata, tags); err != nil {
+		web.ParamsError(c, err.Error())
+		return
+	}
+
+	lgDB := new(plugins.LangGoDB).Use("default").NewDB()
+	meta, err := repo.NewMetaDataInfoRepo().GetByUid(lgDB, uid)
+	if err != nil || meta.Status == utils.MetaStatusDeleted || meta.Status == utils.MetaStatusExpired {
+		web.NotFoundResource(c, "文件不存在")
+		return
+	}
+	if meta.Tenant != c.GetString(utils.ContextTenant) {
+		web.Forbidden(c, "无权修改该文件")
+		return
+	}
+
+	metaRows, tagRows := base.UserMetaRows(uid, metadata, tags)
+	if err := lgDB.Transaction(func(tx *gorm.DB) error {
+		if req.Metadata != nil {
+			if err := repo.NewUserMetaRepo().ReplaceMetadata(tx, uid, metaRows); err != nil {
+				return err
+			}
+		}
+		if req.Tags != nil {
+			if err := repo.NewUserMetaRepo().ReplaceTags(tx, uid, tagRows); err != nil {
+				return err
+			}
+		}
+		return nil
+	}); err != nil {
+		lgLogger.WithContext(c).Error("更新自定义元数据失败", zap.Any("err", err.Error()))
+		web.InternalError(c, "内部异常")
+		return
+	}
+
+	userMeta, err := base.GetUserMeta(lgDB, []int64{uid})
+	if err != nil {
+		lgLogger.WithContext(c).Error("查询自定义元数据失败", zap.Any("err", err.Error()))
+		web.InternalError(c, "内部异常")
+		return
+	}
+	resp := models.UserMetaResp{Uid: req.Uid, Metadata: map[string]string{}, Tags: []string{}}
+	if item, ok := userMeta[uid]; ok {
+		if item.Metadata != nil {
+			resp.Metadata = item.Metadata
+		}
+		if item.Tags != nil {
+			resp.Tags = item.Tags
+		}
+	}
+	web.Success(c, resp)
+}
+
+// FileListHandler    文件列表
+//
+//	@Summary      文件列表
+//	@Description  分页查询当前应用已上传完成的文件，支持按标签及自定义元数据过滤，多个条件同时满足
+//	@Tags         元数据
+//	@Accept       application/json
+//	@Param        X-App-Key    header  string    false  "应用标识"
+//	@Param        X-App-Token  header  string    false  "应用令牌"
+//	@Param        tag          query   []string  false  "标签，可传多个"
+//	@Param        meta         query   []string  false  "元数据，格式key:value，可传多个"
+//	@Param        page         query   int       false  "页码，默认1"
+//	@Param        pageSize     query   int       false  "每页数量，默认100"
+//	@Produce      application/json
+//	@Success      200  {object}  web.Response{data=models.FileListResp}
+//	@Router       /api/storage/v0/files [get]
+func FileListHandler(c *gin.Context) {
+	metadata, err := base.ParseMetaFilter(c.QueryArray("meta"))
+	if err != nil {
+		web.ParamsError(c, err.Error())
+		return
+	}
+	tags := utils.RemoveDuplicates(c.QueryArray("tag"))
+	page, err := strconv.Atoi(c.DefaultQuery("page", "1"))
+	if err != nil || page < 1 {
+		web.ParamsError(c, "page参数有误")
+		return
+	}
+	pageSize, err := strconv.Atoi(c.DefaultQuery("pageSize", "100"))
+	if err != nil || pageSize < 1 || pageSize > utils.FileListLimit {
+		web.ParamsError(c, "pageSize参数有误")
+		return
+	}
+
+	lgDB := new(plugins.LangGoDB).Use("default").NewDB()
+	metaList, total, err := repo.NewMetaDataInfoRepo().ListByTenant(lgDB, c.GetString(utils.ContextTenant), tags,
+		metadata, (page-1)*pageSize, pageSize)
+	if err != nil {
+		lgLogger.WithContext(c).Error("查询文件列表失败", zap.Any("err", err.Error()))
+		web.InternalError(c, "内部异常")
+		return
+	}
+	var uidList []int64
+	for _, meta := range metaList {
+		uidList = append(uidList, meta.UID)
+	}
+	userMeta, err := base.GetUserMeta(lgDB, uidList)
+	if err != nil {
+		lgLogger.WithContext(c).Error("查询自定义元数据失败", zap.Any("err", err.Error()))
+		web.InternalError(c, "内部异常")
+		return
+	}
+
+	resp := models.FileListResp{Total: total, Data: []models.FileItem{}}
+	for _, meta := range metaList {
+		item := models.FileItem{
+			Uid:         strconv.FormatInt(meta.UID, 10),
+			Name:        meta.Name,
+			Size:        meta.StorageSize,
+			Md5:         meta.Md5,
+			ContentType: meta.ContentType,
+			Metadata:    map[string]string{},
+			Tags:        []string{},
+		}
+		if meta.CreatedAt != nil {
+			item.CreatedAt = meta.CreatedAt.Format("2006-01-02 15:04:05")
+		}
+		if um, ok := userMeta[meta.UID]; ok {
+			if um.Metadata != nil {
+				item.Metadata = um.Metadata
+			}
+			if um.Tags != nil {
+				item.Tags = um.Tags
+			}
+		}
+		resp.Data = append(resp.Data, item)
+	}
+	web.Success(c, resp)
+}
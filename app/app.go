@@ -3,8 +3,10 @@ package app
 import (
 	"context"
 	"github.com/gin-gonic/gin"
+	"github.com/qinguoyi/osproxy/app/pkg/analytics"
 	"github.com/qinguoyi/osproxy/app/pkg/base"
 	"github.com/qinguoyi/osproxy/app/pkg/event/dispatch"
+	"github.com/qinguoyi/osproxy/app/pkg/sweeper"
 	"github.com/qinguoyi/osproxy/config"
 	"go.uber.org/zap"
 	"log"
@@ -59,6 +61,14 @@ func (a *App) RunServer() {
 	a.logger.Info("start task ...")
 	p, consumers := dispatch.RunTask()
 
+	// 启动 过期会话回收
+	a.logger.Info("start sweeper ...")
+	s := sweeper.RunSweeper()
+
+	// 启动 下载统计
+	a.logger.Info("start analytics ...")
+	collector := analytics.RunCollector()
+
 	// 等待中断信号以优雅地关闭应用
 	quit := make(chan os.Signal)
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
@@ -67,6 +77,7 @@ func (a *App) RunServer() {
 	// 关闭任务
 	log.Printf("stop task ...")
 	dispatch.StopTask(p, consumers)
+	s.Stop()
 
 	// 设置 5 秒的超时时间
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
@@ -77,6 +88,9 @@ func (a *App) RunServer() {
 	if err := a.Stop(ctx); err != nil {
 		panic(err)
 	}
+
+	// 下载请求处理完后再停止统计，写入剩余的下载事件
+	collector.Stop()
 }
 
 // Run 启动服务
@@ -0,0 +1,34 @@
+package middleware
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/qinguoyi/osproxy/app/pkg/base"
+	"github.com/qinguoyi/osproxy/app/pkg/utils"
+	"github.com/qinguoyi/osproxy/app/pkg/web"
+	"github.com/qinguoyi/osproxy/bootstrap"
+)
+
+/*
+管理接口鉴权
+*/
+
+// AdminAuth _
+type AdminAuth struct {
+}
+
+// NewAdminAuth _
+func NewAdminAuth() *AdminAuth {
+	return &AdminAuth{}
+}
+
+// Handler 校验请求头中的管理令牌，未配置令牌时拒绝所有请求
+func (a *AdminAuth) Handler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !base.CheckToken(bootstrap.NewConfig("").App.AdminToken, c.GetHeader(utils.HeaderAdminToken)) {
+			web.UnAuthorization(c, "管理令牌有误")
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,41 @@
+package middleware
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/qinguoyi/osproxy/app/pkg/base"
+	"github.com/qinguoyi/osproxy/app/pkg/utils"
+	"github.com/qinguoyi/osproxy/app/pkg/web"
+	"github.com/qinguoyi/osproxy/bootstrap"
+)
+
+/*
+租户鉴权，配额、回调及统计均按鉴权后的应用区分
+*/
+
+// TenantAuth _
+type TenantAuth struct {
+}
+
+// NewTenantAuth _
+func NewTenantAuth() *TenantAuth {
+	return &TenantAuth{}
+}
+
+// Handler 校验请求头中的应用标识及令牌，通过后写入上下文；未配置租户时不校验，应用标识为空
+func (t *TenantAuth) Handler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if len(bootstrap.NewConfig("").Tenants) == 0 {
+			c.Next()
+			return
+		}
+		appKey := c.GetHeader(utils.HeaderAppKey)
+		tenant := base.GetTenant(appKey)
+		if tenant == nil || !base.CheckToken(tenant.Token, c.GetHeader(utils.HeaderAppToken)) {
+			web.UnAuthorization(c, "应用标识或令牌有误")
+			c.Abort()
+			return
+		}
+		c.Set(utils.ContextTenant, appKey)
+		c.Next()
+	}
+}
@@ -0,0 +1,17 @@
+package models
+
+// ArchiveInfo 压缩包展开任务信息
+type ArchiveInfo struct {
+	StorageUid int64 `json:"storageUid"`
+}
+
+// ArchiveChildResp 压缩包子文件
+type ArchiveChildResp struct {
+	Uid         string `json:"uid"`
+	Name        string `json:"name"`
+	Path        string `json:"path"`
+	Md5         string `json:"md5"`
+	Size        int64  `json:"size"`
+	ContentType string `json:"contentType"`
+	Status      string `json:"status"` // 启用扫描时，扫描通过前为quarantined
+}
@@ -0,0 +1,74 @@
+package models
+
+import "time"
+
+// UploadBatch 批量上传会话，提交后批次内的文件才可见
+type UploadBatch struct {
+	ID          int64      `gorm:"column:id;primaryKey;not null;autoIncrement;comment:自增ID"`
+	BatchUid    int64      `gorm:"column:batch_uid;not null;uniqueIndex:idx_upload_batch_uid;comment:批次ID"`
+	Name        string     `gorm:"column:name;comment:批次名称"`
+	Tenant      string     `gorm:"column:tenant;comment:租户应用标识"`
+	Callback    string     `gorm:"column:callback;comment:回调地址"`
+	Expire      int        `gorm:"column:expire;comment:上传链接过期时间(s)"`
+	Total       int        `gorm:"column:total;comment:声明的文件数量"`
+	Status      int        `gorm:"column:status;not null;comment:状态 0 上传中 1 已提交"`
+	CommittedAt *time.Time `gorm:"column:committed_at;comment:提交时间"`
+	CreatedAt   *time.Time `gorm:"column:created_at;not null;comment:创建时间"`
+	UpdatedAt   *time.Time `gorm:"column:updated_at;not null;comment:更新时间"`
+}
+
+// BatchStat 批次内按状态统计
+type BatchStat struct {
+	Status int   `json:"status"`
+	Count  int64 `json:"count"`
+	Size   int64 `json:"size"`
+}
+
+// GenBatch 创建批量上传请求体
+type GenBatch struct {
+	Name     string `json:"name"`                      // 批次名称，如目录名
+	Expire   int    `json:"expire" binding:"required"` // 上传链接过期时间
+	Total    int    `json:"total"`                     // 文件数量，大于0时提交需数量一致
+	Callback string `json:"callback"`                  // 回调地址，为空使用租户配置
+}
+
+// GenBatchResp .
+type GenBatchResp struct {
+	BatchUid string `json:"batchUid"`
+}
+
+// GenBatchLink 批量上传分页生成链接请求体，path为目录内的相对路径
+type GenBatchLink struct {
+	BatchUid string       `json:"batchUid" binding:"required"`
+	Files    []UploadFile `json:"files" binding:"required"`
+	PartSize int64        `json:"partSize"` // 期望的分片大小
+	Rate     int64        `json:"rate"`     // 上传限速(KB/s)，0表示不限制
+}
+
+// BatchFileResp .
+type BatchFileResp struct {
+	Uid   string `json:"uid"`
+	Path  string `json:"path"`
+	State string `json:"state"`
+	Md5   string `json:"md5"`
+	Size  int64  `json:"size"`
+}
+
+// BatchFilesResp .
+type BatchFilesResp struct {
+	Total int64           `json:"total"`
+	Data  []BatchFileResp `json:"data"`
+}
+
+// BatchStatusResp 批次进度
+type BatchStatusResp struct {
+	BatchUid  string           `json:"batchUid"`
+	Name      string           `json:"name"`
+	Committed bool             `json:"committed"` // 是否已提交
+	Total     int              `json:"total"`     // 声明的文件数量
+	Files     int64            `json:"files"`     // 已生成链接的文件数量
+	Available int64            `json:"available"` // 已上传完成的文件数量
+	States    map[string]int64 `json:"states"`    // 各状态文件数量
+	Size      int64            `json:"size"`      // 已知的文件总大小
+	Received  int64            `json:"received"`  // 已接收字节数
+}
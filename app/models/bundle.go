@@ -0,0 +1,45 @@
+package models
+
+import "time"
+
+// DownloadBundle 打包下载信息，文件列表及包内路径在生成链接时确定
+type DownloadBundle struct {
+	ID        int64      `gorm:"column:id;primaryKey;not null;autoIncrement;comment:自增ID"`
+	BundleId  int64      `json:"bundleId,string" gorm:"column:bundle_id;not null;uniqueIndex:idx_download_bundle_id;comment:打包ID"`
+	Tenant    string     `json:"tenant" gorm:"column:tenant;comment:租户应用标识"`
+	Name      string     `json:"name" gorm:"column:name;type:varchar(255);comment:压缩包名称"`
+	Files     string     `json:"files" gorm:"column:files;type:text;comment:打包文件列表，json"`
+	Size      int64      `json:"size" gorm:"column:size;not null;default:0;comment:压缩包大小，-1表示存在需压缩的文件"`
+	ExpireAt  *time.Time `json:"expireAt" gorm:"column:expire_at;comment:过期时间"`
+	CreatedAt *time.Time `json:"createdAt" gorm:"column:created_at;not null;comment:创建时间"`
+}
+
+// BundleFile 打包文件
+type BundleFile struct {
+	Uid  string `json:"uid" binding:"required"`
+	Path string `json:"path"` // 压缩包内路径，为空时使用文件名，以/结尾时作为目录
+}
+
+// BundleEntry 打包文件在压缩包内的信息
+type BundleEntry struct {
+	Uid   int64  `json:"uid,string"`
+	Name  string `json:"name"`
+	Store bool   `json:"store"`
+}
+
+// GenBundle 打包下载链接请求体
+type GenBundle struct {
+	Files  []BundleFile `json:"files" binding:"required"`
+	Name   string       `json:"name"`                      // 压缩包名称，默认bundle.zip
+	Expire int          `json:"expire" binding:"required"` // 过期时间
+	Store  bool         `json:"store"`                     // 全部使用存储模式，可预先得知压缩包大小
+}
+
+// GenBundleResp .
+type GenBundleResp struct {
+	BundleId string `json:"bundleId"`
+	Name     string `json:"name"`
+	Url      string `json:"url"`
+	Count    int    `json:"count"`
+	Size     int64  `json:"size"` // 压缩包大小，-1表示存在需压缩的文件，无法预先得知
+}
@@ -0,0 +1,28 @@
+package models
+
+import "time"
+
+// DownloadLink 下载链接，链接ID参与签名，用于限制下载次数及撤销
+type DownloadLink struct {
+	ID           int64      `gorm:"column:id;primaryKey;not null;autoIncrement;comment:自增ID"`
+	LinkId       int64      `json:"linkId,string" gorm:"column:link_id;not null;uniqueIndex:idx_download_link_id;comment:链接ID"`
+	UID          int64      `json:"uid,string" gorm:"column:uid;not null;index:idx_download_link_uid;comment:文件ID"`
+	Tenant       string     `json:"tenant" gorm:"column:tenant;comment:租户应用标识"`
+	MaxDownloads int        `json:"maxDownloads" gorm:"column:max_downloads;not null;default:0;comment:最大下载次数，0表示不限制"`
+	Downloads    int        `json:"downloads" gorm:"column:downloads;not null;default:0;comment:已下载次数"`
+	Revoked      bool       `json:"revoked" gorm:"column:revoked;not null;default:false;comment:是否已撤销"`
+	ExpireAt     *time.Time `json:"expireAt" gorm:"column:expire_at;comment:过期时间"`
+	CreatedAt    *time.Time `json:"createdAt" gorm:"column:created_at;not null;comment:创建时间"`
+	UpdatedAt    *time.Time `json:"updatedAt" gorm:"column:updated_at;not null;comment:更新时间"`
+}
+
+// RevokeLink 撤销下载链接请求体，linkId和uid至少一个不为空，uid表示撤销该文件的所有链接
+type RevokeLink struct {
+	LinkId string `json:"linkId"`
+	Uid    string `json:"uid"`
+}
+
+// RevokeLinkResp .
+type RevokeLinkResp struct {
+	Revoked int64 `json:"revoked"` // 撤销的链接数量
+}
@@ -0,0 +1,71 @@
+package models
+
+import "time"
+
+// DownloadEvent 下载事件，由下载接口异步上报，不落库
+type DownloadEvent struct {
+	Uid    int64
+	LinkId int64 // 链接ID，打包下载为打包ID
+	Tenant string
+	Bytes  int64 // 实际发送的字节数
+	Range  bool  // 是否为Range请求
+	Status int
+	Method string
+	Client string // 客户端IP
+	Time   time.Time
+}
+
+// DownloadMetrics 下载统计指标
+type DownloadMetrics struct {
+	Requests  int64 `gorm:"column:requests;not null;default:0;comment:请求次数" json:"requests"`
+	Completes int64 `gorm:"column:completes;not null;default:0;comment:完整下载次数" json:"completes"`
+	Partials  int64 `gorm:"column:partials;not null;default:0;comment:Range请求次数" json:"partials"`
+	Bytes     int64 `gorm:"column:bytes;not null;default:0;comment:发送字节数" json:"bytes"`
+	Errors    int64 `gorm:"column:errors;not null;default:0;comment:失败次数" json:"errors"`
+	Clients   int64 `gorm:"column:clients;not null;default:0;comment:客户端数量，按小时去重" json:"clients"`
+}
+
+// DownloadStat 文件下载统计，按uid、链接及小时汇总
+type DownloadStat struct {
+	ID     int64     `gorm:"column:id;primaryKey;not null;autoIncrement;comment:自增ID"`
+	UID    int64     `gorm:"column:uid;not null;uniqueIndex:idx_download_stat_key;comment:文件ID"`
+	LinkId int64     `gorm:"column:link_id;not null;default:0;uniqueIndex:idx_download_stat_key;comment:链接ID"`
+	Hour   time.Time `gorm:"column:hour;not null;uniqueIndex:idx_download_stat_key;index:idx_download_stat_tenant_hour,priority:2;comment:统计小时"`
+	Tenant string    `gorm:"column:tenant;type:varchar(128);not null;default:'';index:idx_download_stat_tenant_hour,priority:1;comment:租户应用标识"`
+	DownloadMetrics
+	CreatedAt *time.Time `gorm:"column:created_at;not null;comment:创建时间"`
+	UpdatedAt *time.Time `gorm:"column:updated_at;not null;comment:更新时间"`
+}
+
+// TenantDownloadStat 租户下载统计，按小时汇总
+type TenantDownloadStat struct {
+	ID     int64     `gorm:"column:id;primaryKey;not null;autoIncrement;comment:自增ID"`
+	Tenant string    `gorm:"column:tenant;type:varchar(128);not null;default:'';uniqueIndex:idx_tenant_download_stat_key;comment:租户应用标识"`
+	Hour   time.Time `gorm:"column:hour;not null;uniqueIndex:idx_tenant_download_stat_key;comment:统计小时"`
+	DownloadMetrics
+	CreatedAt *time.Time `gorm:"column:created_at;not null;comment:创建时间"`
+	UpdatedAt *time.Time `gorm:"column:updated_at;not null;comment:更新时间"`
+}
+
+// DownloadStatPoint 统计时间段的下载指标
+type DownloadStatPoint struct {
+	Time string `json:"time"` // 时间段起点
+	DownloadMetrics
+}
+
+// FileDownloadStat 文件下载排行
+type FileDownloadStat struct {
+	Uid      string `json:"uid"`
+	Requests int64  `json:"requests"`
+	Bytes    int64  `json:"bytes"`
+}
+
+// DownloadStatResp 下载统计，客户端数量为各小时去重后的累加
+type DownloadStatResp struct {
+	Start    string              `json:"start"`
+	End      string              `json:"end"`
+	Interval string              `json:"interval"`
+	Total    DownloadMetrics     `json:"total"`
+	Series   []DownloadStatPoint `json:"series"`
+	Top      []FileDownloadStat  `json:"top,omitempty"` // 租户统计时按字节数排序的文件
+}
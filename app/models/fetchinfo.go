@@ -0,0 +1,39 @@
+package models
+
+// FetchItem 远程文件
+type FetchItem struct {
+	Url     string            `json:"url" binding:"required"` // 源地址
+	Name    string            `json:"name"`                   // 文件名称，为空时取源地址路径
+	Headers map[string]string `json:"headers"`                // 请求源地址时附带的请求头
+	Md5     string            `json:"md5"`                    // 期望的md5，为空不校验
+	Size    int64             `json:"size"`                   // 文件大小，用于预留配额，为空时按源地址的Content-Length
+}
+
+// FetchReq 服务端拉取请求体
+type FetchReq struct {
+	Data     []FetchItem `json:"data" binding:"required"`
+	Callback string      `json:"callback"` // 回调地址，为空使用租户配置
+}
+
+// FetchResp .
+type FetchResp struct {
+	Uid string `json:"uid"`
+	Url string `json:"url"`
+}
+
+// FetchInfo 拉取任务信息
+type FetchInfo struct {
+	StorageUid int64             `json:"storageUid"`
+	Url        string            `json:"url"`
+	Headers    map[string]string `json:"headers"`
+	Md5        string            `json:"md5"`
+}
+
+// FetchStatusResp .
+type FetchStatusResp struct {
+	Uid         string `json:"uid"`
+	Status      int    `json:"status"`      // 文件状态 -1 未上传 1 已上传 2 已过期
+	TaskStatus  int    `json:"taskStatus"`  // 任务状态 0 未执行 1 执行中 2 执行完成 99 执行失败
+	ExecuteTime int    `json:"executeTime"` // 任务执行次数
+	ErrorInfo   string `json:"errorInfo"`   // 最近一次错误信息
+}
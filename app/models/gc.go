@@ -0,0 +1,14 @@
+package models
+
+// GcReport 上传会话回收报告
+type GcReport struct {
+	Node            string `json:"node"`            // 节点
+	StartedAt       int64  `json:"startedAt"`       // 开始时间
+	Cost            int64  `json:"cost"`            // 耗时(ms)
+	ExpiredSessions int    `json:"expiredSessions"` // 过期会话数量
+	DeletedParts    int    `json:"deletedParts"`    // 删除的分片对象数量
+	DeletedBytes    int64  `json:"deletedBytes"`    // 删除的分片对象大小
+	DeletedDirs     int    `json:"deletedDirs"`     // 删除的本地目录数量
+	DeletedDirBytes int64  `json:"deletedDirBytes"` // 删除的本地目录大小
+	DeletedLinks    int64  `json:"deletedLinks"`    // 删除的过期下载链接数量
+}
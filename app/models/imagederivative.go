@@ -0,0 +1,35 @@
+package models
+
+import "time"
+
+// ImageDerivative 图片处理结果，按uid及处理参数缓存，原图md5变化时重新生成
+type ImageDerivative struct {
+	ID          int64      `gorm:"column:id;primaryKey;not null;autoIncrement;comment:自增ID"`
+	UID         int64      `gorm:"column:uid;not null;uniqueIndex:idx_image_derivative_uid_params;comment:原图文件ID"`
+	Params      string     `gorm:"column:params;type:varchar(255);not null;uniqueIndex:idx_image_derivative_uid_params;comment:处理参数"`
+	SourceMd5   string     `gorm:"column:source_md5;comment:原图md5"`
+	Bucket      string     `gorm:"column:bucket;not null;comment:桶"`
+	StorageName string     `gorm:"column:storage_name;not null;comment:存储名称"`
+	ContentType string     `gorm:"column:content_type;comment:文件类型"`
+	StorageSize int64      `gorm:"column:storage_size;comment:文件大小"`
+	Md5         string     `gorm:"column:md5;comment:md5"`
+	Width       int        `gorm:"column:width;comment:宽度"`
+	Height      int        `gorm:"column:height;comment:高度"`
+	CreatedAt   *time.Time `gorm:"column:created_at;not null;comment:创建时间"`
+	UpdatedAt   *time.Time `gorm:"column:updated_at;not null;comment:更新时间"`
+}
+
+// ImageOption 下载链接的图片处理参数，先裁剪后缩放
+type ImageOption struct {
+	Width   int    `json:"width"`   // 宽度，为0时按高度等比缩放
+	Height  int    `json:"height"`  // 高度，为0时按宽度等比缩放
+	Fit     string `json:"fit"`     // 缩放方式contain(默认)、cover、fill
+	Crop    string `json:"crop"`    // 裁剪区域x,y,w,h
+	Quality int    `json:"quality"` // jpeg质量1-100
+	Format  string `json:"format"`  // 输出格式jpeg、png、gif，为空时与原图一致
+}
+
+// ThumbnailInfo 缩略图生成任务信息
+type ThumbnailInfo struct {
+	StorageUid int64 `json:"storageUid"`
+}
@@ -0,0 +1,6 @@
+package models
+
+// MediaInfo 媒体元数据解析任务信息
+type MediaInfo struct {
+	StorageUid int64 `json:"storageUid"`
+}
@@ -20,17 +20,50 @@ type MetaDataInfo struct {
 	StorageSize int64      `gorm:"column:storage_size;comment:文件大小"`
 	MultiPart   bool       `gorm:"column:multi_part;not null;comment:是否分片"`
 	PartNum     int        `gorm:"column:part_num;comment:分片总量"`
-	Status      int        `gorm:"column:status;comment:是否上传"`
+	PartSize    int64      `gorm:"column:part_size;comment:计划分片大小"`
+	Status      int        `gorm:"column:status;comment:文件状态"`
 	ContentType string     `gorm:"column:content_type;comment:文件类型"`
-	CompressUid int64      `gorm:"column:compress_uid;comment:压缩文件ID"`
+	CompressUid int64      `gorm:"column:compress_uid;index:idx_compress_uid;comment:压缩文件ID"`
+	RelPath     string     `gorm:"column:rel_path;comment:相对路径"`
+	BatchUid    int64      `gorm:"column:batch_uid;default:0;index:idx_meta_batch_uid;comment:批次ID"`
+	Tenant      string     `gorm:"column:tenant;comment:租户应用标识"`
+	Callback    string     `gorm:"column:callback;comment:回调地址"`
+	ScanResult  string     `gorm:"column:scan_result;comment:扫描结果，clean或病毒特征名称"`
+	ScannedAt   *time.Time `gorm:"column:scanned_at;comment:扫描时间"`
+	Attributes  string     `gorm:"column:attributes;type:text;comment:扩展属性(json)"`
+	ExpireAt    *time.Time `gorm:"column:expire_at;comment:上传链接过期时间"`
+	Reserved    int64      `gorm:"column:reserved;not null;default:0;comment:生成链接时预留的配额容量"`
+	LinkRevoked *time.Time `gorm:"column:link_revoked;comment:下载链接撤销时间，之前生成的链接均失效"`
 	CreatedAt   *time.Time `gorm:"column:created_at;not null;comment:创建时间"`
 	UpdatedAt   *time.Time `gorm:"column:updated_at;not null;comment:更新时间"`
 }
 
-// GenUpload 上传链接请求体
+// MetaStatusHistory 文件状态流转记录
+type MetaStatusHistory struct {
+	ID         int64      `gorm:"column:id;primaryKey;not null;autoIncrement;comment:自增ID"`
+	UID        int64      `json:"uid" gorm:"column:uid;not null;index:idx_status_history_uid"`
+	FromStatus int        `json:"fromStatus" gorm:"column:from_status;comment:原状态"`
+	ToStatus   int        `json:"toStatus" gorm:"column:to_status;comment:新状态"`
+	CreatedAt  *time.Time `gorm:"column:created_at;not null;comment:创建时间"`
+}
+
+// UploadFile 待上传文件，声明大小后返回分片上传计划
+type UploadFile struct {
+	Path     string            `json:"path" binding:"required"` // 文件路径
+	Size     int64             `json:"size"`                    // 文件大小
+	Md5      string            `json:"md5"`                     // 文件md5
+	Metadata map[string]string `json:"metadata"`                // 自定义元数据
+	Tags     []string          `json:"tags"`                    // 标签
+}
+
+// GenUpload 上传链接请求体，filePath和files至少一个不为空
 type GenUpload struct {
-	FilePath []string `json:"filePath" binding:"required"` // 文件路径
-	Expire   int      `json:"expire"`                      // 过期时间
+	FilePath []string     `json:"filePath"` // 文件路径
+	Files    []UploadFile `json:"files"`    // 带大小及md5的文件
+	PartSize int64        `json:"partSize"` // 期望的分片大小，服务端会调整到允许范围内
+	Expire   int          `json:"expire"`   // 过期时间
+	Rate     int64        `json:"rate"`     // 上传限速(KB/s)，0表示不限制
+	Callback string       `json:"callback"` // 回调地址，为空使用租户配置
 }
 
 // MultiUrlResult .
@@ -44,16 +77,43 @@ type UrlResult struct {
 	Multi  *MultiUrlResult `json:"multi"`
 }
 
+// PlanPart 计划中的分片
+type PlanPart struct {
+	Num  int64  `json:"num"`
+	Size int64  `json:"size"`
+	Url  string `json:"url"`
+}
+
+// UploadPlan 分片上传计划
+type UploadPlan struct {
+	Size      int64      `json:"size"`
+	Md5       string     `json:"md5"`
+	PartSize  int64      `json:"partSize"`
+	PartCount int64      `json:"partCount"`
+	Parts     []PlanPart `json:"parts"`
+}
+
 type GenUploadResp struct {
-	Uid  string     `json:"uid"`
-	Url  *UrlResult `json:"url"`
-	Path string     `json:"path"`
+	Uid  string      `json:"uid"`
+	Url  *UrlResult  `json:"url"`
+	Path string      `json:"path"`
+	Plan *UploadPlan `json:"plan,omitempty"`
 }
 
 // GenDownload 下载链接请求体
 type GenDownload struct {
 	Uid    []string `json:"uid" binding:"required"`    // 文件路径
 	Expire int      `json:"expire" binding:"required"` // 过期时间
+	Rate   int64    `json:"rate"`                      // 链接限速(KB/s)，0表示不限制
+
+	MaxDownloads int  `json:"maxDownloads"` // 最大下载次数，0表示不限制，1为一次性链接
+	Revocable    bool `json:"revocable"`    // 是否可撤销，限次链接总是可撤销
+
+	Ip      []string `json:"ip"`      // 允许的客户端IP或CIDR，为空不限制
+	Referer []string `json:"referer"` // 允许的来源域名，*.example.com匹配子域名，为空不限制
+	Header  string   `json:"header"`  // 要求的请求头，格式Name:Value，为空不限制
+
+	Image *ImageOption `json:"image"` // 图片处理参数，为空返回原图
 }
 
 type MetaInfo struct {
@@ -63,12 +123,19 @@ type MetaInfo struct {
 	Width   int    `json:"width"`
 	Md5     string `json:"md5"`
 	Size    string `json:"size"`
+
+	Attributes map[string]interface{} `json:"attributes,omitempty"` // 扩展属性，如时长、编码、拍摄时间
+	Metadata   map[string]string      `json:"metadata,omitempty"`   // 自定义元数据
+	Tags       []string               `json:"tags,omitempty"`       // 标签
 }
 
 type GenDownloadResp struct {
-	Uid  string   `json:"uid"`
-	Url  string   `json:"url"`
-	Meta MetaInfo `json:"meta"`
+	Uid    string   `json:"uid"`
+	LinkId string   `json:"linkId"` // 链接ID，可撤销的链接才返回
+	Url    string   `json:"url"`
+	Meta   MetaInfo `json:"meta"`
+
+	Thumbnails map[string]string `json:"thumbnails,omitempty"` // 缩略图名称及下载地址，只有图片返回
 }
 
 type MD5Name struct {
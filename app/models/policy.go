@@ -0,0 +1,27 @@
+package models
+
+// GenPolicy 表单上传策略请求体
+type GenPolicy struct {
+	Expire      int    `json:"expire" binding:"required"`  // 过期时间
+	KeyPrefix   string `json:"keyPrefix"`                  // 文件路径前缀
+	MinSize     int64  `json:"minSize"`                    // 文件最小字节数
+	MaxSize     int64  `json:"maxSize" binding:"required"` // 文件最大字节数
+	ContentType string `json:"contentType"`                // 允许的content-type前缀，如image/
+	SuccessUrl  string `json:"successUrl"`                 // 上传成功后的跳转地址
+	Callback    string `json:"callback"`                   // 回调地址，为空使用租户配置
+}
+
+// GenPolicyResp 表单上传策略，fields需作为表单隐藏字段原样提交
+type GenPolicyResp struct {
+	Url        string            `json:"url"`
+	Expiration string            `json:"expiration"`
+	Fields     map[string]string `json:"fields"`
+}
+
+// PolicyUploadResp .
+type PolicyUploadResp struct {
+	Uid  string `json:"uid"`
+	Key  string `json:"key"`
+	Md5  string `json:"md5"`
+	Size int64  `json:"size"`
+}
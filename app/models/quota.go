@@ -0,0 +1,26 @@
+package models
+
+import "time"
+
+// TenantUsage 租户存储用量，秒传共用存储对象的文件只计数量不计容量
+type TenantUsage struct {
+	ID        int64      `gorm:"column:id;primaryKey;not null;autoIncrement;comment:自增ID"`
+	Tenant    string     `gorm:"column:tenant;type:varchar(128);not null;uniqueIndex:idx_tenant_usage_tenant;comment:租户应用标识"`
+	Bytes     int64      `gorm:"column:bytes;not null;default:0;comment:已用容量"`
+	Files     int64      `gorm:"column:files;not null;default:0;comment:文件数量"`
+	Reserved  int64      `gorm:"column:reserved;not null;default:0;comment:上传中文件预留的容量"`
+	Warned    bool       `gorm:"column:warned;not null;default:false;comment:是否已发送软限制告警"`
+	CreatedAt *time.Time `gorm:"column:created_at;not null;comment:创建时间"`
+	UpdatedAt *time.Time `gorm:"column:updated_at;not null;comment:更新时间"`
+}
+
+// QuotaResp 租户配额及用量
+type QuotaResp struct {
+	Tenant    string `json:"tenant"`
+	Bytes     int64  `json:"bytes"`     // 已用容量
+	Files     int64  `json:"files"`     // 文件数量
+	Reserved  int64  `json:"reserved"`  // 上传中文件预留的容量
+	MaxBytes  int64  `json:"maxBytes"`  // 容量上限，0表示不限制
+	MaxFiles  int64  `json:"maxFiles"`  // 文件数量上限，0表示不限制
+	SoftLimit int    `json:"softLimit"` // 告警百分比
+}
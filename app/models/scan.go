@@ -0,0 +1,7 @@
+package models
+
+// ScanInfo 扫描任务信息
+type ScanInfo struct {
+	StorageUid int64  `json:"storageUid"`
+	Event      string `json:"event"` // 扫描通过后发送的回调事件
+}
@@ -0,0 +1,54 @@
+package models
+
+// PartStatus 分片信息
+type PartStatus struct {
+	Num  int    `json:"num"`  // 分片序号
+	Size int64  `json:"size"` // 分片大小
+	Md5  string `json:"md5"`  // 分片md5
+}
+
+// MergeStatus 合并任务信息
+type MergeStatus struct {
+	TaskStatus  int    `json:"taskStatus"`  // 任务状态 0 未执行 1 执行中 2 执行完成 99 执行失败
+	ExecuteTime int    `json:"executeTime"` // 任务执行次数
+	NodeId      string `json:"nodeId"`      // 任务运行节点
+	ErrorInfo   string `json:"errorInfo"`   // 最近一次错误信息
+}
+
+// ObjectInfo 上传完成后的对象信息
+type ObjectInfo struct {
+	Bucket      string `json:"bucket"`
+	StorageName string `json:"storageName"`
+	Md5         string `json:"md5"`
+	Size        int64  `json:"size"`
+	ContentType string `json:"contentType"`
+	ScanResult  string `json:"scanResult,omitempty"` // 扫描结果，clean或病毒特征名称
+}
+
+// StatusHistory 状态流转记录
+type StatusHistory struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+	Time string `json:"time"`
+}
+
+// UploadStatusResp 上传会话状态
+type UploadStatusResp struct {
+	Uid      string          `json:"uid"`
+	State    string          `json:"state"`    // 会话状态
+	Status   int             `json:"status"`   // 文件状态
+	Name     string          `json:"name"`     // 文件名称
+	Received int64           `json:"received"` // 已接收字节数
+	Node     string          `json:"node"`     // 暂存数据所在节点
+	Parts    []PartStatus    `json:"parts"`    // 已上传分片
+	Merge    *MergeStatus    `json:"merge"`    // 合并任务
+	Object   *ObjectInfo     `json:"object"`   // 对象信息，上传完成后返回
+	History  []StatusHistory `json:"history"`  // 状态流转记录
+}
+
+// RangeUploadResp 断点续传上传进度
+type RangeUploadResp struct {
+	Uid    string `json:"uid"`
+	Offset int64  `json:"offset"` // 已接收的字节数，下次从该位置续传
+	Total  int64  `json:"total"`
+}
@@ -9,6 +9,7 @@ type TaskInfo struct {
 	TaskType    string     `json:"taskType" gorm:"column:task_type;not null;type:varchar(255)"`      // 任务类型
 	UserID      string     `json:"userId" gorm:"column:user_id;type:varchar(255)"`                   // 任务触发者
 	ExtraData   string     `json:"extraData" gorm:"column:extra_data;type:text"`                     // 任务补充信息
+	StorageUid  int64      `json:"storageUid" gorm:"column:storage_uid;index:idx_task_storage_uid"`  // 任务关联的文件uid
 	NodeId      string     `json:"nodeId" gorm:"column:node_id;type:varchar(255);index:idx_node_id"` // 任务运行节点ID
 	TaskLogID   int        `json:"taskLogId" gorm:"column:task_log_id"`                              // 任务日志ID，只展示最新的任务日志ID
 	ExecuteTime int        `json:"executeTime" gorm:"column:execute_time;comment:任务执行次数;default:1"`
@@ -0,0 +1,58 @@
+package models
+
+import "time"
+
+// FileMetadata 文件自定义元数据
+type FileMetadata struct {
+	ID        int64      `gorm:"column:id;primaryKey;not null;autoIncrement;comment:自增ID"`
+	UID       int64      `gorm:"column:uid;not null;uniqueIndex:idx_file_metadata_uid_key,priority:1;comment:文件ID"`
+	MetaKey   string     `gorm:"column:meta_key;type:varchar(128);not null;uniqueIndex:idx_file_metadata_uid_key,priority:2;index:idx_file_metadata_kv,priority:1;comment:键"`
+	MetaValue string     `gorm:"column:meta_value;type:varchar(512);not null;index:idx_file_metadata_kv,priority:2;comment:值"`
+	CreatedAt *time.Time `gorm:"column:created_at;not null;comment:创建时间"`
+}
+
+// FileTag 文件标签
+type FileTag struct {
+	ID        int64      `gorm:"column:id;primaryKey;not null;autoIncrement;comment:自增ID"`
+	UID       int64      `gorm:"column:uid;not null;uniqueIndex:idx_file_tag_uid_tag,priority:1;comment:文件ID"`
+	Tag       string     `gorm:"column:tag;type:varchar(128);not null;uniqueIndex:idx_file_tag_uid_tag,priority:2;index:idx_file_tag_tag;comment:标签"`
+	CreatedAt *time.Time `gorm:"column:created_at;not null;comment:创建时间"`
+}
+
+// UserMeta 文件自定义元数据及标签
+type UserMeta struct {
+	Metadata map[string]string `json:"metadata,omitempty"` // 键值对元数据
+	Tags     []string          `json:"tags,omitempty"`     // 标签
+}
+
+// UpdateUserMeta 更新自定义元数据请求体，字段为空时保持不变，非空时整体替换
+type UpdateUserMeta struct {
+	Uid      string             `json:"uid" binding:"required"`
+	Metadata *map[string]string `json:"metadata"`
+	Tags     *[]string          `json:"tags"`
+}
+
+// UserMetaResp .
+type UserMetaResp struct {
+	Uid      string            `json:"uid"`
+	Metadata map[string]string `json:"metadata"`
+	Tags     []string          `json:"tags"`
+}
+
+// FileItem 文件列表项
+type FileItem struct {
+	Uid         string            `json:"uid"`
+	Name        string            `json:"name"`
+	Size        int64             `json:"size"`
+	Md5         string            `json:"md5"`
+	ContentType string            `json:"contentType"`
+	Metadata    map[string]string `json:"metadata"`
+	Tags        []string          `json:"tags"`
+	CreatedAt   string            `json:"createdAt"`
+}
+
+// FileListResp .
+type FileListResp struct {
+	Total int64      `json:"total"`
+	Data  []FileItem `json:"data"`
+}
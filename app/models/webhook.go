@@ -0,0 +1,42 @@
+package models
+
+import "time"
+
+// WebhookLog 回调投递记录，每次投递尝试一条
+type WebhookLog struct {
+	ID         int64      `gorm:"column:id;primaryKey;not null;autoIncrement;comment:自增ID"`
+	TaskID     int64      `json:"taskId" gorm:"column:task_id;index:idx_webhook_task_id"` // 任务ID
+	StorageUid int64      `json:"storageUid" gorm:"column:storage_uid;index:idx_webhook_uid"`
+	Event      string     `json:"event" gorm:"column:event;type:varchar(64)"`   // 事件类型
+	Url        string     `json:"url" gorm:"column:url;type:varchar(1024)"`     // 回调地址
+	Attempt    int        `json:"attempt" gorm:"column:attempt"`                // 第几次投递
+	StatusCode int        `json:"statusCode" gorm:"column:status_code"`         // 响应状态码
+	ErrorInfo  string     `json:"errorInfo" gorm:"column:error_info;type:text"` // 错误信息
+	CreatedAt  *time.Time `gorm:"column:created_at;not null;comment:创建时间"`
+	UpdatedAt  *time.Time `gorm:"column:updated_at;not null;comment:更新时间"`
+}
+
+// WebhookInfo 回调任务信息
+type WebhookInfo struct {
+	StorageUid int64  `json:"storageUid"`
+	Event      string `json:"event"`
+	Tenant     string `json:"tenant"`
+	Url        string `json:"url"`
+	Payload    string `json:"payload"`
+}
+
+// WebhookEvent 回调请求体
+type WebhookEvent struct {
+	Event       string     `json:"event"`
+	Uid         string     `json:"uid"`
+	Bucket      string     `json:"bucket"`
+	Name        string     `json:"name"`
+	Md5         string     `json:"md5"`
+	Size        int64      `json:"size"`
+	ContentType string     `json:"contentType"`
+	Timestamp   int64      `json:"timestamp"`
+	Batch       string     `json:"batch,omitempty"`      // 批次ID，批次提交事件返回
+	Files       int64      `json:"files,omitempty"`      // 批次内文件数量
+	ScanResult  string     `json:"scanResult,omitempty"` // 扫描结果，clean或病毒特征名称
+	Quota       *QuotaResp `json:"quota,omitempty"`      // 租户用量，配额告警事件返回
+}
@@ -0,0 +1,215 @@
+package analytics
+
+/*
+下载统计：下载事件先在内存中合并，批量写入redis，再由单个节点定时汇总写入数据库
+*/
+
+import (
+	"context"
+	"fmt"
+	"github.com/go-redis/redis/v8"
+	"github.com/qinguoyi/osproxy/app/models"
+	"github.com/qinguoyi/osproxy/app/pkg/base"
+	"github.com/qinguoyi/osproxy/app/pkg/repo"
+	"github.com/qinguoyi/osproxy/app/pkg/utils"
+	"github.com/qinguoyi/osproxy/bootstrap"
+	"github.com/qinguoyi/osproxy/bootstrap/plugins"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	eventBuffer   = 10000
+	batchSize     = 1000
+	batchInterval = time.Second
+	// 客户端去重记录保留的时间，超过后该小时的客户端数量不再更新
+	clientsExpire = 25 * time.Hour
+)
+
+var events = make(chan models.DownloadEvent, eventBuffer)
+
+// Record 上报下载事件，未启用或队列已满时丢弃，不阻塞下载
+func Record(e models.DownloadEvent) {
+	if !bootstrap.NewConfig("").Analytics.Enabled {
+		return
+	}
+	select {
+	case events <- e:
+	default:
+	}
+}
+
+type Collector struct {
+	Wg     *sync.WaitGroup
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// RunCollector 启动下载统计，未启用时不执行
+func RunCollector() *Collector {
+	ctx, cancel := context.WithCancel(context.Background())
+	s := &Collector{
+		Wg:     &sync.WaitGroup{},
+		ctx:    ctx,
+		cancel: cancel,
+	}
+	if !bootstrap.NewConfig("").Analytics.Enabled {
+		return s
+	}
+	s.Wg.Add(1)
+	go s.run()
+	return s
+}
+
+// Stop 停止下载统计，退出前写入队列中剩余的事件
+func (s *Collector) Stop() {
+	s.cancel()
+	s.Wg.Wait()
+}
+
+func (s *Collector) run() {
+	defer s.Wg.Done()
+	ticker := time.NewTicker(batchInterval)
+	defer ticker.Stop()
+	timer := time.NewTimer(flushInterval())
+	defer timer.Stop()
+	batch := make([]models.DownloadEvent, 0, batchSize)
+	for {
+		select {
+		case e := <-events:
+			batch = append(batch, e)
+			if len(batch) >= batchSize {
+				save(batch)
+				batch = batch[:0]
+			}
+		case <-ticker.C:
+			save(batch)
+			batch = batch[:0]
+		case <-timer.C:
+			if err := Flush(); err != nil {
+				bootstrap.NewLogger().Logger.Error("下载统计写入数据库失败", zap.Any("err", err.Error()))
+			}
+			timer.Reset(flushInterval())
+		case <-s.ctx.Done():
+			for len(events) > 0 {
+				batch = append(batch, <-events)
+			}
+			save(batch)
+			if err := Flush(); err != nil {
+				bootstrap.NewLogger().Logger.Error("下载统计写入数据库失败", zap.Any("err", err.Error()))
+			}
+			fmt.Println("下载统计终止...")
+			return
+		}
+	}
+}
+
+func flushInterval() time.Duration {
+	if i := bootstrap.NewConfig("").Analytics.FlushInterval; i > 0 {
+		return time.Duration(i) * time.Second
+	}
+	return time.Minute
+}
+
+// save 合并一批事件，通过pipeline写入redis，失败时丢弃
+func save(batch []models.DownloadEvent) {
+	if len(batch) == 0 {
+		return
+	}
+	fields, clients := aggregate(batch)
+	ctx := context.Background()
+	pipe := new(plugins.LangGoRedis).NewRedis().Pipeline()
+	for field, v := range fields {
+		pipe.HIncrBy(ctx, utils.AnalyticsRedisPending, field, v)
+	}
+	for key, members := range clients {
+		pipe.PFAdd(ctx, key, members...)
+		pipe.Expire(ctx, key, clientsExpire)
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		bootstrap.NewLogger().Logger.Warn("下载统计写入redis失败", zap.Int("events", len(batch)),
+			zap.Any("err", err.Error()))
+	}
+}
+
+// Flush 将redis中的统计汇总写入数据库，同一时间只有一个节点执行
+func Flush() error {
+	ctx := context.Background()
+	lgRedis := new(plugins.LangGoRedis).NewRedis()
+	lock := base.NewRedisLock(&ctx, lgRedis, utils.AnalyticsRedisLock)
+	lock.SetExpire(60)
+	if flag, err := lock.Acquire(); err != nil || !flag {
+		return err
+	}
+	defer func() {
+		_, _ = lock.Release()
+	}()
+
+	// 上次写入失败的统计仍在flushing中，先重新写入，否则将pending整体改名，之后的事件写入新的pending
+	n, err := lgRedis.Exists(ctx, utils.AnalyticsRedisFlushing).Result()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		if err := lgRedis.Rename(ctx, utils.AnalyticsRedisPending, utils.AnalyticsRedisFlushing).Err(); err != nil {
+			if strings.Contains(err.Error(), "no such key") {
+				return nil
+			}
+			return err
+		}
+	}
+	values, err := lgRedis.HGetAll(ctx, utils.AnalyticsRedisFlushing).Result()
+	if err != nil {
+		return err
+	}
+	files, tenants := parseFields(values)
+
+	// 客户端数量取该小时的去重结果，查询失败时为0，不更新数据库中的值
+	pipe := lgRedis.Pipeline()
+	fileClients := map[fileKey]*redis.IntCmd{}
+	for k := range files {
+		fileClients[k] = pipe.PFCount(ctx, k.clientsKey())
+	}
+	tenantClients := map[tenantKey]*redis.IntCmd{}
+	for k := range tenants {
+		tenantClients[k] = pipe.PFCount(ctx, k.clientsKey())
+	}
+	_, _ = pipe.Exec(ctx)
+	for k, m := range files {
+		m.Clients = fileClients[k].Val()
+	}
+	for k, m := range tenants {
+		m.Clients = tenantClients[k].Val()
+	}
+
+	lgDB := new(plugins.LangGoDB).Use("default").NewDB()
+	if err := lgDB.Transaction(func(tx *gorm.DB) error {
+		for k, m := range files {
+			if err := repo.NewDownloadStatRepo().Add(tx, &models.DownloadStat{
+				UID:             k.uid,
+				LinkId:          k.linkId,
+				Hour:            time.Unix(k.hour, 0),
+				Tenant:          k.tenant,
+				DownloadMetrics: *m,
+			}); err != nil {
+				return err
+			}
+		}
+		for k, m := range tenants {
+			if err := repo.NewDownloadStatRepo().AddTenant(tx, &models.TenantDownloadStat{
+				Tenant:          k.tenant,
+				Hour:            time.Unix(k.hour, 0),
+				DownloadMetrics: *m,
+			}); err != nil {
+				return err
+			}
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+	return lgRedis.Del(ctx, utils.AnalyticsRedisFlushing).Err()
+}
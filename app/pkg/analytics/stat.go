@@ -0,0 +1,271 @@
+package analytics
+
+/*
+下载统计的字段编码及按时间段汇总
+*/
+
+import (
+	"errors"
+	"fmt"
+	"github.com/qinguoyi/osproxy/app/models"
+	"github.com/qinguoyi/osproxy/app/pkg/utils"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 统计指标名称
+const (
+	metricRequests  = "requests"
+	metricCompletes = "completes"
+	metricPartials  = "partials"
+	metricBytes     = "bytes"
+	metricErrors    = "errors"
+)
+
+const timeLayout = "2006-01-02 15:04:05"
+
+// fileKey 文件统计的汇总维度
+type fileKey struct {
+	uid    int64
+	linkId int64
+	hour   int64
+	tenant string
+}
+
+func (k fileKey) field(metric string) string {
+	return fmt.Sprintf("u|%d|%d|%d|%s|%s", k.uid, k.linkId, k.hour, metric, k.tenant)
+}
+
+func (k fileKey) clientsKey() string {
+	return fmt.Sprintf("%s:u:%d:%d:%d", utils.AnalyticsRedisClients, k.uid, k.linkId, k.hour)
+}
+
+// tenantKey 租户统计的汇总维度
+type tenantKey struct {
+	hour   int64
+	tenant string
+}
+
+func (k tenantKey) field(metric string) string {
+	return fmt.Sprintf("t|%d|%s|%s", k.hour, metric, k.tenant)
+}
+
+func (k tenantKey) clientsKey() string {
+	return fmt.Sprintf("%s:t:%d:%s", utils.AnalyticsRedisClients, k.hour, k.tenant)
+}
+
+// eventMetrics 单个事件的统计指标，只有成功的GET请求计入下载次数及字节数
+func eventMetrics(e *models.DownloadEvent) models.DownloadMetrics {
+	m := models.DownloadMetrics{Requests: 1}
+	switch {
+	case e.Status >= http.StatusBadRequest:
+		m.Errors = 1
+	case e.Method == http.MethodHead:
+	case e.Status == http.StatusOK || e.Status == http.StatusPartialContent:
+		if e.Range {
+			m.Partials = 1
+		} else {
+			m.Completes = 1
+		}
+		m.Bytes = e.Bytes
+	}
+	return m
+}
+
+// metricValues 指标名称及数值，客户端数量单独去重，不在其中
+func metricValues(m *models.DownloadMetrics) map[string]int64 {
+	return map[string]int64{
+		metricRequests:  m.Requests,
+		metricCompletes: m.Completes,
+		metricPartials:  m.Partials,
+		metricBytes:     m.Bytes,
+		metricErrors:    m.Errors,
+	}
+}
+
+func addMetric(m *models.DownloadMetrics, metric string, v int64) bool {
+	switch metric {
+	case metricRequests:
+		m.Requests += v
+	case metricCompletes:
+		m.Completes += v
+	case metricPartials:
+		m.Partials += v
+	case metricBytes:
+		m.Bytes += v
+	case metricErrors:
+		m.Errors += v
+	default:
+		return false
+	}
+	return true
+}
+
+// addMetrics 累加统计指标
+func addMetrics(m *models.DownloadMetrics, o *models.DownloadMetrics) {
+	m.Requests += o.Requests
+	m.Completes += o.Completes
+	m.Partials += o.Partials
+	m.Bytes += o.Bytes
+	m.Errors += o.Errors
+	m.Clients += o.Clients
+}
+
+// aggregate 合并一批事件，返回redis统计字段的增量及各小时需去重的客户端
+func aggregate(events []models.DownloadEvent) (map[string]int64, map[string][]interface{}) {
+	fields := map[string]int64{}
+	clients := map[string][]interface{}{}
+	for i := range events {
+		e := &events[i]
+		hour := e.Time.Truncate(time.Hour).Unix()
+		fk := fileKey{uid: e.Uid, linkId: e.LinkId, hour: hour, tenant: e.Tenant}
+		tk := tenantKey{hour: hour, tenant: e.Tenant}
+		m := eventMetrics(e)
+		for metric, v := range metricValues(&m) {
+			if v != 0 {
+				fields[fk.field(metric)] += v
+				fields[tk.field(metric)] += v
+			}
+		}
+		if e.Client != "" {
+			clients[fk.clientsKey()] = append(clients[fk.clientsKey()], e.Client)
+			clients[tk.clientsKey()] = append(clients[tk.clientsKey()], e.Client)
+		}
+	}
+	return fields, clients
+}
+
+// parseFields 解析redis中的统计字段，按文件及租户汇总，无法解析的字段忽略
+func parseFields(values map[string]string) (map[fileKey]*models.DownloadMetrics, map[tenantKey]*models.DownloadMetrics) {
+	files := map[fileKey]*models.DownloadMetrics{}
+	tenants := map[tenantKey]*models.DownloadMetrics{}
+	for field, value := range values {
+		v, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			continue
+		}
+		switch {
+		case strings.HasPrefix(field, "u|"):
+			items := strings.SplitN(field, "|", 6)
+			if len(items) != 6 {
+				continue
+			}
+			var k fileKey
+			var err1, err2, err3 error
+			k.uid, err1 = strconv.ParseInt(items[1], 10, 64)
+			k.linkId, err2 = strconv.ParseInt(items[2], 10, 64)
+			k.hour, err3 = strconv.ParseInt(items[3], 10, 64)
+			if err1 != nil || err2 != nil || err3 != nil {
+				continue
+			}
+			k.tenant = items[5]
+			m, ok := files[k]
+			if !ok {
+				m = &models.DownloadMetrics{}
+			}
+			if addMetric(m, items[4], v) {
+				files[k] = m
+			}
+		case strings.HasPrefix(field, "t|"):
+			items := strings.SplitN(field, "|", 4)
+			if len(items) != 4 {
+				continue
+			}
+			hour, err := strconv.ParseInt(items[1], 10, 64)
+			if err != nil {
+				continue
+			}
+			k := tenantKey{hour: hour, tenant: items[3]}
+			m, ok := tenants[k]
+			if !ok {
+				m = &models.DownloadMetrics{}
+			}
+			if addMetric(m, items[2], v) {
+				tenants[k] = m
+			}
+		}
+	}
+	return files, tenants
+}
+
+// ParseStatRange 解析统计的时间范围[start, end)及粒度，默认最近24小时按小时统计，maxDays为0时不限制范围
+func ParseStatRange(startStr, endStr, interval string, maxDays int, now time.Time) (time.Time, time.Time, string, error) {
+	if interval == "" {
+		interval = utils.StatIntervalHour
+	}
+	if !utils.Contains(interval, []string{utils.StatIntervalHour, utils.StatIntervalDay}) {
+		return time.Time{}, time.Time{}, "", errors.New("interval参数有误，支持hour、day")
+	}
+	end := now
+	if endStr != "" {
+		t, err := time.ParseInLocation(timeLayout, endStr, now.Location())
+		if err != nil {
+			return time.Time{}, time.Time{}, "", errors.New("end参数有误，格式为2006-01-02 15:04:05")
+		}
+		end = t
+	}
+	start := end.Add(-24 * time.Hour)
+	if startStr != "" {
+		t, err := time.ParseInLocation(timeLayout, startStr, now.Location())
+		if err != nil {
+			return time.Time{}, time.Time{}, "", errors.New("start参数有误，格式为2006-01-02 15:04:05")
+		}
+		start = t
+	}
+	start = truncate(start, interval)
+	if !start.Before(end) {
+		return time.Time{}, time.Time{}, "", errors.New("start须早于end")
+	}
+	if maxDays > 0 && end.Sub(start) > time.Duration(maxDays)*24*time.Hour {
+		return time.Time{}, time.Time{}, "", fmt.Errorf("时间范围不能超过%d天", maxDays)
+	}
+	return start, end, interval, nil
+}
+
+// truncate 时间所在统计时间段的起点，按天统计时使用时间所在的时区
+func truncate(t time.Time, interval string) time.Time {
+	if interval == utils.StatIntervalDay {
+		return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+	}
+	return t.Truncate(time.Hour)
+}
+
+func next(t time.Time, interval string) time.Time {
+	if interval == utils.StatIntervalDay {
+		return t.AddDate(0, 0, 1)
+	}
+	return t.Add(time.Hour)
+}
+
+// StatRow 按小时的统计记录
+type StatRow struct {
+	Hour    time.Time
+	Metrics models.DownloadMetrics
+}
+
+// Series 按粒度汇总[start, end)内的统计，没有数据的时间段补零，同时返回合计
+func Series(rows []StatRow, start, end time.Time, interval string) ([]models.DownloadStatPoint, models.DownloadMetrics) {
+	var total models.DownloadMetrics
+	buckets := map[int64]*models.DownloadMetrics{}
+	for i := range rows {
+		t := truncate(rows[i].Hour.In(start.Location()), interval).Unix()
+		m, ok := buckets[t]
+		if !ok {
+			m = &models.DownloadMetrics{}
+			buckets[t] = m
+		}
+		addMetrics(m, &rows[i].Metrics)
+		addMetrics(&total, &rows[i].Metrics)
+	}
+	series := make([]models.DownloadStatPoint, 0)
+	for t := truncate(start, interval); t.Before(end); t = next(t, interval) {
+		point := models.DownloadStatPoint{Time: t.Format(timeLayout)}
+		if m, ok := buckets[t.Unix()]; ok {
+			point.DownloadMetrics = *m
+		}
+		series = append(series, point)
+	}
+	return series, total
+}
@@ -0,0 +1,86 @@
+package analytics
+
+import (
+	"github.com/qinguoyi/osproxy/app/models"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestAggregateParse(t *testing.T) {
+	now := time.Date(2024, 5, 1, 10, 20, 0, 0, time.Local)
+	events := []models.DownloadEvent{
+		{Uid: 1, LinkId: 7, Tenant: "app|1", Bytes: 100, Status: 200, Method: "GET", Client: "1.1.1.1", Time: now},
+		{Uid: 1, LinkId: 7, Tenant: "app|1", Bytes: 10, Range: true, Status: 206, Method: "GET", Client: "1.1.1.1", Time: now},
+		{Uid: 1, LinkId: 7, Tenant: "app|1", Bytes: 50, Status: 403, Method: "GET", Client: "2.2.2.2", Time: now},
+		{Uid: 2, Tenant: "app|1", Status: 200, Method: "HEAD", Time: now.Add(time.Hour)},
+	}
+	fields, clients := aggregate(events)
+	if len(clients) != 2 || len(clients[fileKey{uid: 1, linkId: 7, hour: now.Truncate(time.Hour).Unix()}.clientsKey()]) != 3 {
+		t.Fatalf("unexpected clients %v", clients)
+	}
+	values := map[string]string{"u|bad": "1", "t|1|unknown|x": "1"}
+	for field, v := range fields {
+		values[field] = strconv.FormatInt(v, 10)
+	}
+	files, tenants := parseFields(values)
+	if len(files) != 2 || len(tenants) != 2 {
+		t.Fatalf("expect 2 file and 2 tenant stats, got %d, %d", len(files), len(tenants))
+	}
+	m := files[fileKey{uid: 1, linkId: 7, hour: now.Truncate(time.Hour).Unix(), tenant: "app|1"}]
+	want := models.DownloadMetrics{Requests: 3, Completes: 1, Partials: 1, Bytes: 110, Errors: 1}
+	if m == nil || *m != want {
+		t.Fatalf("expect %+v, got %+v", want, m)
+	}
+	m = tenants[tenantKey{hour: now.Add(time.Hour).Truncate(time.Hour).Unix(), tenant: "app|1"}]
+	if m == nil || *m != (models.DownloadMetrics{Requests: 1}) {
+		t.Fatalf("unexpected head stat %+v", m)
+	}
+}
+
+func TestParseStatRange(t *testing.T) {
+	now := time.Date(2024, 5, 10, 10, 20, 0, 0, time.Local)
+	start, end, interval, err := ParseStatRange("", "", "", 31, now)
+	if err != nil || interval != "hour" || !end.Equal(now) || !start.Equal(time.Date(2024, 5, 9, 10, 0, 0, 0, time.Local)) {
+		t.Fatalf("unexpected default range %v %v %s %v", start, end, interval, err)
+	}
+	start, _, _, err = ParseStatRange("2024-05-01 08:00:00", "2024-05-03 00:00:00", "day", 31, now)
+	if err != nil || !start.Equal(time.Date(2024, 5, 1, 0, 0, 0, 0, time.Local)) {
+		t.Fatalf("unexpected day range %v %v", start, err)
+	}
+	cases := [][3]string{
+		{"", "", "week"},
+		{"2024-05-01", "", ""},
+		{"2024-05-03 00:00:00", "2024-05-01 00:00:00", ""},
+		{"2024-01-01 00:00:00", "2024-05-01 00:00:00", ""},
+	}
+	for i, c := range cases {
+		if _, _, _, err := ParseStatRange(c[0], c[1], c[2], 31, now); err == nil {
+			t.Fatalf("case %d: expect error", i)
+		}
+	}
+}
+
+func TestSeries(t *testing.T) {
+	start := time.Date(2024, 5, 1, 0, 0, 0, 0, time.Local)
+	end := time.Date(2024, 5, 3, 12, 0, 0, 0, time.Local)
+	rows := []StatRow{
+		{Hour: start.Add(time.Hour), Metrics: models.DownloadMetrics{Requests: 1, Bytes: 10, Clients: 1}},
+		{Hour: start.Add(5 * time.Hour), Metrics: models.DownloadMetrics{Requests: 2, Bytes: 20, Clients: 2}},
+		{Hour: start.Add(50 * time.Hour), Metrics: models.DownloadMetrics{Requests: 3, Bytes: 30}},
+	}
+	series, total := Series(rows, start, end, "day")
+	if len(series) != 3 || series[0].Time != "2024-05-01 00:00:00" {
+		t.Fatalf("unexpected series %+v", series)
+	}
+	if series[0].Requests != 3 || series[0].Clients != 3 || series[1].Requests != 0 || series[2].Bytes != 30 {
+		t.Fatalf("unexpected series %+v", series)
+	}
+	if total.Requests != 6 || total.Bytes != 60 {
+		t.Fatalf("unexpected total %+v", total)
+	}
+	series, _ = Series(rows, start, start.Add(6*time.Hour), "hour")
+	if len(series) != 6 || series[1].Requests != 1 || series[5].Requests != 2 {
+		t.Fatalf("unexpected hourly series %+v", series)
+	}
+}
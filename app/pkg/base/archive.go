@@ -0,0 +1,192 @@
+package base
+
+/*
+压缩包读取，包含文件数量、总大小、压缩比限制，防止zip炸弹
+*/
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"errors"
+	"io"
+	"os"
+	"path"
+	"strings"
+)
+
+// ArchiveLimit 压缩包展开限制，0表示不限制
+type ArchiveLimit struct {
+	MaxEntries   int
+	MaxTotalSize int64
+	MaxRatio     int64
+}
+
+type archiveGuard struct {
+	limit       ArchiveLimit
+	archiveSize int64
+	entries     int
+	total       int64
+}
+
+func (g *archiveGuard) addEntry() error {
+	g.entries++
+	if g.limit.MaxEntries > 0 && g.entries > g.limit.MaxEntries {
+		return errors.New("压缩包文件数量超过限制")
+	}
+	return nil
+}
+
+func (g *archiveGuard) addSize(n int64) error {
+	g.total += n
+	if g.limit.MaxTotalSize > 0 && g.total > g.limit.MaxTotalSize {
+		return errors.New("压缩包解压后总大小超过限制")
+	}
+	if g.limit.MaxRatio > 0 && g.archiveSize > 0 && g.total > g.archiveSize*g.limit.MaxRatio {
+		return errors.New("压缩包压缩比超过限制")
+	}
+	return nil
+}
+
+// guardReader 按实际读取的字节数校验，不信任压缩包头部声明的大小
+type guardReader struct {
+	r io.Reader
+	g *archiveGuard
+}
+
+func (gr *guardReader) Read(p []byte) (int, error) {
+	n, err := gr.r.Read(p)
+	if n > 0 {
+		if gErr := gr.g.addSize(int64(n)); gErr != nil {
+			return n, gErr
+		}
+	}
+	return n, err
+}
+
+// GetArchiveFormat 根据文件名判断压缩包格式，不支持时返回空
+func GetArchiveFormat(name string) string {
+	lower := strings.ToLower(name)
+	switch {
+	case strings.HasSuffix(lower, ".zip"):
+		return "zip"
+	case strings.HasSuffix(lower, ".tar.gz"), strings.HasSuffix(lower, ".tgz"):
+		return "tar.gz"
+	case strings.HasSuffix(lower, ".tar"):
+		return "tar"
+	default:
+		return ""
+	}
+}
+
+// CleanArchivePath 规范化压缩包内的相对路径，去掉绝对路径及..，目录返回空
+func CleanArchivePath(name string) string {
+	name = strings.ReplaceAll(name, "\\", "/")
+	if name == "" || strings.HasSuffix(name, "/") {
+		return ""
+	}
+	cleaned := strings.TrimPrefix(path.Clean("/"+name), "/")
+	if cleaned == "." {
+		return ""
+	}
+	return cleaned
+}
+
+// WalkArchive 依次遍历压缩包中的普通文件
+func WalkArchive(fileName, format string, limit ArchiveLimit, fn func(entry string, r io.Reader) error) error {
+	fileInfo, err := os.Stat(fileName)
+	if err != nil {
+		return err
+	}
+	guard := &archiveGuard{limit: limit, archiveSize: fileInfo.Size()}
+	switch format {
+	case "zip":
+		return walkZip(fileName, guard, fn)
+	case "tar", "tar.gz":
+		return walkTar(fileName, format == "tar.gz", guard, fn)
+	default:
+		return errors.New("不支持的压缩包格式")
+	}
+}
+
+func walkZip(fileName string, guard *archiveGuard, fn func(entry string, r io.Reader) error) error {
+	reader, err := zip.OpenReader(fileName)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	// 先按声明信息快速校验，解压时再按实际大小校验
+	var declared uint64
+	for _, f := range reader.File {
+		if !f.Mode().IsRegular() {
+			continue
+		}
+		declared += f.UncompressedSize64
+		if guard.limit.MaxRatio > 0 && f.CompressedSize64 > 0 &&
+			f.UncompressedSize64/f.CompressedSize64 > uint64(guard.limit.MaxRatio) {
+			return errors.New("压缩包压缩比超过限制")
+		}
+	}
+	if guard.limit.MaxTotalSize > 0 && declared > uint64(guard.limit.MaxTotalSize) {
+		return errors.New("压缩包解压后总大小超过限制")
+	}
+
+	for _, f := range reader.File {
+		entry := CleanArchivePath(f.Name)
+		if entry == "" || !f.Mode().IsRegular() {
+			continue
+		}
+		if err := guard.addEntry(); err != nil {
+			return err
+		}
+		src, err := f.Open()
+		if err != nil {
+			return err
+		}
+		err = fn(entry, &guardReader{r: src, g: guard})
+		_ = src.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func walkTar(fileName string, gz bool, guard *archiveGuard, fn func(entry string, r io.Reader) error) error {
+	file, err := os.Open(fileName)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	var src io.Reader = file
+	if gz {
+		gzReader, err := gzip.NewReader(file)
+		if err != nil {
+			return err
+		}
+		defer gzReader.Close()
+		src = gzReader
+	}
+	tarReader := tar.NewReader(src)
+	for {
+		hdr, err := tarReader.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		entry := CleanArchivePath(hdr.Name)
+		if entry == "" || hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+		if err := guard.addEntry(); err != nil {
+			return err
+		}
+		if err := fn(entry, &guardReader{r: tarReader, g: guard}); err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package base
+
+import (
+	"archive/zip"
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeTestZip(t *testing.T, files map[string][]byte) string {
+	fileName := filepath.Join(t.TempDir(), "test.zip")
+	out, err := os.Create(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer out.Close()
+	w := zip.NewWriter(out)
+	for name, data := range files {
+		f, err := w.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := f.Write(data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return fileName
+}
+
+func TestCleanArchivePath(t *testing.T) {
+	cases := map[string]string{
+		"a/b.jpg":         "a/b.jpg",
+		"/abs/c.png":      "abs/c.png",
+		"../../etc/x.txt": "etc/x.txt",
+		"dir/":            "",
+		"win\\d.gif":      "win/d.gif",
+	}
+	for in, expected := range cases {
+		if got := CleanArchivePath(in); got != expected {
+			t.Errorf("CleanArchivePath(%q) = %q, expected %q", in, got, expected)
+		}
+	}
+}
+
+func TestWalkArchive(t *testing.T) {
+	fileName := writeTestZip(t, map[string][]byte{
+		"img/a.jpg": []byte("aaaa"),
+		"b.txt":     []byte("bb"),
+	})
+	got := map[string]string{}
+	err := WalkArchive(fileName, "zip", ArchiveLimit{}, func(entry string, r io.Reader) error {
+		b, err := io.ReadAll(r)
+		got[entry] = string(b)
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got["img/a.jpg"] != "aaaa" || got["b.txt"] != "bb" || len(got) != 2 {
+		t.Errorf("unexpected entries %v", got)
+	}
+}
+
+func TestWalkArchiveLimit(t *testing.T) {
+	bomb := writeTestZip(t, map[string][]byte{"zero.bin": bytes.Repeat([]byte{0}, 1024*1024)})
+	walk := func(limit ArchiveLimit) error {
+		return WalkArchive(bomb, "zip", limit, func(entry string, r io.Reader) error {
+			_, err := io.Copy(io.Discard, r)
+			return err
+		})
+	}
+	if err := walk(ArchiveLimit{MaxRatio: 10}); err == nil {
+		t.Errorf("expected ratio limit error")
+	}
+	if err := walk(ArchiveLimit{MaxTotalSize: 1024}); err == nil {
+		t.Errorf("expected total size limit error")
+	}
+	if err := walk(ArchiveLimit{MaxEntries: 1}); err != nil {
+		t.Errorf("unexpected error %v", err)
+	}
+
+	many := writeTestZip(t, map[string][]byte{"a.txt": []byte("a"), "b.txt": []byte("b")})
+	if err := WalkArchive(many, "zip", ArchiveLimit{MaxEntries: 1}, func(string, io.Reader) error {
+		return nil
+	}); err == nil {
+		t.Errorf("expected entry count limit error")
+	}
+}
@@ -0,0 +1,38 @@
+package base
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+)
+
+// ParseContentRange 解析上传请求头 Content-Range: bytes a-b/total，要求total已知
+func ParseContentRange(s string) (start, end, total int64, err error) {
+	errInvalid := errors.New("Content-Range格式有误，应为bytes a-b/total")
+	s = strings.TrimSpace(s)
+	if !strings.HasPrefix(s, "bytes ") {
+		return 0, 0, 0, errInvalid
+	}
+	s = strings.TrimSpace(strings.TrimPrefix(s, "bytes "))
+	rangePart, totalPart, ok := strings.Cut(s, "/")
+	if !ok {
+		return 0, 0, 0, errInvalid
+	}
+	startPart, endPart, ok := strings.Cut(rangePart, "-")
+	if !ok {
+		return 0, 0, 0, errInvalid
+	}
+	if start, err = strconv.ParseInt(startPart, 10, 64); err != nil {
+		return 0, 0, 0, errInvalid
+	}
+	if end, err = strconv.ParseInt(endPart, 10, 64); err != nil {
+		return 0, 0, 0, errInvalid
+	}
+	if total, err = strconv.ParseInt(totalPart, 10, 64); err != nil {
+		return 0, 0, 0, errInvalid
+	}
+	if start < 0 || end < start || end >= total {
+		return 0, 0, 0, errors.New("Content-Range范围有误")
+	}
+	return start, end, total, nil
+}
@@ -0,0 +1,24 @@
+package base
+
+import "testing"
+
+func TestParseContentRange(t *testing.T) {
+	start, end, total, err := ParseContentRange("bytes 100-199/1000")
+	if err != nil || start != 100 || end != 199 || total != 1000 {
+		t.Fatalf("unexpected %d %d %d %v", start, end, total, err)
+	}
+	for _, s := range []string{
+		"",
+		"bytes 0-99",
+		"bytes 0-99/*",
+		"bytes */1000",
+		"items 0-99/1000",
+		"bytes 100-99/1000",
+		"bytes 0-1000/1000",
+		"bytes -1-10/1000",
+	} {
+		if _, _, _, err := ParseContentRange(s); err == nil {
+			t.Fatalf("expect error for %q", s)
+		}
+	}
+}
@@ -0,0 +1,157 @@
+package base
+
+/*
+限次及可撤销的下载链接
+*/
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/qinguoyi/osproxy/app/models"
+	"github.com/qinguoyi/osproxy/app/pkg/repo"
+	"github.com/qinguoyi/osproxy/app/pkg/utils"
+	"github.com/qinguoyi/osproxy/bootstrap/plugins"
+	"time"
+)
+
+func downloadLinkKey(linkId int64) string {
+	return fmt.Sprintf("%s:%d", utils.DownloadLinkRedisPrefix, linkId)
+}
+
+func downloadCountKey(linkId int64) string {
+	return fmt.Sprintf("%s:%d:count", utils.DownloadLinkRedisPrefix, linkId)
+}
+
+// GetDownloadLink 获取链接信息，优先查询redis缓存
+func GetDownloadLink(linkId int64) (*models.DownloadLink, error) {
+	lgRedis := new(plugins.LangGoRedis).NewRedis()
+	val, err := lgRedis.Get(context.Background(), downloadLinkKey(linkId)).Result()
+	if err == nil {
+		var link models.DownloadLink
+		if err := json.Unmarshal([]byte(val), &link); err == nil {
+			return &link, nil
+		}
+	}
+	lgDB := new(plugins.LangGoDB).Use("default").NewDB()
+	link, err := repo.NewDownloadLinkRepo().GetByLinkId(lgDB, linkId)
+	if err != nil {
+		return nil, err
+	}
+	if b, err := json.Marshal(link); err == nil {
+		lgRedis.SetNX(context.Background(), downloadLinkKey(linkId), b, 5*60*time.Second)
+	}
+	return link, nil
+}
+
+// CheckDownloadLink 校验链接是否已撤销或下载次数已用完，不可用时返回提示信息
+func CheckDownloadLink(link *models.DownloadLink) string {
+	if link.Revoked {
+		return "链接已撤销"
+	}
+	if link.MaxDownloads <= 0 {
+		return ""
+	}
+	if GetDownloadCount(link) >= link.MaxDownloads {
+		return "下载次数已用完"
+	}
+	return ""
+}
+
+// GetDownloadCount 获取链接已下载次数，redis计数不存在时使用数据库中的次数
+func GetDownloadCount(link *models.DownloadLink) int {
+	lgRedis := new(plugins.LangGoRedis).NewRedis()
+	if count, err := lgRedis.Get(context.Background(), downloadCountKey(link.LinkId)).Int(); err == nil {
+		return count
+	}
+	return link.Downloads
+}
+
+// ConsumeDownloadLink 下载次数加一，次数已用完时返回提示信息。
+// 计数以redis为准并同步到数据库，redis计数丢失时按数据库恢复，redis不可用时直接使用数据库计数
+func ConsumeDownloadLink(link *models.DownloadLink) (string, error) {
+	if link.MaxDownloads <= 0 {
+		return "", nil
+	}
+	ctx := context.Background()
+	lgDB := new(plugins.LangGoDB).Use("default").NewDB()
+	lgRedis := new(plugins.LangGoRedis).NewRedis()
+	key := downloadCountKey(link.LinkId)
+	count, err := lgRedis.Incr(ctx, key).Result()
+	if err == nil && count == 1 {
+		// 计数不存在，按数据库中的次数恢复
+		current, err := repo.NewDownloadLinkRepo().GetByLinkId(lgDB, link.LinkId)
+		if err != nil {
+			return "", err
+		}
+		if current.Downloads > 0 {
+			count, err = lgRedis.IncrBy(ctx, key, int64(current.Downloads)).Result()
+		}
+		if err == nil && link.ExpireAt != nil {
+			lgRedis.ExpireAt(ctx, key, link.ExpireAt.Add(time.Minute))
+		}
+	}
+	if err != nil {
+		ok, err := repo.NewDownloadLinkRepo().IncrDownloads(lgDB, link.LinkId, true)
+		if err != nil {
+			return "", err
+		}
+		if !ok {
+			return "下载次数已用完", nil
+		}
+		return "", nil
+	}
+	if count > int64(link.MaxDownloads) {
+		return "下载次数已用完", nil
+	}
+	_, err = repo.NewDownloadLinkRepo().IncrDownloads(lgDB, link.LinkId, false)
+	return "", err
+}
+
+// IsLinkRevoked 链接是否在文件撤销全部链接之前生成，撤销的同一秒内生成的链接同样失效
+func IsLinkRevoked(meta *models.MetaDataInfo, date string) bool {
+	if meta.LinkRevoked == nil {
+		return false
+	}
+	t, err := time.ParseInLocation("2006-01-02T15:04:05Z", date, time.Local)
+	if err != nil {
+		return true
+	}
+	return !t.After(meta.LinkRevoked.Truncate(time.Second))
+}
+
+// RevokeDownloadLinks 撤销链接，linkId为0时撤销文件的所有链接，同时清理链接缓存。
+// 撤销全部链接时记录撤销时间，未落库的链接按生成时间失效
+func RevokeDownloadLinks(uid, linkId int64) (int64, error) {
+	lgDB := new(plugins.LangGoDB).Use("default").NewDB()
+	var links []models.DownloadLink
+	if linkId != 0 {
+		links = append(links, models.DownloadLink{LinkId: linkId})
+	} else {
+		var err error
+		if links, err = repo.NewDownloadLinkRepo().GetActiveByUid(lgDB, uid, time.Now()); err != nil {
+			return 0, err
+		}
+		if err := repo.NewMetaDataInfoRepo().Updates(lgDB, uid, map[string]interface{}{
+			"link_revoked": time.Now(),
+		}); err != nil {
+			return 0, err
+		}
+	}
+	count, err := repo.NewDownloadLinkRepo().Revoke(lgDB, uid, linkId)
+	if err != nil {
+		return 0, err
+	}
+
+	ctx := context.Background()
+	lgRedis := new(plugins.LangGoRedis).NewRedis()
+	for _, link := range links {
+		lgRedis.Del(ctx, downloadLinkKey(link.LinkId))
+	}
+	// 清理已生成的下载链接及元数据缓存，避免再次返回已撤销的链接
+	iter := lgRedis.Scan(ctx, 0, fmt.Sprintf("%d-*", uid), 100).Iterator()
+	for iter.Next(ctx) {
+		lgRedis.Del(ctx, iter.Val())
+	}
+	return count, iter.Err()
+}
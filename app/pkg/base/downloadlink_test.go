@@ -0,0 +1,25 @@
+package base
+
+import (
+	"github.com/qinguoyi/osproxy/app/models"
+	"testing"
+	"time"
+)
+
+func TestIsLinkRevoked(t *testing.T) {
+	revoked := time.Date(2023, 5, 6, 7, 8, 9, 500, time.Local)
+	meta := &models.MetaDataInfo{}
+	if IsLinkRevoked(meta, "2023-05-06T07:08:00Z") {
+		t.Fatal("expect not revoked")
+	}
+	meta.LinkRevoked = &revoked
+	if !IsLinkRevoked(meta, "2023-05-06T07:08:00Z") {
+		t.Fatal("expect earlier link revoked")
+	}
+	if !IsLinkRevoked(meta, "2023-05-06T07:08:09Z") {
+		t.Fatal("expect link in the same second revoked")
+	}
+	if IsLinkRevoked(meta, "2023-05-06T07:08:10Z") {
+		t.Fatal("expect later link valid")
+	}
+}
@@ -6,8 +6,17 @@ import (
 	"encoding/hex"
 	"fmt"
 	"github.com/qinguoyi/osproxy/app/pkg/utils"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
 )
 
+// downloadSignParams 参与签名的下载链接附加参数，为空时不参与签名
+var downloadSignParams = []string{utils.LinkParamRate, utils.LinkParamId, utils.LinkParamTrack, utils.LinkParamIp, utils.LinkParamReferer,
+	utils.LinkParamHeader, utils.LinkParamWidth, utils.LinkParamHeight, utils.LinkParamFit, utils.LinkParamCrop,
+	utils.LinkParamQuality, utils.LinkParamFormat}
+
 func decode(message string) string {
 	h := hmac.New(sha256.New, []byte(utils.EncryKey))
 	h.Write([]byte(message))
@@ -15,7 +24,8 @@ func decode(message string) string {
 	return sha
 }
 
-func GenUploadSignature(uid, date string, expire int, signature string) string {
+// GenUploadSignature 生成上传链接的query，rate为链接限速(KB/s)，0表示不限制
+func GenUploadSignature(uid, date string, expire int, rate int64, signature string) string {
 	standardizedQueryString := fmt.Sprintf(
 		"uid=%s&date=%s&expire=%d&signature=%s",
 		uid,
@@ -23,15 +33,32 @@ func GenUploadSignature(uid, date string, expire int, signature string) string {
 		expire,
 		signature,
 	)
+	if rate > 0 {
+		standardizedQueryString += fmt.Sprintf("&%s=%d", utils.LinkParamRate, rate)
+	}
 	return standardizedQueryString
 }
 
-func CheckUploadSignature(date, expire, signature string) bool {
-	decodeRes := decode(fmt.Sprintf("%s-%s", date, expire))
-	return decodeRes == signature
+// SignUpload 生成上传链接签名，rate为空时不参与签名
+func SignUpload(uid, date, expire, rate string) string {
+	message := url.Values{
+		"uid":    {uid},
+		"date":   {date},
+		"expire": {expire},
+	}
+	if rate != "" {
+		message.Set(utils.LinkParamRate, rate)
+	}
+	return decode(message.Encode())
+}
+
+// CheckUploadSignature 校验上传链接签名，extra为请求中的query参数
+func CheckUploadSignature(uid, date, expire, signature string, extra url.Values) bool {
+	return hmac.Equal([]byte(SignUpload(uid, date, expire, extra.Get(utils.LinkParamRate))), []byte(signature))
 }
 
-func GenDownloadSignature(uid int64, srcName, bucket, objectName, expire, date, signature string) string {
+// GenDownloadSignature 生成下载链接的query，extra为参与签名的附加参数
+func GenDownloadSignature(uid int64, srcName, bucket, objectName, expire, date, signature string, extra url.Values) string {
 	standardizedQueryString := fmt.Sprintf(
 		"uid=%d&name=%s&date=%s&expire=%s&bucket=%s&object=%s&signature=%s",
 		uid,
@@ -42,10 +69,82 @@ func GenDownloadSignature(uid int64, srcName, bucket, objectName, expire, date,
 		objectName,
 		signature,
 	)
+	if len(extra) != 0 {
+		standardizedQueryString += "&" + extra.Encode()
+	}
 	return standardizedQueryString
 }
 
-func CheckDownloadSignature(date, expire, bucket, objectName, signature string) bool {
-	decodeRes := decode(fmt.Sprintf("%s-%s-%s-%s", date, expire, bucket, objectName))
-	return decodeRes == signature
+// downloadSignMessage 下载链接的签名原文，按参数名排序并转义后拼接，各字段之间没有歧义
+func downloadSignMessage(uid, date, expire, bucket, objectName string, extra url.Values) string {
+	message := url.Values{
+		"uid":    {uid},
+		"date":   {date},
+		"expire": {expire},
+		"bucket": {bucket},
+		"object": {objectName},
+	}
+	for _, key := range downloadSignParams {
+		if v := extra.Get(key); v != "" {
+			message.Set(key, v)
+		}
+	}
+	return message.Encode()
+}
+
+// SignDownload 生成下载链接签名
+func SignDownload(uid int64, date, expire, bucket, objectName string, extra url.Values) string {
+	return decode(downloadSignMessage(strconv.FormatInt(uid, 10), date, expire, bucket, objectName, extra))
+}
+
+// CheckDownloadSignature 校验下载链接签名，extra为请求中的query参数
+func CheckDownloadSignature(uid int64, date, expire, bucket, objectName, signature string, extra url.Values) bool {
+	return hmac.Equal([]byte(SignDownload(uid, date, expire, bucket, objectName, extra)), []byte(signature))
+}
+
+// forwardExpire 节点间转发请求签名的有效时间，兼容节点间的时钟偏差
+const forwardExpire = 5 * time.Minute
+
+// SignForward 节点间转发请求的签名，uri为请求路径及query，client为原始客户端IP
+func SignForward(uri, client, timestamp string) string {
+	return decode(url.Values{"forward": {uri}, "client": {client}, "timestamp": {timestamp}}.Encode())
+}
+
+// SetForwardHeader 转发到其他节点的请求添加签名头
+func SetForwardHeader(header http.Header, uri, client string) {
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	header.Set(utils.ForwardHeaderClient, client)
+	header.Set(utils.ForwardHeaderTimestamp, timestamp)
+	header.Set(utils.ForwardHeaderSignature, SignForward(uri, client, timestamp))
+}
+
+// CheckForwardHeader 校验其他节点转发请求的签名头，通过时返回原始客户端IP，ok为false表示不是节点间转发的请求
+func CheckForwardHeader(header http.Header, uri string) (string, bool) {
+	signature := header.Get(utils.ForwardHeaderSignature)
+	if signature == "" {
+		return "", false
+	}
+	timestamp := header.Get(utils.ForwardHeaderTimestamp)
+	ts, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return "", false
+	}
+	if d := time.Since(time.Unix(ts, 0)); d > forwardExpire || d < -forwardExpire {
+		return "", false
+	}
+	client := header.Get(utils.ForwardHeaderClient)
+	if !hmac.Equal([]byte(SignForward(uri, client, timestamp)), []byte(signature)) {
+		return "", false
+	}
+	return client, true
+}
+
+// SignBundle 生成打包下载链接签名
+func SignBundle(date, expire, bundleId string) string {
+	return decode(fmt.Sprintf("%s-%s-bundle-%s", date, expire, bundleId))
+}
+
+// CheckBundleSignature 校验打包下载链接签名
+func CheckBundleSignature(date, expire, bundleId, signature string) bool {
+	return hmac.Equal([]byte(SignBundle(date, expire, bundleId)), []byte(signature))
 }
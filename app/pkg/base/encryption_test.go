@@ -0,0 +1,89 @@
+package base
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestDownloadSignature(t *testing.T) {
+	date, expire, bucket, object := "2023-05-06T07:08:09Z", "3600", "image", "123.jpg"
+	plain := SignDownload(123, date, expire, bucket, object, nil)
+	if !CheckDownloadSignature(123, date, expire, bucket, object, plain, url.Values{"online": {"0"}}) {
+		t.Fatal("expect signature valid")
+	}
+	if CheckDownloadSignature(124, date, expire, bucket, object, plain, nil) {
+		t.Fatal("expect other uid invalid")
+	}
+	// 字段拼接后相同的参数签名不同
+	if SignDownload(123, date, expire, "image-a", "b.jpg", nil) == SignDownload(123, date, expire, "image", "a-b.jpg", nil) {
+		t.Fatal("expect unambiguous message")
+	}
+
+	extra := url.Values{"lid": {"42"}, "rate": {"512"}}
+	signature := SignDownload(123, date, expire, bucket, object, extra)
+	if signature == plain {
+		t.Fatal("expect extra params signed")
+	}
+	query, _ := url.ParseQuery(GenDownloadSignature(123, "a.jpg", bucket, object, expire, date, signature, extra))
+	if !CheckDownloadSignature(123, date, expire, bucket, object, query.Get("signature"), query) {
+		t.Fatal("expect signature valid")
+	}
+	query.Set("lid", "43")
+	if CheckDownloadSignature(123, date, expire, bucket, object, signature, query) {
+		t.Fatal("expect tampered lid invalid")
+	}
+	query.Del("lid")
+	if CheckDownloadSignature(123, date, expire, bucket, object, signature, query) {
+		t.Fatal("expect removed lid invalid")
+	}
+}
+
+func TestUploadSignature(t *testing.T) {
+	date := "2023-05-06T07:08:09Z"
+	signature := SignUpload("123", date, "3600", "256")
+	query, _ := url.ParseQuery(GenUploadSignature("123", date, 3600, 256, signature))
+	if !CheckUploadSignature("123", date, "3600", query.Get("signature"), query) {
+		t.Fatal("expect signature valid")
+	}
+	if CheckUploadSignature("124", date, "3600", signature, query) {
+		t.Fatal("expect other uid invalid")
+	}
+	query.Del("rate")
+	if CheckUploadSignature("123", date, "3600", signature, query) {
+		t.Fatal("expect removed rate invalid")
+	}
+	query.Set("rate", "0")
+	if CheckUploadSignature("123", date, "3600", SignUpload("123", date, "3600", ""), query) {
+		t.Fatal("expect added rate invalid")
+	}
+}
+
+func TestForwardHeader(t *testing.T) {
+	uri := "/api/storage/v0/download?uid=123&lid=42"
+	header := http.Header{}
+	if _, ok := CheckForwardHeader(header, uri); ok {
+		t.Fatal("expect unsigned request not forwarded")
+	}
+	SetForwardHeader(header, uri, "1.2.3.4")
+	if client, ok := CheckForwardHeader(header, uri); !ok || client != "1.2.3.4" {
+		t.Fatalf("expect forwarded from 1.2.3.4, got %s %v", client, ok)
+	}
+	if _, ok := CheckForwardHeader(header, uri+"&ip=1.2.3.4"); ok {
+		t.Fatal("expect other uri invalid")
+	}
+	header.Set("X-Osproxy-Forward-Client", "5.6.7.8")
+	if _, ok := CheckForwardHeader(header, uri); ok {
+		t.Fatal("expect tampered client invalid")
+	}
+	// 过期的签名
+	timestamp := strconv.FormatInt(time.Now().Add(-10*time.Minute).Unix(), 10)
+	header.Set("X-Osproxy-Forward-Client", "1.2.3.4")
+	header.Set("X-Osproxy-Forward-Timestamp", timestamp)
+	header.Set("X-Osproxy-Forward-Signature", SignForward(uri, "1.2.3.4", timestamp))
+	if _, ok := CheckForwardHeader(header, uri); ok {
+		t.Fatal("expect expired signature invalid")
+	}
+}
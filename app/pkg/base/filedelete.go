@@ -0,0 +1,43 @@
+package base
+
+import (
+	"fmt"
+	"github.com/qinguoyi/osproxy/app/models"
+	"github.com/qinguoyi/osproxy/app/pkg/repo"
+	"github.com/qinguoyi/osproxy/app/pkg/storage"
+	"github.com/qinguoyi/osproxy/app/pkg/utils"
+	"github.com/qinguoyi/osproxy/bootstrap"
+	"gorm.io/gorm"
+)
+
+// DeleteFile 文件流转为已删除，清理下载链接、图片处理结果及不再被引用的存储对象，并回调deleted事件
+func DeleteFile(db *gorm.DB, meta *models.MetaDataInfo) error {
+	if err := repo.NewMetaDataInfoRepo().Transition(db, meta.UID, utils.MetaStatusDeleted, nil); err != nil {
+		return err
+	}
+	logger := bootstrap.NewLogger().Logger
+
+	// 撤销链接时一并清理元数据缓存
+	if _, err := RevokeDownloadLinks(meta.UID, 0); err != nil {
+		logger.Warn(fmt.Sprintf("删除文件，撤销下载链接失败，uid:%d，详情%s", meta.UID, err.Error()))
+	}
+	if err := InvalidateImageDerivatives(db, meta.UID); err != nil {
+		logger.Warn(fmt.Sprintf("删除文件，清理图片处理结果失败，uid:%d，详情%s", meta.UID, err.Error()))
+	}
+
+	// 上传完成的文件才有存储对象，秒传的文件共用存储对象，没有其他文件引用时才删除
+	if meta.Status == utils.MetaStatusAvailable || meta.Status == utils.MetaStatusQuarantined ||
+		meta.Status == utils.MetaStatusInfected {
+		refs, err := repo.NewMetaDataInfoRepo().CountByObject(db, meta.Bucket, meta.StorageName, meta.UID)
+		if err != nil {
+			logger.Warn(fmt.Sprintf("删除文件，统计存储对象引用失败，uid:%d，详情%s", meta.UID, err.Error()))
+		} else if refs == 0 {
+			if err := storage.NewStorage().Storage.DeleteObject(meta.Bucket, meta.StorageName); err != nil {
+				logger.Warn(fmt.Sprintf("删除文件，删除存储对象失败，uid:%d，详情%s", meta.UID, err.Error()))
+			}
+		}
+	}
+
+	meta.Status = utils.MetaStatusDeleted
+	return NotifyEvent(db, meta, utils.EventDeleted)
+}
@@ -0,0 +1,86 @@
+package base
+
+/*
+下载缓存校验，ETag及条件请求，遵循RFC 9110
+*/
+
+import (
+	"net/http"
+	"strings"
+	"time"
+)
+
+// FormatETag 由文件md5生成强ETag，md5为空时不返回
+func FormatETag(md5 string) string {
+	if md5 == "" {
+		return ""
+	}
+	return `"` + md5 + `"`
+}
+
+// GetCacheControl 获取桶对应的缓存策略
+func GetCacheControl(bucket, defaultValue string, bucketCache map[string]string) string {
+	if v, ok := bucketCache[bucket]; ok {
+		return v
+	}
+	return defaultValue
+}
+
+// etagWeakMatch 弱比较，忽略W/前缀
+func etagWeakMatch(a, b string) bool {
+	return strings.TrimPrefix(a, "W/") == strings.TrimPrefix(b, "W/")
+}
+
+// etagStrongMatch 强比较，两者都不能是弱ETag
+func etagStrongMatch(a, b string) bool {
+	return a == b && a != "" && !strings.HasPrefix(a, "W/")
+}
+
+// matchETagList 判断逗号分隔的ETag列表中是否有匹配项，*匹配任意存在的ETag
+func matchETagList(list, etag string, match func(a, b string) bool) bool {
+	for _, item := range strings.Split(list, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		if item == "*" || match(item, etag) {
+			return true
+		}
+	}
+	return false
+}
+
+// CheckNotModified 判断是否返回304，存在If-None-Match时忽略If-Modified-Since
+func CheckNotModified(header http.Header, etag string, lastModified time.Time) bool {
+	if inm := header.Get("If-None-Match"); inm != "" {
+		return etag != "" && matchETagList(inm, etag, etagWeakMatch)
+	}
+	ims := header.Get("If-Modified-Since")
+	if ims == "" || lastModified.IsZero() {
+		return false
+	}
+	t, err := http.ParseTime(ims)
+	if err != nil {
+		return false
+	}
+	return !lastModified.Truncate(time.Second).After(t)
+}
+
+// CheckIfRange 判断Range是否生效，If-Range与当前版本不一致时返回完整内容
+func CheckIfRange(header http.Header, etag string, lastModified time.Time) bool {
+	ir := strings.TrimSpace(header.Get("If-Range"))
+	if ir == "" {
+		return true
+	}
+	if strings.HasPrefix(ir, `"`) || strings.HasPrefix(ir, "W/") {
+		return etagStrongMatch(ir, etag)
+	}
+	if lastModified.IsZero() {
+		return false
+	}
+	t, err := http.ParseTime(ir)
+	if err != nil {
+		return false
+	}
+	return lastModified.Truncate(time.Second).Equal(t)
+}
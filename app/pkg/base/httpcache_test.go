@@ -0,0 +1,68 @@
+package base
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestCheckNotModified(t *testing.T) {
+	etag := FormatETag("abc")
+	modified := time.Date(2023, 5, 6, 7, 8, 9, 500, time.UTC)
+	cases := []struct {
+		header map[string]string
+		want   bool
+	}{
+		{map[string]string{}, false},
+		{map[string]string{"If-None-Match": `"abc"`}, true},
+		{map[string]string{"If-None-Match": `"x", W/"abc"`}, true},
+		{map[string]string{"If-None-Match": "*"}, true},
+		{map[string]string{"If-None-Match": `"x"`, "If-Modified-Since": modified.Format(http.TimeFormat)}, false},
+		{map[string]string{"If-Modified-Since": modified.Format(http.TimeFormat)}, true},
+		{map[string]string{"If-Modified-Since": modified.Add(-time.Second).Format(http.TimeFormat)}, false},
+		{map[string]string{"If-Modified-Since": "bad date"}, false},
+	}
+	for i, item := range cases {
+		header := http.Header{}
+		for k, v := range item.header {
+			header.Set(k, v)
+		}
+		if got := CheckNotModified(header, etag, modified); got != item.want {
+			t.Fatalf("case %d: expect %v, got %v", i, item.want, got)
+		}
+	}
+	if CheckNotModified(http.Header{"If-None-Match": {"*"}}, "", modified) {
+		t.Fatal("expect modified without etag")
+	}
+}
+
+func TestCheckIfRange(t *testing.T) {
+	etag := FormatETag("abc")
+	modified := time.Date(2023, 5, 6, 7, 8, 9, 0, time.UTC)
+	cases := []struct {
+		ifRange string
+		want    bool
+	}{
+		{"", true},
+		{`"abc"`, true},
+		{`"old"`, false},
+		{`W/"abc"`, false},
+		{modified.Format(http.TimeFormat), true},
+		{modified.Add(time.Hour).Format(http.TimeFormat), false},
+	}
+	for _, item := range cases {
+		header := http.Header{}
+		header.Set("If-Range", item.ifRange)
+		if got := CheckIfRange(header, etag, modified); got != item.want {
+			t.Fatalf("%q: expect %v, got %v", item.ifRange, item.want, got)
+		}
+	}
+}
+
+func TestGetCacheControl(t *testing.T) {
+	bucketCache := map[string]string{"image": "public, max-age=86400"}
+	if GetCacheControl("image", "no-cache", bucketCache) != "public, max-age=86400" ||
+		GetCacheControl("doc", "no-cache", bucketCache) != "no-cache" {
+		t.Fatal("unexpected cache control")
+	}
+}
@@ -20,7 +20,8 @@ type Response struct {
 }
 
 var (
-	Client *http.Client //HTTPClient
+	Client       *http.Client //HTTPClient
+	StreamClient *http.Client // 流式转发使用，不限制整体耗时，由请求context取消
 )
 
 type Request struct {
@@ -50,6 +51,19 @@ func init() {
 			IdleConnTimeout:       60 * time.Second, // 空闲连接的超时时间
 		},
 	}
+	StreamClient = &http.Client{
+		Transport: &http.Transport{
+			TLSClientConfig:   &tls.Config{InsecureSkipVerify: true},
+			DisableKeepAlives: true,
+			Proxy:             http.ProxyFromEnvironment,
+			DialContext: (&net.Dialer{
+				Timeout:   30 * time.Second, // tcp连接超时时间
+				KeepAlive: 60 * time.Second, // 保持长连接的时间
+			}).DialContext,
+			ResponseHeaderTimeout: 60 * time.Second, // 等待响应头的超时时间
+			IdleConnTimeout:       60 * time.Second, // 空闲连接的超时时间
+		},
+	}
 }
 
 // CheckRespStatus 状态检查
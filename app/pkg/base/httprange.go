@@ -0,0 +1,166 @@
+package base
+
+/*
+HTTP Range请求解析，遵循RFC 9110
+*/
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/textproto"
+	"strconv"
+	"strings"
+)
+
+// MaxRangeCount 单次请求允许的最大区间数量，超出时忽略Range返回完整内容
+const MaxRangeCount = 64
+
+// ErrRangeNotSatisfiable 所有区间都不在文件范围内
+var ErrRangeNotSatisfiable = errors.New("range not satisfiable")
+
+// HttpRange 字节区间
+type HttpRange struct {
+	Start  int64
+	Length int64
+}
+
+// ContentRange Content-Range响应头
+func (r HttpRange) ContentRange(size int64) string {
+	return fmt.Sprintf("bytes %d-%d/%d", r.Start, r.Start+r.Length-1, size)
+}
+
+// MimeHeader multipart/byteranges中每一段的头部
+func (r HttpRange) MimeHeader(contentType string, size int64) textproto.MIMEHeader {
+	return textproto.MIMEHeader{
+		"Content-Range": {r.ContentRange(size)},
+		"Content-Type":  {contentType},
+	}
+}
+
+// ParseRange 解析Range请求头，支持 a-b、a- 及 -n 形式，多个区间以逗号分隔
+// 请求头为空、格式有误或区间过多时返回nil，表示忽略Range返回完整内容；
+// 区间都不满足时返回ErrRangeNotSatisfiable
+func ParseRange(s string, size int64) ([]HttpRange, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return nil, nil
+	}
+	const b = "bytes="
+	if !strings.HasPrefix(s, b) {
+		return nil, nil
+	}
+	var ranges []HttpRange
+	noOverlap := false
+	specs := strings.Split(s[len(b):], ",")
+	if len(specs) > MaxRangeCount {
+		return nil, nil
+	}
+	for _, spec := range specs {
+		spec = strings.TrimSpace(spec)
+		if spec == "" {
+			continue
+		}
+		startPart, endPart, ok := strings.Cut(spec, "-")
+		if !ok {
+			return nil, nil
+		}
+		startPart, endPart = strings.TrimSpace(startPart), strings.TrimSpace(endPart)
+		var r HttpRange
+		if startPart == "" {
+			// 后缀区间，取最后n个字节
+			n, err := strconv.ParseInt(endPart, 10, 64)
+			if err != nil || n < 0 || endPart[0] == '-' {
+				return nil, nil
+			}
+			if n == 0 || size == 0 {
+				noOverlap = true
+				continue
+			}
+			if n > size {
+				n = size
+			}
+			r.Start, r.Length = size-n, n
+		} else {
+			start, err := strconv.ParseInt(startPart, 10, 64)
+			if err != nil || start < 0 || startPart[0] == '-' {
+				return nil, nil
+			}
+			if start >= size {
+				noOverlap = true
+				continue
+			}
+			r.Start = start
+			if endPart == "" {
+				r.Length = size - start
+			} else {
+				end, err := strconv.ParseInt(endPart, 10, 64)
+				if err != nil || end < start || endPart[0] == '-' {
+					return nil, nil
+				}
+				if end >= size {
+					end = size - 1
+				}
+				r.Length = end - start + 1
+			}
+		}
+		ranges = append(ranges, r)
+	}
+	if len(ranges) == 0 {
+		if noOverlap {
+			return nil, ErrRangeNotSatisfiable
+		}
+		return nil, nil
+	}
+	// 区间总长度超过文件大小时视为滥用，返回完整内容
+	var total int64
+	for _, r := range ranges {
+		total += r.Length
+	}
+	if total > size {
+		return nil, nil
+	}
+	return ranges, nil
+}
+
+// countingWriter 只统计写入的字节数
+type countingWriter int64
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	*w += countingWriter(len(p))
+	return len(p), nil
+}
+
+// MultipartRangeSize 计算multipart/byteranges响应体的长度，boundary需与实际响应一致
+func MultipartRangeSize(ranges []HttpRange, boundary, contentType string, size int64) int64 {
+	var w countingWriter
+	mw := multipart.NewWriter(&w)
+	_ = mw.SetBoundary(boundary)
+	var length int64
+	for _, r := range ranges {
+		_, _ = mw.CreatePart(r.MimeHeader(contentType, size))
+		length += r.Length
+	}
+	_ = mw.Close()
+	return int64(w) + length
+}
+
+// WriteMultipartRange 按区间顺序写入multipart/byteranges响应体，区间数据由copyRange写入
+func WriteMultipartRange(w io.Writer, ranges []HttpRange, boundary, contentType string, size int64,
+	copyRange func(w io.Writer, r HttpRange) error) error {
+	mw := multipart.NewWriter(w)
+	if err := mw.SetBoundary(boundary); err != nil {
+		return err
+	}
+	for _, r := range ranges {
+		part, err := mw.CreatePart(r.MimeHeader(contentType, size))
+		if err != nil {
+			return err
+		}
+		if err := copyRange(part, r); err != nil {
+			return err
+		}
+	}
+	return mw.Close()
+}
@@ -0,0 +1,83 @@
+package base
+
+import (
+	"bytes"
+	"io"
+	"mime"
+	"mime/multipart"
+	"testing"
+)
+
+func TestParseRange(t *testing.T) {
+	cases := []struct {
+		header string
+		size   int64
+		want   []HttpRange
+		err    error
+	}{
+		{"", 100, nil, nil},
+		{"bytes=0-0", 100, []HttpRange{{0, 1}}, nil},
+		{"bytes=0-", 100, []HttpRange{{0, 100}}, nil},
+		{"bytes=10-19", 100, []HttpRange{{10, 10}}, nil},
+		{"bytes=90-200", 100, []HttpRange{{90, 10}}, nil},
+		{"bytes=-30", 100, []HttpRange{{70, 30}}, nil},
+		{"bytes=-300", 100, []HttpRange{{0, 100}}, nil},
+		{"bytes=0-9, 20-29,-5", 100, []HttpRange{{0, 10}, {20, 10}, {95, 5}}, nil},
+		{"bytes=100-", 100, nil, ErrRangeNotSatisfiable},
+		{"bytes=-0", 100, nil, ErrRangeNotSatisfiable},
+		{"bytes=0-0", 0, nil, ErrRangeNotSatisfiable},
+		{"bytes=200-300,0-9", 100, []HttpRange{{0, 10}}, nil},
+		{"bytes=9-0", 100, nil, nil},
+		{"bytes=a-b", 100, nil, nil},
+		{"items=0-9", 100, nil, nil},
+		{"bytes=0-,0-", 100, nil, nil},
+	}
+	for _, item := range cases {
+		got, err := ParseRange(item.header, item.size)
+		if err != item.err {
+			t.Fatalf("%q: unexpected err %v", item.header, err)
+		}
+		if len(got) != len(item.want) {
+			t.Fatalf("%q: unexpected ranges %v", item.header, got)
+		}
+		for i := range got {
+			if got[i] != item.want[i] {
+				t.Fatalf("%q: unexpected ranges %v", item.header, got)
+			}
+		}
+	}
+}
+
+func TestMultipartRange(t *testing.T) {
+	content := []byte("0123456789abcdefghij")
+	size := int64(len(content))
+	ranges := []HttpRange{{0, 3}, {15, 5}}
+	boundary := "testboundary"
+	var buf bytes.Buffer
+	err := WriteMultipartRange(&buf, ranges, boundary, "text/plain", size, func(w io.Writer, r HttpRange) error {
+		_, err := w.Write(content[r.Start : r.Start+r.Length])
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if int64(buf.Len()) != MultipartRangeSize(ranges, boundary, "text/plain", size) {
+		t.Fatalf("size mismatch %d %d", buf.Len(), MultipartRangeSize(ranges, boundary, "text/plain", size))
+	}
+
+	_, params, _ := mime.ParseMediaType("multipart/byteranges; boundary=" + boundary)
+	reader := multipart.NewReader(&buf, params["boundary"])
+	for _, want := range []struct{ contentRange, body string }{
+		{"bytes 0-2/20", "012"},
+		{"bytes 15-19/20", "fghij"},
+	} {
+		part, err := reader.NextPart()
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := io.ReadAll(part)
+		if part.Header.Get("Content-Range") != want.contentRange || string(body) != want.body {
+			t.Fatalf("unexpected part %v %q", part.Header, body)
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package base
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"errors"
+	"github.com/qinguoyi/osproxy/app/models"
+	"github.com/qinguoyi/osproxy/app/pkg/repo"
+	"github.com/qinguoyi/osproxy/app/pkg/storage"
+	"github.com/qinguoyi/osproxy/app/pkg/utils"
+	"github.com/qinguoyi/osproxy/bootstrap"
+	"gorm.io/gorm"
+	"net/url"
+	"os"
+	"strconv"
+	"time"
+)
+
+// SaveImageDerivative 图片处理结果上传到存储并记录，已有相同参数的记录时覆盖
+func SaveImageDerivative(db *gorm.DB, meta *models.MetaDataInfo, params string, result *ImageResult,
+	bucket, storageName string) (*models.ImageDerivative, error) {
+	tmpFile, err := os.CreateTemp("", "derivative-")
+	if err != nil {
+		return nil, errors.New("创建临时文件失败")
+	}
+	defer func() {
+		_ = os.Remove(tmpFile.Name())
+	}()
+	_, err = tmpFile.Write(result.Data)
+	_ = tmpFile.Close()
+	if err != nil {
+		return nil, errors.New("写入临时文件失败")
+	}
+	if err := storage.NewStorage().Storage.PutObject(bucket, storageName, tmpFile.Name(), result.ContentType); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	sum := md5.Sum(result.Data)
+	item := &models.ImageDerivative{
+		UID:         meta.UID,
+		Params:      params,
+		SourceMd5:   meta.Md5,
+		Bucket:      bucket,
+		StorageName: storageName,
+		ContentType: result.ContentType,
+		StorageSize: int64(len(result.Data)),
+		Md5:         hex.EncodeToString(sum[:]),
+		Width:       result.Width,
+		Height:      result.Height,
+		CreatedAt:   &now,
+		UpdatedAt:   &now,
+	}
+	if err := repo.NewImageDerivativeRepo().Save(db, item); err != nil {
+		return nil, err
+	}
+	return item, nil
+}
+
+// InvalidateImageDerivatives 删除文件的所有图片处理结果，文件删除时调用
+func InvalidateImageDerivatives(db *gorm.DB, uid int64) error {
+	derivatives, err := repo.NewImageDerivativeRepo().GetByUid(db, uid)
+	if err != nil || len(derivatives) == 0 {
+		return err
+	}
+	for _, item := range derivatives {
+		if err := storage.NewStorage().Storage.DeleteObject(item.Bucket, item.StorageName); err != nil {
+			return err
+		}
+	}
+	return repo.NewImageDerivativeRepo().DeleteByUid(db, uid)
+}
+
+// ThumbnailTransforms 配置的缩略图规格，规格有误时跳过
+func ThumbnailTransforms() map[string]*ImageTransform {
+	conf := bootstrap.NewConfig("").Image
+	ret := map[string]*ImageTransform{}
+	if !conf.Enabled {
+		return ret
+	}
+	for _, item := range conf.Thumbnails {
+		query := url.Values{}
+		if item.Width != 0 {
+			query.Set(utils.LinkParamWidth, strconv.Itoa(item.Width))
+		}
+		if item.Height != 0 {
+			query.Set(utils.LinkParamHeight, strconv.Itoa(item.Height))
+		}
+		query.Set(utils.LinkParamFit, item.Fit)
+		query.Set(utils.LinkParamFormat, item.Format)
+		if t, err := ParseImageTransform(query, 0); err == nil && t != nil && item.Name != "" {
+			ret[item.Name] = t
+		}
+	}
+	return ret
+}
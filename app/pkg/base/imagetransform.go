@@ -0,0 +1,372 @@
+package base
+
+/*
+下载时的图片处理，包含裁剪、缩放及格式转换，只使用标准库编解码
+*/
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/qinguoyi/osproxy/app/pkg/utils"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"math"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// 图片缩放方式
+const (
+	ImageFitContain = "contain" // 等比缩放至宽高范围内，不放大
+	ImageFitCover   = "cover"   // 等比缩放至覆盖宽高后居中裁剪
+	ImageFitFill    = "fill"    // 拉伸至指定宽高
+)
+
+const defaultImageQuality = 85
+
+// imageContentType 支持输出的图片格式
+var imageContentType = map[string]string{
+	"jpeg": "image/jpeg",
+	"png":  "image/png",
+	"gif":  "image/gif",
+}
+
+// ImageTransform 图片处理参数
+type ImageTransform struct {
+	Width   int
+	Height  int
+	Fit     string
+	Crop    image.Rectangle // 为空不裁剪
+	Quality int             // jpeg质量，为0时使用默认值
+	Format  string          // 输出格式，为空时与原图一致
+}
+
+// ImageResult 图片处理结果
+type ImageResult struct {
+	Data        []byte
+	ContentType string
+	Format      string
+	Width       int
+	Height      int
+}
+
+// IsTransformable 原图是否支持处理
+func IsTransformable(contentType string) bool {
+	for _, ct := range imageContentType {
+		if ct == contentType {
+			return true
+		}
+	}
+	return false
+}
+
+// parseImageInt 解析[min, max]范围内的整数，max为0时不限制上限
+func parseImageInt(query url.Values, key string, min, max int) (int, error) {
+	s := query.Get(key)
+	if s == "" {
+		return 0, nil
+	}
+	v, err := strconv.Atoi(s)
+	if err != nil || v < min || (max > 0 && v > max) {
+		return 0, fmt.Errorf("%s参数有误", key)
+	}
+	return v, nil
+}
+
+// ParseImageTransform 解析下载链接中的图片处理参数，未指定时返回nil，maxSize为输出宽高上限
+func ParseImageTransform(query url.Values, maxSize int) (*ImageTransform, error) {
+	keys := []string{utils.LinkParamWidth, utils.LinkParamHeight, utils.LinkParamFit, utils.LinkParamCrop,
+		utils.LinkParamQuality, utils.LinkParamFormat}
+	found := false
+	for _, key := range keys {
+		if query.Get(key) != "" {
+			found = true
+			break
+		}
+	}
+	if !found {
+		return nil, nil
+	}
+
+	t := &ImageTransform{Fit: ImageFitContain}
+	var err error
+	if t.Width, err = parseImageInt(query, utils.LinkParamWidth, 1, maxSize); err != nil {
+		return nil, err
+	}
+	if t.Height, err = parseImageInt(query, utils.LinkParamHeight, 1, maxSize); err != nil {
+		return nil, err
+	}
+	if t.Quality, err = parseImageInt(query, utils.LinkParamQuality, 1, 100); err != nil {
+		return nil, err
+	}
+	if fit := query.Get(utils.LinkParamFit); fit != "" {
+		if !utils.Contains(fit, []string{ImageFitContain, ImageFitCover, ImageFitFill}) {
+			return nil, errors.New("fit参数有误，支持contain、cover、fill")
+		}
+		t.Fit = fit
+	}
+	if t.Fit == ImageFitCover && (t.Width == 0 || t.Height == 0) {
+		return nil, errors.New("fit为cover时需同时指定宽高")
+	}
+	if crop := query.Get(utils.LinkParamCrop); crop != "" {
+		items := strings.Split(crop, ",")
+		var v [4]int
+		if len(items) != 4 {
+			return nil, errors.New("crop参数有误，格式为x,y,w,h")
+		}
+		for i, item := range items {
+			if v[i], err = strconv.Atoi(strings.TrimSpace(item)); err != nil || v[i] < 0 || (i >= 2 && v[i] == 0) {
+				return nil, errors.New("crop参数有误，格式为x,y,w,h")
+			}
+		}
+		t.Crop = image.Rect(v[0], v[1], v[0]+v[2], v[1]+v[3])
+	}
+	if format := strings.ToLower(query.Get(utils.LinkParamFormat)); format != "" {
+		if format == "jpg" {
+			format = "jpeg"
+		}
+		if _, ok := imageContentType[format]; !ok {
+			return nil, errors.New("fmt参数有误，支持jpeg、png、gif")
+		}
+		t.Format = format
+	}
+	return t, nil
+}
+
+// Values 转换为下载链接参数
+func (t *ImageTransform) Values() url.Values {
+	query := url.Values{}
+	if t.Width > 0 {
+		query.Set(utils.LinkParamWidth, strconv.Itoa(t.Width))
+	}
+	if t.Height > 0 {
+		query.Set(utils.LinkParamHeight, strconv.Itoa(t.Height))
+	}
+	if t.Fit != "" && t.Fit != ImageFitContain {
+		query.Set(utils.LinkParamFit, t.Fit)
+	}
+	if !t.Crop.Empty() {
+		query.Set(utils.LinkParamCrop, fmt.Sprintf("%d,%d,%d,%d", t.Crop.Min.X, t.Crop.Min.Y, t.Crop.Dx(), t.Crop.Dy()))
+	}
+	if t.Quality > 0 {
+		query.Set(utils.LinkParamQuality, strconv.Itoa(t.Quality))
+	}
+	if t.Format != "" {
+		query.Set(utils.LinkParamFormat, t.Format)
+	}
+	return query
+}
+
+// Key 处理参数的规范表示，相同效果的参数得到相同的key，用于缓存处理结果
+func (t *ImageTransform) Key() string {
+	return t.Values().Encode()
+}
+
+// StorageName 处理结果的存储名称
+func (t *ImageTransform) StorageName(uid int64, format string) string {
+	sum := md5.Sum([]byte(t.Key()))
+	return fmt.Sprintf("%d-%s.%s", uid, hex.EncodeToString(sum[:8]), format)
+}
+
+// targetSize 按缩放方式计算缩放后的宽高，cover时返回覆盖目标区域的尺寸
+func (t *ImageTransform) targetSize(sw, sh int) (int, int) {
+	w, h := t.Width, t.Height
+	if w == 0 && h == 0 {
+		return sw, sh
+	}
+	scaleW, scaleH := float64(w)/float64(sw), float64(h)/float64(sh)
+	switch {
+	case w == 0:
+		scaleW = scaleH
+	case h == 0:
+		scaleH = scaleW
+	}
+	var scale float64
+	switch t.Fit {
+	case ImageFitFill:
+		return scaledLen(sw, scaleW), scaledLen(sh, scaleH)
+	case ImageFitCover:
+		scale = math.Max(scaleW, scaleH)
+	default:
+		scale = math.Min(scaleW, scaleH)
+		if scale >= 1 {
+			return sw, sh
+		}
+	}
+	return scaledLen(sw, scale), scaledLen(sh, scale)
+}
+
+func scaledLen(n int, scale float64) int {
+	v := int(math.Round(float64(n) * scale))
+	if v < 1 {
+		return 1
+	}
+	return v
+}
+
+// TransformImage 解码、裁剪、缩放并编码，maxPixels为原图像素上限，0表示不限制
+func TransformImage(data []byte, t *ImageTransform, maxPixels int64) (*ImageResult, error) {
+	cfg, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, errors.New("不支持的图片格式")
+	}
+	if maxPixels > 0 && int64(cfg.Width)*int64(cfg.Height) > maxPixels {
+		return nil, errors.New("图片像素超过处理上限")
+	}
+	src, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("图片解码失败，%s", err.Error())
+	}
+
+	bounds := src.Bounds()
+	if !t.Crop.Empty() {
+		bounds = t.Crop.Add(bounds.Min).Intersect(bounds)
+		if bounds.Empty() {
+			return nil, errors.New("裁剪区域超出图片范围")
+		}
+	}
+	img := image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(img, img.Bounds(), src, bounds.Min, draw.Src)
+
+	w, h := t.targetSize(img.Bounds().Dx(), img.Bounds().Dy())
+	if w != img.Bounds().Dx() || h != img.Bounds().Dy() {
+		img = resizeRGBA(img, w, h)
+	}
+	if t.Fit == ImageFitCover && (w > t.Width || h > t.Height) {
+		x, y := (w-t.Width)/2, (h-t.Height)/2
+		img = img.SubImage(image.Rect(x, y, x+t.Width, y+t.Height)).(*image.RGBA)
+	}
+
+	if t.Format != "" {
+		format = t.Format
+	}
+	if _, ok := imageContentType[format]; !ok {
+		format = "jpeg"
+	}
+	var buf bytes.Buffer
+	switch format {
+	case "png":
+		err = png.Encode(&buf, img)
+	case "gif":
+		err = gif.Encode(&buf, img, nil)
+	default:
+		// jpeg不支持透明，先合成到白色背景
+		quality := t.Quality
+		if quality == 0 {
+			quality = defaultImageQuality
+		}
+		flat := image.NewRGBA(img.Bounds())
+		draw.Draw(flat, flat.Bounds(), image.NewUniform(color.White), image.Point{}, draw.Src)
+		draw.Draw(flat, flat.Bounds(), img, img.Bounds().Min, draw.Over)
+		err = jpeg.Encode(&buf, flat, &jpeg.Options{Quality: quality})
+	}
+	if err != nil {
+		return nil, fmt.Errorf("图片编码失败，%s", err.Error())
+	}
+	return &ImageResult{
+		Data:        buf.Bytes(),
+		ContentType: imageContentType[format],
+		Format:      format,
+		Width:       img.Bounds().Dx(),
+		Height:      img.Bounds().Dy(),
+	}, nil
+}
+
+// filterWeight 目标像素对应的源像素起点及权重
+type filterWeight struct {
+	start   int
+	weights []float64
+}
+
+// filterWeights 三角滤波权重，缩小时按比例扩大滤波范围，避免锯齿
+func filterWeights(dst, src int) []filterWeight {
+	scale := float64(src) / float64(dst)
+	support := math.Max(scale, 1)
+	ret := make([]filterWeight, dst)
+	for i := range ret {
+		center := (float64(i) + 0.5) * scale
+		start := int(math.Floor(center - support))
+		if start < 0 {
+			start = 0
+		}
+		end := int(math.Ceil(center + support))
+		if end > src {
+			end = src
+		}
+		var sum float64
+		weights := make([]float64, 0, end-start)
+		for j := start; j < end; j++ {
+			w := 1 - math.Abs((float64(j)+0.5-center)/support)
+			if w < 0 {
+				w = 0
+			}
+			weights = append(weights, w)
+			sum += w
+		}
+		for j := range weights {
+			weights[j] /= sum
+		}
+		ret[i] = filterWeight{start: start, weights: weights}
+	}
+	return ret
+}
+
+func clampUint8(v float64) uint8 {
+	switch {
+	case v <= 0:
+		return 0
+	case v >= 255:
+		return 255
+	default:
+		return uint8(v + 0.5)
+	}
+}
+
+// resizeRGBA 先水平后垂直两次一维缩放，RGBA为预乘透明度，透明边缘不会产生杂色
+func resizeRGBA(src *image.RGBA, w, h int) *image.RGBA {
+	sw, sh := src.Bounds().Dx(), src.Bounds().Dy()
+	tmp := image.NewRGBA(image.Rect(0, 0, w, sh))
+	for x, fw := range filterWeights(w, sw) {
+		for y := 0; y < sh; y++ {
+			var c [4]float64
+			off := src.PixOffset(src.Bounds().Min.X+fw.start, src.Bounds().Min.Y+y)
+			for _, wt := range fw.weights {
+				for k := 0; k < 4; k++ {
+					c[k] += wt * float64(src.Pix[off+k])
+				}
+				off += 4
+			}
+			p := tmp.PixOffset(x, y)
+			for k := 0; k < 4; k++ {
+				tmp.Pix[p+k] = clampUint8(c[k])
+			}
+		}
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y, fw := range filterWeights(h, sh) {
+		for x := 0; x < w; x++ {
+			var c [4]float64
+			off := tmp.PixOffset(x, fw.start)
+			for _, wt := range fw.weights {
+				for k := 0; k < 4; k++ {
+					c[k] += wt * float64(tmp.Pix[off+k])
+				}
+				off += tmp.Stride
+			}
+			p := dst.PixOffset(x, y)
+			for k := 0; k < 4; k++ {
+				dst.Pix[p+k] = clampUint8(c[k])
+			}
+		}
+	}
+	return dst
+}
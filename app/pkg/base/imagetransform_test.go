@@ -0,0 +1,118 @@
+package base
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"math"
+	"net/url"
+	"testing"
+)
+
+func testImage(t *testing.T, w, h int) []byte {
+	img := image.NewNRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			img.Set(x, y, color.NRGBA{R: uint8(x), G: uint8(y), B: 100, A: 255})
+		}
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func transform(t *testing.T, data []byte, query url.Values) *ImageResult {
+	tr, err := ParseImageTransform(query, 4096)
+	if err != nil || tr == nil {
+		t.Fatalf("parse %v: %v", query, err)
+	}
+	ret, err := TransformImage(data, tr, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded, format, err := image.Decode(bytes.NewReader(ret.Data))
+	if err != nil || format != ret.Format {
+		t.Fatalf("decode result: %v %s", err, format)
+	}
+	if decoded.Bounds().Dx() != ret.Width || decoded.Bounds().Dy() != ret.Height {
+		t.Fatalf("unexpected result size %v", decoded.Bounds())
+	}
+	return ret
+}
+
+func TestTransformImage(t *testing.T) {
+	data := testImage(t, 200, 100)
+	cases := []struct {
+		query  url.Values
+		w, h   int
+		format string
+	}{
+		{url.Values{"w": {"50"}}, 50, 25, "png"},
+		{url.Values{"w": {"400"}}, 200, 100, "png"},
+		{url.Values{"w": {"50"}, "h": {"50"}, "fit": {"cover"}, "fmt": {"jpg"}}, 50, 50, "jpeg"},
+		{url.Values{"w": {"30"}, "h": {"60"}, "fit": {"fill"}, "fmt": {"gif"}}, 30, 60, "gif"},
+		{url.Values{"crop": {"150,50,100,100"}, "q": {"60"}, "fmt": {"jpeg"}}, 50, 50, "jpeg"},
+	}
+	for _, c := range cases {
+		ret := transform(t, data, c.query)
+		if ret.Width != c.w || ret.Height != c.h || ret.Format != c.format {
+			t.Fatalf("%v: unexpected %dx%d %s", c.query, ret.Width, ret.Height, ret.Format)
+		}
+	}
+
+	tr, _ := ParseImageTransform(url.Values{"crop": {"300,0,10,10"}}, 0)
+	if _, err := TransformImage(data, tr, 0); err == nil {
+		t.Fatal("expect crop out of range")
+	}
+	if _, err := TransformImage(data, tr, 100); err == nil {
+		t.Fatal("expect pixel limit")
+	}
+	if _, err := TransformImage([]byte("not image"), tr, 0); err == nil {
+		t.Fatal("expect unsupported format")
+	}
+}
+
+func TestParseImageTransform(t *testing.T) {
+	if tr, err := ParseImageTransform(url.Values{"uid": {"1"}}, 0); tr != nil || err != nil {
+		t.Fatal("expect nil transform")
+	}
+	bad := []url.Values{
+		{"w": {"0"}},
+		{"w": {"5000"}},
+		{"fit": {"cover"}, "w": {"10"}},
+		{"fit": {"stretch"}},
+		{"crop": {"1,2,3"}},
+		{"crop": {"0,0,0,10"}},
+		{"q": {"101"}},
+		{"fmt": {"webp"}},
+	}
+	for _, query := range bad {
+		if _, err := ParseImageTransform(query, 4096); err == nil {
+			t.Fatalf("expect error for %v", query)
+		}
+	}
+
+	// 等效参数得到相同的key
+	a, _ := ParseImageTransform(url.Values{"w": {"10"}, "fit": {"contain"}, "fmt": {"jpg"}}, 0)
+	b, _ := ParseImageTransform(url.Values{"fmt": {"jpeg"}, "w": {"10"}}, 0)
+	if a.Key() != b.Key() || a.StorageName(1, "jpeg") != b.StorageName(1, "jpeg") {
+		t.Fatalf("expect same key, %s %s", a.Key(), b.Key())
+	}
+}
+
+func TestFilterWeights(t *testing.T) {
+	for _, c := range [][2]int{{10, 100}, {100, 10}, {7, 7}, {1, 3}} {
+		for _, fw := range filterWeights(c[0], c[1]) {
+			var sum float64
+			for _, w := range fw.weights {
+				sum += w
+			}
+			if math.Abs(sum-1) > 1e-9 || fw.start < 0 || fw.start+len(fw.weights) > c[1] {
+				t.Fatalf("invalid weights %v for %v", fw, c)
+			}
+		}
+	}
+}
@@ -0,0 +1,98 @@
+package base
+
+/*
+下载链接绑定客户端，限制IP、来源及请求头
+*/
+
+import (
+	"errors"
+	"fmt"
+	"github.com/qinguoyi/osproxy/app/pkg/utils"
+	"net"
+	"net/http"
+	"net/textproto"
+	"net/url"
+	"strings"
+)
+
+// splitList 拆分逗号分隔的列表
+func splitList(s string) []string {
+	var ret []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			ret = append(ret, item)
+		}
+	}
+	return ret
+}
+
+// matchReferer 判断来源域名是否在允许列表中，*.example.com匹配所有子域名
+func matchReferer(referer string, allowed []string) bool {
+	u, err := url.Parse(referer)
+	if err != nil || u.Hostname() == "" {
+		return false
+	}
+	host := strings.ToLower(u.Hostname())
+	for _, item := range allowed {
+		item = strings.ToLower(item)
+		if strings.HasPrefix(item, "*.") {
+			if strings.HasSuffix(host, item[1:]) {
+				return true
+			}
+		} else if host == item {
+			return true
+		}
+	}
+	return false
+}
+
+// parseHeaderBinding 解析请求头绑定，格式Name:Value
+func parseHeaderBinding(s string) (string, string, bool) {
+	name, value, ok := strings.Cut(s, ":")
+	name = strings.TrimSpace(name)
+	if !ok || name == "" || strings.ContainsAny(name, " \t\r\n") {
+		return "", "", false
+	}
+	return textproto.CanonicalMIMEHeaderKey(name), strings.TrimSpace(value), true
+}
+
+// CheckLinkBindingParams 校验生成链接时的绑定参数
+func CheckLinkBindingParams(ip, referer []string, header string) error {
+	for _, item := range ip {
+		if net.ParseIP(item) == nil {
+			if _, _, err := net.ParseCIDR(item); err != nil {
+				return fmt.Errorf("ip[%s]有误，应为IP或CIDR", item)
+			}
+		}
+	}
+	for _, item := range referer {
+		item = strings.TrimPrefix(item, "*.")
+		if item == "" || strings.ContainsAny(item, ",/: ") {
+			return fmt.Errorf("referer[%s]有误，应为域名或*.开头的域名", item)
+		}
+	}
+	if header != "" {
+		if _, _, ok := parseHeaderBinding(header); !ok {
+			return errors.New("header有误，格式为Name:Value")
+		}
+	}
+	return nil
+}
+
+// CheckLinkBinding 校验请求是否满足链接绑定的客户端条件，不满足时返回提示信息
+func CheckLinkBinding(query url.Values, clientIP string, header http.Header) string {
+	if ip := query.Get(utils.LinkParamIp); ip != "" && !inCidrs(clientIP, splitList(ip)) {
+		return "客户端IP不在链接允许的范围内"
+	}
+	if referer := query.Get(utils.LinkParamReferer); referer != "" &&
+		!matchReferer(header.Get("Referer"), splitList(referer)) {
+		return "来源不在链接允许的范围内"
+	}
+	if binding := query.Get(utils.LinkParamHeader); binding != "" {
+		name, value, ok := parseHeaderBinding(binding)
+		if !ok || header.Get(name) != value {
+			return "请求头不满足链接要求"
+		}
+	}
+	return ""
+}
@@ -0,0 +1,55 @@
+package base
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+)
+
+func TestCheckLinkBinding(t *testing.T) {
+	query := url.Values{
+		"ip":      {"10.0.0.0/8,192.168.1.10"},
+		"referer": {"example.com,*.example.org"},
+		"header":  {"x-app-client:mobile"},
+	}
+	ok := http.Header{}
+	ok.Set("Referer", "https://cdn.example.org/page")
+	ok.Set("X-App-Client", "mobile")
+	if msg := CheckLinkBinding(query, "10.2.3.4", ok); msg != "" {
+		t.Fatal(msg)
+	}
+	if CheckLinkBinding(query, "8.8.8.8", ok) == "" {
+		t.Fatal("expect ip rejected")
+	}
+
+	badReferer := ok.Clone()
+	badReferer.Set("Referer", "https://evil-example.org/")
+	if CheckLinkBinding(query, "192.168.1.10", badReferer) == "" {
+		t.Fatal("expect referer rejected")
+	}
+	badReferer.Del("Referer")
+	if CheckLinkBinding(query, "192.168.1.10", badReferer) == "" {
+		t.Fatal("expect empty referer rejected")
+	}
+
+	badHeader := ok.Clone()
+	badHeader.Set("X-App-Client", "web")
+	if CheckLinkBinding(query, "192.168.1.10", badHeader) == "" {
+		t.Fatal("expect header rejected")
+	}
+
+	if CheckLinkBinding(url.Values{}, "8.8.8.8", http.Header{}) != "" {
+		t.Fatal("expect unbound link allowed")
+	}
+}
+
+func TestCheckLinkBindingParams(t *testing.T) {
+	if err := CheckLinkBindingParams([]string{"1.2.3.4", "10.0.0.0/8"}, []string{"*.example.com"}, "User-Agent:app/1.0"); err != nil {
+		t.Fatal(err)
+	}
+	if CheckLinkBindingParams([]string{"1.2.3"}, nil, "") == nil ||
+		CheckLinkBindingParams(nil, []string{"http://example.com"}, "") == nil ||
+		CheckLinkBindingParams(nil, nil, "novalue") == nil {
+		t.Fatal("expect error")
+	}
+}
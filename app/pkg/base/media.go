@@ -0,0 +1,639 @@
+package base
+
+/*
+媒体元数据解析，按文件头识别格式，只读取文件头及必要的索引，不解码完整内容
+*/
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+	"math"
+	"strings"
+	"time"
+)
+
+// 媒体扩展属性
+const (
+	MediaAttrFormat        = "format"
+	MediaAttrOrientation   = "orientation"
+	MediaAttrCaptureTime   = "captureTime"
+	MediaAttrDuration      = "duration"
+	MediaAttrVideoCodec    = "videoCodec"
+	MediaAttrAudioCodec    = "audioCodec"
+	MediaAttrSampleRate    = "sampleRate"
+	MediaAttrChannels      = "channels"
+	MediaAttrBitsPerSample = "bitsPerSample"
+	MediaAttrBitrate       = "bitrate"
+)
+
+// MediaInfo 媒体元数据，宽高为存储的像素尺寸，显示方向见orientation属性
+type MediaInfo struct {
+	Width      int
+	Height     int
+	Attributes map[string]interface{}
+}
+
+// ExtractMedia 解析图片、视频及音频的元数据，无法识别的格式返回nil
+func ExtractMedia(r io.ReaderAt, size int64) (*MediaInfo, error) {
+	head := make([]byte, 16)
+	n, err := r.ReadAt(head, 0)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	head = head[:n]
+	info := &MediaInfo{Attributes: map[string]interface{}{}}
+
+	switch {
+	case bytes.HasPrefix(head, []byte("\xff\xd8")):
+		err = parseImageConfig(r, size, info, "jpeg")
+		if err == nil {
+			err = parseJpegExif(r, size, info)
+		}
+	case bytes.HasPrefix(head, []byte("\x89PNG")):
+		err = parseImageConfig(r, size, info, "png")
+	case bytes.HasPrefix(head, []byte("GIF8")):
+		err = parseImageConfig(r, size, info, "gif")
+	case bytes.HasPrefix(head, []byte("BM")):
+		err = parseBmp(r, size, info)
+	case len(head) >= 12 && string(head[:4]) == "RIFF" && string(head[8:12]) == "WEBP":
+		err = parseWebp(r, size, info)
+	case len(head) >= 12 && string(head[:4]) == "RIFF" && string(head[8:12]) == "WAVE":
+		err = parseWav(r, size, info)
+	case bytes.HasPrefix(head, []byte("fLaC")):
+		err = parseFlac(r, size, info)
+	case len(head) >= 8 && isMp4Box(string(head[4:8])):
+		err = parseMp4(r, size, info)
+	case bytes.HasPrefix(head, []byte("ID3")) || (len(head) >= 2 && head[0] == 0xff && head[1]&0xe0 == 0xe0):
+		err = parseMp3(r, size, info)
+	default:
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return info, nil
+}
+
+// readAt 读取指定区间，超出文件大小视为格式有误
+func readAt(r io.ReaderAt, size, off, n int64) ([]byte, error) {
+	if off < 0 || n < 0 || off+n > size {
+		return nil, errors.New("媒体文件数据不完整")
+	}
+	buf := make([]byte, n)
+	if _, err := r.ReadAt(buf, off); err != nil && err != io.EOF {
+		return nil, err
+	}
+	return buf, nil
+}
+
+func parseImageConfig(r io.ReaderAt, size int64, info *MediaInfo, format string) error {
+	conf, _, err := image.DecodeConfig(io.NewSectionReader(r, 0, size))
+	if err != nil {
+		return err
+	}
+	info.Width, info.Height = conf.Width, conf.Height
+	info.Attributes[MediaAttrFormat] = format
+	return nil
+}
+
+func parseBmp(r io.ReaderAt, size int64, info *MediaInfo) error {
+	buf, err := readAt(r, size, 0, 30)
+	if err != nil {
+		return err
+	}
+	width := int32(binary.LittleEndian.Uint32(buf[18:22]))
+	height := int32(binary.LittleEndian.Uint32(buf[22:26]))
+	// 高度为负表示自上而下存储
+	if height < 0 {
+		height = -height
+	}
+	info.Width, info.Height = int(width), int(height)
+	info.Attributes[MediaAttrFormat] = "bmp"
+	info.Attributes[MediaAttrBitsPerSample] = int(binary.LittleEndian.Uint16(buf[28:30]))
+	return nil
+}
+
+func parseWebp(r io.ReaderAt, size int64, info *MediaInfo) error {
+	buf, err := readAt(r, size, 12, 18)
+	if err != nil {
+		return err
+	}
+	switch string(buf[:4]) {
+	case "VP8 ":
+		// 3字节帧标记 + 起始码 9d 01 2a
+		if !bytes.Equal(buf[11:14], []byte{0x9d, 0x01, 0x2a}) {
+			return errors.New("webp格式有误")
+		}
+		info.Width = int(binary.LittleEndian.Uint16(buf[14:16]) & 0x3fff)
+		info.Height = int(binary.LittleEndian.Uint16(buf[16:18]) & 0x3fff)
+	case "VP8L":
+		if buf[8] != 0x2f {
+			return errors.New("webp格式有误")
+		}
+		bits := binary.LittleEndian.Uint32(buf[9:13])
+		info.Width = int(bits&0x3fff) + 1
+		info.Height = int((bits>>14)&0x3fff) + 1
+	case "VP8X":
+		info.Width = int(uint32(buf[12])|uint32(buf[13])<<8|uint32(buf[14])<<16) + 1
+		info.Height = int(uint32(buf[15])|uint32(buf[16])<<8|uint32(buf[17])<<16) + 1
+	default:
+		return errors.New("webp格式有误")
+	}
+	info.Attributes[MediaAttrFormat] = "webp"
+	return nil
+}
+
+// parseJpegExif 读取APP1中的EXIF，获取方向及拍摄时间
+func parseJpegExif(r io.ReaderAt, size int64, info *MediaInfo) error {
+	for off := int64(2); off+4 <= size; {
+		buf, err := readAt(r, size, off, 4)
+		if err != nil {
+			return nil
+		}
+		if buf[0] != 0xff {
+			return nil
+		}
+		marker := buf[1]
+		// 图像数据开始，之后不再有元数据
+		if marker == 0xda || marker == 0xd9 {
+			return nil
+		}
+		length := int64(binary.BigEndian.Uint16(buf[2:4]))
+		if marker == 0xe1 && length > 8 {
+			seg, err := readAt(r, size, off+4, length-2)
+			if err != nil {
+				return nil
+			}
+			if bytes.HasPrefix(seg, []byte("Exif\x00\x00")) {
+				parseExif(seg[6:], info)
+				return nil
+			}
+		}
+		off += 2 + length
+	}
+	return nil
+}
+
+// EXIF标签
+const (
+	exifTagOrientation      = 0x0112
+	exifTagDateTime         = 0x0132
+	exifTagExifIFD          = 0x8769
+	exifTagDateTimeOriginal = 0x9003
+)
+
+// parseExif 解析TIFF结构的IFD0及Exif子IFD，数据有误时忽略
+func parseExif(tiff []byte, info *MediaInfo) {
+	if len(tiff) < 8 {
+		return
+	}
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return
+	}
+	tags := map[uint16][]byte{}
+	readIFD := func(off uint32) {
+		if int(off)+2 > len(tiff) {
+			return
+		}
+		count := int(order.Uint16(tiff[off:]))
+		for i := 0; i < count; i++ {
+			start := int(off) + 2 + i*12
+			if start+12 > len(tiff) {
+				return
+			}
+			tags[order.Uint16(tiff[start:])] = tiff[start : start+12]
+		}
+	}
+	readIFD(order.Uint32(tiff[4:8]))
+	if entry, ok := tags[exifTagExifIFD]; ok {
+		readIFD(order.Uint32(entry[8:12]))
+	}
+
+	if entry, ok := tags[exifTagOrientation]; ok {
+		if orientation := int(order.Uint16(entry[8:10])); orientation >= 1 && orientation <= 8 {
+			info.Attributes[MediaAttrOrientation] = orientation
+		}
+	}
+	for _, tag := range []uint16{exifTagDateTimeOriginal, exifTagDateTime} {
+		entry, ok := tags[tag]
+		if !ok {
+			continue
+		}
+		count := order.Uint32(entry[4:8])
+		off := order.Uint32(entry[8:12])
+		if count < 19 || int(off)+19 > len(tiff) {
+			continue
+		}
+		t, err := time.Parse("2006:01:02 15:04:05", string(tiff[off:off+19]))
+		if err != nil {
+			continue
+		}
+		info.Attributes[MediaAttrCaptureTime] = t.Format("2006-01-02 15:04:05")
+		break
+	}
+}
+
+// mediaDuration 时长(s)，保留三位小数
+func mediaDuration(d float64) float64 {
+	return math.Round(d*1000) / 1000
+}
+
+// isMp4Box 判断文件开头是否为MP4/MOV的box
+func isMp4Box(typ string) bool {
+	switch typ {
+	case "ftyp", "moov", "mdat", "wide", "free", "skip":
+		return true
+	}
+	return false
+}
+
+// walkMp4Box 遍历[start,end)区间的box，fn返回的错误会终止遍历
+func walkMp4Box(r io.ReaderAt, size, start, end int64, fn func(typ string, dataStart, dataEnd int64) error) error {
+	for off := start; off+8 <= end; {
+		buf, err := readAt(r, size, off, 8)
+		if err != nil {
+			return err
+		}
+		boxSize := int64(binary.BigEndian.Uint32(buf[:4]))
+		typ := string(buf[4:8])
+		header := int64(8)
+		switch boxSize {
+		case 0:
+			boxSize = end - off
+		case 1:
+			large, err := readAt(r, size, off+8, 8)
+			if err != nil {
+				return err
+			}
+			boxSize = int64(binary.BigEndian.Uint64(large))
+			header = 16
+		}
+		if boxSize < header || off+boxSize > end {
+			return errors.New("mp4格式有误")
+		}
+		if err := fn(typ, off+header, off+boxSize); err != nil {
+			return err
+		}
+		off += boxSize
+	}
+	return nil
+}
+
+// mp4Track 轨道信息
+type mp4Track struct {
+	handler string
+	codec   string
+	width   int
+	height  int
+}
+
+func parseMp4(r io.ReaderAt, size int64, info *MediaInfo) error {
+	format := "mov"
+	var tracks []*mp4Track
+	var track *mp4Track
+	var walk func(typ string, dataStart, dataEnd int64) error
+	walk = func(typ string, dataStart, dataEnd int64) error {
+		switch typ {
+		case "ftyp":
+			brand, err := readAt(r, size, dataStart, 4)
+			if err != nil {
+				return err
+			}
+			if string(brand) != "qt  " {
+				format = "mp4"
+			}
+		case "moov", "mdia", "minf", "stbl":
+			return walkMp4Box(r, size, dataStart, dataEnd, walk)
+		case "trak":
+			track = &mp4Track{}
+			tracks = append(tracks, track)
+			return walkMp4Box(r, size, dataStart, dataEnd, walk)
+		case "mvhd":
+			return parseMvhd(r, size, dataStart, info)
+		case "tkhd":
+			if track == nil {
+				return nil
+			}
+			buf, err := readAt(r, size, dataStart, 1)
+			if err != nil {
+				return err
+			}
+			// 宽高为16.16定点数
+			off := int64(76)
+			if buf[0] == 1 {
+				off = 88
+			}
+			wh, err := readAt(r, size, dataStart+off, 8)
+			if err != nil {
+				return err
+			}
+			track.width = int(binary.BigEndian.Uint32(wh[:4]) >> 16)
+			track.height = int(binary.BigEndian.Uint32(wh[4:]) >> 16)
+		case "hdlr":
+			if track == nil {
+				return nil
+			}
+			buf, err := readAt(r, size, dataStart+8, 4)
+			if err != nil {
+				return err
+			}
+			track.handler = string(buf)
+		case "stsd":
+			if track == nil {
+				return nil
+			}
+			// 取第一个sample entry的类型作为编码
+			buf, err := readAt(r, size, dataStart+12, 4)
+			if err != nil {
+				return err
+			}
+			track.codec = strings.TrimSpace(string(buf))
+		}
+		return nil
+	}
+	if err := walkMp4Box(r, size, 0, size, walk); err != nil {
+		return err
+	}
+
+	info.Attributes[MediaAttrFormat] = format
+	for _, t := range tracks {
+		switch t.handler {
+		case "vide":
+			if _, ok := info.Attributes[MediaAttrVideoCodec]; !ok {
+				info.Attributes[MediaAttrVideoCodec] = t.codec
+				info.Width, info.Height = t.width, t.height
+			}
+		case "soun":
+			if _, ok := info.Attributes[MediaAttrAudioCodec]; !ok {
+				info.Attributes[MediaAttrAudioCodec] = t.codec
+			}
+		}
+	}
+	return nil
+}
+
+// parseMvhd 解析时长及创建时间，时间从1904-01-01开始计算
+func parseMvhd(r io.ReaderAt, size, dataStart int64, info *MediaInfo) error {
+	buf, err := readAt(r, size, dataStart, 1)
+	if err != nil {
+		return err
+	}
+	var created, timescale, duration uint64
+	if buf[0] == 1 {
+		buf, err = readAt(r, size, dataStart+4, 28)
+		if err != nil {
+			return err
+		}
+		created = binary.BigEndian.Uint64(buf[:8])
+		timescale = uint64(binary.BigEndian.Uint32(buf[16:20]))
+		duration = binary.BigEndian.Uint64(buf[20:28])
+	} else {
+		buf, err = readAt(r, size, dataStart+4, 16)
+		if err != nil {
+			return err
+		}
+		created = uint64(binary.BigEndian.Uint32(buf[:4]))
+		timescale = uint64(binary.BigEndian.Uint32(buf[8:12]))
+		duration = uint64(binary.BigEndian.Uint32(buf[12:16]))
+	}
+	if timescale > 0 {
+		info.Attributes[MediaAttrDuration] = mediaDuration(float64(duration) / float64(timescale))
+	}
+	if created > 0 {
+		epoch := time.Date(1904, 1, 1, 0, 0, 0, 0, time.UTC)
+		info.Attributes[MediaAttrCaptureTime] = epoch.Add(time.Duration(created) * time.Second).
+			Format("2006-01-02 15:04:05")
+	}
+	return nil
+}
+
+func parseFlac(r io.ReaderAt, size int64, info *MediaInfo) error {
+	// 第一个元数据块必须是STREAMINFO
+	buf, err := readAt(r, size, 4, 38)
+	if err != nil {
+		return err
+	}
+	if buf[0]&0x7f != 0 {
+		return errors.New("flac格式有误")
+	}
+	v := binary.BigEndian.Uint64(buf[14:22])
+	sampleRate := v >> 44
+	total := v & 0xfffffffff
+	info.Attributes[MediaAttrFormat] = "flac"
+	info.Attributes[MediaAttrAudioCodec] = "flac"
+	info.Attributes[MediaAttrSampleRate] = int(sampleRate)
+	info.Attributes[MediaAttrChannels] = int((v>>41)&0x7) + 1
+	info.Attributes[MediaAttrBitsPerSample] = int((v>>36)&0x1f) + 1
+	if sampleRate > 0 && total > 0 {
+		info.Attributes[MediaAttrDuration] = mediaDuration(float64(total) / float64(sampleRate))
+	}
+	return nil
+}
+
+// wavCodecs WAVE格式标签
+var wavCodecs = map[uint16]string{
+	0x0001: "pcm",
+	0x0003: "pcm_float",
+	0x0006: "alaw",
+	0x0007: "mulaw",
+	0x0055: "mp3",
+	0xfffe: "extensible",
+}
+
+func parseWav(r io.ReaderAt, size int64, info *MediaInfo) error {
+	var byteRate uint32
+	var dataSize int64 = -1
+	for off := int64(12); off+8 <= size && (byteRate == 0 || dataSize < 0); {
+		buf, err := readAt(r, size, off, 8)
+		if err != nil {
+			return err
+		}
+		chunkSize := int64(binary.LittleEndian.Uint32(buf[4:8]))
+		switch string(buf[:4]) {
+		case "fmt ":
+			fmtBuf, err := readAt(r, size, off+8, 16)
+			if err != nil {
+				return err
+			}
+			tag := binary.LittleEndian.Uint16(fmtBuf[:2])
+			codec, ok := wavCodecs[tag]
+			if !ok {
+				codec = "unknown"
+			}
+			byteRate = binary.LittleEndian.Uint32(fmtBuf[8:12])
+			info.Attributes[MediaAttrAudioCodec] = codec
+			info.Attributes[MediaAttrChannels] = int(binary.LittleEndian.Uint16(fmtBuf[2:4]))
+			info.Attributes[MediaAttrSampleRate] = int(binary.LittleEndian.Uint32(fmtBuf[4:8]))
+			info.Attributes[MediaAttrBitsPerSample] = int(binary.LittleEndian.Uint16(fmtBuf[14:16]))
+			info.Attributes[MediaAttrBitrate] = int(byteRate) * 8
+		case "data":
+			dataSize = chunkSize
+			// 流式写入的文件data大小可能未回填
+			if off+8+dataSize > size || dataSize == 0 {
+				dataSize = size - off - 8
+			}
+		}
+		// chunk按偶数字节对齐
+		off += 8 + chunkSize + chunkSize%2
+	}
+	if byteRate == 0 {
+		return errors.New("wav格式有误")
+	}
+	info.Attributes[MediaAttrFormat] = "wav"
+	if dataSize > 0 {
+		info.Attributes[MediaAttrDuration] = mediaDuration(float64(dataSize) / float64(byteRate))
+	}
+	return nil
+}
+
+// MPEG音频码率表(kbps)，按[版本][层]索引，版本0为MPEG1，1为MPEG2/2.5
+var mp3Bitrates = [2][3][16]int{
+	{
+		{0, 32, 64, 96, 128, 160, 192, 224, 256, 288, 320, 352, 384, 416, 448},
+		{0, 32, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320, 384},
+		{0, 32, 40, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320},
+	},
+	{
+		{0, 32, 48, 56, 64, 80, 96, 112, 128, 144, 160, 176, 192, 224, 256},
+		{0, 8, 16, 24, 32, 40, 48, 56, 64, 80, 96, 112, 128, 144, 160},
+		{0, 8, 16, 24, 32, 40, 48, 56, 64, 80, 96, 112, 128, 144, 160},
+	},
+}
+
+var mp3SampleRates = [3]int{44100, 48000, 32000}
+
+// mp3Frame MPEG音频帧头
+type mp3Frame struct {
+	version    int // 1 MPEG1，2 MPEG2，25 MPEG2.5
+	layer      int
+	bitrate    int // kbps
+	sampleRate int
+	channels   int
+}
+
+func parseMp3Frame(h []byte) (*mp3Frame, bool) {
+	if h[0] != 0xff || h[1]&0xe0 != 0xe0 {
+		return nil, false
+	}
+	versionBits := (h[1] >> 3) & 0x3
+	layerBits := (h[1] >> 1) & 0x3
+	bitrateIdx := h[2] >> 4
+	srIdx := (h[2] >> 2) & 0x3
+	if versionBits == 1 || layerBits == 0 || bitrateIdx == 0 || bitrateIdx == 15 || srIdx == 3 {
+		return nil, false
+	}
+	f := &mp3Frame{layer: 4 - int(layerBits), channels: 2}
+	table := 1
+	switch versionBits {
+	case 3:
+		f.version, table = 1, 0
+		f.sampleRate = mp3SampleRates[srIdx]
+	case 2:
+		f.version = 2
+		f.sampleRate = mp3SampleRates[srIdx] / 2
+	default:
+		f.version = 25
+		f.sampleRate = mp3SampleRates[srIdx] / 4
+	}
+	f.bitrate = mp3Bitrates[table][f.layer-1][bitrateIdx]
+	if h[3]>>6 == 3 {
+		f.channels = 1
+	}
+	return f, true
+}
+
+// samplesPerFrame 每帧采样数
+func (f *mp3Frame) samplesPerFrame() int {
+	switch {
+	case f.layer == 1:
+		return 384
+	case f.layer == 3 && f.version != 1:
+		return 576
+	}
+	return 1152
+}
+
+func parseMp3(r io.ReaderAt, size int64, info *MediaInfo) error {
+	start := int64(0)
+	// 跳过ID3v2标签，长度为syncsafe整数
+	if head, err := readAt(r, size, 0, 10); err == nil && string(head[:3]) == "ID3" {
+		tagSize := int64(head[6]&0x7f)<<21 | int64(head[7]&0x7f)<<14 | int64(head[8]&0x7f)<<7 | int64(head[9]&0x7f)
+		start = 10 + tagSize
+		if head[5]&0x10 != 0 {
+			start += 10
+		}
+	}
+	end := size
+	if tail, err := readAt(r, size, size-128, 3); err == nil && string(tail) == "TAG" {
+		end -= 128
+	}
+
+	// 在标签后查找第一个有效帧
+	window := int64(64 * 1024)
+	if start+window > end {
+		window = end - start
+	}
+	buf, err := readAt(r, size, start, window)
+	if err != nil {
+		return err
+	}
+	var frame *mp3Frame
+	pos := -1
+	for i := 0; i+4 <= len(buf); i++ {
+		if f, ok := parseMp3Frame(buf[i : i+4]); ok {
+			frame, pos = f, i
+			break
+		}
+	}
+	if frame == nil {
+		return errors.New("mp3格式有误")
+	}
+
+	info.Attributes[MediaAttrFormat] = "mp3"
+	info.Attributes[MediaAttrAudioCodec] = []string{"", "mp1", "mp2", "mp3"}[frame.layer]
+	info.Attributes[MediaAttrSampleRate] = frame.sampleRate
+	info.Attributes[MediaAttrChannels] = frame.channels
+
+	// VBR文件的Xing/Info头记录总帧数，位于side info之后
+	sideInfo := 32
+	switch {
+	case frame.version == 1 && frame.channels == 1, frame.version != 1 && frame.channels != 1:
+		sideInfo = 17
+	case frame.version != 1:
+		sideInfo = 9
+	}
+	frames := uint32(0)
+	if x := pos + 4 + sideInfo; x+12 <= len(buf) {
+		tag := string(buf[x : x+4])
+		if (tag == "Xing" || tag == "Info") && binary.BigEndian.Uint32(buf[x+4:x+8])&0x1 != 0 {
+			frames = binary.BigEndian.Uint32(buf[x+8 : x+12])
+		}
+	}
+	if v := pos + 4 + 32; frames == 0 && v+18 <= len(buf) && string(buf[v:v+4]) == "VBRI" {
+		frames = binary.BigEndian.Uint32(buf[v+14 : v+18])
+	}
+	if frames > 0 {
+		duration := float64(frames) * float64(frame.samplesPerFrame()) / float64(frame.sampleRate)
+		info.Attributes[MediaAttrDuration] = mediaDuration(duration)
+		if duration > 0 {
+			info.Attributes[MediaAttrBitrate] = int(float64(end-start-int64(pos)) * 8 / duration)
+		}
+		return nil
+	}
+	// 固定码率按音频数据大小估算
+	info.Attributes[MediaAttrBitrate] = frame.bitrate * 1000
+	info.Attributes[MediaAttrDuration] = mediaDuration(float64(end-start-int64(pos)) * 8 / float64(frame.bitrate*1000))
+	return nil
+}
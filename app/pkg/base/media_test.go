@@ -0,0 +1,198 @@
+package base
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"testing"
+)
+
+func extractBytes(t *testing.T, data []byte) *MediaInfo {
+	info, err := ExtractMedia(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info == nil {
+		t.Fatal("expect media info")
+	}
+	return info
+}
+
+func TestExtractPng(t *testing.T) {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewRGBA(image.Rect(0, 0, 30, 20))); err != nil {
+		t.Fatal(err)
+	}
+	info := extractBytes(t, buf.Bytes())
+	if info.Width != 30 || info.Height != 20 || info.Attributes[MediaAttrFormat] != "png" {
+		t.Fatalf("unexpected %+v", info)
+	}
+}
+
+// exifSegment 构造包含方向及拍摄时间的APP1段
+func exifSegment() []byte {
+	var tiff bytes.Buffer
+	le := binary.LittleEndian
+	tiff.WriteString("II")
+	_ = binary.Write(&tiff, le, uint16(42))
+	_ = binary.Write(&tiff, le, uint32(8))
+	// IFD0: Orientation、ExifIFD指针
+	_ = binary.Write(&tiff, le, uint16(2))
+	_ = binary.Write(&tiff, le, []uint16{exifTagOrientation, 3})
+	_ = binary.Write(&tiff, le, uint32(1))
+	_ = binary.Write(&tiff, le, []uint16{6, 0})
+	_ = binary.Write(&tiff, le, []uint16{exifTagExifIFD, 4})
+	_ = binary.Write(&tiff, le, uint32(1))
+	_ = binary.Write(&tiff, le, uint32(38))
+	_ = binary.Write(&tiff, le, uint32(0))
+	// Exif IFD: DateTimeOriginal
+	_ = binary.Write(&tiff, le, uint16(1))
+	_ = binary.Write(&tiff, le, []uint16{exifTagDateTimeOriginal, 2})
+	_ = binary.Write(&tiff, le, uint32(20))
+	_ = binary.Write(&tiff, le, uint32(56))
+	_ = binary.Write(&tiff, le, uint32(0))
+	tiff.WriteString("2023:05:06 07:08:09\x00")
+
+	seg := append([]byte("Exif\x00\x00"), tiff.Bytes()...)
+	head := []byte{0xff, 0xe1, 0, 0}
+	binary.BigEndian.PutUint16(head[2:], uint16(len(seg)+2))
+	return append(head, seg...)
+}
+
+func TestExtractJpegExif(t *testing.T) {
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, image.NewRGBA(image.Rect(0, 0, 16, 8)), nil); err != nil {
+		t.Fatal(err)
+	}
+	data := append([]byte{0xff, 0xd8}, exifSegment()...)
+	data = append(data, buf.Bytes()[2:]...)
+	info := extractBytes(t, data)
+	if info.Width != 16 || info.Height != 8 {
+		t.Fatalf("unexpected size %dx%d", info.Width, info.Height)
+	}
+	if info.Attributes[MediaAttrOrientation] != 6 || info.Attributes[MediaAttrCaptureTime] != "2023-05-06 07:08:09" {
+		t.Fatalf("unexpected attributes %+v", info.Attributes)
+	}
+}
+
+func TestExtractWebpAndBmp(t *testing.T) {
+	webp := []byte("RIFF\x00\x00\x00\x00WEBPVP8X\x0a\x00\x00\x00\x00\x00\x00\x00")
+	webp = append(webp, 0x7f, 0x02, 0x00, 0xdf, 0x01, 0x00)
+	info := extractBytes(t, webp)
+	if info.Width != 640 || info.Height != 480 {
+		t.Fatalf("unexpected webp size %dx%d", info.Width, info.Height)
+	}
+
+	bmp := make([]byte, 54)
+	copy(bmp, "BM")
+	binary.LittleEndian.PutUint32(bmp[18:], 100)
+	binary.LittleEndian.PutUint32(bmp[22:], uint32(0xffffffff-49)) // -50
+	binary.LittleEndian.PutUint16(bmp[28:], 24)
+	info = extractBytes(t, bmp)
+	if info.Width != 100 || info.Height != 50 {
+		t.Fatalf("unexpected bmp size %dx%d", info.Width, info.Height)
+	}
+}
+
+func TestExtractWavAndFlac(t *testing.T) {
+	var wav bytes.Buffer
+	le := binary.LittleEndian
+	wav.WriteString("RIFF")
+	_ = binary.Write(&wav, le, uint32(36+88200))
+	wav.WriteString("WAVEfmt ")
+	_ = binary.Write(&wav, le, uint32(16))
+	_ = binary.Write(&wav, le, []uint16{1, 1})
+	_ = binary.Write(&wav, le, []uint32{44100, 88200})
+	_ = binary.Write(&wav, le, []uint16{2, 16})
+	wav.WriteString("data")
+	_ = binary.Write(&wav, le, uint32(88200))
+	wav.Write(make([]byte, 88200))
+	info := extractBytes(t, wav.Bytes())
+	if info.Attributes[MediaAttrDuration] != 1.0 || info.Attributes[MediaAttrAudioCodec] != "pcm" {
+		t.Fatalf("unexpected wav %+v", info.Attributes)
+	}
+
+	flac := []byte("fLaC\x00\x00\x00\x22")
+	streamInfo := make([]byte, 34)
+	// 48000Hz，2声道，16位，96000个采样
+	v := uint64(48000)<<44 | uint64(1)<<41 | uint64(15)<<36 | 96000
+	binary.BigEndian.PutUint64(streamInfo[10:], v)
+	info = extractBytes(t, append(flac, streamInfo...))
+	if info.Attributes[MediaAttrDuration] != 2.0 || info.Attributes[MediaAttrChannels] != 2 ||
+		info.Attributes[MediaAttrSampleRate] != 48000 {
+		t.Fatalf("unexpected flac %+v", info.Attributes)
+	}
+}
+
+func mp4Box(typ string, payload ...[]byte) []byte {
+	body := bytes.Join(payload, nil)
+	head := make([]byte, 8)
+	binary.BigEndian.PutUint32(head, uint32(len(body)+8))
+	copy(head[4:], typ)
+	return append(head, body...)
+}
+
+func TestExtractMp4(t *testing.T) {
+	mvhd := make([]byte, 100)
+	binary.BigEndian.PutUint32(mvhd[12:], 1000)
+	binary.BigEndian.PutUint32(mvhd[16:], 12500)
+	tkhd := make([]byte, 84)
+	binary.BigEndian.PutUint32(tkhd[76:], 1920<<16)
+	binary.BigEndian.PutUint32(tkhd[80:], 1080<<16)
+	hdlr := make([]byte, 24)
+	copy(hdlr[8:], "vide")
+	stsd := make([]byte, 24)
+	copy(stsd[12:], "avc1")
+	audioHdlr := make([]byte, 24)
+	copy(audioHdlr[8:], "soun")
+	audioStsd := make([]byte, 24)
+	copy(audioStsd[12:], "mp4a")
+
+	data := bytes.Join([][]byte{
+		mp4Box("ftyp", []byte("isom\x00\x00\x02\x00")),
+		mp4Box("mdat", make([]byte, 64)),
+		mp4Box("moov",
+			mp4Box("mvhd", mvhd),
+			mp4Box("trak", mp4Box("tkhd", tkhd), mp4Box("mdia", mp4Box("hdlr", hdlr),
+				mp4Box("minf", mp4Box("stbl", mp4Box("stsd", stsd))))),
+			mp4Box("trak", mp4Box("mdia", mp4Box("hdlr", audioHdlr),
+				mp4Box("minf", mp4Box("stbl", mp4Box("stsd", audioStsd))))),
+		),
+	}, nil)
+	info := extractBytes(t, data)
+	if info.Width != 1920 || info.Height != 1080 {
+		t.Fatalf("unexpected size %dx%d", info.Width, info.Height)
+	}
+	if info.Attributes[MediaAttrDuration] != 12.5 || info.Attributes[MediaAttrVideoCodec] != "avc1" ||
+		info.Attributes[MediaAttrAudioCodec] != "mp4a" || info.Attributes[MediaAttrFormat] != "mp4" {
+		t.Fatalf("unexpected attributes %+v", info.Attributes)
+	}
+}
+
+func TestExtractMp3(t *testing.T) {
+	// MPEG1 Layer III，128kbps，44100Hz，每帧417字节
+	frame := make([]byte, 417)
+	copy(frame, []byte{0xff, 0xfb, 0x90, 0x00})
+	var data bytes.Buffer
+	data.WriteString("ID3\x03\x00\x00\x00\x00\x00\x0a")
+	data.Write(make([]byte, 10))
+	for i := 0; i < 100; i++ {
+		data.Write(frame)
+	}
+	info := extractBytes(t, data.Bytes())
+	if info.Attributes[MediaAttrSampleRate] != 44100 || info.Attributes[MediaAttrBitrate] != 128000 {
+		t.Fatalf("unexpected mp3 %+v", info.Attributes)
+	}
+	if d := info.Attributes[MediaAttrDuration].(float64); d < 2.6 || d > 2.62 {
+		t.Fatalf("unexpected duration %v", d)
+	}
+}
+
+func TestExtractUnknown(t *testing.T) {
+	info, err := ExtractMedia(bytes.NewReader([]byte("plain text")), 10)
+	if err != nil || info != nil {
+		t.Fatalf("expect nil, got %+v %v", info, err)
+	}
+}
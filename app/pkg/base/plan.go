@@ -0,0 +1,49 @@
+package base
+
+import (
+	"errors"
+	"fmt"
+	"github.com/qinguoyi/osproxy/config"
+)
+
+// defaultPartSize 未配置分片大小时使用的默认值
+const defaultPartSize = 5 * 1024 * 1024
+
+// CalcUploadPlan 根据文件大小及期望的分片大小计算分片大小和数量
+func CalcUploadPlan(size, partSize int64, conf config.Upload) (int64, int64, error) {
+	if size <= 0 {
+		return 0, 0, errors.New("文件大小有误")
+	}
+	minSize, maxSize := conf.MinPartSize*1024*1024, conf.MaxPartSize*1024*1024
+	if partSize <= 0 {
+		partSize = conf.PartSize * 1024 * 1024
+	}
+	if minSize > 0 && partSize < minSize {
+		partSize = minSize
+	}
+	if maxSize > 0 && partSize > maxSize {
+		partSize = maxSize
+	}
+	if partSize <= 0 {
+		partSize = defaultPartSize
+	}
+	// 分片数量超过上限时增大分片
+	if conf.MaxPartCount > 0 && (size+partSize-1)/partSize > conf.MaxPartCount {
+		partSize = (size + conf.MaxPartCount - 1) / conf.MaxPartCount
+		if maxSize > 0 && partSize > maxSize {
+			return 0, 0, fmt.Errorf("文件大小超过上限%d", maxSize*conf.MaxPartCount)
+		}
+	}
+	return partSize, (size + partSize - 1) / partSize, nil
+}
+
+// PlanPartSize 计划中第num个分片的大小，分片序号从1开始
+func PlanPartSize(size, partSize, partCount, num int64) int64 {
+	if num < 1 || num > partCount {
+		return 0
+	}
+	if num == partCount {
+		return size - partSize*(partCount-1)
+	}
+	return partSize
+}
@@ -0,0 +1,53 @@
+package base
+
+import (
+	"github.com/qinguoyi/osproxy/config"
+	"testing"
+)
+
+func TestCalcUploadPlan(t *testing.T) {
+	const mb = 1024 * 1024
+	conf := config.Upload{PartSize: 5, MinPartSize: 1, MaxPartSize: 100, MaxPartCount: 10}
+	cases := []struct {
+		size, partSize      int64
+		wantSize, wantCount int64
+	}{
+		{12 * mb, 0, 5 * mb, 3},
+		{12 * mb, 100, (12*mb + 9) / 10, 10},
+		{12 * mb, 1000 * mb, 100 * mb, 1},
+		{200 * mb, 5 * mb, 20 * mb, 10},
+		{1, 0, 5 * mb, 1},
+	}
+	for _, c := range cases {
+		partSize, count, err := CalcUploadPlan(c.size, c.partSize, conf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if partSize != c.wantSize || count != c.wantCount {
+			t.Fatalf("CalcUploadPlan(%d, %d) = %d, %d; want %d, %d", c.size, c.partSize,
+				partSize, count, c.wantSize, c.wantCount)
+		}
+	}
+	if _, _, err := CalcUploadPlan(2000*mb, 0, conf); err == nil {
+		t.Fatal("expected error for oversized file")
+	}
+	if _, _, err := CalcUploadPlan(0, 0, conf); err == nil {
+		t.Fatal("expected error for empty file")
+	}
+	// 未配置分片大小时使用默认值
+	if partSize, count, err := CalcUploadPlan(12*mb, 0, config.Upload{}); err != nil || partSize != 5*mb || count != 3 {
+		t.Fatalf("CalcUploadPlan with empty config = %d, %d, %v", partSize, count, err)
+	}
+}
+
+func TestPlanPartSize(t *testing.T) {
+	if got := PlanPartSize(12, 5, 3, 1); got != 5 {
+		t.Fatalf("got %d", got)
+	}
+	if got := PlanPartSize(12, 5, 3, 3); got != 2 {
+		t.Fatalf("got %d", got)
+	}
+	if got := PlanPartSize(12, 5, 3, 4); got != 0 {
+		t.Fatalf("got %d", got)
+	}
+}
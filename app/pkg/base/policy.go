@@ -0,0 +1,189 @@
+package base
+
+import (
+	"crypto/hmac"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/qinguoyi/osproxy/app/models"
+	"strings"
+	"time"
+)
+
+/*
+表单上传策略，参照S3 POST Policy，条件支持:
+{"field": "value"}、["eq", "$field", "value"]、["starts-with", "$field", "prefix"]、["content-length-range", min, max]
+*/
+
+// 表单字段
+const (
+	PolicyFieldKey         = "key"
+	PolicyFieldPolicy      = "policy"
+	PolicyFieldSignature   = "signature"
+	PolicyFieldContentType = "Content-Type"
+	PolicyFieldRedirect    = "success_action_redirect"
+	PolicyFieldTenant      = "tenant"
+	PolicyFieldCallback    = "callback"
+	PolicyFilenameVar      = "${filename}"
+)
+
+// PostPolicy .
+type PostPolicy struct {
+	Expiration string        `json:"expiration"`
+	Conditions []interface{} `json:"conditions"`
+}
+
+// GenPostPolicy 生成表单上传策略及签名
+func GenPostPolicy(req *models.GenPolicy, tenant string, now time.Time) (*models.GenPolicyResp, error) {
+	if req.MaxSize <= 0 || req.MinSize < 0 || req.MinSize > req.MaxSize {
+		return nil, errors.New("文件大小范围有误")
+	}
+	if err := CheckCallback(req.Callback); err != nil {
+		return nil, err
+	}
+	expiration := now.Add(time.Duration(req.Expire) * time.Second).UTC().Format(time.RFC3339)
+	fields := map[string]string{
+		PolicyFieldKey:    req.KeyPrefix + PolicyFilenameVar,
+		PolicyFieldTenant: tenant,
+	}
+	conditions := []interface{}{
+		[]interface{}{"starts-with", "$" + PolicyFieldKey, req.KeyPrefix},
+		[]interface{}{"content-length-range", req.MinSize, req.MaxSize},
+		map[string]string{PolicyFieldTenant: tenant},
+	}
+	if req.ContentType != "" {
+		conditions = append(conditions, []interface{}{"starts-with", "$" + PolicyFieldContentType, req.ContentType})
+	}
+	if req.Callback != "" {
+		fields[PolicyFieldCallback] = req.Callback
+		conditions = append(conditions, map[string]string{PolicyFieldCallback: req.Callback})
+	}
+	if req.SuccessUrl != "" {
+		fields[PolicyFieldRedirect] = req.SuccessUrl
+		conditions = append(conditions, map[string]string{PolicyFieldRedirect: req.SuccessUrl})
+	}
+	b, err := json.Marshal(PostPolicy{Expiration: expiration, Conditions: conditions})
+	if err != nil {
+		return nil, err
+	}
+	policy := base64.StdEncoding.EncodeToString(b)
+	fields[PolicyFieldPolicy] = policy
+	fields[PolicyFieldSignature] = decode(policy)
+	return &models.GenPolicyResp{
+		Url:        "/api/storage/v0/upload/form",
+		Expiration: expiration,
+		Fields:     fields,
+	}, nil
+}
+
+// ParsePostPolicy 校验签名及过期时间并解析策略
+func ParsePostPolicy(policy, signature string, now time.Time) (*PostPolicy, error) {
+	if policy == "" || !hmac.Equal([]byte(decode(policy)), []byte(signature)) {
+		return nil, errors.New("签名校验失败")
+	}
+	b, err := base64.StdEncoding.DecodeString(policy)
+	if err != nil {
+		return nil, errors.New("策略解析失败")
+	}
+	var p PostPolicy
+	if err := json.Unmarshal(b, &p); err != nil {
+		return nil, errors.New("策略解析失败")
+	}
+	expiration, err := time.Parse(time.RFC3339, p.Expiration)
+	if err != nil {
+		return nil, errors.New("策略过期时间有误")
+	}
+	if now.After(expiration) {
+		return nil, errors.New("策略已过期")
+	}
+	return &p, nil
+}
+
+// MaxSize 策略允许的最大文件大小，未限制时返回-1
+func (p *PostPolicy) MaxSize() int64 {
+	for _, condition := range p.Conditions {
+		if cond, ok := condition.([]interface{}); ok && len(cond) == 3 {
+			if op, _ := cond[0].(string); strings.ToLower(op) == "content-length-range" {
+				if max, ok := cond[2].(float64); ok {
+					return int64(max)
+				}
+			}
+		}
+	}
+	return -1
+}
+
+// CheckFields 读取文件前校验表单字段，文件大小及识别出的Content-Type在读取文件后由Check校验
+func (p *PostPolicy) CheckFields(fields map[string]string) error {
+	return p.check(fields, -1)
+}
+
+// Check 校验表单字段及文件大小，未出现在条件中的跳转地址、回调地址不允许使用
+func (p *PostPolicy) Check(fields map[string]string, size int64) error {
+	return p.check(fields, size)
+}
+
+// check size小于0时跳过文件大小及Content-Type条件
+func (p *PostPolicy) check(fields map[string]string, size int64) error {
+	covered := map[string]bool{}
+	for _, condition := range p.Conditions {
+		switch cond := condition.(type) {
+		case map[string]interface{}:
+			for field, v := range cond {
+				expect, ok := v.(string)
+				if !ok {
+					return fmt.Errorf("策略条件[%s]有误", field)
+				}
+				if size < 0 && field == PolicyFieldContentType {
+					continue
+				}
+				if fields[field] != expect {
+					return fmt.Errorf("字段[%s]不满足策略", field)
+				}
+				covered[field] = true
+			}
+		case []interface{}:
+			if len(cond) != 3 {
+				return errors.New("策略条件有误")
+			}
+			op, _ := cond[0].(string)
+			switch strings.ToLower(op) {
+			case "content-length-range":
+				min, ok1 := cond[1].(float64)
+				max, ok2 := cond[2].(float64)
+				if !ok1 || !ok2 {
+					return errors.New("策略条件content-length-range有误")
+				}
+				if size >= 0 && (size < int64(min) || size > int64(max)) {
+					return fmt.Errorf("文件大小%d不在允许范围[%d, %d]内", size, int64(min), int64(max))
+				}
+			case "eq", "starts-with":
+				name, ok1 := cond[1].(string)
+				expect, ok2 := cond[2].(string)
+				if !ok1 || !ok2 || !strings.HasPrefix(name, "$") {
+					return fmt.Errorf("策略条件%s有误", op)
+				}
+				field := name[1:]
+				if size < 0 && field == PolicyFieldContentType {
+					continue
+				}
+				value := fields[field]
+				if op == "eq" && value != expect || op == "starts-with" && !strings.HasPrefix(value, expect) {
+					return fmt.Errorf("字段[%s]不满足策略", field)
+				}
+				covered[field] = true
+			default:
+				return fmt.Errorf("不支持的策略条件%s", op)
+			}
+		default:
+			return errors.New("策略条件有误")
+		}
+	}
+	for _, field := range []string{PolicyFieldRedirect, PolicyFieldCallback} {
+		if fields[field] != "" && !covered[field] {
+			return fmt.Errorf("字段[%s]未经签名", field)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,78 @@
+package base
+
+import (
+	"github.com/qinguoyi/osproxy/app/models"
+	"testing"
+	"time"
+)
+
+func TestPostPolicy(t *testing.T) {
+	now := time.Now()
+	resp, err := GenPostPolicy(&models.GenPolicy{
+		Expire:      60,
+		KeyPrefix:   "avatar/",
+		MaxSize:     1024,
+		ContentType: "image/",
+		SuccessUrl:  "https://example.com/done",
+	}, "app1", now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fields := map[string]string{}
+	for k, v := range resp.Fields {
+		fields[k] = v
+	}
+	fields[PolicyFieldKey] = "avatar/a.png"
+	fields[PolicyFieldContentType] = "image/png"
+
+	policy, err := ParsePostPolicy(fields[PolicyFieldPolicy], fields[PolicyFieldSignature], now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := policy.Check(fields, 100); err != nil {
+		t.Fatalf("expected valid form, got %v", err)
+	}
+	if err := policy.Check(fields, 2048); err == nil {
+		t.Fatal("expected size limit error")
+	}
+	if policy.MaxSize() != 1024 {
+		t.Fatalf("expected max size 1024, got %d", policy.MaxSize())
+	}
+	// 读取文件前不校验大小及Content-Type
+	if err := policy.CheckFields(map[string]string{PolicyFieldKey: "avatar/a.png", PolicyFieldTenant: "app1",
+		PolicyFieldRedirect: "https://example.com/done"}); err != nil {
+		t.Fatalf("expected valid fields, got %v", err)
+	}
+	if err := policy.CheckFields(map[string]string{PolicyFieldKey: "other/a.png", PolicyFieldTenant: "app1",
+		PolicyFieldRedirect: "https://example.com/done"}); err == nil {
+		t.Fatal("expected key error")
+	}
+
+	invalid := []map[string]string{
+		{PolicyFieldKey: "other/a.png"},
+		{PolicyFieldContentType: "text/plain"},
+		{PolicyFieldTenant: "app2"},
+		{PolicyFieldRedirect: "https://evil.com"},
+		{PolicyFieldCallback: "https://evil.com"},
+	}
+	for _, override := range invalid {
+		form := map[string]string{}
+		for k, v := range fields {
+			form[k] = v
+		}
+		for k, v := range override {
+			form[k] = v
+		}
+		if err := policy.Check(form, 100); err == nil {
+			t.Fatalf("expected error for %v", override)
+		}
+	}
+
+	if _, err := ParsePostPolicy(fields[PolicyFieldPolicy], "bad", now); err == nil {
+		t.Fatal("expected signature error")
+	}
+	if _, err := ParsePostPolicy(fields[PolicyFieldPolicy], fields[PolicyFieldSignature],
+		now.Add(2*time.Minute)); err == nil {
+		t.Fatal("expected expiration error")
+	}
+}
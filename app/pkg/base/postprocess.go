@@ -0,0 +1,96 @@
+package base
+
+import (
+	"github.com/qinguoyi/osproxy/app/models"
+	"github.com/qinguoyi/osproxy/app/pkg/utils"
+	"github.com/qinguoyi/osproxy/bootstrap"
+	"gorm.io/gorm"
+	"net/url"
+	"strings"
+)
+
+// UploadedStatus 上传完成后的文件状态，启用扫描时先隔离，扫描通过后才可下载
+func UploadedStatus() int {
+	if bootstrap.NewConfig("").Scan.Enabled {
+		return utils.MetaStatusQuarantined
+	}
+	return utils.MetaStatusAvailable
+}
+
+// AfterUpload 文件上传或合并完成后的后置处理，待扫描的文件先创建扫描任务
+func AfterUpload(db *gorm.DB, meta *models.MetaDataInfo, eventType string) error {
+	// 租户用量在上传完成时累计，不等待扫描结果
+	usageErr := AddUsage(db, meta)
+
+	var err error
+	if meta.Status == utils.MetaStatusQuarantined {
+		err = CreateTask(db, utils.TaskScan, meta.UID, models.ScanInfo{
+			StorageUid: meta.UID,
+			Event:      eventType,
+		})
+	} else {
+		err = AfterScan(db, meta, eventType)
+	}
+	if err != nil {
+		return err
+	}
+	return usageErr
+}
+
+// AfterScan 文件可下载后的后置处理，包括回调通知及后续异步任务
+func AfterScan(db *gorm.DB, meta *models.MetaDataInfo, eventType string) error {
+	// 批次内的文件在批次提交时统一通知
+	if meta.BatchUid == 0 {
+		if err := NotifyEvent(db, meta, eventType); err != nil {
+			return err
+		}
+	}
+
+	// 媒体元数据解析
+	if bootstrap.NewConfig("").Media.Enabled && isMediaFile(meta) {
+		if err := CreateTask(db, utils.TaskMedia, meta.UID, models.MediaInfo{
+			StorageUid: meta.UID,
+		}); err != nil {
+			return err
+		}
+	}
+
+	// 缩略图生成
+	if meta.Bucket == "image" && IsTransformable(meta.ContentType) && len(ThumbnailTransforms()) > 0 {
+		if err := CreateTask(db, utils.TaskThumbnail, meta.UID, models.ThumbnailInfo{
+			StorageUid: meta.UID,
+		}); err != nil {
+			return err
+		}
+	}
+
+	// 压缩包展开
+	if bootstrap.NewConfig("").Archive.Enabled && meta.Bucket == "archive" && meta.CompressUid == 0 {
+		srcName, err := url.PathUnescape(meta.Name)
+		if err != nil {
+			srcName = meta.Name
+		}
+		if GetArchiveFormat(srcName) != "" {
+			if err := CreateTask(db, utils.TaskArchive, meta.UID, models.ArchiveInfo{
+				StorageUid: meta.UID,
+			}); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// isMediaFile 按桶或探测到的内容类型判断是否为图片、音视频，后缀未收录的文件也能解析
+func isMediaFile(meta *models.MetaDataInfo) bool {
+	switch meta.Bucket {
+	case "image", "video", "audio":
+		return true
+	}
+	for _, prefix := range []string{"image/", "video/", "audio/"} {
+		if strings.HasPrefix(meta.ContentType, prefix) {
+			return true
+		}
+	}
+	return false
+}
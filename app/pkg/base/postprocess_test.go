@@ -0,0 +1,74 @@
+package base
+
+import (
+	"github.com/qinguoyi/osproxy/app/models"
+	"github.com/qinguoyi/osproxy/app/pkg/utils"
+	"github.com/qinguoyi/osproxy/bootstrap"
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+	"testing"
+)
+
+// dryRunTasks 返回不连接数据库的gorm实例，记录AfterScan创建的任务类型
+func dryRunTasks(t *testing.T) (*gorm.DB, *[]string) {
+	bootstrap.NewConfig("../../../conf/config.yaml")
+	db, err := gorm.Open(mysql.New(mysql.Config{
+		DSN:                       "test:test@tcp(127.0.0.1:3306)/test",
+		SkipInitializeWithVersion: true,
+	}), &gorm.Config{
+		DryRun:                 true,
+		DisableAutomaticPing:   true,
+		SkipDefaultTransaction: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var tasks []string
+	if err := db.Callback().Create().After("gorm:create").Register("test:tasks", func(tx *gorm.DB) {
+		if task, ok := tx.Statement.Dest.(*models.TaskInfo); ok {
+			tasks = append(tasks, task.TaskType)
+		}
+	}); err != nil {
+		t.Fatal(err)
+	}
+	return db, &tasks
+}
+
+func TestAfterScanMedia(t *testing.T) {
+	db, tasks := dryRunTasks(t)
+	if !bootstrap.NewConfig("").Media.Enabled {
+		t.Skip("media disabled")
+	}
+	for _, tt := range []struct {
+		name        string
+		contentType string
+		media       bool
+	}{
+		{"photo.webp", "image/webp", true},
+		{"clip.mov", "application/octet-stream", true},
+		{"voice.m4a", "application/octet-stream", true},
+		{"clip.mkv", "video/webm", true},
+		{"data.bin", "application/octet-stream", false},
+	} {
+		*tasks = nil
+		meta := &models.MetaDataInfo{
+			UID:         1,
+			Bucket:      selectBucketBySuffix(tt.name),
+			Name:        tt.name,
+			ContentType: tt.contentType,
+			Status:      utils.MetaStatusAvailable,
+		}
+		if err := AfterScan(db, meta, utils.EventUploaded); err != nil {
+			t.Fatal(err)
+		}
+		found := false
+		for _, task := range *tasks {
+			if task == utils.TaskMedia {
+				found = true
+			}
+		}
+		if found != tt.media {
+			t.Fatalf("%s: expect media task %v, got tasks %v", tt.name, tt.media, *tasks)
+		}
+	}
+}
@@ -0,0 +1,135 @@
+package base
+
+/*
+租户存储配额
+*/
+
+import (
+	"fmt"
+	"github.com/qinguoyi/osproxy/app/models"
+	"github.com/qinguoyi/osproxy/app/pkg/repo"
+	"gorm.io/gorm"
+)
+
+// GetQuota 获取租户配额及用量
+func GetQuota(db *gorm.DB, tenant string) (*models.QuotaResp, error) {
+	usage, err := repo.NewTenantUsageRepo().GetByTenant(db, tenant)
+	if err != nil {
+		return nil, err
+	}
+	resp := &models.QuotaResp{
+		Tenant:   tenant,
+		Bytes:    usage.Bytes,
+		Files:    usage.Files,
+		Reserved: usage.Reserved,
+	}
+	if conf := GetTenant(tenant); conf != nil {
+		resp.MaxBytes = conf.MaxBytes * 1024 * 1024
+		resp.MaxFiles = conf.MaxFiles
+		resp.SoftLimit = conf.SoftLimit
+	}
+	return resp, nil
+}
+
+// CheckQuota 校验新增size字节及files个文件后是否超出配额，超出时返回提示信息
+func CheckQuota(db *gorm.DB, tenant string, size, files int64) (string, error) {
+	conf := GetTenant(tenant)
+	if conf == nil || (conf.MaxBytes <= 0 && conf.MaxFiles <= 0) {
+		return "", nil
+	}
+	quota, err := GetQuota(db, tenant)
+	if err != nil {
+		return "", err
+	}
+	if quota.MaxBytes > 0 && quota.Bytes+quota.Reserved+size > quota.MaxBytes {
+		return fmt.Sprintf("存储容量超出配额，已用:%d, 预留:%d, 新增:%d, 上限:%d", quota.Bytes, quota.Reserved, size,
+			quota.MaxBytes), nil
+	}
+	if quota.MaxFiles > 0 && quota.Files+files > quota.MaxFiles {
+		return fmt.Sprintf("文件数量超出配额，已有:%d, 新增:%d, 上限:%d", quota.Files, files, quota.MaxFiles), nil
+	}
+	return "", nil
+}
+
+// ReserveQuota 生成上传链接时按声明的大小预留容量，避免并发上传超出配额；需在落库元数据的事务内调用
+func ReserveQuota(db *gorm.DB, tenant string, metas []models.MetaDataInfo) (string, error) {
+	conf := GetTenant(tenant)
+	if conf == nil || conf.MaxBytes <= 0 {
+		return "", nil
+	}
+	var size int64
+	for _, meta := range metas {
+		size += meta.StorageSize
+	}
+	if size == 0 {
+		return "", nil
+	}
+	maxBytes := conf.MaxBytes * 1024 * 1024
+	ok, err := repo.NewTenantUsageRepo().Reserve(db, tenant, size, maxBytes)
+	if err != nil {
+		return "", err
+	}
+	if !ok {
+		return fmt.Sprintf("存储容量超出配额，新增:%d, 上限:%d", size, maxBytes), nil
+	}
+	for i := range metas {
+		metas[i].Reserved = metas[i].StorageSize
+	}
+	return "", nil
+}
+
+// UploadQuotaSize 上传完成时需新增校验的容量，生成链接时已预留的部分不重复计算
+func UploadQuotaSize(meta *models.MetaDataInfo, size int64) int64 {
+	if size <= meta.Reserved {
+		return 0
+	}
+	return size - meta.Reserved
+}
+
+// AddUsage 文件上传完成后释放预留容量并累计租户用量，首次达到软限制时发送告警回调
+func AddUsage(db *gorm.DB, meta *models.MetaDataInfo) error {
+	if err := repo.NewTenantUsageRepo().ReleaseByUid(db, meta.UID); err != nil {
+		return err
+	}
+	var size int64
+	if repo.OwnsObject(meta) {
+		size = meta.StorageSize
+	}
+	if err := repo.NewTenantUsageRepo().Add(db, meta.Tenant, size, 1); err != nil {
+		return err
+	}
+	if conf := GetTenant(meta.Tenant); conf == nil || conf.SoftLimit <= 0 {
+		return nil
+	}
+	quota, err := GetQuota(db, meta.Tenant)
+	if err != nil {
+		return err
+	}
+	// 未达到软限制时重置告警标记；本次上传前未达到软限制，说明用量曾回落(删除、过期或感染)，重置后重新告警
+	if !OverSoftLimit(quota) {
+		_, err := repo.NewTenantUsageRepo().SetWarned(db, meta.Tenant, false)
+		return err
+	}
+	prev := *quota
+	prev.Bytes -= size
+	prev.Files--
+	if !OverSoftLimit(&prev) {
+		if _, err := repo.NewTenantUsageRepo().SetWarned(db, meta.Tenant, false); err != nil {
+			return err
+		}
+	}
+	if ok, err := repo.NewTenantUsageRepo().SetWarned(db, meta.Tenant, true); err != nil || !ok {
+		return err
+	}
+	return NotifyQuotaEvent(db, quota)
+}
+
+// OverSoftLimit 容量或文件数量是否达到软限制
+func OverSoftLimit(quota *models.QuotaResp) bool {
+	soft := int64(quota.SoftLimit)
+	if soft <= 0 {
+		return false
+	}
+	return (quota.MaxBytes > 0 && quota.Bytes*100 >= quota.MaxBytes*soft) ||
+		(quota.MaxFiles > 0 && quota.Files*100 >= quota.MaxFiles*soft)
+}
@@ -0,0 +1,24 @@
+package base
+
+import (
+	"github.com/qinguoyi/osproxy/app/models"
+	"testing"
+)
+
+func TestOverSoftLimit(t *testing.T) {
+	cases := []struct {
+		quota models.QuotaResp
+		want  bool
+	}{
+		{models.QuotaResp{Bytes: 79, MaxBytes: 100, SoftLimit: 80}, false},
+		{models.QuotaResp{Bytes: 80, MaxBytes: 100, SoftLimit: 80}, true},
+		{models.QuotaResp{Files: 9, MaxFiles: 10, SoftLimit: 90}, true},
+		{models.QuotaResp{Bytes: 1000, SoftLimit: 80}, false},
+		{models.QuotaResp{Bytes: 100, MaxBytes: 100}, false},
+	}
+	for i, c := range cases {
+		if got := OverSoftLimit(&c.quota); got != c.want {
+			t.Fatalf("case %d: expect %v, got %v", i, c.want, got)
+		}
+	}
+}
@@ -0,0 +1,92 @@
+package base
+
+/*
+服务端发起的外部请求（远程拉取、回调）只允许访问公网地址，防止借助服务访问内网
+*/
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// privateNets 回环、私有、链路本地、共享、保留及组播地址
+var privateNets = func() []*net.IPNet {
+	var ret []*net.IPNet
+	for _, cidr := range []string{
+		"0.0.0.0/8", "10.0.0.0/8", "100.64.0.0/10", "127.0.0.0/8", "169.254.0.0/16", "172.16.0.0/12",
+		"192.0.0.0/24", "192.168.0.0/16", "198.18.0.0/15", "224.0.0.0/4", "240.0.0.0/4",
+		"::/128", "::1/128", "64:ff9b::/96", "fc00::/7", "fe80::/10", "ff00::/8",
+	} {
+		_, ipNet, _ := net.ParseCIDR(cidr)
+		ret = append(ret, ipNet)
+	}
+	return ret
+}()
+
+// IsPublicIP 是否为公网地址，IPv4映射的IPv6地址按IPv4判断
+func IsPublicIP(ip net.IP) bool {
+	if ip == nil {
+		return false
+	}
+	if v4 := ip.To4(); v4 != nil {
+		ip = v4
+	}
+	for _, ipNet := range privateNets {
+		if ipNet.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
+
+// publicDialControl 建立连接前校验解析后的目标地址，重定向及DNS重新解析同样生效
+func publicDialControl(_, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	if !IsPublicIP(net.ParseIP(host)) {
+		return fmt.Errorf("不允许访问内网地址[%s]", host)
+	}
+	return nil
+}
+
+// NewPublicClient 只允许访问公网地址的http客户端，不使用环境变量中的代理
+func NewPublicClient(timeout time.Duration) *http.Client {
+	dialer := &net.Dialer{
+		Timeout:   30 * time.Second,
+		KeepAlive: 60 * time.Second,
+		Control:   publicDialControl,
+	}
+	return &http.Client{
+		Timeout: timeout,
+		Transport: &http.Transport{
+			DialContext:           dialer.DialContext,
+			DisableKeepAlives:     true,
+			TLSHandshakeTimeout:   10 * time.Second,
+			ExpectContinueTimeout: 1 * time.Second,
+		},
+	}
+}
+
+// CheckPublicUrl 接收请求时校验地址，仅支持http/https，主机为IP时须为公网地址，域名在连接时校验
+func CheckPublicUrl(rawUrl string) error {
+	u, err := url.Parse(rawUrl)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Hostname() == "" {
+		return errors.New("地址有误，仅支持http/https")
+	}
+	host := strings.ToLower(u.Hostname())
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return errors.New("不允许访问内网地址")
+	}
+	if ip := net.ParseIP(host); ip != nil && !IsPublicIP(ip) {
+		return errors.New("不允许访问内网地址")
+	}
+	return nil
+}
@@ -0,0 +1,58 @@
+package base
+
+import (
+	"net"
+	"testing"
+)
+
+func TestIsPublicIP(t *testing.T) {
+	cases := map[string]bool{
+		"8.8.8.8":            true,
+		"2001:4860::8888":    true,
+		"127.0.0.1":          false,
+		"10.1.2.3":           false,
+		"172.20.0.1":         false,
+		"192.168.1.1":        false,
+		"169.254.169.254":    false,
+		"100.64.0.1":         false,
+		"0.0.0.0":            false,
+		"::1":                false,
+		"fd00::1":            false,
+		"fe80::1":            false,
+		"::ffff:127.0.0.1":   false,
+		"::ffff:169.254.1.1": false,
+		"64:ff9b::a9fe:a9fe": false,
+		"::ffff:8.8.8.8":     true,
+	}
+	for s, want := range cases {
+		if got := IsPublicIP(net.ParseIP(s)); got != want {
+			t.Fatalf("%s: expect %v, got %v", s, want, got)
+		}
+	}
+	if IsPublicIP(nil) {
+		t.Fatal("expect nil ip not public")
+	}
+}
+
+func TestCheckPublicUrl(t *testing.T) {
+	for _, u := range []string{"http://example.com/a.jpg", "https://8.8.8.8:8443/x"} {
+		if err := CheckPublicUrl(u); err != nil {
+			t.Fatalf("%s: unexpected error %v", u, err)
+		}
+	}
+	for _, u := range []string{"ftp://example.com/a", "http://", "http://localhost:8080/", "http://127.0.0.1/",
+		"http://[::1]/", "http://169.254.169.254/latest/meta-data", "http://api.localhost/"} {
+		if err := CheckPublicUrl(u); err == nil {
+			t.Fatalf("%s: expect error", u)
+		}
+	}
+}
+
+func TestPublicDialControl(t *testing.T) {
+	if err := publicDialControl("tcp", "10.0.0.1:80", nil); err == nil {
+		t.Fatal("expect private address rejected")
+	}
+	if err := publicDialControl("tcp", "8.8.8.8:443", nil); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+}
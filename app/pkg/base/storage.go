@@ -36,11 +36,11 @@ func selectBucketBySuffix(filename string) string {
 		return ""
 	}
 	switch suffix {
-	case "jpg", "jpeg", "png", "gif", "bmp":
+	case "jpg", "jpeg", "png", "gif", "bmp", "webp":
 		return "image"
-	case "mp4", "avi", "wmv", "mpeg":
+	case "mp4", "avi", "wmv", "mpeg", "mov", "m4v":
 		return "video"
-	case "mp3", "wav", "flac":
+	case "mp3", "wav", "flac", "m4a":
 		return "audio"
 	case "pdf", "doc", "docx", "ppt", "pptx", "xls", "xlsx":
 		return "doc"
@@ -76,21 +76,52 @@ func CheckValid(uidStr, date, expireStr string) (int64, error, string) {
 	return uid, nil, ""
 }
 
-// GenUploadSingle .
-func GenUploadSingle(filename string, expire int, respChan chan models.GenUploadResp,
-	metaDataInfoChan chan models.MetaDataInfo, wg *sync.WaitGroup) {
-	defer wg.Done()
+// NewMetaDataInfo 生成待上传文件的元数据
+func NewMetaDataInfo(filename, tenant, callback string) (*models.MetaDataInfo, error) {
 	bucket := selectBucketBySuffix(filename)
+	if bucket == "" {
+		bucket = "unknown"
+	}
 	uid, err := NewSnowFlake().NextId()
 	if err != nil {
-		//lgLogger.WithContext(c).Error("雪花算法生成ID失败，详情：", zap.Any("err", err.Error()))
-		return
+		return nil, err
 	}
 	uidStr := strconv.FormatInt(uid, 10)
 	name := filepath.Base(filename)
 	name = url.PathEscape(name)
-	storageName := fmt.Sprintf("%s.%s", uidStr, GetExtension(filename))
+	storageName := uidStr
+	if ext := GetExtension(filename); ext != "" {
+		storageName = fmt.Sprintf("%s.%s", uidStr, ext)
+	}
 	objectName := fmt.Sprintf("%s/%s", bucket, storageName)
+	now := time.Now()
+	return &models.MetaDataInfo{
+		UID:         uid,
+		Bucket:      bucket,
+		Name:        name,
+		StorageName: storageName,
+		Address:     objectName,
+		MultiPart:   false,
+		Status:      utils.MetaStatusPending,
+		ContentType: "application/octet-stream", //先按照文件后缀占位，后面文件上传会覆盖
+		Tenant:      tenant,
+		Callback:    callback,
+		CreatedAt:   &now,
+		UpdatedAt:   &now,
+	}, nil
+}
+
+// GenUploadSingle 生成上传链接，声明了文件大小时同时生成分片上传计划
+func GenUploadSingle(file models.UploadFile, partSize int64, expire int, rate int64, tenant, callback string,
+	respChan chan models.GenUploadResp, metaDataInfoChan chan models.MetaDataInfo, wg *sync.WaitGroup) {
+	defer wg.Done()
+	filename := file.Path
+	metaData, err := NewMetaDataInfo(filename, tenant, callback)
+	if err != nil {
+		//lgLogger.WithContext(c).Error("雪花算法生成ID失败，详情：", zap.Any("err", err.Error()))
+		return
+	}
+	uidStr := strconv.FormatInt(metaData.UID, 10)
 
 	// 在本地创建uid的目录
 	if err := os.MkdirAll(path.Join(utils.LocalStore, uidStr), 0755); err != nil {
@@ -100,11 +131,39 @@ func GenUploadSingle(filename string, expire int, respChan chan models.GenUpload
 
 	// 生成加密query
 	date := time.Now().Format("2006-01-02T15:04:05Z")
-	signature := decode(fmt.Sprintf("%s-%d", date, expire))
-	queryString := GenUploadSignature(uidStr, date, expire, signature)
+	var rateStr string
+	if rate > 0 {
+		rateStr = strconv.FormatInt(rate, 10)
+	}
+	signature := SignUpload(uidStr, date, strconv.Itoa(expire), rateStr)
+	queryString := GenUploadSignature(uidStr, date, expire, rate, signature)
 	single := fmt.Sprintf("/api/storage/v0/upload?%s", queryString)
 	multi := fmt.Sprintf("/api/storage/v0/upload/multi?%s", queryString)
 	merge := fmt.Sprintf("/api/storage/v0/upload/merge?%s", queryString)
+	var plan *models.UploadPlan
+	if file.Size > 0 {
+		planPartSize, partCount, err := CalcUploadPlan(file.Size, partSize, bootstrap.NewConfig("").Upload)
+		if err != nil {
+			return
+		}
+		plan = &models.UploadPlan{
+			Size:      file.Size,
+			Md5:       file.Md5,
+			PartSize:  planPartSize,
+			PartCount: partCount,
+		}
+		for num := int64(1); num <= partCount; num++ {
+			plan.Parts = append(plan.Parts, models.PlanPart{
+				Num:  num,
+				Size: PlanPartSize(file.Size, planPartSize, partCount, num),
+				Url:  fmt.Sprintf("%s&chunkNum=%d", multi, num),
+			})
+		}
+		metaData.StorageSize = file.Size
+		metaData.Md5 = file.Md5
+		metaData.PartSize = planPartSize
+		metaData.PartNum = int(partCount)
+	}
 	respChan <- models.GenUploadResp{
 		Uid: uidStr,
 		Url: &models.UrlResult{
@@ -115,26 +174,27 @@ func GenUploadSingle(filename string, expire int, respChan chan models.GenUpload
 			},
 		},
 		Path: filename,
+		Plan: plan,
 	}
 	// 生成DB信息
-	now := time.Now()
-	metaDataInfoChan <- models.MetaDataInfo{
-		UID:         uid,
-		Bucket:      bucket,
-		Name:        name,
-		StorageName: storageName,
-		Address:     objectName,
-		MultiPart:   false,
-		Status:      -1,
-		ContentType: "application/octet-stream", //先按照文件后缀占位，后面文件上传会覆盖
-		CreatedAt:   &now,
-		UpdatedAt:   &now,
-	}
+	expireAt := metaData.CreatedAt.Add(time.Duration(expire) * time.Second)
+	metaData.ExpireAt = &expireAt
+	metaDataInfoChan <- *metaData
 	return
 }
 
-func GenDownloadSingle(meta models.MetaDataInfo, expire string, respChan chan models.GenDownloadResp,
-	wg *sync.WaitGroup) {
+// DownloadCacheKey 下载链接的缓存key，附加参数不同的链接分别缓存
+func DownloadCacheKey(uid int64, expire string, extra url.Values) string {
+	key := fmt.Sprintf("%d-%s", uid, expire)
+	if len(extra) != 0 {
+		key += "-" + extra.Encode()
+	}
+	return key
+}
+
+// GenDownloadSingle 生成下载链接，cacheKey为空时不缓存
+func GenDownloadSingle(meta models.MetaDataInfo, expire string, extra url.Values, cacheKey string,
+	respChan chan models.GenDownloadResp, wg *sync.WaitGroup) {
 	defer wg.Done()
 	uid := meta.UID
 	bucketName := meta.Bucket
@@ -146,9 +206,8 @@ func GenDownloadSingle(meta models.MetaDataInfo, expire string, respChan chan mo
 
 	// 生成加密query
 	date := time.Now().Format("2006-01-02T15:04:05Z")
-	signature := decode(fmt.Sprintf("%s-%s-%s-%s", date, expire,
-		bucketName, objectName))
-	queryString := GenDownloadSignature(uid, srcName, bucketName, objectName, expire, date, signature)
+	signature := SignDownload(uid, date, expire, bucketName, objectName, extra)
+	queryString := GenDownloadSignature(uid, srcName, bucketName, objectName, expire, date, signature, extra)
 	url := fmt.Sprintf("/api/storage/v0/download?%s", queryString)
 	info := models.GenDownloadResp{
 		Uid: fmt.Sprintf("%d", uid),
@@ -162,30 +221,49 @@ func GenDownloadSingle(meta models.MetaDataInfo, expire string, respChan chan mo
 			Size:    fmt.Sprintf("%d", meta.StorageSize),
 		},
 	}
+	if extra.Get(utils.LinkParamTrack) != "" {
+		info.LinkId = extra.Get(utils.LinkParamId)
+	}
+	if meta.Attributes != "" {
+		_ = json.Unmarshal([]byte(meta.Attributes), &info.Meta.Attributes)
+	}
+	if IsTransformable(meta.ContentType) {
+		info.Thumbnails = thumbnailUrls(meta, srcName, expire, date, extra)
+	}
 	respChan <- info
 	// 写入redis
-	key := fmt.Sprintf("%d-%s", uid, expire)
+	if cacheKey == "" {
+		return
+	}
 	lgRedis := new(plugins.LangGoRedis).NewRedis()
 	b, err := json.Marshal(info)
 	if err != nil {
 	}
-	lgRedis.SetNX(context.Background(), key, b, 5*60*time.Second)
+	lgRedis.SetNX(context.Background(), cacheKey, b, 5*60*time.Second)
 }
 
-func GetRange(rangeHeader string, size int64) (int64, int64) {
-	var start, end int64
-	if rangeHeader == "" {
-		end = size - 1
-	} else {
-		split := strings.Split(rangeHeader, "=")
-		ranges := strings.Split(split[1], "-")
-		start, _ = strconv.ParseInt(ranges[0], 10, 64)
-		if ranges[1] != "" {
-			end, _ = strconv.ParseInt(ranges[1], 10, 64)
+// thumbnailUrls 生成缩略图的下载地址，沿用原图链接的附加参数并替换图片处理参数
+func thumbnailUrls(meta models.MetaDataInfo, srcName, expire, date string, extra url.Values) map[string]string {
+	transforms := ThumbnailTransforms()
+	if len(transforms) == 0 {
+		return nil
+	}
+	ret := map[string]string{}
+	for name, t := range transforms {
+		thumbExtra := url.Values{}
+		for k, v := range extra {
+			thumbExtra[k] = v
+		}
+		for _, k := range []string{utils.LinkParamWidth, utils.LinkParamHeight, utils.LinkParamFit, utils.LinkParamCrop,
+			utils.LinkParamQuality, utils.LinkParamFormat} {
+			thumbExtra.Del(k)
 		}
-		if end >= size || end == 0 {
-			end = size - 1
+		for k, v := range t.Values() {
+			thumbExtra[k] = v
 		}
+		signature := SignDownload(meta.UID, date, expire, meta.Bucket, meta.StorageName, thumbExtra)
+		queryString := GenDownloadSignature(meta.UID, srcName, meta.Bucket, meta.StorageName, expire, date, signature, thumbExtra)
+		ret[name] = fmt.Sprintf("/api/storage/v0/download?%s", queryString)
 	}
-	return start, end
+	return ret
 }
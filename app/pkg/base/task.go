@@ -0,0 +1,23 @@
+package base
+
+import (
+	"encoding/json"
+	"github.com/qinguoyi/osproxy/app/models"
+	"github.com/qinguoyi/osproxy/app/pkg/repo"
+	"github.com/qinguoyi/osproxy/app/pkg/utils"
+	"gorm.io/gorm"
+)
+
+// CreateTask 创建异步任务，extra序列化后写入任务补充信息
+func CreateTask(db *gorm.DB, taskType string, uid int64, extra interface{}) error {
+	b, err := json.Marshal(extra)
+	if err != nil {
+		return err
+	}
+	return repo.NewTaskRepo().Create(db, &models.TaskInfo{
+		Status:     utils.TaskStatusUndo,
+		TaskType:   taskType,
+		ExtraData:  string(b),
+		StorageUid: uid,
+	})
+}
@@ -0,0 +1,25 @@
+package base
+
+import (
+	"crypto/hmac"
+	"github.com/qinguoyi/osproxy/bootstrap"
+	"github.com/qinguoyi/osproxy/config"
+)
+
+// CheckToken 校验令牌，未配置令牌时不通过
+func CheckToken(expect, token string) bool {
+	return expect != "" && hmac.Equal([]byte(expect), []byte(token))
+}
+
+// GetTenant 根据应用标识获取租户配置，不存在返回nil
+func GetTenant(appKey string) *config.Tenant {
+	if appKey == "" {
+		return nil
+	}
+	for _, tenant := range bootstrap.NewConfig("").Tenants {
+		if tenant != nil && tenant.AppKey == appKey {
+			return tenant
+		}
+	}
+	return nil
+}
@@ -0,0 +1,59 @@
+package base
+
+/*
+上传下载限速
+*/
+
+import (
+	"fmt"
+	"github.com/qinguoyi/osproxy/app/pkg/throttle"
+	"github.com/qinguoyi/osproxy/app/pkg/utils"
+	"github.com/qinguoyi/osproxy/bootstrap"
+	"github.com/qinguoyi/osproxy/bootstrap/plugins"
+	"net"
+)
+
+// inCidrs 判断ip是否在网段列表中，网段也可以是单个ip
+func inCidrs(ip string, cidrs []string) bool {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return false
+	}
+	for _, cidr := range cidrs {
+		if _, ipNet, err := net.ParseCIDR(cidr); err == nil {
+			if ipNet.Contains(parsed) {
+				return true
+			}
+		} else if other := net.ParseIP(cidr); other != nil && other.Equal(parsed) {
+			return true
+		}
+	}
+	return false
+}
+
+// TransferLimiters 生成传输限速器，linkRate为链接签名中的限速(KB/s)，
+// 内部优先级的租户或来源IP在内部网段时不限速
+func TransferLimiters(tenant string, linkRate int64, clientIP string) []throttle.Limiter {
+	conf := bootstrap.NewConfig("").Throttle
+	if conf := GetTenant(tenant); conf != nil && conf.Priority == utils.PriorityInternal {
+		return nil
+	}
+	if inCidrs(clientIP, conf.BypassCidrs) {
+		return nil
+	}
+	var limiters []throttle.Limiter
+	if linkRate > 0 {
+		limiters = append(limiters, throttle.NewLocalLimiter(linkRate*1024))
+	}
+	if !conf.Enabled {
+		return limiters
+	}
+	if conf.ConnectionRate > 0 {
+		limiters = append(limiters, throttle.NewLocalLimiter(conf.ConnectionRate*1024))
+	}
+	if conf.TenantRate > 0 && tenant != "" {
+		limiters = append(limiters, throttle.NewRedisLimiter(new(plugins.LangGoRedis).NewRedis(),
+			fmt.Sprintf("%s:%s", utils.ThrottleRedisPrefix, tenant), conf.TenantRate*1024))
+	}
+	return limiters
+}
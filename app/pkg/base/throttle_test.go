@@ -0,0 +1,19 @@
+package base
+
+import "testing"
+
+func TestInCidrs(t *testing.T) {
+	cidrs := []string{"10.0.0.0/8", "192.168.1.10", "fd00::/8"}
+	for ip, want := range map[string]bool{
+		"10.1.2.3":     true,
+		"192.168.1.10": true,
+		"192.168.1.11": false,
+		"fd00::1":      true,
+		"8.8.8.8":      false,
+		"bad":          false,
+	} {
+		if got := inCidrs(ip, cidrs); got != want {
+			t.Fatalf("%s: expect %v, got %v", ip, want, got)
+		}
+	}
+}
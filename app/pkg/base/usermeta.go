@@ -0,0 +1,121 @@
+package base
+
+/*
+文件自定义元数据及标签
+*/
+
+import (
+	"errors"
+	"fmt"
+	"github.com/qinguoyi/osproxy/app/models"
+	"github.com/qinguoyi/osproxy/app/pkg/repo"
+	"github.com/qinguoyi/osproxy/app/pkg/utils"
+	"gorm.io/gorm"
+	"strings"
+	"time"
+)
+
+// validMetaKey 键仅允许字母、数字及 _ - .
+func validMetaKey(key string) bool {
+	if key == "" {
+		return false
+	}
+	for _, ch := range key {
+		if !(ch >= 'a' && ch <= 'z' || ch >= 'A' && ch <= 'Z' || ch >= '0' && ch <= '9' ||
+			ch == '_' || ch == '-' || ch == '.') {
+			return false
+		}
+	}
+	return true
+}
+
+// CheckUserMeta 校验元数据及标签的数量和长度
+func CheckUserMeta(metadata map[string]string, tags []string) error {
+	if len(metadata) > utils.UserMetaCountLimit {
+		return fmt.Errorf("元数据数量不能超过%d个", utils.UserMetaCountLimit)
+	}
+	if len(tags) > utils.UserTagCountLimit {
+		return fmt.Errorf("标签数量不能超过%d个", utils.UserTagCountLimit)
+	}
+	size := 0
+	for key, value := range metadata {
+		if !validMetaKey(key) || len(key) > utils.UserMetaKeyLen {
+			return fmt.Errorf("元数据键[%s]有误，仅支持字母、数字及_-.，长度不超过%d", key, utils.UserMetaKeyLen)
+		}
+		if len(value) > utils.UserMetaValueLen {
+			return fmt.Errorf("元数据[%s]的值长度不能超过%d", key, utils.UserMetaValueLen)
+		}
+		size += len(key) + len(value)
+	}
+	for _, tag := range tags {
+		if strings.TrimSpace(tag) == "" || len(tag) > utils.UserTagLen {
+			return fmt.Errorf("标签[%s]有误，不能为空且长度不超过%d", tag, utils.UserTagLen)
+		}
+		size += len(tag)
+	}
+	if size > utils.UserMetaSizeLimit {
+		return fmt.Errorf("元数据及标签总大小不能超过%d字节", utils.UserMetaSizeLimit)
+	}
+	return nil
+}
+
+// ParseMetaFilter 解析元数据过滤条件，格式为 key:value
+func ParseMetaFilter(filters []string) (map[string]string, error) {
+	ret := map[string]string{}
+	for _, filter := range filters {
+		key, value, ok := strings.Cut(filter, ":")
+		if !ok || !validMetaKey(key) {
+			return nil, errors.New("meta参数有误，格式为key:value")
+		}
+		ret[key] = value
+	}
+	return ret, nil
+}
+
+// UserMetaRows 生成文件的元数据及标签记录，标签去重
+func UserMetaRows(uid int64, metadata map[string]string, tags []string) ([]models.FileMetadata, []models.FileTag) {
+	now := time.Now()
+	var metaRows []models.FileMetadata
+	var tagRows []models.FileTag
+	for key, value := range metadata {
+		metaRows = append(metaRows, models.FileMetadata{UID: uid, MetaKey: key, MetaValue: value, CreatedAt: &now})
+	}
+	for _, tag := range utils.RemoveDuplicates(tags) {
+		tagRows = append(tagRows, models.FileTag{UID: uid, Tag: tag, CreatedAt: &now})
+	}
+	return metaRows, tagRows
+}
+
+// GetUserMeta 批量获取文件的元数据及标签
+func GetUserMeta(db *gorm.DB, uidList []int64) (map[int64]*models.UserMeta, error) {
+	ret := map[int64]*models.UserMeta{}
+	if len(uidList) == 0 {
+		return ret, nil
+	}
+	metaRows, err := repo.NewUserMetaRepo().GetMetadataByUidList(db, uidList)
+	if err != nil {
+		return nil, err
+	}
+	tagRows, err := repo.NewUserMetaRepo().GetTagsByUidList(db, uidList)
+	if err != nil {
+		return nil, err
+	}
+	get := func(uid int64) *models.UserMeta {
+		if _, ok := ret[uid]; !ok {
+			ret[uid] = &models.UserMeta{}
+		}
+		return ret[uid]
+	}
+	for _, row := range metaRows {
+		item := get(row.UID)
+		if item.Metadata == nil {
+			item.Metadata = map[string]string{}
+		}
+		item.Metadata[row.MetaKey] = row.MetaValue
+	}
+	for _, row := range tagRows {
+		item := get(row.UID)
+		item.Tags = append(item.Tags, row.Tag)
+	}
+	return ret, nil
+}
@@ -0,0 +1,48 @@
+package base
+
+import (
+	"github.com/qinguoyi/osproxy/app/pkg/utils"
+	"strings"
+	"testing"
+)
+
+func TestCheckUserMeta(t *testing.T) {
+	ok := map[string]string{"ownerId": "1001", "doc-type": "contract", "retention.class": "7y"}
+	if err := CheckUserMeta(ok, []string{"finance", "2023"}); err != nil {
+		t.Fatal(err)
+	}
+	cases := []struct {
+		metadata map[string]string
+		tags     []string
+	}{
+		{map[string]string{"owner id": "1"}, nil},
+		{map[string]string{"": "1"}, nil},
+		{map[string]string{"k": strings.Repeat("v", utils.UserMetaValueLen+1)}, nil},
+		{nil, []string{" "}},
+		{nil, []string{strings.Repeat("t", utils.UserTagLen+1)}},
+		{nil, make([]string, utils.UserTagCountLimit+1)},
+	}
+	for i, item := range cases {
+		if err := CheckUserMeta(item.metadata, item.tags); err == nil {
+			t.Fatalf("case %d expect error", i)
+		}
+	}
+
+	big := map[string]string{}
+	for i := 0; i < utils.UserMetaCountLimit; i++ {
+		big[strings.Repeat("k", 8)+string(rune('a'+i%26))+string(rune('a'+i/26))] = strings.Repeat("v", utils.UserMetaValueLen)
+	}
+	if err := CheckUserMeta(big, nil); err == nil {
+		t.Fatal("expect total size error")
+	}
+}
+
+func TestParseMetaFilter(t *testing.T) {
+	ret, err := ParseMetaFilter([]string{"docType:contract", "url:http://a"})
+	if err != nil || ret["docType"] != "contract" || ret["url"] != "http://a" {
+		t.Fatalf("unexpected %v %v", ret, err)
+	}
+	if _, err := ParseMetaFilter([]string{"novalue"}); err == nil {
+		t.Fatal("expect error")
+	}
+}
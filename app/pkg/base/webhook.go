@@ -0,0 +1,144 @@
+package base
+
+/*
+上传生命周期回调
+*/
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/qinguoyi/osproxy/app/models"
+	"github.com/qinguoyi/osproxy/app/pkg/utils"
+	"github.com/qinguoyi/osproxy/bootstrap"
+	"gorm.io/gorm"
+	"time"
+)
+
+// CheckCallback 校验请求中指定的回调地址，只允许公网地址，为空时使用租户配置
+func CheckCallback(callback string) error {
+	if callback == "" {
+		return nil
+	}
+	if err := CheckPublicUrl(callback); err != nil {
+		return fmt.Errorf("callback参数有误，%s", err.Error())
+	}
+	return nil
+}
+
+// IsTenantCallback 是否为租户配置的回调地址，配置中的地址可以是内网地址
+func IsTenantCallback(appKey, callback string) bool {
+	tenant := GetTenant(appKey)
+	return tenant != nil && tenant.Callback != "" && tenant.Callback == callback
+}
+
+// NotifyEvent 创建回调任务，未配置回调地址时直接忽略
+func NotifyEvent(db *gorm.DB, meta *models.MetaDataInfo, eventType string) error {
+	callback := meta.Callback
+	if callback == "" {
+		if tenant := GetTenant(meta.Tenant); tenant != nil {
+			callback = tenant.Callback
+		}
+	}
+	if callback == "" {
+		return nil
+	}
+
+	payload, err := json.Marshal(models.WebhookEvent{
+		Event:       eventType,
+		Uid:         fmt.Sprintf("%d", meta.UID),
+		Bucket:      meta.Bucket,
+		Name:        meta.Name,
+		Md5:         meta.Md5,
+		Size:        meta.StorageSize,
+		ContentType: meta.ContentType,
+		Timestamp:   time.Now().Unix(),
+		ScanResult:  meta.ScanResult,
+	})
+	if err != nil {
+		return err
+	}
+	return CreateTask(db, utils.TaskWebhook, meta.UID, models.WebhookInfo{
+		StorageUid: meta.UID,
+		Event:      eventType,
+		Tenant:     meta.Tenant,
+		Url:        callback,
+		Payload:    string(payload),
+	})
+}
+
+// NotifyBatchEvent 批次提交时创建回调任务
+func NotifyBatchEvent(db *gorm.DB, batch *models.UploadBatch, files, size int64) error {
+	callback := batch.Callback
+	if callback == "" {
+		if tenant := GetTenant(batch.Tenant); tenant != nil {
+			callback = tenant.Callback
+		}
+	}
+	if callback == "" {
+		return nil
+	}
+
+	payload, err := json.Marshal(models.WebhookEvent{
+		Event:     utils.EventBatch,
+		Name:      batch.Name,
+		Size:      size,
+		Timestamp: time.Now().Unix(),
+		Batch:     fmt.Sprintf("%d", batch.BatchUid),
+		Files:     files,
+	})
+	if err != nil {
+		return err
+	}
+	return CreateTask(db, utils.TaskWebhook, batch.BatchUid, models.WebhookInfo{
+		StorageUid: batch.BatchUid,
+		Event:      utils.EventBatch,
+		Tenant:     batch.Tenant,
+		Url:        callback,
+		Payload:    string(payload),
+	})
+}
+
+// NotifyQuotaEvent 租户用量达到软限制时创建回调任务
+func NotifyQuotaEvent(db *gorm.DB, quota *models.QuotaResp) error {
+	tenant := GetTenant(quota.Tenant)
+	if tenant == nil || tenant.Callback == "" {
+		return nil
+	}
+
+	payload, err := json.Marshal(models.WebhookEvent{
+		Event:     utils.EventQuota,
+		Size:      quota.Bytes,
+		Files:     quota.Files,
+		Timestamp: time.Now().Unix(),
+		Quota:     quota,
+	})
+	if err != nil {
+		return err
+	}
+	return CreateTask(db, utils.TaskWebhook, 0, models.WebhookInfo{
+		Event:   utils.EventQuota,
+		Tenant:  quota.Tenant,
+		Url:     tenant.Callback,
+		Payload: string(payload),
+	})
+}
+
+// GetWebhookSecret 获取回调签名密钥，租户未配置时使用全局密钥
+func GetWebhookSecret(appKey string) string {
+	if tenant := GetTenant(appKey); tenant != nil && tenant.Secret != "" {
+		return tenant.Secret
+	}
+	return bootstrap.NewConfig("").Webhook.Secret
+}
+
+// SignWebhook 回调签名 hex(hmac-sha256(secret, timestamp.body))
+func SignWebhook(secret, timestamp string, body []byte) string {
+	h := hmac.New(sha256.New, []byte(secret))
+	h.Write([]byte(timestamp))
+	h.Write([]byte("."))
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
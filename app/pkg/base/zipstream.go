@@ -0,0 +1,345 @@
+package base
+
+/*
+打包下载的zip流式写入，不落盘，存储模式的文件可预先计算压缩包大小
+*/
+
+import (
+	"compress/flate"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"path"
+	"strings"
+	"time"
+)
+
+const (
+	zipLocalSign      = 0x04034b50
+	zipDescriptorSign = 0x08074b50
+	zipCentralSign    = 0x02014b50
+	zip64EndSign      = 0x06064b50
+	zip64LocatorSign  = 0x07064b50
+	zipEndSign        = 0x06054b50
+	zip64ExtraId      = 0x0001
+
+	zipFlagDescriptor = 0x8
+	zipFlagUTF8       = 0x800
+	zipVersion20      = 20
+	zipVersion45      = 45
+
+	uint16max = 1<<16 - 1
+	uint32max = 1<<32 - 1
+)
+
+// compressedExt 本身已压缩的文件类型，打包时使用存储模式
+var compressedExt = map[string]bool{
+	"jpg": true, "jpeg": true, "png": true, "gif": true, "webp": true,
+	"mp4": true, "avi": true, "wmv": true, "mpeg": true, "mov": true, "mkv": true,
+	"mp3": true, "flac": true, "aac": true, "ogg": true,
+	"zip": true, "rar": true, "gz": true, "tgz": true, "7z": true, "bz2": true, "xz": true,
+	"docx": true, "xlsx": true, "pptx": true,
+}
+
+// IsCompressedFile 根据扩展名判断文件是否已压缩
+func IsCompressedFile(name string) bool {
+	return compressedExt[GetExtension(name)]
+}
+
+// ZipEntry 压缩包内的文件
+type ZipEntry struct {
+	Name     string
+	Size     int64
+	Modified time.Time
+	Store    bool // 存储模式，不压缩
+}
+
+// zip64 是否需要zip64格式，压缩后可能略大于原始大小，预留余量
+func (e *ZipEntry) zip64() bool {
+	if e.Store {
+		return e.Size >= uint32max
+	}
+	return e.Size >= uint32max-uint32max/64
+}
+
+func (e *ZipEntry) method() uint16 {
+	if e.Store {
+		return 0
+	}
+	return 8
+}
+
+func (e *ZipEntry) version() uint16 {
+	if e.zip64() {
+		return zipVersion45
+	}
+	return zipVersion20
+}
+
+// msDosTime 转换为zip使用的MS-DOS日期和时间
+func msDosTime(t time.Time) (uint16, uint16) {
+	if t.Year() < 1980 {
+		t = time.Date(1980, 1, 1, 0, 0, 0, 0, time.UTC)
+	}
+	date := uint16(t.Day() + int(t.Month())<<5 + (t.Year()-1980)<<9)
+	clock := uint16(t.Second()/2 + t.Minute()<<5 + t.Hour()<<11)
+	return date, clock
+}
+
+// localHeader 本地文件头，大小及校验和写在数据描述符中
+func localHeader(e *ZipEntry) []byte {
+	date, clock := msDosTime(e.Modified)
+	extra := 0
+	if e.zip64() {
+		extra = 20
+	}
+	buf := make([]byte, 30, 30+len(e.Name)+extra)
+	le := binary.LittleEndian
+	le.PutUint32(buf[0:], zipLocalSign)
+	le.PutUint16(buf[4:], e.version())
+	le.PutUint16(buf[6:], zipFlagDescriptor|zipFlagUTF8)
+	le.PutUint16(buf[8:], e.method())
+	le.PutUint16(buf[10:], clock)
+	le.PutUint16(buf[12:], date)
+	le.PutUint16(buf[26:], uint16(len(e.Name)))
+	le.PutUint16(buf[28:], uint16(extra))
+	buf = append(buf, e.Name...)
+	if e.zip64() {
+		// 大小为0xFFFFFFFF，zip64扩展字段置0，表示数据描述符使用8字节大小
+		le.PutUint32(buf[18:], uint32max)
+		le.PutUint32(buf[22:], uint32max)
+		ext := make([]byte, 20)
+		le.PutUint16(ext[0:], zip64ExtraId)
+		le.PutUint16(ext[2:], 16)
+		buf = append(buf, ext...)
+	}
+	return buf
+}
+
+// descriptor 数据描述符
+func descriptor(e *ZipEntry, crc uint32, compressed, size int64) []byte {
+	le := binary.LittleEndian
+	if e.zip64() {
+		buf := make([]byte, 24)
+		le.PutUint32(buf[0:], zipDescriptorSign)
+		le.PutUint32(buf[4:], crc)
+		le.PutUint64(buf[8:], uint64(compressed))
+		le.PutUint64(buf[16:], uint64(size))
+		return buf
+	}
+	buf := make([]byte, 16)
+	le.PutUint32(buf[0:], zipDescriptorSign)
+	le.PutUint32(buf[4:], crc)
+	le.PutUint32(buf[8:], uint32(compressed))
+	le.PutUint32(buf[12:], uint32(size))
+	return buf
+}
+
+// zipRecord 写入后用于生成中央目录的文件记录
+type zipRecord struct {
+	entry      *ZipEntry
+	crc        uint32
+	compressed int64
+	offset     int64
+}
+
+// centralHeader 中央目录文件头，大小或偏移超过4G时使用zip64扩展字段
+func centralHeader(r *zipRecord) []byte {
+	e := r.entry
+	date, clock := msDosTime(e.Modified)
+	zip64 := e.zip64() || r.offset >= uint32max
+	extra := 0
+	if zip64 {
+		extra = 28
+	}
+	buf := make([]byte, 46, 46+len(e.Name)+extra)
+	le := binary.LittleEndian
+	le.PutUint32(buf[0:], zipCentralSign)
+	le.PutUint16(buf[4:], e.version())
+	le.PutUint16(buf[6:], e.version())
+	le.PutUint16(buf[8:], zipFlagDescriptor|zipFlagUTF8)
+	le.PutUint16(buf[10:], e.method())
+	le.PutUint16(buf[12:], clock)
+	le.PutUint16(buf[14:], date)
+	le.PutUint32(buf[16:], r.crc)
+	le.PutUint16(buf[28:], uint16(len(e.Name)))
+	le.PutUint16(buf[30:], uint16(extra))
+	if zip64 {
+		le.PutUint32(buf[20:], uint32max)
+		le.PutUint32(buf[24:], uint32max)
+		le.PutUint32(buf[42:], uint32max)
+	} else {
+		le.PutUint32(buf[20:], uint32(r.compressed))
+		le.PutUint32(buf[24:], uint32(e.Size))
+		le.PutUint32(buf[42:], uint32(r.offset))
+	}
+	buf = append(buf, e.Name...)
+	if zip64 {
+		ext := make([]byte, 28)
+		le.PutUint16(ext[0:], zip64ExtraId)
+		le.PutUint16(ext[2:], 24)
+		le.PutUint64(ext[4:], uint64(e.Size))
+		le.PutUint64(ext[12:], uint64(r.compressed))
+		le.PutUint64(ext[20:], uint64(r.offset))
+		buf = append(buf, ext...)
+	}
+	return buf
+}
+
+// endRecord 目录结束记录，数量或大小超出限制时先写入zip64结束记录及定位器
+func endRecord(count int, dirOffset, dirSize int64) []byte {
+	le := binary.LittleEndian
+	var buf []byte
+	if count >= uint16max || dirOffset >= uint32max || dirSize >= uint32max {
+		end64 := make([]byte, 56+20)
+		le.PutUint32(end64[0:], zip64EndSign)
+		le.PutUint64(end64[4:], 44)
+		le.PutUint16(end64[12:], zipVersion45)
+		le.PutUint16(end64[14:], zipVersion45)
+		le.PutUint64(end64[24:], uint64(count))
+		le.PutUint64(end64[32:], uint64(count))
+		le.PutUint64(end64[40:], uint64(dirSize))
+		le.PutUint64(end64[48:], uint64(dirOffset))
+		le.PutUint32(end64[56:], zip64LocatorSign)
+		le.PutUint64(end64[64:], uint64(dirOffset+dirSize))
+		le.PutUint32(end64[72:], 1)
+		buf = end64
+		count, dirOffset, dirSize = uint16max, uint32max, uint32max
+	}
+	end := make([]byte, 22)
+	le.PutUint32(end[0:], zipEndSign)
+	le.PutUint16(end[8:], uint16(count))
+	le.PutUint16(end[10:], uint16(count))
+	le.PutUint32(end[12:], uint32(dirSize))
+	le.PutUint32(end[16:], uint32(dirOffset))
+	return append(buf, end...)
+}
+
+// ZipStreamSize 预先计算压缩包大小，存在需压缩的文件时无法得知，返回-1
+func ZipStreamSize(entries []ZipEntry) int64 {
+	var offset, dirSize int64
+	for i := range entries {
+		e := &entries[i]
+		if !e.Store {
+			return -1
+		}
+		r := &zipRecord{entry: e, compressed: e.Size, offset: offset}
+		offset += int64(len(localHeader(e))) + e.Size + int64(len(descriptor(e, 0, 0, 0)))
+		dirSize += int64(len(centralHeader(r)))
+	}
+	return offset + dirSize + int64(len(endRecord(len(entries), offset, dirSize)))
+}
+
+// countWriter 统计写入的字节数
+type countWriter struct {
+	w     io.Writer
+	count int64
+}
+
+func (cw *countWriter) Write(p []byte) (int, error) {
+	n, err := cw.w.Write(p)
+	cw.count += int64(n)
+	return n, err
+}
+
+// WriteZipStream 按顺序写入压缩包，copyData将第i个文件的原始内容写入w，写入长度须与Size一致
+func WriteZipStream(w io.Writer, entries []ZipEntry, copyData func(w io.Writer, i int) error) error {
+	for i := range entries {
+		if len(entries[i].Name) > uint16max {
+			return errors.New("压缩包内文件名过长")
+		}
+	}
+	cw := &countWriter{w: w}
+	records := make([]zipRecord, 0, len(entries))
+	for i := range entries {
+		e := &entries[i]
+		r := zipRecord{entry: e, offset: cw.count}
+		if _, err := cw.Write(localHeader(e)); err != nil {
+			return err
+		}
+		start := cw.count
+		hash := crc32.NewIEEE()
+		raw := &countWriter{w: hash}
+		var err error
+		if e.Store {
+			err = copyData(io.MultiWriter(cw, raw), i)
+		} else {
+			fw, _ := flate.NewWriter(cw, flate.DefaultCompression)
+			if err = copyData(io.MultiWriter(fw, raw), i); err == nil {
+				err = fw.Close()
+			}
+		}
+		if err != nil {
+			return err
+		}
+		if raw.count != e.Size {
+			return fmt.Errorf("文件[%s]大小不一致，预期%d，实际%d", e.Name, e.Size, raw.count)
+		}
+		r.crc = hash.Sum32()
+		r.compressed = cw.count - start
+		if _, err := cw.Write(descriptor(e, r.crc, r.compressed, e.Size)); err != nil {
+			return err
+		}
+		records = append(records, r)
+	}
+
+	dirOffset := cw.count
+	for i := range records {
+		if _, err := cw.Write(centralHeader(&records[i])); err != nil {
+			return err
+		}
+	}
+	_, err := cw.Write(endRecord(len(records), dirOffset, cw.count-dirOffset))
+	return err
+}
+
+// CleanZipName 规范压缩包内路径，去除开头的/及..，为空时返回def
+func CleanZipName(name, def string) string {
+	name = strings.ReplaceAll(name, "\\", "/")
+	if strings.HasSuffix(name, "/") {
+		name += def
+	}
+	var parts []string
+	for _, part := range strings.Split(path.Clean("/"+name), "/") {
+		if part != "" && part != "." && part != ".." {
+			parts = append(parts, part)
+		}
+	}
+	if len(parts) == 0 {
+		return def
+	}
+	return strings.Join(parts, "/")
+}
+
+// DedupZipNames 压缩包内重名的文件按name (1).ext依次编号，忽略大小写
+func DedupZipNames(names []string) []string {
+	used := map[string]bool{}
+	for _, name := range names {
+		used[strings.ToLower(name)] = true
+	}
+	seen := map[string]bool{}
+	ret := make([]string, len(names))
+	for i, name := range names {
+		if !seen[strings.ToLower(name)] {
+			seen[strings.ToLower(name)] = true
+			ret[i] = name
+			continue
+		}
+		ext := path.Ext(name)
+		if ext == name[strings.LastIndex(name, "/")+1:] {
+			ext = ""
+		}
+		base := strings.TrimSuffix(name, ext)
+		for n := 1; ; n++ {
+			candidate := fmt.Sprintf("%s (%d)%s", base, n, ext)
+			if !used[strings.ToLower(candidate)] {
+				used[strings.ToLower(candidate)] = true
+				ret[i] = candidate
+				break
+			}
+		}
+	}
+	return ret
+}
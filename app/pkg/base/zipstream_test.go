@@ -0,0 +1,107 @@
+package base
+
+import (
+	"archive/zip"
+	"bytes"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeStreamZip(t *testing.T, entries []ZipEntry, data []string) []byte {
+	var buf bytes.Buffer
+	err := WriteZipStream(&buf, entries, func(w io.Writer, i int) error {
+		_, err := io.WriteString(w, data[i])
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestWriteZipStream(t *testing.T) {
+	modified := time.Date(2023, 5, 6, 7, 8, 10, 0, time.UTC)
+	data := []string{"hello", strings.Repeat("osproxy ", 1000), ""}
+	entries := []ZipEntry{
+		{Name: "a.jpg", Size: int64(len(data[0])), Modified: modified, Store: true},
+		{Name: "目录/说明.txt", Size: int64(len(data[1])), Modified: modified},
+		{Name: "empty.txt", Size: 0, Modified: modified, Store: true},
+	}
+	b := writeStreamZip(t, entries, data)
+	if ZipStreamSize(entries) != -1 {
+		t.Fatal("expect unknown size with deflate entry")
+	}
+
+	r, err := zip.NewReader(bytes.NewReader(b), int64(len(b)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(r.File) != len(entries) {
+		t.Fatalf("unexpected file count %d", len(r.File))
+	}
+	for i, f := range r.File {
+		if f.Name != entries[i].Name || !f.Modified.Equal(modified) {
+			t.Fatalf("unexpected header %s %v", f.Name, f.Modified)
+		}
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		content, err := io.ReadAll(rc)
+		rc.Close()
+		if err != nil || string(content) != data[i] {
+			t.Fatalf("unexpected content of %s, %v", f.Name, err)
+		}
+	}
+	if r.File[1].Method != zip.Deflate || r.File[0].Method != zip.Store {
+		t.Fatal("unexpected method")
+	}
+}
+
+func TestZipStreamSize(t *testing.T) {
+	data := []string{"a", "bb", strings.Repeat("c", 4096)}
+	entries := []ZipEntry{
+		{Name: "a.png", Size: 1, Store: true},
+		{Name: "图片/b.png", Size: 2, Store: true},
+		{Name: "c.zip", Size: 4096, Store: true},
+	}
+	b := writeStreamZip(t, entries, data)
+	if size := ZipStreamSize(entries); size != int64(len(b)) {
+		t.Fatalf("expect %d, got %d", len(b), size)
+	}
+
+	// 写入长度与声明不一致时报错
+	err := WriteZipStream(io.Discard, entries[:1], func(w io.Writer, i int) error {
+		_, err := io.WriteString(w, "too long")
+		return err
+	})
+	if err == nil {
+		t.Fatal("expect size mismatch error")
+	}
+}
+
+func TestDedupZipNames(t *testing.T) {
+	got := DedupZipNames([]string{"a.txt", "A.txt", "a (1).txt", "dir/b", "dir/b", ".env", ".env"})
+	want := []string{"a.txt", "A (2).txt", "a (1).txt", "dir/b", "dir/b (1)", ".env", ".env (1)"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("expect %v, got %v", want, got)
+	}
+}
+
+func TestCleanZipName(t *testing.T) {
+	cases := map[string]string{
+		"":              "f.txt",
+		"../../etc/x":   "etc/x",
+		"/a/./b.txt":    "a/b.txt",
+		"dir/":          "dir/f.txt",
+		"win\\path.txt": "win/path.txt",
+	}
+	for in, want := range cases {
+		if got := CleanZipName(in, "f.txt"); got != want {
+			t.Fatalf("%q: expect %q, got %q", in, want, got)
+		}
+	}
+}
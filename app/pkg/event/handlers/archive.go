@@ -0,0 +1,158 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/qinguoyi/osproxy/app/models"
+	"github.com/qinguoyi/osproxy/app/pkg/base"
+	"github.com/qinguoyi/osproxy/app/pkg/event"
+	"github.com/qinguoyi/osproxy/app/pkg/repo"
+	"github.com/qinguoyi/osproxy/app/pkg/storage"
+	"github.com/qinguoyi/osproxy/app/pkg/utils"
+	"github.com/qinguoyi/osproxy/bootstrap"
+	"github.com/qinguoyi/osproxy/bootstrap/plugins"
+	"gorm.io/gorm"
+	"io"
+	"net/url"
+	"os"
+	"path"
+	"time"
+)
+
+func init() {
+	event.NewEventsHandler().RegHandler(utils.TaskArchive, handleArchiveExpand)
+}
+
+// errArchiveQuota 子文件超出租户配额，停止展开
+var errArchiveQuota = errors.New("压缩包子文件超出配额")
+
+func handleArchiveExpand(i interface{}) error {
+	lgDB := new(plugins.LangGoDB).Use("default").NewDB()
+
+	taskID := i.(int64)
+	taskInfo, err := repo.NewTaskRepo().GetByID(lgDB, taskID)
+	if err != nil {
+		fmt.Printf("任务不存在%v", err)
+		return err
+	}
+
+	// 反序列extraData
+	var msg models.ArchiveInfo
+	if err := json.Unmarshal([]byte(taskInfo.ExtraData), &msg); err != nil {
+		return err
+	}
+	metaData, err := repo.NewMetaDataInfoRepo().GetByUid(lgDB, msg.StorageUid)
+	if err != nil {
+		return errors.New("压缩包uid不存在")
+	}
+	srcName, err := url.PathUnescape(metaData.Name)
+	if err != nil {
+		srcName = metaData.Name
+	}
+	format := base.GetArchiveFormat(srcName)
+	if format == "" {
+		return nil
+	}
+
+	tmpDir, err := os.MkdirTemp("", "archive-")
+	if err != nil {
+		return errors.New("创建临时目录失败")
+	}
+	defer func() {
+		_ = os.RemoveAll(tmpDir)
+	}()
+	archiveFile := path.Join(tmpDir, metaData.StorageName)
+	if err := storage.FGetObject(metaData.Bucket, metaData.StorageName, metaData.StorageSize, archiveFile); err != nil {
+		return errors.New(fmt.Sprintf("下载压缩包失败，详情%s", err.Error()))
+	}
+
+	// 任务重试时，跳过已展开的子文件
+	children, err := repo.NewMetaDataInfoRepo().GetByCompressUid(lgDB, metaData.UID)
+	if err != nil {
+		return errors.New("查询压缩包子文件失败")
+	}
+	expanded := map[string]bool{}
+	for _, child := range children {
+		expanded[child.RelPath] = true
+	}
+
+	conf := bootstrap.NewConfig("").Archive
+	limit := base.ArchiveLimit{
+		MaxEntries:   conf.MaxEntries,
+		MaxTotalSize: conf.MaxTotalSize * 1024 * 1024,
+		MaxRatio:     conf.MaxRatio,
+	}
+	err = base.WalkArchive(archiveFile, format, limit, func(entry string, r io.Reader) error {
+		if expanded[entry] {
+			// 仍需读取，保证大小限制按实际数据计算
+			_, err := io.Copy(io.Discard, r)
+			return err
+		}
+		return expandArchiveEntry(lgDB, metaData, tmpDir, entry, r)
+	})
+	// 超出配额时保留已展开的子文件，重试也无法继续，不再重试
+	if errors.Is(err, errArchiveQuota) {
+		bootstrap.NewLogger().Logger.Warn(fmt.Sprintf("压缩包展开终止，uid:%d，详情%s", metaData.UID, err.Error()))
+		return nil
+	}
+	return err
+}
+
+// expandArchiveEntry 将压缩包中的单个文件保存为独立uid
+func expandArchiveEntry(lgDB *gorm.DB, parent *models.MetaDataInfo, tmpDir, entry string, r io.Reader) error {
+	child, err := base.NewMetaDataInfo(entry, parent.Tenant, "")
+	if err != nil {
+		return err
+	}
+	fileName := path.Join(tmpDir, child.StorageName)
+	out, err := os.Create(fileName)
+	if err != nil {
+		return errors.New("本地创建文件失败")
+	}
+	defer func() {
+		_ = os.Remove(fileName)
+	}()
+	size, err := io.Copy(out, r)
+	_ = out.Close()
+	if err != nil {
+		return errors.New(fmt.Sprintf("解压文件[%s]失败，详情%s", entry, err.Error()))
+	}
+
+	md5Str, err := base.CalculateFileMd5(fileName)
+	if err != nil {
+		return errors.New(fmt.Sprintf("生成md5失败，详情%s", err.Error()))
+	}
+	contentType := "application/octet-stream"
+	if size > 0 {
+		if contentType, err = base.DetectContentType(fileName); err != nil {
+			return errors.New("判断文件content-type失败")
+		}
+	}
+	errorInfo, err := base.CheckQuota(lgDB, parent.Tenant, size, 1)
+	if err != nil {
+		return errors.New(fmt.Sprintf("查询租户用量失败，详情%s", err.Error()))
+	}
+	if errorInfo != "" {
+		return fmt.Errorf("%w，文件[%s]，%s", errArchiveQuota, entry, errorInfo)
+	}
+	if err := storage.NewStorage().Storage.PutObject(child.Bucket, child.StorageName, fileName, contentType); err != nil {
+		return errors.New("上传到对象存储失败")
+	}
+
+	now := time.Now()
+	child.Md5 = md5Str
+	child.StorageSize = size
+	child.ContentType = contentType
+	// 子文件与普通上传一致，启用扫描时先隔离，扫描通过后才可下载
+	child.Status = base.UploadedStatus()
+	child.CompressUid = parent.UID
+	// 子文件和压缩包一起随批次提交可见
+	child.BatchUid = parent.BatchUid
+	child.RelPath = entry
+	child.UpdatedAt = &now
+	if err := repo.NewMetaDataInfoRepo().Create(lgDB, child); err != nil {
+		return err
+	}
+	return base.AfterUpload(lgDB, child, utils.EventUploaded)
+}
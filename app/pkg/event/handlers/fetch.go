@@ -0,0 +1,187 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/qinguoyi/osproxy/app/models"
+	"github.com/qinguoyi/osproxy/app/pkg/base"
+	"github.com/qinguoyi/osproxy/app/pkg/event"
+	"github.com/qinguoyi/osproxy/app/pkg/repo"
+	"github.com/qinguoyi/osproxy/app/pkg/storage"
+	"github.com/qinguoyi/osproxy/app/pkg/utils"
+	"github.com/qinguoyi/osproxy/bootstrap"
+	"github.com/qinguoyi/osproxy/bootstrap/plugins"
+	"gorm.io/gorm"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"time"
+)
+
+func init() {
+	event.NewEventsHandler().RegHandler(utils.TaskFetch, handleFetch)
+}
+
+func handleFetch(i interface{}) error {
+	lgDB := new(plugins.LangGoDB).Use("default").NewDB()
+
+	taskID := i.(int64)
+	taskInfo, err := repo.NewTaskRepo().GetByID(lgDB, taskID)
+	if err != nil {
+		fmt.Printf("任务不存在%v", err)
+		return err
+	}
+
+	// 反序列extraData
+	var msg models.FetchInfo
+	if err := json.Unmarshal([]byte(taskInfo.ExtraData), &msg); err != nil {
+		return err
+	}
+	metaData, err := repo.NewMetaDataInfoRepo().GetByUid(lgDB, msg.StorageUid)
+	if err != nil {
+		return errors.New("拉取文件，uid不存在")
+	}
+	if metaData.Status == utils.MetaStatusAvailable || metaData.Status == utils.MetaStatusQuarantined {
+		return nil
+	}
+
+	if err := fetchRemoteFile(lgDB, metaData, &msg); err != nil {
+		return err
+	}
+
+	// 更新数据 删除redis
+	lgRedis := new(plugins.LangGoRedis).NewRedis()
+	lgRedis.Del(context.Background(), fmt.Sprintf("%d-meta", metaData.UID))
+	if metaData, err = repo.NewMetaDataInfoRepo().GetByUid(lgDB, msg.StorageUid); err == nil {
+		_ = base.AfterUpload(lgDB, metaData, utils.EventUploaded)
+	}
+	return nil
+}
+
+// fetchRemoteFile 拉取远程文件到本地，校验后上传到对象存储
+func fetchRemoteFile(lgDB *gorm.DB, metaData *models.MetaDataInfo, msg *models.FetchInfo) error {
+	conf := bootstrap.NewConfig("").Fetch
+	timeout := conf.Timeout
+	if timeout <= 0 {
+		timeout = 600
+	}
+	// 只允许访问公网地址，每次建立连接时校验，重定向同样生效
+	client := base.NewPublicClient(time.Duration(timeout) * time.Second)
+	client.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		if len(via) > conf.MaxRedirects {
+			return errors.New("重定向次数超过限制")
+		}
+		if req.URL.Scheme != "http" && req.URL.Scheme != "https" {
+			return errors.New("重定向地址协议不支持")
+		}
+		return nil
+	}
+	req, err := http.NewRequest("GET", msg.Url, nil)
+	if err != nil {
+		return err
+	}
+	for k, v := range msg.Headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return errors.New(fmt.Sprintf("拉取源文件失败，状态码:%d", resp.StatusCode))
+	}
+	maxSize := conf.MaxSize * 1024 * 1024
+	if maxSize > 0 && resp.ContentLength > maxSize {
+		return errors.New(fmt.Sprintf("源文件大小超过限制，大小:%d", resp.ContentLength))
+	}
+
+	dirName := path.Join(utils.LocalStore, fmt.Sprintf("%d", metaData.UID))
+	if err := os.MkdirAll(dirName, 0755); err != nil {
+		return errors.New("本地创建目录失败")
+	}
+	defer func() {
+		_ = os.RemoveAll(dirName)
+	}()
+	fileName := path.Join(dirName, metaData.StorageName)
+	out, err := os.Create(fileName)
+	if err != nil {
+		return errors.New("本地创建文件失败")
+	}
+	defer out.Close()
+
+	var src io.Reader = resp.Body
+	if maxSize > 0 {
+		src = io.LimitReader(resp.Body, maxSize+1)
+	}
+	written, err := io.Copy(out, src)
+	if err != nil {
+		return errors.New(fmt.Sprintf("拉取源文件数据失败，详情%s", err.Error()))
+	}
+	if maxSize > 0 && written > maxSize {
+		return errors.New("源文件大小超过限制")
+	}
+
+	// 校验md5
+	md5Str, err := base.CalculateFileMd5(fileName)
+	if err != nil {
+		return errors.New(fmt.Sprintf("生成md5失败，详情%s", err.Error()))
+	}
+	if msg.Md5 != "" && md5Str != msg.Md5 {
+		return errors.New(fmt.Sprintf("校验md5失败，计算结果:%s, 参数:%s", md5Str, msg.Md5))
+	}
+
+	// 判断是否上传过，md5
+	resumeInfo, err := repo.NewMetaDataInfoRepo().GetResumeByMd5(lgDB, []string{md5Str})
+	if err != nil {
+		return err
+	}
+	// 按实际大小校验配额，预留的部分不重复计算，秒传不占用存储容量
+	quotaSize := written
+	if len(resumeInfo) != 0 {
+		quotaSize = 0
+	}
+	errorInfo, err := base.CheckQuota(lgDB, metaData.Tenant, base.UploadQuotaSize(metaData, quotaSize), 1)
+	if err != nil {
+		return err
+	}
+	if errorInfo != "" {
+		return errors.New(errorInfo)
+	}
+	if len(resumeInfo) != 0 {
+		if err := repo.NewMetaDataInfoRepo().Transition(lgDB, metaData.UID, utils.MetaStatusAvailable, map[string]interface{}{
+			"bucket":       resumeInfo[0].Bucket,
+			"storage_name": resumeInfo[0].StorageName,
+			"address":      resumeInfo[0].Address,
+			"md5":          md5Str,
+			"storage_size": resumeInfo[0].StorageSize,
+			"multi_part":   false,
+			"content_type": resumeInfo[0].ContentType,
+		}); err != nil {
+			return errors.New("拉取完更新数据失败")
+		}
+		return nil
+	}
+
+	// 上传到对象存储
+	contentType, err := base.DetectContentType(fileName)
+	if err != nil {
+		return errors.New("判断文件content-type失败")
+	}
+	if err := storage.NewStorage().Storage.PutObject(
+		metaData.Bucket, metaData.StorageName, fileName, contentType); err != nil {
+		return errors.New("上传到对象存储失败")
+	}
+	if err := repo.NewMetaDataInfoRepo().Transition(lgDB, metaData.UID, base.UploadedStatus(), map[string]interface{}{
+		"md5":          md5Str,
+		"storage_size": written,
+		"multi_part":   false,
+		"content_type": contentType,
+	}); err != nil {
+		return errors.New("拉取完更新数据失败")
+	}
+	return nil
+}
@@ -0,0 +1,70 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/qinguoyi/osproxy/app/models"
+	"github.com/qinguoyi/osproxy/app/pkg/base"
+	"github.com/qinguoyi/osproxy/app/pkg/event"
+	"github.com/qinguoyi/osproxy/app/pkg/repo"
+	"github.com/qinguoyi/osproxy/app/pkg/storage"
+	"github.com/qinguoyi/osproxy/app/pkg/utils"
+	"github.com/qinguoyi/osproxy/bootstrap"
+	"github.com/qinguoyi/osproxy/bootstrap/plugins"
+)
+
+func init() {
+	event.NewEventsHandler().RegHandler(utils.TaskMedia, handleMediaExtract)
+}
+
+func handleMediaExtract(i interface{}) error {
+	lgDB := new(plugins.LangGoDB).Use("default").NewDB()
+
+	taskID := i.(int64)
+	taskInfo, err := repo.NewTaskRepo().GetByID(lgDB, taskID)
+	if err != nil {
+		fmt.Printf("任务不存在%v", err)
+		return err
+	}
+
+	// 反序列extraData
+	var msg models.MediaInfo
+	if err := json.Unmarshal([]byte(taskInfo.ExtraData), &msg); err != nil {
+		return err
+	}
+	metaData, err := repo.NewMetaDataInfoRepo().GetByUid(lgDB, msg.StorageUid)
+	if err != nil {
+		return errors.New("媒体文件uid不存在")
+	}
+	if metaData.Status != utils.MetaStatusAvailable || metaData.StorageSize == 0 {
+		return nil
+	}
+
+	// 按需读取文件头及索引，不下载完整文件
+	r := storage.NewObjectReader(metaData.Bucket, metaData.StorageName, metaData.StorageSize)
+	info, err := base.ExtractMedia(r, metaData.StorageSize)
+	if err != nil {
+		// 文件内容与格式不符时不再重试
+		bootstrap.NewLogger().Logger.Warn(fmt.Sprintf("解析媒体元数据失败，uid:%d，详情%s", metaData.UID, err.Error()))
+		return nil
+	}
+	if info == nil {
+		return nil
+	}
+	attributes, err := json.Marshal(info.Attributes)
+	if err != nil {
+		return err
+	}
+	if err := repo.NewMetaDataInfoRepo().Updates(lgDB, metaData.UID, map[string]interface{}{
+		"width":      info.Width,
+		"height":     info.Height,
+		"attributes": string(attributes),
+	}); err != nil {
+		return errors.New("更新媒体元数据失败")
+	}
+	lgRedis := new(plugins.LangGoRedis).NewRedis()
+	lgRedis.Del(context.Background(), fmt.Sprintf("%d-meta", metaData.UID))
+	return nil
+}
@@ -5,6 +5,7 @@ import (
 	"errors"
 	"fmt"
 	"github.com/qinguoyi/osproxy/app/models"
+	"github.com/qinguoyi/osproxy/app/pkg/base"
 	"github.com/qinguoyi/osproxy/app/pkg/event"
 	"github.com/qinguoyi/osproxy/app/pkg/repo"
 	"github.com/qinguoyi/osproxy/app/pkg/storage"
@@ -80,5 +81,15 @@ func handlePartDelete(i interface{}) error {
 			return errors.New("删除对象存储的脏数据失败")
 		}
 	}
+
+	// 分片已清理，会话回到未上传，可重新上传
+	if err := repo.NewMetaDataInfoRepo().Transition(lgDB, msg.StorageUid, utils.MetaStatusPending, map[string]interface{}{
+		"multi_part": false,
+	}); err != nil {
+		return errors.New(fmt.Sprintf("重置上传会话失败，详情%s", err.Error()))
+	}
+	if metaData, err := repo.NewMetaDataInfoRepo().GetByUid(lgDB, msg.StorageUid); err == nil {
+		_ = base.NotifyEvent(lgDB, metaData, utils.EventReset)
+	}
 	return nil
 }
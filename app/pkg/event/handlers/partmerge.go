@@ -12,10 +12,10 @@ import (
 	"github.com/qinguoyi/osproxy/app/pkg/storage"
 	"github.com/qinguoyi/osproxy/app/pkg/utils"
 	"github.com/qinguoyi/osproxy/bootstrap/plugins"
+	"gorm.io/gorm"
 	"io"
 	"os"
 	"path"
-	"time"
 )
 
 func init() {
@@ -63,6 +63,25 @@ func handlePartMerge(i interface{}) error {
 		return err
 	}
 
+	err = mergePartFile(lgDB, &msg)
+	metaData, metaErr := repo.NewMetaDataInfoRepo().GetByUid(lgDB, msg.StorageUid)
+	if metaErr != nil {
+		return err
+	}
+	if err == nil {
+		_ = base.AfterUpload(lgDB, metaData, utils.EventMerged)
+	} else if taskInfo.ExecuteTime >= utils.CompensationTotal {
+		// 已达到补偿次数上限，不会再重试
+		_ = repo.NewMetaDataInfoRepo().Transition(lgDB, msg.StorageUid, utils.MetaStatusFailed, nil)
+		lgRedis := new(plugins.LangGoRedis).NewRedis()
+		lgRedis.Del(context.Background(), fmt.Sprintf("%d-meta", msg.StorageUid))
+		_ = base.NotifyEvent(lgDB, metaData, utils.EventMergeFailed)
+	}
+	return err
+}
+
+// mergePartFile 合并分片并上传到对象存储
+func mergePartFile(lgDB *gorm.DB, msg *models.MergeInfo) error {
 	// 按顺序合并分片
 	var multiPartInfoList []models.MultiPartInfo
 	if err := lgDB.Model(&models.MultiPartInfo{}).Where(
@@ -110,13 +129,11 @@ func handlePartMerge(i interface{}) error {
 		return err
 	}
 	if len(resumeInfo) != 0 {
-		now := time.Now()
-		if err := repo.NewMetaDataInfoRepo().Updates(lgDB, metaData.UID, map[string]interface{}{
+		if err := repo.NewMetaDataInfoRepo().Transition(lgDB, metaData.UID, utils.MetaStatusAvailable, map[string]interface{}{
 			"bucket":       resumeInfo[0].Bucket,
 			"storage_name": resumeInfo[0].StorageName,
 			"address":      resumeInfo[0].Address,
 			"multi_part":   false,
-			"updated_at":   &now,
 			"content_type": resumeInfo[0].ContentType,
 		}); err != nil {
 			return errors.New("上传完更新数据失败")
@@ -140,10 +157,8 @@ func handlePartMerge(i interface{}) error {
 	}
 
 	// 更新元数据
-	now := time.Now()
-	if err := repo.NewMetaDataInfoRepo().Updates(lgDB, metaData.UID, map[string]interface{}{
+	if err := repo.NewMetaDataInfoRepo().Transition(lgDB, metaData.UID, base.UploadedStatus(), map[string]interface{}{
 		"multi_part":   false,
-		"updated_at":   &now,
 		"content_type": contentType,
 	}); err != nil {
 		return errors.New("上传完更新数据失败")
@@ -0,0 +1,131 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/qinguoyi/osproxy/app/models"
+	"github.com/qinguoyi/osproxy/app/pkg/base"
+	"github.com/qinguoyi/osproxy/app/pkg/event"
+	"github.com/qinguoyi/osproxy/app/pkg/repo"
+	"github.com/qinguoyi/osproxy/app/pkg/scanner"
+	"github.com/qinguoyi/osproxy/app/pkg/storage"
+	"github.com/qinguoyi/osproxy/app/pkg/utils"
+	"github.com/qinguoyi/osproxy/bootstrap"
+	"github.com/qinguoyi/osproxy/bootstrap/plugins"
+	"gorm.io/gorm"
+	"os"
+	"path"
+	"time"
+)
+
+func init() {
+	event.NewEventsHandler().RegHandler(utils.TaskScan, handleScan)
+}
+
+func handleScan(i interface{}) error {
+	lgDB := new(plugins.LangGoDB).Use("default").NewDB()
+
+	taskID := i.(int64)
+	taskInfo, err := repo.NewTaskRepo().GetByID(lgDB, taskID)
+	if err != nil {
+		fmt.Printf("任务不存在%v", err)
+		return err
+	}
+
+	// 反序列extraData
+	var msg models.ScanInfo
+	if err := json.Unmarshal([]byte(taskInfo.ExtraData), &msg); err != nil {
+		return err
+	}
+	metaData, err := repo.NewMetaDataInfoRepo().GetByUid(lgDB, msg.StorageUid)
+	if err != nil {
+		return errors.New("扫描文件uid不存在")
+	}
+	if metaData.Status != utils.MetaStatusQuarantined {
+		return nil
+	}
+
+	conf := bootstrap.NewConfig("").Scan
+	result := &scanner.Result{Clean: true}
+	var fileName string
+	if s := scanner.NewScanner(conf); s != nil {
+		tmpDir, err := os.MkdirTemp("", "scan-")
+		if err != nil {
+			return errors.New("创建临时目录失败")
+		}
+		defer func() {
+			_ = os.RemoveAll(tmpDir)
+		}()
+		fileName = path.Join(tmpDir, metaData.StorageName)
+		if err := storage.FGetObject(metaData.Bucket, metaData.StorageName, metaData.StorageSize, fileName); err != nil {
+			return errors.New(fmt.Sprintf("下载待扫描文件失败，详情%s", err.Error()))
+		}
+		f, err := os.Open(fileName)
+		if err != nil {
+			return err
+		}
+		result, err = s.Scan(context.Background(), f)
+		_ = f.Close()
+		if err != nil {
+			return err
+		}
+	}
+
+	now := time.Now()
+	if result.Clean {
+		columns := map[string]interface{}{"scanned_at": &now}
+		// 扫描已关闭时直接放行，不记录扫描结果
+		if fileName != "" {
+			columns["scan_result"] = utils.ScanResultClean
+		}
+		if err := repo.NewMetaDataInfoRepo().Transition(lgDB, metaData.UID, utils.MetaStatusAvailable, columns); err != nil {
+			return errors.New("扫描完更新数据失败")
+		}
+	} else if err := quarantineObject(lgDB, metaData, fileName, conf.Quarantine, result.Signature, &now); err != nil {
+		return err
+	}
+
+	// 更新数据 删除redis
+	lgRedis := new(plugins.LangGoRedis).NewRedis()
+	lgRedis.Del(context.Background(), fmt.Sprintf("%d-meta", metaData.UID))
+	if metaData, err = repo.NewMetaDataInfoRepo().GetByUid(lgDB, msg.StorageUid); err != nil {
+		return nil
+	}
+	if result.Clean {
+		_ = base.AfterScan(lgDB, metaData, msg.Event)
+	} else {
+		_ = base.NotifyEvent(lgDB, metaData, utils.EventInfected)
+	}
+	return nil
+}
+
+// quarantineObject 感染文件移入隔离桶，存储对象仍被其他文件引用时只标记状态
+func quarantineObject(lgDB *gorm.DB, metaData *models.MetaDataInfo, fileName, bucket, signature string, now *time.Time) error {
+	columns := map[string]interface{}{
+		"scan_result": signature,
+		"scanned_at":  now,
+	}
+	refs, err := repo.NewMetaDataInfoRepo().CountByObject(lgDB, metaData.Bucket, metaData.StorageName, metaData.UID)
+	if err != nil {
+		return err
+	}
+	moved := bucket != "" && refs == 0
+	if moved {
+		if err := storage.NewStorage().Storage.PutObject(
+			bucket, metaData.StorageName, fileName, metaData.ContentType); err != nil {
+			return errors.New("上传到隔离桶失败")
+		}
+		columns["bucket"] = bucket
+	}
+	if err := repo.NewMetaDataInfoRepo().Transition(lgDB, metaData.UID, utils.MetaStatusInfected, columns); err != nil {
+		return errors.New("扫描完更新数据失败")
+	}
+	if moved {
+		if err := storage.NewStorage().Storage.DeleteObject(metaData.Bucket, metaData.StorageName); err != nil {
+			bootstrap.NewLogger().Logger.Warn(fmt.Sprintf("删除感染文件原对象失败，详情%s", err.Error()))
+		}
+	}
+	return nil
+}
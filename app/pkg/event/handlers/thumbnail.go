@@ -0,0 +1,85 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/qinguoyi/osproxy/app/models"
+	"github.com/qinguoyi/osproxy/app/pkg/base"
+	"github.com/qinguoyi/osproxy/app/pkg/event"
+	"github.com/qinguoyi/osproxy/app/pkg/repo"
+	"github.com/qinguoyi/osproxy/app/pkg/storage"
+	"github.com/qinguoyi/osproxy/app/pkg/utils"
+	"github.com/qinguoyi/osproxy/bootstrap"
+	"github.com/qinguoyi/osproxy/bootstrap/plugins"
+	"io"
+	"path"
+	"strings"
+)
+
+func init() {
+	event.NewEventsHandler().RegHandler(utils.TaskThumbnail, handleThumbnail)
+}
+
+func handleThumbnail(i interface{}) error {
+	lgDB := new(plugins.LangGoDB).Use("default").NewDB()
+
+	taskID := i.(int64)
+	taskInfo, err := repo.NewTaskRepo().GetByID(lgDB, taskID)
+	if err != nil {
+		fmt.Printf("任务不存在%v", err)
+		return err
+	}
+
+	// 反序列extraData
+	var msg models.ThumbnailInfo
+	if err := json.Unmarshal([]byte(taskInfo.ExtraData), &msg); err != nil {
+		return err
+	}
+	metaData, err := repo.NewMetaDataInfoRepo().GetByUid(lgDB, msg.StorageUid)
+	if err != nil {
+		return errors.New("图片uid不存在")
+	}
+	conf := bootstrap.NewConfig("").Image
+	if metaData.Status != utils.MetaStatusAvailable || metaData.MultiPart || !base.IsTransformable(metaData.ContentType) ||
+		(conf.MaxSource > 0 && metaData.StorageSize > conf.MaxSource*1024*1024) {
+		return nil
+	}
+
+	r := storage.NewObjectReader(metaData.Bucket, metaData.StorageName, metaData.StorageSize)
+	data, err := io.ReadAll(io.NewSectionReader(r, 0, metaData.StorageSize))
+	if err != nil {
+		return errors.New(fmt.Sprintf("读取原图失败，详情%s", err.Error()))
+	}
+	prefix := strings.TrimSuffix(metaData.StorageName, path.Ext(metaData.StorageName))
+	var failed []string
+	for name, t := range base.ThumbnailTransforms() {
+		params := t.Key()
+		existing, err := repo.NewImageDerivativeRepo().GetByUidParams(lgDB, metaData.UID, params)
+		if err == nil && existing.SourceMd5 == metaData.Md5 && existing.Bucket == metaData.Bucket {
+			continue
+		}
+		result, err := base.TransformImage(data, t, conf.MaxPixels*10000)
+		if err != nil {
+			// 单个规格失败不影响其他规格，已生成的规格重试时跳过
+			bootstrap.NewLogger().Logger.Warn(fmt.Sprintf("生成缩略图失败，uid:%d，规格:%s，详情%s", metaData.UID, name,
+				err.Error()))
+			failed = append(failed, name)
+			continue
+		}
+		// 缩略图与原图存放在同一个桶
+		item, err := base.SaveImageDerivative(lgDB, metaData, params, result, metaData.Bucket,
+			fmt.Sprintf("%s-%s.%s", prefix, name, result.Format))
+		if err != nil {
+			return errors.New(fmt.Sprintf("保存缩略图失败，详情%s", err.Error()))
+		}
+		// 下载时已按需生成的结果存放在缓存桶，覆盖记录后删除
+		if existing.ID != 0 && (existing.Bucket != item.Bucket || existing.StorageName != item.StorageName) {
+			_ = storage.NewStorage().Storage.DeleteObject(existing.Bucket, existing.StorageName)
+		}
+	}
+	if len(failed) != 0 {
+		return errors.New(fmt.Sprintf("生成缩略图失败，规格:%s", strings.Join(failed, ",")))
+	}
+	return nil
+}
@@ -0,0 +1,119 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/qinguoyi/osproxy/app/models"
+	"github.com/qinguoyi/osproxy/app/pkg/base"
+	"github.com/qinguoyi/osproxy/app/pkg/event"
+	"github.com/qinguoyi/osproxy/app/pkg/repo"
+	"github.com/qinguoyi/osproxy/app/pkg/utils"
+	"github.com/qinguoyi/osproxy/bootstrap"
+	"github.com/qinguoyi/osproxy/bootstrap/plugins"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+func init() {
+	event.NewEventsHandler().RegPreProcess(utils.TaskWebhook, preProcessWebhook)
+	event.NewEventsHandler().RegHandler(utils.TaskWebhook, handleWebhook)
+}
+
+// preProcessWebhook 失败重试按指数退避，未到下次投递时间不抢占
+func preProcessWebhook(i interface{}) bool {
+	lgDB := new(plugins.LangGoDB).Use("default").NewDB()
+
+	taskID := i.(int64)
+	latest, err := repo.NewWebhookLogRepo().GetLatestByTaskID(lgDB, taskID)
+	if err != nil || latest == nil || latest.CreatedAt == nil {
+		// 首次投递
+		return true
+	}
+	backoff := bootstrap.NewConfig("").Webhook.Backoff
+	if backoff <= 0 {
+		return true
+	}
+	wait := time.Duration(backoff) * time.Second << uint(latest.Attempt-1)
+	return time.Since(*latest.CreatedAt) >= wait
+}
+
+func handleWebhook(i interface{}) error {
+	lgDB := new(plugins.LangGoDB).Use("default").NewDB()
+
+	taskID := i.(int64)
+	taskInfo, err := repo.NewTaskRepo().GetByID(lgDB, taskID)
+	if err != nil {
+		fmt.Printf("任务不存在%v", err)
+		return err
+	}
+
+	// 反序列extraData
+	var msg models.WebhookInfo
+	if err := json.Unmarshal([]byte(taskInfo.ExtraData), &msg); err != nil {
+		return err
+	}
+
+	attempt, err := repo.NewWebhookLogRepo().CountByTaskID(lgDB, taskID)
+	if err != nil {
+		return errors.New("查询回调投递记录失败")
+	}
+	statusCode, err := deliverWebhook(taskID, &msg)
+
+	// 记录投递结果
+	now := time.Now()
+	webhookLog := models.WebhookLog{
+		TaskID:     taskID,
+		StorageUid: msg.StorageUid,
+		Event:      msg.Event,
+		Url:        msg.Url,
+		Attempt:    int(attempt) + 1,
+		StatusCode: statusCode,
+		CreatedAt:  &now,
+		UpdatedAt:  &now,
+	}
+	if err != nil {
+		webhookLog.ErrorInfo = err.Error()
+	}
+	_ = repo.NewWebhookLogRepo().Create(lgDB, &webhookLog)
+	return err
+}
+
+// deliverWebhook 发送签名回调请求，非2xx视为失败
+func deliverWebhook(taskID int64, msg *models.WebhookInfo) (int, error) {
+	body := []byte(msg.Payload)
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req, err := http.NewRequest("POST", msg.Url, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(utils.WebhookHeaderEvent, msg.Event)
+	req.Header.Set(utils.WebhookHeaderDelivery, strconv.FormatInt(taskID, 10))
+	req.Header.Set(utils.WebhookHeaderTimestamp, timestamp)
+	req.Header.Set(utils.WebhookHeaderSignature,
+		"sha256="+base.SignWebhook(base.GetWebhookSecret(msg.Tenant), timestamp, body))
+
+	timeout := bootstrap.NewConfig("").Webhook.Timeout
+	if timeout <= 0 {
+		timeout = 10
+	}
+	// 请求中指定的回调地址只允许访问公网，租户配置的地址不限制
+	client := &http.Client{Timeout: time.Duration(timeout) * time.Second}
+	if !base.IsTenantCallback(msg.Tenant, msg.Url) {
+		client = base.NewPublicClient(time.Duration(timeout) * time.Second)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return resp.StatusCode, errors.New(fmt.Sprintf("回调响应状态码异常:%d", resp.StatusCode))
+	}
+	return resp.StatusCode, nil
+}
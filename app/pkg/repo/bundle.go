@@ -0,0 +1,24 @@
+package repo
+
+import (
+	"github.com/qinguoyi/osproxy/app/models"
+	"gorm.io/gorm"
+)
+
+type downloadBundleRepo struct{}
+
+func NewDownloadBundleRepo() *downloadBundleRepo { return &downloadBundleRepo{} }
+
+// GetByBundleId .
+func (r *downloadBundleRepo) GetByBundleId(db *gorm.DB, bundleId int64) (*models.DownloadBundle, error) {
+	ret := &models.DownloadBundle{}
+	if err := db.Where("bundle_id = ?", bundleId).First(ret).Error; err != nil {
+		return ret, err
+	}
+	return ret, nil
+}
+
+// Create .
+func (r *downloadBundleRepo) Create(db *gorm.DB, m *models.DownloadBundle) error {
+	return db.Create(m).Error
+}
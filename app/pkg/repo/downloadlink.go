@@ -0,0 +1,78 @@
+package repo
+
+import (
+	"github.com/qinguoyi/osproxy/app/models"
+	"gorm.io/gorm"
+	"time"
+)
+
+type downloadLinkRepo struct{}
+
+func NewDownloadLinkRepo() *downloadLinkRepo { return &downloadLinkRepo{} }
+
+// GetByLinkId .
+func (r *downloadLinkRepo) GetByLinkId(db *gorm.DB, linkId int64) (*models.DownloadLink, error) {
+	ret := &models.DownloadLink{}
+	if err := db.Where("link_id = ?", linkId).First(ret).Error; err != nil {
+		return ret, err
+	}
+	return ret, nil
+}
+
+// GetActiveByUid 获取文件未撤销且未过期的链接
+func (r *downloadLinkRepo) GetActiveByUid(db *gorm.DB, uid int64, now time.Time) ([]models.DownloadLink, error) {
+	var ret []models.DownloadLink
+	if err := db.Where("uid = ? and revoked = ? and expire_at > ?", uid, false, now).
+		Order("id DESC").Find(&ret).Error; err != nil {
+		return ret, err
+	}
+	return ret, nil
+}
+
+// BatchCreate .
+func (r *downloadLinkRepo) BatchCreate(db *gorm.DB, m *[]models.DownloadLink) error {
+	if len(*m) == 0 {
+		return nil
+	}
+	return db.Create(m).Error
+}
+
+// IncrDownloads 下载次数加一，limit为true时只在次数未用完且未撤销时更新，返回是否更新成功
+func (r *downloadLinkRepo) IncrDownloads(db *gorm.DB, linkId int64, limit bool) (bool, error) {
+	query := db.Model(&models.DownloadLink{}).Where("link_id = ?", linkId)
+	if limit {
+		query = query.Where("revoked = ? and (max_downloads = 0 or downloads < max_downloads)", false)
+	}
+	ret := query.Updates(map[string]interface{}{
+		"downloads":  gorm.Expr("downloads + 1"),
+		"updated_at": time.Now(),
+	})
+	if ret.Error != nil {
+		return false, ret.Error
+	}
+	return ret.RowsAffected == 1, nil
+}
+
+// DeleteExpired 删除before之前过期的链接，单次最多删除limit条，返回删除的数量
+func (r *downloadLinkRepo) DeleteExpired(db *gorm.DB, before time.Time, limit int) (int64, error) {
+	var idList []int64
+	if err := db.Model(&models.DownloadLink{}).Where("expire_at < ?", before).Order("id").Limit(limit).
+		Pluck("id", &idList).Error; err != nil || len(idList) == 0 {
+		return 0, err
+	}
+	ret := db.Where("id in ?", idList).Delete(&models.DownloadLink{})
+	return ret.RowsAffected, ret.Error
+}
+
+// Revoke 撤销链接，linkId为0时撤销文件的所有链接，返回撤销的数量
+func (r *downloadLinkRepo) Revoke(db *gorm.DB, uid, linkId int64) (int64, error) {
+	query := db.Model(&models.DownloadLink{}).Where("uid = ? and revoked = ?", uid, false)
+	if linkId != 0 {
+		query = query.Where("link_id = ?", linkId)
+	}
+	ret := query.Updates(map[string]interface{}{
+		"revoked":    true,
+		"updated_at": time.Now(),
+	})
+	return ret.RowsAffected, ret.Error
+}
@@ -0,0 +1,80 @@
+package repo
+
+import (
+	"github.com/qinguoyi/osproxy/app/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"time"
+)
+
+type downloadStatRepo struct{}
+
+func NewDownloadStatRepo() *downloadStatRepo { return &downloadStatRepo{} }
+
+// metricAssignments 累加统计指标，客户端数量为该小时的去重结果，直接覆盖，去重记录过期后为0时保留原值
+func metricAssignments(table string, m models.DownloadMetrics, now *time.Time) clause.Set {
+	values := map[string]interface{}{
+		"requests":   gorm.Expr(table+".requests + ?", m.Requests),
+		"completes":  gorm.Expr(table+".completes + ?", m.Completes),
+		"partials":   gorm.Expr(table+".partials + ?", m.Partials),
+		"bytes":      gorm.Expr(table+".bytes + ?", m.Bytes),
+		"errors":     gorm.Expr(table+".errors + ?", m.Errors),
+		"updated_at": now,
+	}
+	if m.Clients > 0 {
+		values["clients"] = m.Clients
+	}
+	return clause.Assignments(values)
+}
+
+// Add 累加文件下载统计，记录不存在时创建
+func (r *downloadStatRepo) Add(db *gorm.DB, stat *models.DownloadStat) error {
+	now := time.Now()
+	stat.CreatedAt, stat.UpdatedAt = &now, &now
+	return db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "uid"}, {Name: "link_id"}, {Name: "hour"}},
+		DoUpdates: metricAssignments("download_stat", stat.DownloadMetrics, &now),
+	}).Create(stat).Error
+}
+
+// AddTenant 累加租户下载统计，记录不存在时创建
+func (r *downloadStatRepo) AddTenant(db *gorm.DB, stat *models.TenantDownloadStat) error {
+	now := time.Now()
+	stat.CreatedAt, stat.UpdatedAt = &now, &now
+	return db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "tenant"}, {Name: "hour"}},
+		DoUpdates: metricAssignments("tenant_download_stat", stat.DownloadMetrics, &now),
+	}).Create(stat).Error
+}
+
+// GetByUid 查询文件在[start, end)内的按小时统计，包含所有链接
+func (r *downloadStatRepo) GetByUid(db *gorm.DB, uid int64, start, end time.Time) ([]models.DownloadStat, error) {
+	var ret []models.DownloadStat
+	if err := db.Where("uid = ? and hour >= ? and hour < ?", uid, start, end).
+		Order("hour ASC").Find(&ret).Error; err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+// GetByTenant 查询租户在[start, end)内的按小时统计
+func (r *downloadStatRepo) GetByTenant(db *gorm.DB, tenant string, start, end time.Time) ([]models.TenantDownloadStat, error) {
+	var ret []models.TenantDownloadStat
+	if err := db.Where("tenant = ? and hour >= ? and hour < ?", tenant, start, end).
+		Order("hour ASC").Find(&ret).Error; err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+// TopFiles 租户在[start, end)内按发送字节数排序的文件
+func (r *downloadStatRepo) TopFiles(db *gorm.DB, tenant string, start, end time.Time, limit int) ([]models.DownloadStat, error) {
+	var ret []models.DownloadStat
+	if err := db.Model(&models.DownloadStat{}).
+		Select("uid, sum(requests) as requests, sum(bytes) as bytes").
+		Where("tenant = ? and hour >= ? and hour < ?", tenant, start, end).
+		Group("uid").Order("bytes DESC").Limit(limit).Find(&ret).Error; err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
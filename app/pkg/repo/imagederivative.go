@@ -0,0 +1,43 @@
+package repo
+
+import (
+	"github.com/qinguoyi/osproxy/app/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type imageDerivativeRepo struct{}
+
+func NewImageDerivativeRepo() *imageDerivativeRepo { return &imageDerivativeRepo{} }
+
+// GetByUidParams .
+func (r *imageDerivativeRepo) GetByUidParams(db *gorm.DB, uid int64, params string) (*models.ImageDerivative, error) {
+	ret := &models.ImageDerivative{}
+	if err := db.Where("uid = ? and params = ?", uid, params).First(ret).Error; err != nil {
+		return ret, err
+	}
+	return ret, nil
+}
+
+// GetByUid .
+func (r *imageDerivativeRepo) GetByUid(db *gorm.DB, uid int64) ([]models.ImageDerivative, error) {
+	var ret []models.ImageDerivative
+	if err := db.Where("uid = ?", uid).Find(&ret).Error; err != nil {
+		return ret, err
+	}
+	return ret, nil
+}
+
+// Save 按uid及处理参数新增或覆盖
+func (r *imageDerivativeRepo) Save(db *gorm.DB, m *models.ImageDerivative) error {
+	return db.Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "uid"}, {Name: "params"}},
+		DoUpdates: clause.AssignmentColumns([]string{"source_md5", "bucket", "storage_name", "content_type",
+			"storage_size", "md5", "width", "height", "updated_at"}),
+	}).Create(m).Error
+}
+
+// DeleteByUid .
+func (r *imageDerivativeRepo) DeleteByUid(db *gorm.DB, uid int64) error {
+	return db.Where("uid = ?", uid).Delete(&models.ImageDerivative{}).Error
+}
@@ -2,7 +2,9 @@ package repo
 
 import (
 	"github.com/qinguoyi/osproxy/app/models"
+	"github.com/qinguoyi/osproxy/app/pkg/utils"
 	"gorm.io/gorm"
+	"time"
 )
 
 type metaDataInfoRepo struct{}
@@ -18,10 +20,13 @@ func (r *metaDataInfoRepo) GetByUid(db *gorm.DB, uid int64) (*models.MetaDataInf
 	return ret, nil
 }
 
-// GetResumeByMd5 .
+// GetResumeByMd5 获取可秒传的数据，未提交批次内的文件不可见
 func (r *metaDataInfoRepo) GetResumeByMd5(db *gorm.DB, md5 []string) ([]models.MetaDataInfo, error) {
 	var ret []models.MetaDataInfo
-	if err := db.Where("md5 in ? and status = 1 and multi_part = ?", md5, false).
+	committed := db.Session(&gorm.Session{NewDB: true}).Model(&models.UploadBatch{}).Select("batch_uid").
+		Where("status = ?", utils.BatchStatusCommitted)
+	if err := db.Where("md5 in ? and status = ? and multi_part = ?", md5, utils.MetaStatusAvailable, false).
+		Where("batch_uid = 0 or batch_uid in (?)", committed).
 		Find(&ret).Error; err != nil {
 		return ret, err
 	}
@@ -31,7 +36,7 @@ func (r *metaDataInfoRepo) GetResumeByMd5(db *gorm.DB, md5 []string) ([]models.M
 // GetPartByMd5 .
 func (r *metaDataInfoRepo) GetPartByMd5(db *gorm.DB, md5 []string) ([]models.MetaDataInfo, error) {
 	var ret []models.MetaDataInfo
-	if err := db.Where("md5 in ? and status = -1 and multi_part = ? ", md5, true).
+	if err := db.Where("md5 in ? and status = ? and multi_part = ? ", md5, utils.MetaStatusReceiving, true).
 		Find(&ret).Error; err != nil {
 		return ret, err
 	}
@@ -41,7 +46,7 @@ func (r *metaDataInfoRepo) GetPartByMd5(db *gorm.DB, md5 []string) ([]models.Met
 // GetPartByUid .
 func (r *metaDataInfoRepo) GetPartByUid(db *gorm.DB, uid int64) ([]models.MetaDataInfo, error) {
 	var ret []models.MetaDataInfo
-	if err := db.Where("uid = ? and status = -1 and multi_part = ? ", uid, true).
+	if err := db.Where("uid = ? and status = ? and multi_part = ? ", uid, utils.MetaStatusReceiving, true).
 		Find(&ret).Error; err != nil {
 		return ret, err
 	}
@@ -57,6 +62,41 @@ func (r *metaDataInfoRepo) GetByUidList(db *gorm.DB, uid []int64) ([]models.Meta
 	return ret, nil
 }
 
+// GetByCompressUid 获取压缩包展开的子文件
+func (r *metaDataInfoRepo) GetByCompressUid(db *gorm.DB, uid int64) ([]models.MetaDataInfo, error) {
+	var ret []models.MetaDataInfo
+	if err := db.Where("compress_uid = ?", uid).Order("rel_path ASC").Find(&ret).Error; err != nil {
+		return ret, err
+	}
+	return ret, nil
+}
+
+// GetExpiredSessions 获取链接已过期的上传会话
+func (r *metaDataInfoRepo) GetExpiredSessions(db *gorm.DB, status []int, before time.Time, limit int) ([]models.MetaDataInfo, error) {
+	var ret []models.MetaDataInfo
+	if err := db.Where("status in ? and expire_at is not null and expire_at < ?", status, before).
+		Order("id ASC").Limit(limit).Find(&ret).Error; err != nil {
+		return ret, err
+	}
+	return ret, nil
+}
+
+// CountByObject 统计引用同一存储对象的其他文件数量，秒传的文件共用存储对象，已删除的文件不计入
+func (r *metaDataInfoRepo) CountByObject(db *gorm.DB, bucket, storageName string, excludeUid int64) (int64, error) {
+	var count int64
+	if err := db.Model(&models.MetaDataInfo{}).Where("bucket = ? and storage_name = ? and uid <> ? and status <> ?",
+		bucket, storageName, excludeUid, utils.MetaStatusDeleted).Count(&count).Error; err != nil {
+		return 0, err
+	}
+	return count, nil
+}
+
+// Create .
+func (r *metaDataInfoRepo) Create(db *gorm.DB, m *models.MetaDataInfo) error {
+	err := db.Create(m).Error
+	return err
+}
+
 // BatchCreate .
 func (r *metaDataInfoRepo) BatchCreate(db *gorm.DB, m *[]models.MetaDataInfo) error {
 	err := db.Create(m).Error
@@ -68,3 +108,65 @@ func (r *metaDataInfoRepo) Updates(db *gorm.DB, uid int64, columns map[string]in
 	err := db.Model(&models.MetaDataInfo{}).Where("uid = ?", uid).Updates(columns).Error
 	return err
 }
+
+// GetByBatchPath 获取批次内指定相对路径的文件，不含压缩包展开的子文件
+func (r *metaDataInfoRepo) GetByBatchPath(db *gorm.DB, batchUid int64, relPath []string) ([]models.MetaDataInfo, error) {
+	var ret []models.MetaDataInfo
+	if err := db.Where("batch_uid = ? and compress_uid = 0 and rel_path in ?", batchUid, relPath).Find(&ret).Error; err != nil {
+		return ret, err
+	}
+	return ret, nil
+}
+
+// GetByBatchUid 分页获取批次内的文件，不含压缩包展开的子文件
+func (r *metaDataInfoRepo) GetByBatchUid(db *gorm.DB, batchUid int64, offset, limit int) ([]models.MetaDataInfo, int64, error) {
+	var ret []models.MetaDataInfo
+	var total int64
+	query := db.Model(&models.MetaDataInfo{}).Where("batch_uid = ? and compress_uid = 0", batchUid)
+	if err := query.Count(&total).Error; err != nil {
+		return ret, 0, err
+	}
+	if err := query.Order("rel_path ASC").Offset(offset).Limit(limit).Find(&ret).Error; err != nil {
+		return ret, 0, err
+	}
+	return ret, total, nil
+}
+
+// CountByBatchUid 统计批次内的文件数量，不含压缩包展开的子文件
+func (r *metaDataInfoRepo) CountByBatchUid(db *gorm.DB, batchUid int64) (int64, error) {
+	var count int64
+	if err := db.Model(&models.MetaDataInfo{}).Where("batch_uid = ? and compress_uid = 0", batchUid).
+		Count(&count).Error; err != nil {
+		return 0, err
+	}
+	return count, nil
+}
+
+// GetBatchStat 按状态统计批次内的文件数量及大小
+func (r *metaDataInfoRepo) GetBatchStat(db *gorm.DB, batchUid int64) ([]models.BatchStat, error) {
+	var ret []models.BatchStat
+	if err := db.Model(&models.MetaDataInfo{}).Select("status, count(*) as count, coalesce(sum(storage_size), 0) as size").
+		Where("batch_uid = ? and compress_uid = 0", batchUid).Group("status").Scan(&ret).Error; err != nil {
+		return ret, err
+	}
+	return ret, nil
+}
+
+// ListByTenant 分页获取租户可用的文件，未提交批次内的文件不可见
+func (r *metaDataInfoRepo) ListByTenant(db *gorm.DB, tenant string, tags []string, metadata map[string]string,
+	offset, limit int) ([]models.MetaDataInfo, int64, error) {
+	var ret []models.MetaDataInfo
+	var total int64
+	committed := db.Session(&gorm.Session{NewDB: true}).Model(&models.UploadBatch{}).Select("batch_uid").
+		Where("status = ?", utils.BatchStatusCommitted)
+	query := db.Model(&models.MetaDataInfo{}).Where("tenant = ? and status = ?", tenant, utils.MetaStatusAvailable).
+		Where("batch_uid = 0 or batch_uid in (?)", committed)
+	query = NewUserMetaRepo().Filter(db, query, tags, metadata)
+	if err := query.Count(&total).Error; err != nil {
+		return ret, 0, err
+	}
+	if err := query.Order("id DESC").Offset(offset).Limit(limit).Find(&ret).Error; err != nil {
+		return ret, 0, err
+	}
+	return ret, total, nil
+}
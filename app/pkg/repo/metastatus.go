@@ -0,0 +1,108 @@
+package repo
+
+import (
+	"errors"
+	"github.com/qinguoyi/osproxy/app/models"
+	"github.com/qinguoyi/osproxy/app/pkg/utils"
+	"gorm.io/gorm"
+	"time"
+)
+
+// ErrStatusTransition 状态流转不合法或状态已被并发修改
+var ErrStatusTransition = errors.New("文件状态流转不合法")
+
+// metaStatusTransitions 文件状态流转规则
+var metaStatusTransitions = map[int][]int{
+	utils.MetaStatusPending: {utils.MetaStatusReceiving, utils.MetaStatusAvailable, utils.MetaStatusQuarantined,
+		utils.MetaStatusExpired},
+	utils.MetaStatusReceiving: {utils.MetaStatusMerging, utils.MetaStatusPending, utils.MetaStatusExpired},
+	utils.MetaStatusMerging:   {utils.MetaStatusAvailable, utils.MetaStatusQuarantined, utils.MetaStatusFailed},
+	utils.MetaStatusFailed: {utils.MetaStatusMerging, utils.MetaStatusPending, utils.MetaStatusExpired,
+		utils.MetaStatusDeleted},
+	utils.MetaStatusQuarantined: {utils.MetaStatusAvailable, utils.MetaStatusInfected, utils.MetaStatusDeleted},
+	utils.MetaStatusAvailable:   {utils.MetaStatusDeleted},
+	utils.MetaStatusInfected:    {utils.MetaStatusDeleted},
+	utils.MetaStatusExpired:     {utils.MetaStatusDeleted},
+}
+
+var metaStatusNames = map[int]string{
+	utils.MetaStatusPending:     utils.UploadStatePending,
+	utils.MetaStatusReceiving:   utils.UploadStateReceiving,
+	utils.MetaStatusMerging:     utils.UploadStateMerging,
+	utils.MetaStatusAvailable:   utils.UploadStateAvailable,
+	utils.MetaStatusFailed:      utils.UploadStateFailed,
+	utils.MetaStatusExpired:     utils.UploadStateExpired,
+	utils.MetaStatusDeleted:     utils.UploadStateDeleted,
+	utils.MetaStatusQuarantined: utils.UploadStateQuarantined,
+	utils.MetaStatusInfected:    utils.UploadStateInfected,
+}
+
+// CanTransition 判断状态能否流转
+func CanTransition(from, to int) bool {
+	for _, status := range metaStatusTransitions[from] {
+		if status == to {
+			return true
+		}
+	}
+	return false
+}
+
+// MetaStatusName 状态名称
+func MetaStatusName(status int) string {
+	return metaStatusNames[status]
+}
+
+// IsDownloadable 已上传的文件可下载；未启用扫描时，合并中的文件也可按分片读取
+func IsDownloadable(status int, scanEnabled bool) bool {
+	return status == utils.MetaStatusAvailable || (status == utils.MetaStatusMerging && !scanEnabled)
+}
+
+// Transition 校验并流转文件状态，同时更新columns并记录流转历史
+func (r *metaDataInfoRepo) Transition(db *gorm.DB, uid int64, to int, columns map[string]interface{}) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		meta, err := r.GetByUid(tx, uid)
+		if err != nil {
+			return err
+		}
+		if !CanTransition(meta.Status, to) {
+			return ErrStatusTransition
+		}
+		now := time.Now()
+		updates := map[string]interface{}{
+			"updated_at": &now,
+		}
+		for k, v := range columns {
+			updates[k] = v
+		}
+		updates["status"] = to
+		if meta.Reserved > 0 && (to == utils.MetaStatusExpired || to == utils.MetaStatusDeleted) {
+			updates["reserved"] = 0
+		}
+		// 按原状态更新，避免并发流转
+		ret := tx.Model(&models.MetaDataInfo{}).Where("uid = ? and status = ?", uid, meta.Status).Updates(updates)
+		if ret.Error != nil {
+			return ret.Error
+		}
+		if ret.RowsAffected == 0 {
+			return ErrStatusTransition
+		}
+		if err := NewTenantUsageRepo().adjustUsage(tx, meta, to); err != nil {
+			return err
+		}
+		return tx.Create(&models.MetaStatusHistory{
+			UID:        uid,
+			FromStatus: meta.Status,
+			ToStatus:   to,
+			CreatedAt:  &now,
+		}).Error
+	})
+}
+
+// GetStatusHistory 获取文件状态流转记录
+func (r *metaDataInfoRepo) GetStatusHistory(db *gorm.DB, uid int64) ([]models.MetaStatusHistory, error) {
+	var ret []models.MetaStatusHistory
+	if err := db.Where("uid = ?", uid).Order("id ASC").Find(&ret).Error; err != nil {
+		return ret, err
+	}
+	return ret, nil
+}
@@ -2,6 +2,7 @@ package repo
 
 import (
 	"github.com/qinguoyi/osproxy/app/models"
+	"github.com/qinguoyi/osproxy/app/pkg/utils"
 	"gorm.io/gorm"
 )
 
@@ -33,6 +34,16 @@ func (r *multiPartInfoRepo) GetPartNumByUid(db *gorm.DB, uid int64) ([]models.Mu
 	return ret, nil
 }
 
+// GetValidByUid 获取有效的分片信息，按分片序号排序
+func (r *multiPartInfoRepo) GetValidByUid(db *gorm.DB, uid int64) ([]models.MultiPartInfo, error) {
+	var ret []models.MultiPartInfo
+	if err := db.Model(&models.MultiPartInfo{}).Where("storage_uid = ? and status = ?", uid, 1).
+		Order("chunk_num ASC").Find(&ret).Error; err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
 // GetPartInfo .
 func (r *multiPartInfoRepo) GetPartInfo(db *gorm.DB, uid, num int64, md5 string) ([]models.MultiPartInfo, error) {
 	var ret []models.MultiPartInfo
@@ -61,3 +72,36 @@ func (r *multiPartInfoRepo) BatchCreate(db *gorm.DB, m *[]models.MultiPartInfo)
 	err := db.Create(m).Error
 	return err
 }
+
+// GetByChunkNum 获取指定序号的有效分片
+func (r *multiPartInfoRepo) GetByChunkNum(db *gorm.DB, uid, num int64) ([]models.MultiPartInfo, error) {
+	var ret []models.MultiPartInfo
+	if err := db.Model(&models.MultiPartInfo{}).Where(
+		"storage_uid = ? and chunk_num = ? and status = 1", uid, num,
+	).Find(&ret).Error; err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+// SumSizeByUid 统计文件已上传分片的大小
+func (r *multiPartInfoRepo) SumSizeByUid(db *gorm.DB, uid int64) (int64, error) {
+	var size int64
+	if err := db.Model(&models.MultiPartInfo{}).Select("coalesce(sum(storage_size), 0)").
+		Where("storage_uid = ? and status = 1", uid).Scan(&size).Error; err != nil {
+		return 0, err
+	}
+	return size, nil
+}
+
+// SumSizeByBatch 统计批次内分片上传中文件的已上传分片大小
+func (r *multiPartInfoRepo) SumSizeByBatch(db *gorm.DB, batchUid int64) (int64, error) {
+	var size int64
+	receiving := db.Session(&gorm.Session{NewDB: true}).Model(&models.MetaDataInfo{}).Select("uid").
+		Where("batch_uid = ? and status = ?", batchUid, utils.MetaStatusReceiving)
+	if err := db.Model(&models.MultiPartInfo{}).Select("coalesce(sum(storage_size), 0)").
+		Where("status = 1 and storage_uid in (?)", receiving).Scan(&size).Error; err != nil {
+		return 0, err
+	}
+	return size, nil
+}
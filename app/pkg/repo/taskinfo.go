@@ -88,3 +88,25 @@ func (r *taskInfoRepo) UpdateColumn(db *gorm.DB, commentID int64, name string, v
 	err := db.Model(&models.TaskInfo{}).Where("id = ?", commentID).UpdateColumn(name, value).Error
 	return err
 }
+
+// GetLatestByStorageUid 获取文件最近一次的指定类型任务
+func (r *taskInfoRepo) GetLatestByStorageUid(db *gorm.DB, uid int64, taskType string) (*models.TaskInfo, error) {
+	ret := &models.TaskInfo{}
+	if err := db.Where("storage_uid = ? and task_type = ?", uid, taskType).Order("id DESC").
+		First(ret).Error; err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+// CountUnfinishedByBatch 统计批次内文件未执行完的指定类型任务数量，失败重试的任务会重置为未执行
+func (r *taskInfoRepo) CountUnfinishedByBatch(db *gorm.DB, batchUid int64, taskType string) (int64, error) {
+	var count int64
+	files := db.Session(&gorm.Session{NewDB: true}).Model(&models.MetaDataInfo{}).Select("uid").
+		Where("batch_uid = ? and compress_uid = 0", batchUid)
+	if err := db.Model(&models.TaskInfo{}).Where("task_type = ? and status in ? and storage_uid in (?)", taskType,
+		[]int{utils.TaskStatusUndo, utils.TaskStatusRunning}, files).Count(&count).Error; err != nil {
+		return 0, err
+	}
+	return count, nil
+}
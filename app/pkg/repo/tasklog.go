@@ -31,3 +31,11 @@ func (r *taskLogRepo) GetByTaskID(db *gorm.DB, TaskID int64) (*models.TaskLog, e
 	}
 	return ret, nil
 }
+
+func (r *taskLogRepo) GetByID(db *gorm.DB, logID int64) (*models.TaskLog, error) {
+	ret := &models.TaskLog{}
+	if err := db.Where("id = ?", logID).First(ret).Error; err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
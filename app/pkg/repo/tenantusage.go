@@ -0,0 +1,133 @@
+package repo
+
+import (
+	"errors"
+	"github.com/qinguoyi/osproxy/app/models"
+	"github.com/qinguoyi/osproxy/app/pkg/utils"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type tenantUsageRepo struct{}
+
+func NewTenantUsageRepo() *tenantUsageRepo { return &tenantUsageRepo{} }
+
+// GetByTenant 获取租户用量，没有记录时返回零值
+func (r *tenantUsageRepo) GetByTenant(db *gorm.DB, tenant string) (*models.TenantUsage, error) {
+	ret := &models.TenantUsage{Tenant: tenant}
+	if err := db.Where("tenant = ?", tenant).First(ret).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ret, nil
+		}
+		return nil, err
+	}
+	return ret, nil
+}
+
+// Add 累加租户用量，记录不存在时创建
+func (r *tenantUsageRepo) Add(db *gorm.DB, tenant string, bytes, files int64) error {
+	now := time.Now()
+	return db.Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "tenant"}},
+		DoUpdates: clause.Assignments(map[string]interface{}{
+			"bytes":      gorm.Expr("tenant_usage.bytes + ?", bytes),
+			"files":      gorm.Expr("tenant_usage.files + ?", files),
+			"updated_at": &now,
+		}),
+	}).Create(&models.TenantUsage{
+		Tenant:    tenant,
+		Bytes:     bytes,
+		Files:     files,
+		CreatedAt: &now,
+		UpdatedAt: &now,
+	}).Error
+}
+
+// Reserve 预留容量，已用及已预留的容量加上size不超过maxBytes时成功
+func (r *tenantUsageRepo) Reserve(db *gorm.DB, tenant string, size, maxBytes int64) (bool, error) {
+	now := time.Now()
+	if err := db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "tenant"}},
+		DoNothing: true,
+	}).Create(&models.TenantUsage{Tenant: tenant, CreatedAt: &now, UpdatedAt: &now}).Error; err != nil {
+		return false, err
+	}
+	ret := db.Model(&models.TenantUsage{}).Where("tenant = ? and bytes + reserved + ? <= ?", tenant, size, maxBytes).
+		Updates(map[string]interface{}{
+			"reserved":   gorm.Expr("reserved + ?", size),
+			"updated_at": &now,
+		})
+	if ret.Error != nil {
+		return false, ret.Error
+	}
+	return ret.RowsAffected == 1, nil
+}
+
+// Release 释放预留的容量
+func (r *tenantUsageRepo) Release(db *gorm.DB, tenant string, size int64) error {
+	now := time.Now()
+	return db.Model(&models.TenantUsage{}).Where("tenant = ?", tenant).Updates(map[string]interface{}{
+		"reserved":   gorm.Expr("CASE WHEN reserved > ? THEN reserved - ? ELSE 0 END", size, size),
+		"updated_at": &now,
+	}).Error
+}
+
+// ReleaseByUid 释放文件预留的容量，并发调用时只释放一次
+func (r *tenantUsageRepo) ReleaseByUid(db *gorm.DB, uid int64) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		var meta models.MetaDataInfo
+		if err := tx.Select("uid", "tenant", "reserved").Where("uid = ?", uid).First(&meta).Error; err != nil {
+			return err
+		}
+		if meta.Reserved <= 0 {
+			return nil
+		}
+		ret := tx.Model(&models.MetaDataInfo{}).Where("uid = ? and reserved = ?", uid, meta.Reserved).
+			Update("reserved", 0)
+		if ret.Error != nil || ret.RowsAffected == 0 {
+			return ret.Error
+		}
+		return r.Release(tx, meta.Tenant, meta.Reserved)
+	})
+}
+
+// OwnsObject 存储对象是否由当前文件上传，秒传的文件共用其他文件的存储对象
+func OwnsObject(meta *models.MetaDataInfo) bool {
+	uidStr := strconv.FormatInt(meta.UID, 10)
+	return meta.StorageName == uidStr || strings.HasPrefix(meta.StorageName, uidStr+".")
+}
+
+// usageCounted 已计入租户用量的状态，上传完成时计入
+func usageCounted(status int) bool {
+	return status == utils.MetaStatusAvailable || status == utils.MetaStatusQuarantined
+}
+
+// adjustUsage 状态流转时调整租户用量：离开已计入用量的状态时扣减，会话过期或删除时释放预留的容量
+func (r *tenantUsageRepo) adjustUsage(db *gorm.DB, meta *models.MetaDataInfo, to int) error {
+	if usageCounted(meta.Status) && !usageCounted(to) {
+		var size int64
+		if OwnsObject(meta) {
+			size = meta.StorageSize
+		}
+		if err := r.Add(db, meta.Tenant, -size, -1); err != nil {
+			return err
+		}
+	}
+	if meta.Reserved > 0 && (to == utils.MetaStatusExpired || to == utils.MetaStatusDeleted) {
+		return r.Release(db, meta.Tenant, meta.Reserved)
+	}
+	return nil
+}
+
+// SetWarned 更新告警标记，返回是否由当前调用更新，避免重复告警
+func (r *tenantUsageRepo) SetWarned(db *gorm.DB, tenant string, warned bool) (bool, error) {
+	ret := db.Model(&models.TenantUsage{}).Where("tenant = ? and warned = ?", tenant, !warned).
+		Update("warned", warned)
+	if ret.Error != nil {
+		return false, ret.Error
+	}
+	return ret.RowsAffected == 1, nil
+}
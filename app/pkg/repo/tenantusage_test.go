@@ -0,0 +1,19 @@
+package repo
+
+import (
+	"github.com/qinguoyi/osproxy/app/models"
+	"testing"
+)
+
+func TestOwnsObject(t *testing.T) {
+	if !OwnsObject(&models.MetaDataInfo{UID: 123, StorageName: "123.jpg"}) {
+		t.Fatal("expect own object")
+	}
+	if !OwnsObject(&models.MetaDataInfo{UID: 123, StorageName: "123"}) {
+		t.Fatal("expect own object")
+	}
+	// 秒传复制的元数据指向其他文件的存储对象
+	if OwnsObject(&models.MetaDataInfo{UID: 123, StorageName: "1234.jpg"}) {
+		t.Fatal("expect shared object")
+	}
+}
@@ -0,0 +1,76 @@
+package repo
+
+import (
+	"github.com/qinguoyi/osproxy/app/models"
+	"github.com/qinguoyi/osproxy/app/pkg/utils"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"time"
+)
+
+type uploadBatchRepo struct{}
+
+func NewUploadBatchRepo() *uploadBatchRepo { return &uploadBatchRepo{} }
+
+// Create .
+func (r *uploadBatchRepo) Create(db *gorm.DB, m *models.UploadBatch) error {
+	err := db.Create(m).Error
+	return err
+}
+
+// GetByBatchUid .
+func (r *uploadBatchRepo) GetByBatchUid(db *gorm.DB, batchUid int64) (*models.UploadBatch, error) {
+	ret := &models.UploadBatch{}
+	if err := db.Where("batch_uid = ?", batchUid).First(ret).Error; err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+// LockByBatchUid 事务内加行锁获取批次，保证生成链接和提交互斥
+func (r *uploadBatchRepo) LockByBatchUid(tx *gorm.DB, batchUid int64) (*models.UploadBatch, error) {
+	ret := &models.UploadBatch{}
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("batch_uid = ?", batchUid).
+		First(ret).Error; err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+// Commit 提交批次，返回更新的数量
+func (r *uploadBatchRepo) Commit(db *gorm.DB, batchUid int64) int64 {
+	now := time.Now()
+	ret := db.Model(&models.UploadBatch{}).Where("batch_uid = ? and status = ?", batchUid, utils.BatchStatusOpen).
+		Updates(map[string]interface{}{
+			"status":       utils.BatchStatusCommitted,
+			"committed_at": &now,
+			"updated_at":   &now,
+		})
+	return ret.RowsAffected
+}
+
+// GetCommitted 获取已提交的批次
+func (r *uploadBatchRepo) GetCommitted(db *gorm.DB, batchUid []int64) (map[int64]bool, error) {
+	ret := map[int64]bool{}
+	if len(batchUid) == 0 {
+		return ret, nil
+	}
+	var batchList []models.UploadBatch
+	if err := db.Where("batch_uid in ? and status = ?", batchUid, utils.BatchStatusCommitted).
+		Find(&batchList).Error; err != nil {
+		return ret, err
+	}
+	for _, batch := range batchList {
+		ret[batch.BatchUid] = true
+	}
+	return ret, nil
+}
+
+// IsVisible 不属于批次或批次已提交的文件可见
+func (r *uploadBatchRepo) IsVisible(db *gorm.DB, batchUid int64) bool {
+	if batchUid == 0 {
+		return true
+	}
+	committed, err := r.GetCommitted(db, []int64{batchUid})
+	return err == nil && committed[batchUid]
+}
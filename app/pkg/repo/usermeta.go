@@ -0,0 +1,74 @@
+package repo
+
+import (
+	"github.com/qinguoyi/osproxy/app/models"
+	"gorm.io/gorm"
+)
+
+type userMetaRepo struct{}
+
+func NewUserMetaRepo() *userMetaRepo { return &userMetaRepo{} }
+
+// BatchCreate 批量创建元数据及标签
+func (r *userMetaRepo) BatchCreate(db *gorm.DB, metadata []models.FileMetadata, tags []models.FileTag) error {
+	if len(metadata) != 0 {
+		if err := db.Create(&metadata).Error; err != nil {
+			return err
+		}
+	}
+	if len(tags) != 0 {
+		if err := db.Create(&tags).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ReplaceMetadata 整体替换文件的元数据
+func (r *userMetaRepo) ReplaceMetadata(db *gorm.DB, uid int64, metadata []models.FileMetadata) error {
+	if err := db.Where("uid = ?", uid).Delete(&models.FileMetadata{}).Error; err != nil {
+		return err
+	}
+	return r.BatchCreate(db, metadata, nil)
+}
+
+// ReplaceTags 整体替换文件的标签
+func (r *userMetaRepo) ReplaceTags(db *gorm.DB, uid int64, tags []models.FileTag) error {
+	if err := db.Where("uid = ?", uid).Delete(&models.FileTag{}).Error; err != nil {
+		return err
+	}
+	return r.BatchCreate(db, nil, tags)
+}
+
+// GetMetadataByUidList .
+func (r *userMetaRepo) GetMetadataByUidList(db *gorm.DB, uid []int64) ([]models.FileMetadata, error) {
+	var ret []models.FileMetadata
+	if err := db.Where("uid in ?", uid).Order("id ASC").Find(&ret).Error; err != nil {
+		return ret, err
+	}
+	return ret, nil
+}
+
+// GetTagsByUidList .
+func (r *userMetaRepo) GetTagsByUidList(db *gorm.DB, uid []int64) ([]models.FileTag, error) {
+	var ret []models.FileTag
+	if err := db.Where("uid in ?", uid).Order("id ASC").Find(&ret).Error; err != nil {
+		return ret, err
+	}
+	return ret, nil
+}
+
+// Filter 按标签及元数据过滤文件，多个条件之间为且的关系
+func (r *userMetaRepo) Filter(db *gorm.DB, query *gorm.DB, tags []string, metadata map[string]string) *gorm.DB {
+	for _, tag := range tags {
+		sub := db.Session(&gorm.Session{NewDB: true}).Model(&models.FileTag{}).Select("uid").
+			Where("tag = ?", tag)
+		query = query.Where("uid in (?)", sub)
+	}
+	for key, value := range metadata {
+		sub := db.Session(&gorm.Session{NewDB: true}).Model(&models.FileMetadata{}).Select("uid").
+			Where("meta_key = ? and meta_value = ?", key, value)
+		query = query.Where("uid in (?)", sub)
+	}
+	return query
+}
@@ -0,0 +1,34 @@
+package repo
+
+import (
+	"github.com/qinguoyi/osproxy/app/models"
+	"gorm.io/gorm"
+)
+
+type webhookLogRepo struct{}
+
+func NewWebhookLogRepo() *webhookLogRepo { return &webhookLogRepo{} }
+
+// Create .
+func (r *webhookLogRepo) Create(db *gorm.DB, m *models.WebhookLog) error {
+	err := db.Create(m).Error
+	return err
+}
+
+// GetLatestByTaskID 获取任务最近一次投递记录
+func (r *webhookLogRepo) GetLatestByTaskID(db *gorm.DB, taskID int64) (*models.WebhookLog, error) {
+	ret := &models.WebhookLog{}
+	if err := db.Where("task_id = ?", taskID).Order("id DESC").First(ret).Error; err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+// CountByTaskID .
+func (r *webhookLogRepo) CountByTaskID(db *gorm.DB, taskID int64) (int64, error) {
+	var count int64
+	if err := db.Model(&models.WebhookLog{}).Where("task_id = ?", taskID).Count(&count).Error; err != nil {
+		return 0, err
+	}
+	return count, nil
+}
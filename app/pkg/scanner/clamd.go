@@ -0,0 +1,108 @@
+package scanner
+
+/*
+ClamAV clamd扫描，使用INSTREAM命令按块发送数据
+*/
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"time"
+)
+
+const clamdChunkSize = 64 * 1024
+
+// ClamdScanner clamd扫描器，支持unix socket及tcp
+type ClamdScanner struct {
+	network string
+	address string
+	timeout time.Duration
+}
+
+// NewClamdScanner .
+func NewClamdScanner(network, address string, timeout time.Duration) *ClamdScanner {
+	if network == "" {
+		network = "tcp"
+	}
+	return &ClamdScanner{
+		network: network,
+		address: address,
+		timeout: timeout,
+	}
+}
+
+// Scan 发送 zINSTREAM，数据块格式为4字节大端长度+数据，长度为0表示结束
+func (s *ClamdScanner) Scan(ctx context.Context, r io.Reader) (*Result, error) {
+	if s.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.timeout)
+		defer cancel()
+	}
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, s.network, s.address)
+	if err != nil {
+		return nil, fmt.Errorf("连接clamd失败，详情%s", err.Error())
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+
+	if _, err := conn.Write([]byte("zINSTREAM\x00")); err != nil {
+		return nil, err
+	}
+	buf := make([]byte, clamdChunkSize)
+	size := make([]byte, 4)
+	for {
+		n, err := r.Read(buf)
+		if n > 0 {
+			binary.BigEndian.PutUint32(size, uint32(n))
+			if _, err := conn.Write(size); err != nil {
+				return nil, err
+			}
+			if _, err := conn.Write(buf[:n]); err != nil {
+				return nil, err
+			}
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	binary.BigEndian.PutUint32(size, 0)
+	if _, err := conn.Write(size); err != nil {
+		return nil, err
+	}
+
+	reply, err := bufio.NewReader(conn).ReadString('\x00')
+	if err != nil && reply == "" {
+		return nil, fmt.Errorf("读取clamd响应失败，详情%s", err.Error())
+	}
+	return parseClamdReply(reply)
+}
+
+// parseClamdReply 解析响应，如 "stream: OK"、"stream: Eicar-Signature FOUND"
+func parseClamdReply(reply string) (*Result, error) {
+	reply = strings.TrimSpace(strings.TrimRight(reply, "\x00"))
+	idx := strings.Index(reply, ": ")
+	if idx < 0 {
+		return nil, errors.New(fmt.Sprintf("clamd响应有误:%s", reply))
+	}
+	status := reply[idx+2:]
+	switch {
+	case status == "OK":
+		return &Result{Clean: true}, nil
+	case strings.HasSuffix(status, " FOUND"):
+		return &Result{Signature: strings.TrimSuffix(status, " FOUND")}, nil
+	default:
+		return nil, errors.New(fmt.Sprintf("clamd扫描失败:%s", reply))
+	}
+}
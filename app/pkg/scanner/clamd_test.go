@@ -0,0 +1,109 @@
+package scanner
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"io"
+	"net"
+	"path"
+	"strings"
+	"testing"
+	"time"
+)
+
+const eicar = `X5O!P%@AP[4\PZX54(P^)7CC)7}$EICAR-STANDARD-ANTIVIRUS-TEST-FILE!$H+H*`
+
+// stubClamd 模拟clamd的INSTREAM处理，数据包含EICAR时返回FOUND
+func stubClamd(t *testing.T, network, address string) net.Listener {
+	ln, err := net.Listen(network, address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func(conn net.Conn) {
+				defer conn.Close()
+				r := bufio.NewReader(conn)
+				cmd, err := r.ReadString('\x00')
+				if err != nil || cmd != "zINSTREAM\x00" {
+					_, _ = conn.Write([]byte("UNKNOWN COMMAND\x00"))
+					return
+				}
+				var data bytes.Buffer
+				size := make([]byte, 4)
+				for {
+					if _, err := io.ReadFull(r, size); err != nil {
+						return
+					}
+					n := binary.BigEndian.Uint32(size)
+					if n == 0 {
+						break
+					}
+					if _, err := io.CopyN(&data, r, int64(n)); err != nil {
+						return
+					}
+				}
+				if strings.Contains(data.String(), eicar) {
+					_, _ = conn.Write([]byte("stream: Eicar-Test-Signature FOUND\x00"))
+					return
+				}
+				_, _ = conn.Write([]byte("stream: OK\x00"))
+			}(conn)
+		}
+	}()
+	return ln
+}
+
+func TestClamdScanner(t *testing.T) {
+	ln := stubClamd(t, "tcp", "127.0.0.1:0")
+	defer ln.Close()
+	s := NewClamdScanner("tcp", ln.Addr().String(), 5*time.Second)
+
+	// 超过单块大小，验证分块发送
+	clean := bytes.Repeat([]byte("a"), clamdChunkSize*2+100)
+	ret, err := s.Scan(context.Background(), bytes.NewReader(clean))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ret.Clean {
+		t.Fatalf("expect clean, got %+v", ret)
+	}
+
+	infected := append(bytes.Repeat([]byte("b"), clamdChunkSize-10), []byte(eicar)...)
+	ret, err = s.Scan(context.Background(), bytes.NewReader(infected))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ret.Clean || ret.Signature != "Eicar-Test-Signature" {
+		t.Fatalf("expect infected, got %+v", ret)
+	}
+}
+
+func TestClamdScannerUnix(t *testing.T) {
+	ln := stubClamd(t, "unix", path.Join(t.TempDir(), "clamd.sock"))
+	defer ln.Close()
+	s := NewClamdScanner("unix", ln.Addr().String(), 5*time.Second)
+	ret, err := s.Scan(context.Background(), strings.NewReader(eicar))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ret.Clean {
+		t.Fatal("expect infected")
+	}
+}
+
+func TestParseClamdReply(t *testing.T) {
+	if _, err := parseClamdReply("INSTREAM size limit exceeded. ERROR\x00"); err == nil {
+		t.Fatal("expect error")
+	}
+	ret, err := parseClamdReply("stream: OK\x00")
+	if err != nil || !ret.Clean {
+		t.Fatalf("expect clean, got %+v %v", ret, err)
+	}
+}
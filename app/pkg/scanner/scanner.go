@@ -0,0 +1,28 @@
+package scanner
+
+import (
+	"context"
+	"github.com/qinguoyi/osproxy/config"
+	"io"
+	"time"
+)
+
+// Result 扫描结果
+type Result struct {
+	Clean     bool   // 是否未发现威胁
+	Signature string // 命中的病毒特征名称
+}
+
+// Scanner 文件扫描
+type Scanner interface {
+	// Scan 扫描数据流
+	Scan(context.Context, io.Reader) (*Result, error)
+}
+
+// NewScanner 根据配置创建扫描器，未启用时返回nil
+func NewScanner(conf config.Scan) Scanner {
+	if !conf.Enabled {
+		return nil
+	}
+	return NewClamdScanner(conf.Network, conf.Address, time.Duration(conf.Timeout)*time.Second)
+}
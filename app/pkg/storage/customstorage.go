@@ -3,6 +3,8 @@ package storage
 import (
 	"github.com/qinguoyi/osproxy/bootstrap"
 	"github.com/qinguoyi/osproxy/config"
+	"io"
+	"os"
 	"sync"
 )
 
@@ -57,6 +59,16 @@ func InitStorage(conf *config.Configuration) {
 			panic(err)
 		}
 	}
+	if conf.Image.Enabled && conf.Image.Bucket != "" {
+		if err := storageHandler.MakeBucket(conf.Image.Bucket); err != nil {
+			panic(err)
+		}
+	}
+	if conf.Scan.Enabled && conf.Scan.Quarantine != "" {
+		if err := storageHandler.MakeBucket(conf.Scan.Quarantine); err != nil {
+			panic(err)
+		}
+	}
 }
 
 func NewStorage() *LangGoStorage {
@@ -66,3 +78,88 @@ func NewStorage() *LangGoStorage {
 		return nil
 	}
 }
+
+// FGetObject 分块读取存储对象写入本地文件，避免整体读入内存
+func FGetObject(bucketName, objectName string, size int64, filePath string) error {
+	out, err := os.Create(filePath)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	step := int64(1 * 1024 * 1024)
+	for offset := int64(0); offset < size; {
+		length := step
+		if offset+length > size {
+			length = size - offset
+		}
+		data, err := NewStorage().Storage.GetObject(bucketName, objectName, offset, length)
+		if err != nil && err != io.EOF {
+			return err
+		}
+		// 部分存储单次读取可能不足length，按实际读取长度推进
+		if len(data) == 0 {
+			return io.ErrUnexpectedEOF
+		}
+		if _, err := out.Write(data); err != nil {
+			return err
+		}
+		offset += int64(len(data))
+	}
+	return nil
+}
+
+// ObjectReader 按需分块读取存储对象，实现io.ReaderAt，用于只需读取部分数据的场景
+type ObjectReader struct {
+	bucketName string
+	objectName string
+	size       int64
+	blockOff   int64
+	block      []byte
+}
+
+// NewObjectReader .
+func NewObjectReader(bucketName, objectName string, size int64) *ObjectReader {
+	return &ObjectReader{
+		bucketName: bucketName,
+		objectName: objectName,
+		size:       size,
+		blockOff:   -1,
+	}
+}
+
+// ReadAt 以64KB对齐分块读取，缓存最近读取的块
+func (r *ObjectReader) ReadAt(p []byte, off int64) (int, error) {
+	const blockSize = int64(64 * 1024)
+	n := 0
+	for n < len(p) {
+		pos := off + int64(n)
+		if pos >= r.size {
+			return n, io.EOF
+		}
+		blockOff := pos - pos%blockSize
+		if blockOff != r.blockOff {
+			length := blockSize
+			if blockOff+length > r.size {
+				length = r.size - blockOff
+			}
+			data, err := NewStorage().Storage.GetObject(r.bucketName, r.objectName, blockOff, length)
+			if err != nil && err != io.EOF {
+				return n, err
+			}
+			if int64(len(data)) > length {
+				data = data[:length]
+			}
+			if len(data) == 0 {
+				return n, io.ErrUnexpectedEOF
+			}
+			r.blockOff, r.block = blockOff, data
+		}
+		idx := pos - r.blockOff
+		if idx >= int64(len(r.block)) {
+			return n, io.ErrUnexpectedEOF
+		}
+		n += copy(p[n:], r.block[idx:])
+	}
+	return n, nil
+}
@@ -0,0 +1,237 @@
+package sweeper
+
+/*
+过期上传会话回收
+*/
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/qinguoyi/osproxy/app/models"
+	"github.com/qinguoyi/osproxy/app/pkg/base"
+	"github.com/qinguoyi/osproxy/app/pkg/repo"
+	"github.com/qinguoyi/osproxy/app/pkg/storage"
+	"github.com/qinguoyi/osproxy/app/pkg/utils"
+	"github.com/qinguoyi/osproxy/bootstrap"
+	"github.com/qinguoyi/osproxy/bootstrap/plugins"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+)
+
+type Sweeper struct {
+	Wg     *sync.WaitGroup
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// RunSweeper 启动回收，未启用时不执行
+func RunSweeper() *Sweeper {
+	ctx, cancel := context.WithCancel(context.Background())
+	s := &Sweeper{
+		Wg:     &sync.WaitGroup{},
+		ctx:    ctx,
+		cancel: cancel,
+	}
+	if !bootstrap.NewConfig("").Gc.Enabled {
+		return s
+	}
+	s.Wg.Add(1)
+	go s.run()
+	return s
+}
+
+// Stop 停止回收
+func (s *Sweeper) Stop() {
+	s.cancel()
+	s.Wg.Wait()
+}
+
+func (s *Sweeper) run() {
+	defer s.Wg.Done()
+	ip, err := base.GetOutBoundIP()
+	if err != nil {
+		panic(err)
+	}
+	timer := time.NewTimer(1 * time.Minute)
+	defer timer.Stop()
+	for {
+		select {
+		case <-timer.C:
+			report := Sweep(ip)
+			b, _ := json.Marshal(report)
+			new(plugins.LangGoRedis).NewRedis().HSet(context.Background(), utils.GcRedisReport, ip, b)
+			bootstrap.NewLogger().Logger.Info("回收过期上传会话", zap.Any("report", report))
+		case <-s.ctx.Done():
+			fmt.Println("过期会话回收终止...")
+			return
+		}
+		timer.Reset(interval())
+	}
+}
+
+func interval() time.Duration {
+	if i := bootstrap.NewConfig("").Gc.Interval; i > 0 {
+		return time.Duration(i) * time.Second
+	}
+	return 10 * time.Minute
+}
+
+// Sweep 执行一次回收：过期会话及对象存储中的分片由单个节点处理，本地目录每个节点各自清理
+func Sweep(ip string) *models.GcReport {
+	start := time.Now()
+	report := &models.GcReport{Node: ip, StartedAt: start.Unix()}
+	lgDB := new(plugins.LangGoDB).Use("default").NewDB()
+	lgRedis := new(plugins.LangGoRedis).NewRedis()
+
+	// 锁不主动释放，保证一个扫描周期内只有一个节点处理集群数据
+	ctx := context.Background()
+	lock := base.NewRedisLock(&ctx, lgRedis, utils.GcRedisLock)
+	lock.SetExpire(int(interval().Seconds()))
+	if flag, err := lock.Acquire(); err == nil && flag {
+		expireSessions(lgDB, report)
+		cleanDownloadLinks(lgDB, report)
+	}
+	cleanLocalDirs(lgDB, report)
+	report.Cost = time.Since(start).Milliseconds()
+	return report
+}
+
+func grace() time.Duration {
+	return time.Duration(bootstrap.NewConfig("").Gc.Grace) * time.Second
+}
+
+// expireSessions 标记过期会话（含合并失败未重试的会话）并删除对象存储中的分片，释放预留的配额
+func expireSessions(lgDB *gorm.DB, report *models.GcReport) {
+	batch := bootstrap.NewConfig("").Gc.Batch
+	if batch <= 0 {
+		batch = 500
+	}
+	sessions, err := repo.NewMetaDataInfoRepo().GetExpiredSessions(lgDB,
+		[]int{utils.MetaStatusPending, utils.MetaStatusReceiving, utils.MetaStatusFailed}, time.Now().Add(-grace()),
+		batch)
+	if err != nil {
+		bootstrap.NewLogger().Logger.Error("查询过期上传会话失败", zap.Any("err", err.Error()))
+		return
+	}
+	lgRedis := new(plugins.LangGoRedis).NewRedis()
+	sto := storage.NewStorage().Storage
+	for _, session := range sessions {
+		// 先标记过期，流转失败说明会话状态已变化，仍在使用
+		if err := repo.NewMetaDataInfoRepo().Transition(lgDB, session.UID, utils.MetaStatusExpired,
+			nil); err != nil {
+			continue
+		}
+		report.ExpiredSessions++
+
+		parts, err := repo.NewMultiPartInfoRepo().GetValidByUid(lgDB, session.UID)
+		if err != nil {
+			bootstrap.NewLogger().Logger.Error("查询过期会话分片失败", zap.Int64("uid", session.UID))
+			continue
+		}
+		for _, part := range parts {
+			if err := sto.DeleteObject(part.Bucket, part.StorageName); err != nil {
+				bootstrap.NewLogger().Logger.Error("删除过期会话分片失败", zap.Int64("uid", session.UID),
+					zap.String("part", part.StorageName))
+				continue
+			}
+			report.DeletedParts++
+			report.DeletedBytes += part.StorageSize
+		}
+		if len(parts) != 0 {
+			_ = repo.NewMultiPartInfoRepo().Updates(lgDB, session.UID, map[string]interface{}{
+				"status": -1,
+			})
+		}
+		lgRedis.Del(context.Background(), fmt.Sprintf("%d-meta", session.UID),
+			fmt.Sprintf("%d-multiPart", session.UID))
+		session.Status = utils.MetaStatusExpired
+		_ = base.NotifyEvent(lgDB, &session, utils.EventExpired)
+	}
+}
+
+// cleanDownloadLinks 删除过期的下载链接记录，过期链接签名校验不通过，不再需要计数及撤销
+func cleanDownloadLinks(lgDB *gorm.DB, report *models.GcReport) {
+	batch := bootstrap.NewConfig("").Gc.Batch
+	if batch <= 0 {
+		batch = 500
+	}
+	count, err := repo.NewDownloadLinkRepo().DeleteExpired(lgDB, time.Now().Add(-grace()), batch)
+	if err != nil {
+		bootstrap.NewLogger().Logger.Error("删除过期下载链接失败", zap.Any("err", err.Error()))
+		return
+	}
+	report.DeletedLinks = count
+}
+
+// cleanLocalDirs 删除本节点上已过期会话及无元数据的暂存目录
+func cleanLocalDirs(lgDB *gorm.DB, report *models.GcReport) {
+	entries, err := os.ReadDir(utils.LocalStore)
+	if err != nil {
+		return
+	}
+	var uidList []int64
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		// 暂存目录以uid命名，本地存储的桶目录跳过
+		if uid, err := strconv.ParseInt(entry.Name(), 10, 64); err == nil {
+			uidList = append(uidList, uid)
+		}
+	}
+
+	for i := 0; i < len(uidList); i += 500 {
+		end := i + 500
+		if end > len(uidList) {
+			end = len(uidList)
+		}
+		metaList, err := repo.NewMetaDataInfoRepo().GetByUidList(lgDB, uidList[i:end])
+		if err != nil {
+			bootstrap.NewLogger().Logger.Error("查询暂存目录元数据失败", zap.Any("err", err.Error()))
+			return
+		}
+		uidMapMeta := map[int64]models.MetaDataInfo{}
+		for _, meta := range metaList {
+			uidMapMeta[meta.UID] = meta
+		}
+		for _, uid := range uidList[i:end] {
+			dirName := path.Join(utils.LocalStore, strconv.FormatInt(uid, 10))
+			if meta, ok := uidMapMeta[uid]; ok {
+				if meta.Status != utils.MetaStatusExpired {
+					continue
+				}
+			} else {
+				// 没有元数据，可能是生成链接时落库失败，超过宽限时间后删除
+				dirInfo, err := os.Stat(dirName)
+				if err != nil || time.Since(dirInfo.ModTime()) < grace() {
+					continue
+				}
+			}
+			size := dirSize(dirName)
+			if err := os.RemoveAll(dirName); err != nil {
+				bootstrap.NewLogger().Logger.Error("删除暂存目录失败", zap.String("dir", dirName))
+				continue
+			}
+			report.DeletedDirs++
+			report.DeletedDirBytes += size
+		}
+	}
+}
+
+func dirSize(dirName string) int64 {
+	var size int64
+	_ = filepath.Walk(dirName, func(_ string, info os.FileInfo, err error) error {
+		if err == nil && !info.IsDir() {
+			size += info.Size()
+		}
+		return nil
+	})
+	return size
+}
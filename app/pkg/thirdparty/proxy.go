@@ -2,12 +2,14 @@ package thirdparty
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"github.com/gin-gonic/gin"
 	"github.com/qinguoyi/osproxy/app/pkg/base"
 	"io"
 	"mime/multipart"
 	"net/http"
+	"net/url"
 	"strings"
 )
 
@@ -43,9 +45,11 @@ func (s *storageService) UploadForward(c *gin.Context, scheme, ip, port, uid str
 	}
 	// 获取查询参数
 	queryParam := map[string]string{}
+	params := url.Values{}
 	query := c.Request.URL.Query()
 	for k, v := range query {
 		queryParam[k] = v[0]
+		params.Set(k, v[0])
 	}
 
 	form, err := c.MultipartForm()
@@ -100,9 +104,39 @@ func (s *storageService) UploadForward(c *gin.Context, scheme, ip, port, uid str
 		Method: "PUT",
 		Params: queryParam,
 	}
+	// 请求体已在当前节点限速读取，所在节点按签名头识别转发请求，不重复限速
+	forwardHeader := http.Header{}
+	base.SetForwardHeader(forwardHeader, fmt.Sprintf("%s?%s", urlStr, params.Encode()), c.ClientIP())
+	for key := range forwardHeader {
+		req.HeaderSet[key] = forwardHeader.Get(key)
+	}
 	return base.Ask(req)
 }
 
+// RangeUploadForward 转发断点续传请求，请求体流式转发，响应由调用方处理
+func (s *storageService) RangeUploadForward(c *gin.Context, scheme, ip, port string) (*http.Response, error) {
+	proxyUrl := fmt.Sprintf("%s://%s:%s%s", scheme, ip, port, c.Request.URL.RequestURI())
+	var body io.Reader = http.NoBody
+	if c.Request.Method == http.MethodPut {
+		body = c.Request.Body
+	}
+	request, err := http.NewRequestWithContext(c.Request.Context(), c.Request.Method, proxyUrl, body)
+	if err != nil {
+		return nil, err
+	}
+	if c.Request.Method == http.MethodPut {
+		request.ContentLength = c.Request.ContentLength
+	}
+	// 请求体已在当前节点限速，所在节点按签名头识别转发请求，不重复限速
+	base.SetForwardHeader(request.Header, c.Request.URL.RequestURI(), c.ClientIP())
+	for _, key := range []string{"Content-Range", "Content-Type"} {
+		if v := c.GetHeader(key); v != "" {
+			request.Header.Set(key, v)
+		}
+	}
+	return base.Client.Do(request)
+}
+
 // MergeForward .
 func (s *storageService) MergeForward(c *gin.Context, scheme, ip, port, uid string) (int, *base.Response, http.Header, error) {
 	urlStr := fmt.Sprintf("/api/storage/v0/upload/merge")
@@ -123,25 +157,35 @@ func (s *storageService) MergeForward(c *gin.Context, scheme, ip, port, uid stri
 	return base.Ask(req)
 }
 
-// DownloadForward .
-func (s *storageService) DownloadForward(c *gin.Context, scheme, ip, port string) (int, io.ReadCloser, http.Header, error) {
-	// 获取查询参数
-	queryParam := map[string]string{}
-	query := c.Request.URL.Query()
-	for k, v := range query {
-		queryParam[k] = v[0]
+// DownloadForward 转发下载请求，响应体由调用方流式写回，客户端断开时取消远端请求
+func (s *storageService) DownloadForward(c *gin.Context, scheme, ip, port string) (*http.Response, error) {
+	proxyUrl := fmt.Sprintf("%s://%s:%s%s", scheme, ip, port, c.Request.URL.RequestURI())
+	request, err := http.NewRequestWithContext(c.Request.Context(), c.Request.Method, proxyUrl, http.NoBody)
+	if err != nil {
+		return nil, err
 	}
-
-	newUrl := c.Request.URL.RequestURI()
-	proxyUrl := fmt.Sprintf("%s://%s:%s%s", scheme, ip, port, newUrl)
-
-	req := base.Request{
-		Url:       proxyUrl,
-		Body:      io.NopCloser(strings.NewReader("")),
-		HeaderSet: map[string]string{},
-		Method:    "GET",
-		Params:    queryParam,
+	// 链接绑定的客户端条件已在当前节点校验，所在节点按签名头获取原始客户端IP用于限速及统计
+	base.SetForwardHeader(request.Header, c.Request.URL.RequestURI(), c.ClientIP())
+	for _, key := range []string{"Range", "If-Range", "If-None-Match", "If-Modified-Since"} {
+		if v := c.GetHeader(key); v != "" {
+			request.Header.Set(key, v)
+		}
 	}
+	// 禁止透明解压，保证Content-Length及Range与所在节点一致
+	request.Header.Set("Accept-Encoding", "identity")
+	return base.StreamClient.Do(request)
+}
 
-	return base.AskFile(req)
+// DownloadObject 从所在节点下载完整文件，query为已签名的下载参数，用于打包下载读取其他节点的文件
+func (s *storageService) DownloadObject(ctx context.Context, scheme, ip, port, query string) (*http.Response, error) {
+	uri := fmt.Sprintf("/api/storage/v0/download?%s", query)
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, fmt.Sprintf("%s://%s:%s%s", scheme, ip, port, uri),
+		http.NoBody)
+	if err != nil {
+		return nil, err
+	}
+	// 节点内部读取，不带客户端IP，所在节点不计入下载统计
+	base.SetForwardHeader(request.Header, uri, "")
+	request.Header.Set("Accept-Encoding", "identity")
+	return base.StreamClient.Do(request)
 }
@@ -0,0 +1,66 @@
+package throttle
+
+import (
+	"context"
+	"fmt"
+	"github.com/go-redis/redis/v8"
+	"sync"
+	"time"
+)
+
+// reserveSize 每次从redis预留的字节数，减少redis访问次数
+const reserveSize = 256 * 1024
+
+// redisLimiter 基于redis按秒计数的集群限速，多个节点共享同一个key
+type redisLimiter struct {
+	mu             sync.Mutex
+	client         *redis.Client
+	key            string
+	bytesPerSecond int64
+	reserved       int64 // 本地已预留未使用的字节数
+}
+
+// NewRedisLimiter 集群限速，key相同的限速器共享每秒的额度
+func NewRedisLimiter(client *redis.Client, key string, bytesPerSecond int64) Limiter {
+	return &redisLimiter{client: client, key: key, bytesPerSecond: bytesPerSecond}
+}
+
+func (l *redisLimiter) WaitN(ctx context.Context, n int) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.reserved >= int64(n) {
+		l.reserved -= int64(n)
+		return nil
+	}
+	size := int64(reserveSize)
+	if size > l.bytesPerSecond {
+		size = l.bytesPerSecond
+	}
+	if size < int64(n) {
+		size = int64(n)
+	}
+	for {
+		now := time.Now()
+		key := fmt.Sprintf("%s:%d", l.key, now.Unix())
+		used, err := l.client.IncrBy(ctx, key, size).Result()
+		if err != nil {
+			// redis异常时不限速，避免影响传输
+			return nil
+		}
+		if used == size {
+			l.client.Expire(ctx, key, 2*time.Second)
+		}
+		// 当前秒的额度未用完，或额度小于单次申请时每秒至少放行一次
+		if used <= l.bytesPerSecond || used == size {
+			l.reserved += size - int64(n)
+			return nil
+		}
+		l.client.DecrBy(ctx, key, size)
+		wait := now.Truncate(time.Second).Add(time.Second).Sub(now)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(wait):
+		}
+	}
+}
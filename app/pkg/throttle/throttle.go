@@ -0,0 +1,96 @@
+package throttle
+
+import (
+	"context"
+	"golang.org/x/time/rate"
+	"io"
+)
+
+// chunkSize 单次申请的字节数，读写按该大小拆分
+const chunkSize = 32 * 1024
+
+// Limiter 限速器
+type Limiter interface {
+	// WaitN 阻塞直到允许传输n字节，n不超过chunkSize
+	WaitN(ctx context.Context, n int) error
+}
+
+// NewLocalLimiter 进程内令牌桶，bytesPerSecond为每秒字节数
+func NewLocalLimiter(bytesPerSecond int64) Limiter {
+	return rate.NewLimiter(rate.Limit(bytesPerSecond), chunkSize)
+}
+
+// waitAll 依次等待所有限速器
+func waitAll(ctx context.Context, limiters []Limiter, n int) error {
+	for _, l := range limiters {
+		if err := l.WaitN(ctx, n); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type writer struct {
+	ctx      context.Context
+	w        io.Writer
+	limiters []Limiter
+}
+
+// NewWriter 限速写入，limiters为空时直接返回w
+func NewWriter(ctx context.Context, w io.Writer, limiters ...Limiter) io.Writer {
+	if len(limiters) == 0 {
+		return w
+	}
+	return &writer{ctx: ctx, w: w, limiters: limiters}
+}
+
+func (t *writer) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		n := len(p)
+		if n > chunkSize {
+			n = chunkSize
+		}
+		if err := waitAll(t.ctx, t.limiters, n); err != nil {
+			return written, err
+		}
+		m, err := t.w.Write(p[:n])
+		written += m
+		if err != nil {
+			return written, err
+		}
+		p = p[n:]
+	}
+	return written, nil
+}
+
+type readCloser struct {
+	ctx      context.Context
+	r        io.ReadCloser
+	limiters []Limiter
+}
+
+// NewReadCloser 限速读取，limiters为空时直接返回r
+func NewReadCloser(ctx context.Context, r io.ReadCloser, limiters ...Limiter) io.ReadCloser {
+	if len(limiters) == 0 {
+		return r
+	}
+	return &readCloser{ctx: ctx, r: r, limiters: limiters}
+}
+
+func (t *readCloser) Read(p []byte) (int, error) {
+	if len(p) > chunkSize {
+		p = p[:chunkSize]
+	}
+	n, err := t.r.Read(p)
+	if n > 0 {
+		if werr := waitAll(t.ctx, t.limiters, n); werr != nil {
+			return n, werr
+		}
+	}
+	return n, err
+}
+
+func (t *readCloser) Close() error {
+	return t.r.Close()
+}
@@ -0,0 +1,46 @@
+package throttle
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"testing"
+	"time"
+)
+
+func TestWriterRate(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewWriter(context.Background(), &buf, NewLocalLimiter(256*1024))
+	data := bytes.Repeat([]byte("a"), 160*1024)
+	start := time.Now()
+	if n, err := w.Write(data); err != nil || n != len(data) {
+		t.Fatalf("unexpected write %d %v", n, err)
+	}
+	// 首个32KB为突发额度，剩余128KB需要约0.5s
+	if elapsed := time.Since(start); elapsed < 400*time.Millisecond {
+		t.Fatalf("write too fast %v", elapsed)
+	}
+	if !bytes.Equal(buf.Bytes(), data) {
+		t.Fatal("data mismatch")
+	}
+}
+
+func TestReaderCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	r := NewReadCloser(ctx, io.NopCloser(bytes.NewReader(make([]byte, 1024*1024))), NewLocalLimiter(32*1024))
+	buf := make([]byte, 64*1024)
+	if n, err := r.Read(buf); err != nil || n != chunkSize {
+		t.Fatalf("unexpected read %d %v", n, err)
+	}
+	cancel()
+	if _, err := r.Read(buf); err == nil {
+		t.Fatal("expect canceled")
+	}
+}
+
+func TestNoLimiter(t *testing.T) {
+	var buf bytes.Buffer
+	if NewWriter(context.Background(), &buf) != &buf {
+		t.Fatal("expect original writer")
+	}
+}
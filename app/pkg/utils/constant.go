@@ -10,14 +10,89 @@ const (
 	LocalStore            = "localstore"
 	ServiceRedisPrefix    = "service:proxy"
 	ServiceRedisTTl       = time.Second * 3 * 60
+	GcRedisLock           = "gc:sweeper:lock"
+	GcRedisReport         = "gc:sweeper:report"
 	S3StoragePutThreadNum = 10
 	MultiPartDownload     = 10
+	FetchLimit            = 50
+	HeaderAppKey          = "X-App-Key"
+	HeaderAppToken        = "X-App-Token"
+	HeaderAdminToken      = "X-Admin-Token"
+	ContextTenant         = "tenant" // 鉴权通过的应用标识
+	HeaderUploadOffset    = "Upload-Offset"
+	HeaderUploadLength    = "Upload-Length"
+	StatusWaitLimit       = 30
+	BatchLinkLimit        = 1000
+	FileListLimit         = 500
+	BundleFileLimit       = 1000
+	FormFieldsLimit       = 1024 * 1024 // 表单上传中文件以外字段的总大小上限
+)
+
+// 自定义元数据及标签限制
+const (
+	UserMetaCountLimit = 32      // 元数据键数量
+	UserMetaKeyLen     = 128     // 键长度
+	UserMetaValueLen   = 512     // 值长度
+	UserMetaSizeLimit  = 8 << 10 // 元数据及标签总大小
+	UserTagCountLimit  = 32      // 标签数量
+	UserTagLen         = 128     // 标签长度
 )
 
 // 任务类型
 const (
 	TaskPartMerge  = "partMerge"
 	TaskPartDelete = "partDelete"
+	TaskWebhook    = "webhook"
+	TaskFetch      = "fetch"
+	TaskArchive    = "archiveExpand"
+	TaskScan       = "scan"
+	TaskMedia      = "mediaExtract"
+	TaskThumbnail  = "thumbnail"
+)
+
+// 回调事件类型
+const (
+	EventUploaded    = "uploaded"
+	EventMerged      = "merged"
+	EventMergeFailed = "merge_failed"
+	EventReset       = "reset"
+	EventDeleted     = "deleted"
+	EventExpired     = "expired"
+	EventBatch       = "batch_committed"
+	EventInfected    = "infected"
+	EventQuota       = "quota_warning"
+)
+
+// 文件状态，流转规则见repo.CanTransition
+const (
+	MetaStatusPending     = -1 // 未上传
+	MetaStatusAvailable   = 1  // 已上传，可下载
+	MetaStatusExpired     = 2  // 上传会话已过期
+	MetaStatusReceiving   = 3  // 分片上传中
+	MetaStatusMerging     = 4  // 分片合并中
+	MetaStatusFailed      = 5  // 合并失败
+	MetaStatusDeleted     = 6  // 已删除
+	MetaStatusQuarantined = 7  // 待扫描，隔离不可下载
+	MetaStatusInfected    = 8  // 扫描发现病毒
+)
+
+// 上传会话状态
+const (
+	UploadStatePending     = "pending"     // 未上传
+	UploadStateReceiving   = "receiving"   // 分片上传中
+	UploadStateMerging     = "merging"     // 合并中
+	UploadStateAvailable   = "available"   // 可下载
+	UploadStateFailed      = "failed"      // 合并失败
+	UploadStateExpired     = "expired"     // 已过期
+	UploadStateDeleted     = "deleted"     // 已删除
+	UploadStateQuarantined = "quarantined" // 待扫描
+	UploadStateInfected    = "infected"    // 发现病毒
+)
+
+// 批次状态
+const (
+	BatchStatusOpen      = 0
+	BatchStatusCommitted = 1
 )
 
 // 任务状态
@@ -35,3 +110,58 @@ const (
 )
 
 const CompensationTotal = 5 // 补偿次数总量
+
+// 扫描结果
+const ScanResultClean = "clean"
+
+// 回调请求头
+const (
+	WebhookHeaderEvent     = "X-Osproxy-Event"
+	WebhookHeaderDelivery  = "X-Osproxy-Delivery"
+	WebhookHeaderTimestamp = "X-Osproxy-Timestamp"
+	WebhookHeaderSignature = "X-Osproxy-Signature"
+)
+
+// 节点间转发请求头，签名后由所在节点信任其中的原始客户端IP
+const (
+	ForwardHeaderClient    = "X-Osproxy-Forward-Client"
+	ForwardHeaderTimestamp = "X-Osproxy-Forward-Timestamp"
+	ForwardHeaderSignature = "X-Osproxy-Forward-Signature"
+)
+
+// 租户优先级
+const PriorityInternal = "internal" // 内部流量，不限速
+
+// 下载链接中参与签名的附加参数
+const (
+	LinkParamRate    = "rate"    // 链接限速(KB/s)
+	LinkParamId      = "lid"     // 链接ID
+	LinkParamTrack   = "lt"      // 链接信息已落库，校验下载次数及撤销
+	LinkParamIp      = "ip"      // 允许的客户端IP或网段，逗号分隔
+	LinkParamReferer = "referer" // 允许的来源域名，逗号分隔，*.开头匹配子域名
+	LinkParamHeader  = "header"  // 要求的请求头，格式Name:Value
+	LinkParamWidth   = "w"       // 图片处理：宽度
+	LinkParamHeight  = "h"       // 图片处理：高度
+	LinkParamFit     = "fit"     // 图片处理：缩放方式
+	LinkParamCrop    = "crop"    // 图片处理：裁剪区域x,y,w,h
+	LinkParamQuality = "q"       // 图片处理：jpeg质量
+	LinkParamFormat  = "fmt"     // 图片处理：输出格式
+)
+
+const (
+	ThrottleRedisPrefix     = "throttle:tenant"
+	DownloadLinkRedisPrefix = "download:link"
+)
+
+const (
+	AnalyticsRedisPending  = "download:stat:pending"  // 待写入数据库的统计
+	AnalyticsRedisFlushing = "download:stat:flushing" // 正在写入数据库的统计
+	AnalyticsRedisClients  = "download:stat:clients"  // 按小时去重的客户端
+	AnalyticsRedisLock     = "download:stat:lock"
+)
+
+// 下载统计的时间粒度
+const (
+	StatIntervalHour = "hour"
+	StatIntervalDay  = "day"
+)
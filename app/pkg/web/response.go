@@ -65,6 +65,24 @@ func UnAuthorization(c *gin.Context, msg string) {
 	})
 }
 
+// Forbidden 拒绝访问
+func Forbidden(c *gin.Context, msg string) {
+	c.JSON(http.StatusForbidden, Response{
+		0,
+		msg,
+		"",
+	})
+}
+
+// Conflict 资源状态冲突
+func Conflict(c *gin.Context, msg string) {
+	c.JSON(http.StatusConflict, Response{
+		0,
+		msg,
+		"",
+	})
+}
+
 // NotFoundResource 资源不存在
 func NotFoundResource(c *gin.Context, msg string) {
 	c.JSON(http.StatusNotFound, Response{
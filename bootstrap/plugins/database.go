@@ -231,6 +231,17 @@ func initMySqlTables(db *gorm.DB) {
 		models.MultiPartInfo{},
 		models.TaskInfo{},
 		models.TaskLog{},
+		models.WebhookLog{},
+		models.MetaStatusHistory{},
+		models.UploadBatch{},
+		models.TenantUsage{},
+		models.FileMetadata{},
+		models.FileTag{},
+		models.DownloadLink{},
+		models.DownloadBundle{},
+		models.ImageDerivative{},
+		models.DownloadStat{},
+		models.TenantDownloadStat{},
 	)
 	if err != nil {
 		bootstrap.NewLogger().Logger.Error("migrate table failed", zap.Any("err", err))
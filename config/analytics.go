@@ -0,0 +1,8 @@
+package config
+
+// Analytics 下载统计配置
+type Analytics struct {
+	Enabled       bool `mapstructure:"enabled" json:"enabled" yaml:"enabled"`                      // 是否启用
+	FlushInterval int  `mapstructure:"flush_interval" json:"flush_interval" yaml:"flush_interval"` // 汇总写入数据库的间隔(s)
+	MaxRange      int  `mapstructure:"max_range" json:"max_range" yaml:"max_range"`                // 单次查询的最大时间范围(天)
+}
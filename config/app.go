@@ -6,4 +6,7 @@ type App struct {
 	Port    string `mapstructure:"port" json:"port" yaml:"port"`
 	AppName string `mapstructure:"app_name" json:"app_name" yaml:"app_name"`
 	AppUrl  string `mapstructure:"app_url" json:"app_url" yaml:"app_url"`
+
+	AdminToken     string   `mapstructure:"admin_token" json:"admin_token" yaml:"admin_token"`             // 管理接口令牌，请求头X-Admin-Token，为空时管理接口不可用
+	TrustedProxies []string `mapstructure:"trusted_proxies" json:"trusted_proxies" yaml:"trusted_proxies"` // 可信代理，来自其中的请求按X-Forwarded-For获取客户端IP，支持CIDR
 }
@@ -0,0 +1,9 @@
+package config
+
+// Archive 压缩包展开配置
+type Archive struct {
+	Enabled      bool  `mapstructure:"enabled" json:"enabled" yaml:"enabled"`                      // 是否启用
+	MaxEntries   int   `mapstructure:"max_entries" json:"max_entries" yaml:"max_entries"`          // 最大文件数量
+	MaxTotalSize int64 `mapstructure:"max_total_size" json:"max_total_size" yaml:"max_total_size"` // 解压后总大小上限(MB)
+	MaxRatio     int64 `mapstructure:"max_ratio" json:"max_ratio" yaml:"max_ratio"`                // 最大压缩比
+}
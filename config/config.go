@@ -4,12 +4,24 @@ import "github.com/qinguoyi/osproxy/config/plugins"
 
 // Configuration 配置文件中所有字段对应的结构体
 type Configuration struct {
-	App      App                 `mapstructure:"app" json:"app" yaml:"app"`
-	Log      Log                 `mapstructure:"log" json:"log" yaml:"log"`
-	Database []*plugins.Database `mapstructure:"database" json:"database" yaml:"database"`
-	Redis    *plugins.Redis      `mapstructure:"redis" json:"redis" yaml:"redis"`
-	Minio    *plugins.Minio      `mapstructure:"minio" json:"minio" yaml:"minio"`
-	Cos      *plugins.Cos        `mapstructure:"cos" json:"cos" yaml:"cos"`
-	Oss      *plugins.Oss        `mapstructure:"oss" json:"oss" yaml:"oss"`
-	Local    *plugins.Local      `mapstructure:"local" json:"local" yaml:"local"`
+	App       App                 `mapstructure:"app" json:"app" yaml:"app"`
+	Log       Log                 `mapstructure:"log" json:"log" yaml:"log"`
+	Database  []*plugins.Database `mapstructure:"database" json:"database" yaml:"database"`
+	Redis     *plugins.Redis      `mapstructure:"redis" json:"redis" yaml:"redis"`
+	Minio     *plugins.Minio      `mapstructure:"minio" json:"minio" yaml:"minio"`
+	Cos       *plugins.Cos        `mapstructure:"cos" json:"cos" yaml:"cos"`
+	Oss       *plugins.Oss        `mapstructure:"oss" json:"oss" yaml:"oss"`
+	Local     *plugins.Local      `mapstructure:"local" json:"local" yaml:"local"`
+	Webhook   Webhook             `mapstructure:"webhook" json:"webhook" yaml:"webhook"`
+	Fetch     Fetch               `mapstructure:"fetch" json:"fetch" yaml:"fetch"`
+	Archive   Archive             `mapstructure:"archive" json:"archive" yaml:"archive"`
+	Gc        Gc                  `mapstructure:"gc" json:"gc" yaml:"gc"`
+	Upload    Upload              `mapstructure:"upload" json:"upload" yaml:"upload"`
+	Scan      Scan                `mapstructure:"scan" json:"scan" yaml:"scan"`
+	Media     Media               `mapstructure:"media" json:"media" yaml:"media"`
+	Download  Download            `mapstructure:"download" json:"download" yaml:"download"`
+	Throttle  Throttle            `mapstructure:"throttle" json:"throttle" yaml:"throttle"`
+	Image     Image               `mapstructure:"image" json:"image" yaml:"image"`
+	Analytics Analytics           `mapstructure:"analytics" json:"analytics" yaml:"analytics"`
+	Tenants   []*Tenant           `mapstructure:"tenants" json:"tenants" yaml:"tenants"`
 }
@@ -0,0 +1,7 @@
+package config
+
+// Download 下载配置
+type Download struct {
+	CacheControl string            `mapstructure:"cache_control" json:"cache_control" yaml:"cache_control"` // 默认缓存策略，为空不返回Cache-Control
+	BucketCache  map[string]string `mapstructure:"bucket_cache" json:"bucket_cache" yaml:"bucket_cache"`    // 按桶设置的缓存策略，覆盖默认值
+}
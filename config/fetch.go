@@ -0,0 +1,8 @@
+package config
+
+// Fetch 服务端拉取远程文件配置
+type Fetch struct {
+	MaxSize      int64 `mapstructure:"max_size" json:"max_size" yaml:"max_size"`                // 单个文件大小上限(MB)
+	Timeout      int   `mapstructure:"timeout" json:"timeout" yaml:"timeout"`                   // 单个文件拉取超时时间(s)
+	MaxRedirects int   `mapstructure:"max_redirects" json:"max_redirects" yaml:"max_redirects"` // 最大重定向次数，0表示不允许重定向
+}
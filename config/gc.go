@@ -0,0 +1,9 @@
+package config
+
+// Gc 过期上传会话回收配置
+type Gc struct {
+	Enabled  bool `mapstructure:"enabled" json:"enabled" yaml:"enabled"`    // 是否启用
+	Interval int  `mapstructure:"interval" json:"interval" yaml:"interval"` // 扫描间隔(s)
+	Grace    int  `mapstructure:"grace" json:"grace" yaml:"grace"`          // 链接过期后的宽限时间(s)
+	Batch    int  `mapstructure:"batch" json:"batch" yaml:"batch"`          // 单次回收的会话数量
+}
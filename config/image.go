@@ -0,0 +1,21 @@
+package config
+
+// Image 下载时图片处理配置
+type Image struct {
+	Enabled   bool   `mapstructure:"enabled" json:"enabled" yaml:"enabled"`          // 是否支持下载时缩放、裁剪及格式转换
+	Bucket    string `mapstructure:"bucket" json:"bucket" yaml:"bucket"`             // 处理结果缓存的存储桶
+	MaxSource int64  `mapstructure:"max_source" json:"max_source" yaml:"max_source"` // 原图大小上限(MB)
+	MaxPixels int64  `mapstructure:"max_pixels" json:"max_pixels" yaml:"max_pixels"` // 原图像素上限(万)，防止解码占用过多内存
+	MaxSize   int    `mapstructure:"max_size" json:"max_size" yaml:"max_size"`       // 输出图片的最大宽高
+
+	Thumbnails []Thumbnail `mapstructure:"thumbnails" json:"thumbnails" yaml:"thumbnails"` // 上传完成后自动生成的缩略图
+}
+
+// Thumbnail 缩略图规格
+type Thumbnail struct {
+	Name   string `mapstructure:"name" json:"name" yaml:"name"`       // 名称，下载链接中按名称返回缩略图地址
+	Width  int    `mapstructure:"width" json:"width" yaml:"width"`    // 宽度
+	Height int    `mapstructure:"height" json:"height" yaml:"height"` // 高度
+	Fit    string `mapstructure:"fit" json:"fit" yaml:"fit"`          // 缩放方式contain、cover、fill
+	Format string `mapstructure:"format" json:"format" yaml:"format"` // 输出格式，为空时与原图一致
+}
@@ -0,0 +1,6 @@
+package config
+
+// Media 媒体元数据解析配置
+type Media struct {
+	Enabled bool `mapstructure:"enabled" json:"enabled" yaml:"enabled"` // 是否解析图片、视频及音频的元数据
+}
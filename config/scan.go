@@ -0,0 +1,10 @@
+package config
+
+// Scan 上传文件病毒扫描配置
+type Scan struct {
+	Enabled    bool   `mapstructure:"enabled" json:"enabled" yaml:"enabled"`          // 是否启用
+	Network    string `mapstructure:"network" json:"network" yaml:"network"`          // clamd连接方式，unix或tcp
+	Address    string `mapstructure:"address" json:"address" yaml:"address"`          // clamd地址，unix socket路径或host:port
+	Timeout    int    `mapstructure:"timeout" json:"timeout" yaml:"timeout"`          // 单个文件扫描超时(s)
+	Quarantine string `mapstructure:"quarantine" json:"quarantine" yaml:"quarantine"` // 隔离桶
+}
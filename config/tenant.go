@@ -0,0 +1,13 @@
+package config
+
+// Tenant 租户(应用)配置，通过请求头中的应用标识区分
+type Tenant struct {
+	AppKey    string `mapstructure:"app_key" json:"app_key" yaml:"app_key"`          // 应用标识
+	Token     string `mapstructure:"token" json:"token" yaml:"token"`                // 接口令牌，请求头X-App-Token，为空时该应用无法调用接口
+	Callback  string `mapstructure:"callback" json:"callback" yaml:"callback"`       // 默认回调地址
+	Secret    string `mapstructure:"secret" json:"secret" yaml:"secret"`             // 回调签名密钥
+	MaxBytes  int64  `mapstructure:"max_bytes" json:"max_bytes" yaml:"max_bytes"`    // 存储容量上限(MB)，0表示不限制
+	MaxFiles  int64  `mapstructure:"max_files" json:"max_files" yaml:"max_files"`    // 文件数量上限，0表示不限制
+	SoftLimit int    `mapstructure:"soft_limit" json:"soft_limit" yaml:"soft_limit"` // 用量达到上限的百分比时告警，0表示不告警
+	Priority  string `mapstructure:"priority" json:"priority" yaml:"priority"`       // 优先级，internal不限速
+}
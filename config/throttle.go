@@ -0,0 +1,9 @@
+package config
+
+// Throttle 上传下载限速配置
+type Throttle struct {
+	Enabled        bool     `mapstructure:"enabled" json:"enabled" yaml:"enabled"`                         // 是否启用全局限速，链接签名中的限速始终生效
+	ConnectionRate int64    `mapstructure:"connection_rate" json:"connection_rate" yaml:"connection_rate"` // 单连接速率上限(KB/s)，0表示不限制
+	TenantRate     int64    `mapstructure:"tenant_rate" json:"tenant_rate" yaml:"tenant_rate"`             // 单租户集群内总速率上限(KB/s)，0表示不限制
+	BypassCidrs    []string `mapstructure:"bypass_cidrs" json:"bypass_cidrs" yaml:"bypass_cidrs"`          // 内部网段，来源IP在其中时不限速
+}
@@ -0,0 +1,10 @@
+package config
+
+// Upload 分片上传计划配置
+type Upload struct {
+	PartSize     int64 `mapstructure:"part_size" json:"part_size" yaml:"part_size"`                // 默认分片大小(MB)
+	MinPartSize  int64 `mapstructure:"min_part_size" json:"min_part_size" yaml:"min_part_size"`    // 最小分片大小(MB)
+	MaxPartSize  int64 `mapstructure:"max_part_size" json:"max_part_size" yaml:"max_part_size"`    // 最大分片大小(MB)
+	MaxPartCount int64 `mapstructure:"max_part_count" json:"max_part_count" yaml:"max_part_count"` // 最大分片数量
+	FormMaxSize  int64 `mapstructure:"form_max_size" json:"form_max_size" yaml:"form_max_size"`    // 表单上传的文件大小上限(MB)
+}
@@ -0,0 +1,8 @@
+package config
+
+// Webhook 回调通知配置
+type Webhook struct {
+	Secret  string `mapstructure:"secret" json:"secret" yaml:"secret"`    // 默认签名密钥，租户未配置时使用
+	Timeout int    `mapstructure:"timeout" json:"timeout" yaml:"timeout"` // 单次投递超时时间(s)
+	Backoff int    `mapstructure:"backoff" json:"backoff" yaml:"backoff"` // 重试退避基数(s)，按2的指数递增
+}